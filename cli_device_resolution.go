@@ -3,6 +3,7 @@ package main
 import (
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/danielpaulus/go-ios/ios"
 	"github.com/danielpaulus/go-ios/ios/tunnel"
@@ -31,11 +32,48 @@ func tunnelInfoConfigFromArgs(arguments docopt.Opts) tunnelInfoConfig {
 	}
 }
 
+// splitUdidArgs returns argv with only the first --udid and the udids of all of them.
+// docopt allows an option of [options] only once, runtest takes --udid several times
+// to shard the tests over the devices.
+func splitUdidArgs(argv []string) ([]string, []string) {
+	var udids []string
+	result := make([]string, 0, len(argv))
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		if arg == "--" {
+			result = append(result, argv[i:]...)
+			break
+		}
+		udid, isUdid := strings.CutPrefix(arg, "--udid=")
+		udidArgs := argv[i : i+1]
+		if arg == "--udid" && i+1 < len(argv) {
+			udid, isUdid = argv[i+1], true
+			udidArgs = argv[i : i+2]
+			i++
+		}
+		if !isUdid {
+			result = append(result, arg)
+			continue
+		}
+		if len(udids) == 0 {
+			result = append(result, udidArgs...)
+		}
+		udids = append(udids, udid)
+	}
+	return result, udids
+}
+
 func resolveDevice(arguments docopt.Opts, tunnelInfo tunnelInfoConfig) ios.DeviceEntry {
 	udid, _ := arguments.String("--udid")
 	if udid == "" {
 		udid = os.Getenv("GO_IOS_UDID")
 	}
+	return resolveDeviceWithUdid(arguments, tunnelInfo, udid)
+}
+
+// resolveDeviceWithUdid resolves the device udid like resolveDevice resolves the device
+// of the --udid option
+func resolveDeviceWithUdid(arguments docopt.Opts, tunnelInfo tunnelInfoConfig, udid string) ios.DeviceEntry {
 	address, addressErr := arguments.String("--address")
 	rsdPort, rsdErr := arguments.Int("--rsd-port")
 	userspaceTunnelHost, userspaceTunnelHostErr := arguments.String("--userspace-host")
@@ -77,7 +115,12 @@ func resolveDevice(arguments docopt.Opts, tunnelInfo tunnelInfoConfig) ios.Devic
 }
 
 func needsAutomaticTunnelInfo(args docopt.Opts) bool {
-	if boolArg(args, "rsd") || boolArg(args, "file") || boolArg(args, "webinspector") {
+	if boolArg(args, "rsd") || boolArg(args, "webinspector") {
+		return true
+	}
+	// `file serve` runs on AFC over usbmuxd; the other `file` commands use the
+	// RemoteXPC file service, which needs the tunnel.
+	if boolArg(args, "file") && !boolArg(args, "serve") {
 		return true
 	}
 	if boolArg(args, "info") && boolArg(args, "display") {
@@ -90,14 +133,18 @@ func needsAutomaticTunnelInfo(args docopt.Opts) bool {
 	}
 
 	for _, commandName := range []string{
+		"appdata",
 		"debug",
 		"devicestate",
+		"dtx",
+		"flightrecorder",
 		"instruments",
 		"kill",
 		"launch",
 		"memlimitoff",
 		"ostrace",
 		"pasteboard",
+		"perf",
 		"ps",
 		"resetlocation",
 		"runwda",
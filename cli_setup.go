@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/danielpaulus/go-ios/ios"
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
 	"github.com/danielpaulus/go-ios/ios/tunnel"
 	"github.com/docopt/docopt-go"
 )
@@ -61,6 +62,12 @@ func configureCLI(arguments docopt.Opts) {
 	}
 	slog.Debug("parsed arguments", "args", redactArgs(arguments))
 
+	if recordFile, _ := arguments.String("--record-dtx"); recordFile != "" {
+		f, err := os.Create(recordFile)
+		exitIfError("failed creating DTX recording", err)
+		dtx.SetRecorder(dtx.NewRecorder(f))
+	}
+
 	startAgentFromEnvironment()
 	warnIfAgentIsNotRunning()
 }
@@ -69,7 +76,7 @@ func redactArgs(arguments docopt.Opts) map[string]interface{} {
 	redacted := make(map[string]interface{}, len(arguments))
 	for key, value := range arguments {
 		switch key {
-		case "--password", "--p12password", "--proxyurl":
+		case "--password", "--p12password", "--proxyurl", "--auth":
 			if value != nil && value != "" {
 				redacted[key] = "<redacted>"
 				continue
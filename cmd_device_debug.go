@@ -1,11 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,10 +24,14 @@ import (
 	"github.com/danielpaulus/go-ios/ios"
 	"github.com/danielpaulus/go-ios/ios/crashreport"
 	"github.com/danielpaulus/go-ios/ios/debugserver"
+	"github.com/danielpaulus/go-ios/ios/flightrecorder"
 	"github.com/danielpaulus/go-ios/ios/imagemounter"
 	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/danielpaulus/go-ios/ios/logship"
 	"github.com/danielpaulus/go-ios/ios/ostrace"
 	"github.com/danielpaulus/go-ios/ios/pcap"
+	"github.com/danielpaulus/go-ios/ios/syslog"
 	"github.com/docopt/docopt-go"
 )
 
@@ -40,10 +53,74 @@ func runDproxyCommand(ctx commandContext) {
 
 func runSyslogCommand(ctx commandContext) {
 	parse, _ := ctx.Args.Bool("--parse")
-	runSyslog(ctx.Device, parse)
+	format, _ := ctx.Args.String("--format")
+	options := syslog.FilterOptions{}
+	options.Process, _ = ctx.Args.String("--process")
+	options.PID, _ = ctx.Args.String("--pid")
+	options.Level, _ = ctx.Args.String("--level")
+	options.Match, _ = ctx.Args.String("--match")
+	options.Exclude, _ = ctx.Args.String("--exclude")
+	options.Since, _ = ctx.Args.String("--since")
+	filter, err := syslog.NewFilter(options)
+	exitIfError("invalid syslog filter", err)
+	runSyslog(ctx.Device, parse, format, filter, newLogShipper(ctx))
+}
+
+// newLogShipper returns a shipper for the --otlp or --loki endpoint, or nil if none is given
+func newLogShipper(ctx commandContext) *logship.Shipper {
+	otlpEndpoint, _ := ctx.Args.String("--otlp")
+	lokiURL, _ := ctx.Args.String("--loki")
+	if otlpEndpoint == "" && lokiURL == "" {
+		return nil
+	}
+	if otlpEndpoint != "" && lokiURL != "" {
+		exitIfError("invalid arguments", errors.New("use either --otlp or --loki"))
+	}
+	resource, err := logship.DeviceResource(ctx.Device)
+	exitIfError("failed reading device info", err)
+	var exporter logship.Exporter
+	if otlpEndpoint != "" {
+		exporter, err = logship.NewOTLPExporter(otlpEndpoint, resource)
+		exitIfError("invalid --otlp endpoint", err)
+		slog.Info("shipping logs to OTLP collector", "endpoint", otlpEndpoint)
+	} else {
+		exporter, err = logship.NewLokiExporter(lokiURL, resource)
+		exitIfError("invalid --loki url", err)
+		slog.Info("shipping logs to Loki", "url", lokiURL)
+	}
+	return logship.NewShipper(exporter, logship.ShipperOptions{})
+}
+
+// closeLogShipper sends the remaining records, giving up after a few seconds if the backend is unreachable
+func closeLogShipper(shipper *logship.Shipper) {
+	if shipper == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shipper.Close(ctx); err != nil {
+		slog.Warn("not all logs were shipped", "error", err)
+	}
+	if dropped := shipper.Dropped(); dropped > 0 {
+		slog.Warn("dropped log records", "count", dropped)
+	}
 }
 
 func runOSTraceCommand(ctx commandContext) {
+	if pids, _ := ctx.Args.Bool("pids"); pids {
+		processes, err := ostrace.ListPids(ctx.Device)
+		exitIfError("failed listing os_trace processes", err)
+		fmt.Println(convertToJSONString(processes))
+		return
+	}
+	if archive, _ := ctx.Args.Bool("archive"); archive {
+		runOSTraceArchive(ctx)
+		return
+	}
+	if signposts, _ := ctx.Args.Bool("signposts"); signposts {
+		runOSTraceSignposts(ctx)
+		return
+	}
 	pidStr, _ := ctx.Args.String("--pid")
 	processName, _ := ctx.Args.String("--process")
 	levelStr, _ := ctx.Args.String("--level")
@@ -65,25 +142,215 @@ func runOSTraceCommand(ctx commandContext) {
 		Exclude:   exclude,
 	}
 	follow, _ := ctx.Args.Bool("--follow")
-	runOsTrace(ctx.Device, pid, processName, levelFilter.MessageFilter, levelFilter.StreamFlags, clientFilter, follow)
+	runOsTrace(ctx.Device, pid, processName, levelFilter.MessageFilter, levelFilter.StreamFlags, clientFilter, follow, newLogShipper(ctx))
+}
+
+func runOSTraceArchive(ctx commandContext) {
+	output, _ := ctx.Args.String("--output")
+	options := ostrace.ArchiveOptions{}
+	if start, _ := ctx.Args.String("--start"); start != "" {
+		if d, err := time.ParseDuration(start); err == nil {
+			options.StartTime = time.Now().Add(-d)
+		} else {
+			options.StartTime, err = time.Parse(time.RFC3339, start)
+			exitIfError("invalid --start, use a duration like 2h or an RFC 3339 timestamp", err)
+		}
+	}
+	if sizeLimit, _ := ctx.Args.String("--size-limit"); sizeLimit != "" {
+		limit, err := strconv.ParseUint(sizeLimit, 10, 64)
+		exitIfError("invalid --size-limit", err)
+		options.SizeLimit = limit
+	}
+
+	if output == "-" {
+		err := ostrace.CreateArchive(ctx.Device, os.Stdout, options)
+		exitIfError("failed creating log archive", err)
+		return
+	}
+	if strings.HasSuffix(output, ".tar") {
+		f, err := os.Create(output)
+		exitIfError("failed creating "+output, err)
+		err = ostrace.CreateArchive(ctx.Device, f, options)
+		exitIfError("failed creating log archive", err)
+		exitIfError("failed writing "+output, f.Close())
+		slog.Info("log archive written", "path", output)
+		return
+	}
+
+	// extract while downloading, the archive is never stored as a whole
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(ostrace.CreateArchive(ctx.Device, w, options))
+	}()
+	err := ostrace.ExtractArchive(r, output)
+	r.Close()
+	exitIfError("failed creating log archive", err)
+	slog.Info("log archive extracted", "path", output)
+}
+
+type signpostSummary struct {
+	Stats         []ostrace.IntervalStats `json:"stats"`
+	OpenIntervals int                     `json:"openIntervals"`
+}
+
+// runOSTraceSignposts prints every completed signpost interval as a JSON line and
+// the duration statistics when the stream ends after --duration or on Ctrl+C.
+func runOSTraceSignposts(ctx commandContext) {
+	pid := -1
+	if pidStr, _ := ctx.Args.String("--pid"); pidStr != "" {
+		var err error
+		pid, err = strconv.Atoi(pidStr)
+		exitIfError("invalid --pid value", err)
+	}
+	subsystem, _ := ctx.Args.String("--subsystem")
+	duration, err := instrumentsSampleDuration(ctx.Args)
+	exitIfError("failed parsing --duration", err)
+
+	conn, err := ostrace.New(ctx.Device, pid, ostrace.MessageFilterSignpost, 0)
+	exitIfError("os_trace connection failed", err)
+
+	analyzer := ostrace.NewSignpostAnalyzer()
+	filter := ostrace.ClientFilter{Subsystem: subsystem}
+	done := make(chan error, 1)
+	go func() {
+		for {
+			entry, err := conn.ReadFilteredEntry(filter)
+			if err != nil {
+				done <- err
+				return
+			}
+			if interval, ok := analyzer.Add(entry); ok {
+				fmt.Println(convertToJSONString(interval))
+			}
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+	select {
+	case <-stop:
+		conn.Close()
+		<-done
+	case <-timeout:
+		conn.Close()
+		<-done
+	case err := <-done:
+		conn.Close()
+		slog.Warn("os_trace stream ended", "error", err)
+	}
+	fmt.Println(convertToJSONString(signpostSummary{Stats: analyzer.Stats(), OpenIntervals: analyzer.OpenIntervals()}))
+}
+
+type flightRecorderDump struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
 }
 
+func runFlightRecorderCommand(ctx commandContext) {
+	options := flightrecorder.Options{}
+	options.Dir, _ = ctx.Args.String("--dir")
+	if window, _ := ctx.Args.String("--window"); window != "" {
+		d, err := time.ParseDuration(window)
+		exitIfError("invalid --window, use a duration like 5m", err)
+		options.Window = d
+	}
+	if maxEntries, _ := ctx.Args.String("--max-entries"); maxEntries != "" {
+		n, err := strconv.Atoi(maxEntries)
+		exitIfError("invalid --max-entries", err)
+		options.MaxEntries = n
+	}
+	sources, _ := ctx.Args["--source"].([]string)
+	for _, name := range sources {
+		source, err := flightrecorder.ParseSource(name)
+		exitIfError("invalid --source", err)
+		options.Sources = append(options.Sources, source)
+	}
+
+	recorder := flightrecorder.New(ctx.Device, options)
+	recordCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		exitIfError("flight recorder failed", recorder.Run(recordCtx))
+	}()
+	if onCrash, _ := ctx.Args.Bool("--on-crash"); onCrash {
+		go func() {
+			err := recorder.DumpOnCrash(recordCtx, "", func(p string, event crashreport.WatchEvent) {
+				fmt.Println(convertToJSONString(flightRecorderDump{Path: p, Reason: "crash " + event.Name}))
+			})
+			exitIfError("failed watching crashreports", err)
+		}()
+	}
+
+	dump := make(chan os.Signal, 1)
+	if len(flightRecorderDumpSignals) > 0 {
+		signal.Notify(dump, flightRecorderDumpSignals...)
+		defer signal.Stop(dump)
+	}
+	slog.Info("flight recorder started", "pid", os.Getpid(), "dir", options.Dir)
+	for {
+		select {
+		case <-recordCtx.Done():
+			return
+		case <-dump:
+			p, err := recorder.DumpFile("signal")
+			if err != nil {
+				slog.Error("failed writing flight recorder dump", "err", err)
+				continue
+			}
+			fmt.Println(convertToJSONString(flightRecorderDump{Path: p, Reason: "signal"}))
+		}
+	}
+}
+
+// crashSummaryFrames is the number of frames of the crashed thread `ios crash ls --details` prints
+const crashSummaryFrames = 5
+
 func runCrashCommand(ctx commandContext) {
 	if ls, _ := ctx.Args.Bool("ls"); ls {
 		pattern, err := ctx.Args.String("<pattern>")
 		if err != nil || pattern == "" {
 			pattern = "*"
 		}
+		if details, _ := ctx.Args.Bool("--details"); details {
+			reports, err := crashreport.ListReportDetails(ctx.Device, pattern)
+			exitIfError("failed listing crashreports", err)
+			summaries := make([]crashreport.Summary, len(reports))
+			for i, report := range reports {
+				summaries[i] = report.Summary(crashSummaryFrames)
+			}
+			fmt.Println(convertToJSONString(map[string]interface{}{"reports": summaries, "length": len(summaries)}))
+			return
+		}
 		files, err := crashreport.ListReports(ctx.Device, pattern)
 		exitIfError("failed listing crashreports", err)
 		fmt.Println(convertToJSONString(map[string]interface{}{"files": files, "length": len(files)}))
 	}
+	if show, _ := ctx.Args.Bool("show"); show {
+		name, _ := ctx.Args.String("<name>")
+		report, err := crashreport.GetReport(ctx.Device, name)
+		exitIfError("failed reading crashreport", err)
+		fmt.Println(convertToJSONString(report.Summary(-1)))
+	}
+	if symbolicate, _ := ctx.Args.Bool("symbolicate"); symbolicate {
+		runCrashSymbolicate(ctx)
+	}
+	if watch, _ := ctx.Args.Bool("watch"); watch {
+		runCrashWatch(ctx)
+	}
 	if cp, _ := ctx.Args.Bool("cp"); cp {
 		pattern, _ := ctx.Args.String("<srcpattern>")
 		target, _ := ctx.Args.String("<target>")
 		slog.Debug("cp", "srcpattern", pattern, "target", target)
 		err := crashreport.DownloadReports(ctx.Device, pattern, target)
 		exitIfError("failed downloading crashreports", err)
+		if dsyms, _ := ctx.Args["--dsym"].([]string); len(dsyms) > 0 {
+			symbolicateDownloadedReports(dsyms, target, pattern)
+		}
 	}
 	if rm, _ := ctx.Args.Bool("rm"); rm {
 		cwd, _ := ctx.Args.String("<cwd>")
@@ -94,15 +361,151 @@ func runCrashCommand(ctx commandContext) {
 	}
 }
 
+func runCrashSymbolicate(ctx commandContext) {
+	reportPath, _ := ctx.Args.String("<report>")
+	dsyms, _ := ctx.Args["--dsym"].([]string)
+	output, _ := ctx.Args.String("--output")
+
+	symbolicator, err := crashreport.NewSymbolicator(dsyms...)
+	exitIfError("failed loading dSYMs", err)
+	data, err := os.ReadFile(reportPath)
+	exitIfError("failed reading crashreport", err)
+	report, err := crashreport.ParseReport(filepath.Base(reportPath), data)
+	exitIfError("failed parsing crashreport", err)
+	resolved, err := symbolicator.Symbolicate(&report)
+	exitIfError("failed symbolicating crashreport", err)
+	slog.Debug("symbolicated", "report", reportPath, "frames", resolved)
+
+	if output != "" {
+		err = os.WriteFile(output, report.Bytes(), 0o644)
+		exitIfError("failed writing symbolicated crashreport", err)
+	}
+	fmt.Println(convertToJSONString(report.Summary(-1)))
+}
+
+func runCrashWatch(ctx commandContext) {
+	bundleID, _ := ctx.Args.String("--bundle-id")
+	execCmd, _ := ctx.Args.String("--exec")
+	webhook, _ := ctx.Args.String("--webhook")
+	downloadDir, _ := ctx.Args.String("--download")
+	statePath, _ := ctx.Args.String("--state")
+	options := crashreport.WatchOptions{BundleID: bundleID, DownloadDir: downloadDir, StatePath: statePath}
+	if interval, _ := ctx.Args.String("--interval"); interval != "" {
+		seconds, err := strconv.ParseFloat(interval, 64)
+		if err != nil || seconds <= 0 {
+			exitIfError("invalid --interval", fmt.Errorf("interval must be a positive number of seconds, got %q", interval))
+		}
+		options.Interval = time.Duration(seconds * float64(time.Second))
+	}
+	if options.StatePath == "" {
+		cacheDir, err := os.UserCacheDir()
+		exitIfError("failed finding the user cache dir, use --state", err)
+		options.StatePath = filepath.Join(cacheDir, "go-ios", "crash-watch-"+ctx.Device.Properties.SerialNumber+".json")
+	}
+	slog.Debug("watching crash reports", "state", options.StatePath, "bundleID", bundleID)
+
+	watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := crashreport.Watch(watchCtx, ctx.Device, options, func(event crashreport.WatchEvent) {
+		eventJSON := convertToJSONString(event)
+		fmt.Println(eventJSON)
+		if execCmd != "" {
+			if err := runCrashWatchExec(execCmd, eventJSON); err != nil {
+				slog.Warn("crash watch exec failed", "cmd", execCmd, "report", event.Name, "err", err)
+			}
+		}
+		if webhook != "" {
+			if err := postCrashWatchWebhook(webhook, eventJSON); err != nil {
+				slog.Warn("crash watch webhook failed", "url", webhook, "report", event.Name, "err", err)
+			}
+		}
+	})
+	exitIfError("failed watching crashreports", err)
+}
+
+// runCrashWatchExec runs cmd with the shell and passes the event JSON on stdin
+func runCrashWatchExec(cmd string, eventJSON string) error {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", cmd)
+	} else {
+		c = exec.Command("sh", "-c", cmd)
+	}
+	c.Stdin = strings.NewReader(eventJSON)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+func postCrashWatchWebhook(url string, eventJSON string) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", strings.NewReader(eventJSON))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// symbolicateDownloadedReports symbolicates the .ips reports crash cp wrote to target in place.
+// Like crash cp, pattern is matched against the file names in all subdirectories of target.
+func symbolicateDownloadedReports(dsyms []string, target, pattern string) {
+	symbolicator, err := crashreport.NewSymbolicator(dsyms...)
+	exitIfError("failed loading dSYMs", err)
+	err = filepath.WalkDir(target, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(file) != ".ips" {
+			return nil
+		}
+		if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+			return nil
+		}
+		resolved, err := symbolicator.SymbolicateFile(file)
+		if err != nil {
+			slog.Warn("failed symbolicating crashreport", "report", file, "err", err)
+			return nil
+		}
+		slog.Info("symbolicated", "report", file, "frames", resolved)
+		return nil
+	})
+	exitIfError("failed listing downloaded crashreports", err)
+}
+
 func runInstrumentsCommand(ctx commandContext) {
 	duration, err := instrumentsSampleDuration(ctx.Args)
 	exitIfError("failed parsing --duration", err)
 
 	switch instrumentsSubcommand(ctx.Args) {
+	case "energy":
+		pids, err := parsePIDList(ctx.Args)
+		exitIfError("invalid --pid", err)
+		streamInstrumentsEnergy(ctx.Device, pids, duration)
 	case "fps":
 		streamInstrumentsFPS(ctx.Device, duration)
 	case "network":
-		streamInstrumentsNetwork(ctx.Device, duration)
+		summary, _ := ctx.Args.Bool("--summary")
+		streamInstrumentsNetwork(ctx.Device, duration, summary)
+	case "profile":
+		pids, err := parsePIDList(ctx.Args)
+		if err == nil && len(pids) > 1 {
+			err = fmt.Errorf("profile samples one process, got %d process IDs", len(pids))
+		}
+		exitIfError("invalid --pid", err)
+		output, _ := ctx.Args.String("--output")
+		dsyms, _ := ctx.Args["--dsym"].([]string)
+		recordInstrumentsProfile(ctx.Device, pids[0], duration, output, dsyms)
+	case "trace":
+		filterValue, _ := ctx.Args.String("--filter")
+		filter, err := kdebug.ParseFilter(filterValue)
+		exitIfError("invalid --filter", err)
+		output, _ := ctx.Args.String("--output")
+		exitIfError("failed tracing kdebug events", traceInstrumentsKdebug(ctx.Device, duration, filter, output))
 	default:
 		listenAppStateNotifications(ctx.Device)
 	}
@@ -111,7 +514,7 @@ func runInstrumentsCommand(ctx commandContext) {
 // instrumentsSubcommand returns which `ios instruments <subcommand>` was
 // requested, or "" if none matched.
 func instrumentsSubcommand(args docopt.Opts) string {
-	for _, name := range []string{"fps", "network", "notifications"} {
+	for _, name := range []string{"energy", "fps", "network", "notifications", "profile", "trace"} {
 		if boolArg(args, name) {
 			return name
 		}
@@ -136,6 +539,35 @@ func instrumentsSampleDuration(args docopt.Opts) (time.Duration, error) {
 	return time.Duration(seconds * float64(time.Second)), nil
 }
 
+// parsePIDList parses the comma-separated process IDs of the --pid flag
+func parsePIDList(args docopt.Opts) ([]uint64, error) {
+	value, _ := args.String("--pid")
+	var pids []uint64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		pid, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid process ID %q: %w", field, err)
+		}
+		pids = append(pids, pid)
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("at least one process ID is required")
+	}
+	return pids, nil
+}
+
+func streamInstrumentsEnergy(device ios.DeviceEntry, pids []uint64, duration time.Duration) {
+	service, err := instruments.NewEnergyService(device, pids)
+	exitIfError("failed starting energy service", err)
+	defer service.Close()
+
+	streamInstrumentsSamples(service.ReceiveEnergySamples(time.Second), duration, formatEnergySample)
+}
+
 func streamInstrumentsFPS(device ios.DeviceEntry, duration time.Duration) {
 	service, err := instruments.NewGraphicsOpenGLService(device)
 	exitIfError("failed starting graphics service", err)
@@ -144,17 +576,137 @@ func streamInstrumentsFPS(device ios.DeviceEntry, duration time.Duration) {
 	streamInstrumentsSamples(service.ReceiveFramesPerSecondSamples(), duration, formatFPSSample)
 }
 
-func streamInstrumentsNetwork(device ios.DeviceEntry, duration time.Duration) {
+// recordInstrumentsProfile samples the callstacks of pid and writes them as pprof profile to output
+func recordInstrumentsProfile(device ios.DeviceEntry, pid uint64, duration time.Duration, output string, dsyms []string) {
+	if output == "" {
+		output = "cpu.pb.gz"
+	}
+	options := instruments.ProfileOptions{PID: pid, Duration: duration}
+	if len(dsyms) > 0 {
+		symbolicator, err := crashreport.NewSymbolicator(dsyms...)
+		exitIfError("failed loading dSYMs", err)
+		options.Symbolicator = symbolicator
+	}
+
+	recordCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("recording profile, press CTRL+C to stop", "pid", pid, "duration", duration)
+	profile, err := instruments.RecordProfile(recordCtx, device, options)
+	exitIfError("failed recording profile", err)
+
+	f, err := os.Create(output)
+	exitIfError("failed creating profile file", err)
+	defer f.Close()
+	exitIfError("failed writing profile", profile.Write(f))
+	var samples int64
+	for _, sample := range profile.Sample {
+		samples += sample.Value[0]
+	}
+	slog.Info("wrote profile", "file", output, "samples", samples)
+}
+
+// traceInstrumentsKdebug prints the kdebug events that match filter, or writes them as
+// kd_buf records to output if it is set. Errors are returned after the core profile
+// session was stopped.
+func traceInstrumentsKdebug(device ios.DeviceEntry, duration time.Duration, filter kdebug.Filter, output string) error {
+	tap, err := instruments.NewCoreProfileSessionTap(device, instruments.CoreProfileConfig{Filters: filter.Values()})
+	if err != nil {
+		return fmt.Errorf("starting core profile session: %w", err)
+	}
+	defer tap.Close()
+
+	// the device applies the filter already, events of other classes are still dropped
+	// in case it records more than asked for
+	if output == "" {
+		streamInstrumentsSamples(tap.ReceiveEvents(), duration, func(e kdebug.Event) string {
+			if !filter.Match(e) {
+				return ""
+			}
+			return formatKdebugEvent(e)
+		})
+		return nil
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating trace file: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	events := 0
+	err = handleInstrumentsSamples(tap.ReceiveEvents(), duration, func(e kdebug.Event) error {
+		if !filter.Match(e) {
+			return nil
+		}
+		record, _ := e.MarshalBinary()
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		events++
+		return nil
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing trace: %w", err)
+	}
+	slog.Info("wrote trace", "file", output, "events", events)
+	return nil
+}
+
+// streamInstrumentsNetwork prints the network samples and, if summary is set, the
+// traffic per process and per remote host when streaming stops.
+func streamInstrumentsNetwork(device ios.DeviceEntry, duration time.Duration, summary bool) {
 	service, err := instruments.NewNetworkService(device)
 	exitIfError("failed starting network monitoring service", err)
 	defer service.Close()
 
-	streamInstrumentsSamples(service.ReceiveNetworkSamples(), duration, formatNetworkSample)
+	if !summary {
+		streamInstrumentsSamples(service.ReceiveNetworkSamples(), duration, formatNetworkSample)
+		return
+	}
+	aggregator := instruments.NewNetworkAggregator()
+	streamInstrumentsSamples(service.ReceiveNetworkSamples(), duration, func(sample instruments.NetworkSample) string {
+		aggregator.Add(sample)
+		return formatNetworkSample(sample)
+	})
+	if deviceInfo, err := instruments.NewDeviceInfoService(device); err == nil {
+		processes, err := deviceInfo.ProcessList()
+		deviceInfo.Close()
+		if err == nil {
+			aggregator.SetProcessNames(processes)
+		}
+	} else {
+		slog.Debug("failed resolving process names", "error", err)
+	}
+	fmt.Println(convertToJSONString(networkSummaryOutput{Processes: aggregator.ByProcess(), RemoteHosts: aggregator.ByRemoteHost()}))
+}
+
+type networkSummaryOutput struct {
+	Processes   []instruments.ProcessNetworkStats    `json:"processes"`
+	RemoteHosts []instruments.RemoteHostNetworkStats `json:"remoteHosts"`
 }
 
 // streamInstrumentsSamples prints one formatted line per sample until the
 // channel closes, the optional duration elapses, or the process is interrupted.
+// Samples formatted as empty string are skipped.
 func streamInstrumentsSamples[T any](samples chan T, duration time.Duration, format func(T) string) {
+	_ = handleInstrumentsSamples(samples, duration, func(sample T) error {
+		if line := format(sample); line != "" {
+			fmt.Println(line)
+		}
+		return nil
+	})
+}
+
+// handleInstrumentsSamples calls handle for every sample until the channel closes,
+// the optional duration elapses, or the process is interrupted. The first error of
+// handle stops handling and is returned.
+func handleInstrumentsSamples[T any](samples chan T, duration time.Duration, handle func(T) error) error {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(stop)
@@ -170,17 +722,64 @@ func streamInstrumentsSamples[T any](samples chan T, duration time.Duration, for
 		select {
 		case sample, ok := <-samples:
 			if !ok {
-				return
+				return nil
+			}
+			if err := handle(sample); err != nil {
+				return err
 			}
-			fmt.Println(format(sample))
 		case <-timeout:
-			return
+			return nil
 		case <-stop:
-			return
+			return nil
 		}
 	}
 }
 
+func formatEnergySample(sample instruments.EnergySample) string {
+	if JSONdisabled {
+		return fmt.Sprintf("pid=%d total=%.2f cpu=%.2f gpu=%.2f networking=%.2f location=%.2f display=%.2f overhead=%.2f",
+			sample.PID, sample.TotalCost, sample.CPUCost, sample.GPUCost, sample.NetworkingCost, sample.LocationCost, sample.DisplayCost, sample.Overhead)
+	}
+	return convertToJSONString(sample)
+}
+
+type kdebugEventOutput struct {
+	Timestamp uint64    `json:"timestamp"`
+	Name      string    `json:"name"`
+	Class     uint8     `json:"class"`
+	Subclass  uint8     `json:"subclass"`
+	Code      uint16    `json:"code"`
+	Func      uint8     `json:"func"`
+	ThreadID  uint64    `json:"thread"`
+	CPU       uint32    `json:"cpu"`
+	Args      [4]uint64 `json:"args"`
+}
+
+func formatKdebugEvent(e kdebug.Event) string {
+	if JSONdisabled {
+		phase := ""
+		switch e.Func() {
+		case kdebug.FuncStart:
+			phase = " start"
+		case kdebug.FuncEnd:
+			phase = " end"
+		}
+		return fmt.Sprintf("%d %s%s thread=0x%x cpu=%d args=0x%x,0x%x,0x%x,0x%x",
+			e.Timestamp, e.Name(), phase, e.ThreadID, e.CPU, e.Args[0], e.Args[1], e.Args[2], e.Args[3])
+	}
+	return convertToJSONString(kdebugEventOutput{
+		Timestamp: e.Timestamp,
+		Name:      e.Name(),
+		Class:     e.Class(),
+		Subclass:  e.Subclass(),
+		Code:      e.Code(),
+		Func:      e.Func(),
+		ThreadID:  e.ThreadID,
+		CPU:       e.CPU,
+		Args:      e.Args,
+	})
+}
+
 type fpsSampleOutput struct {
 	FPS float64 `json:"fps"`
 }
@@ -193,12 +792,25 @@ func formatFPSSample(sample instruments.FramesPerSecondSample) string {
 }
 
 type networkSampleOutput struct {
-	Type uint64                 `json:"type"`
-	Data map[string]interface{} `json:"data"`
+	Type       uint64                           `json:"type"`
+	Data       map[string]interface{}           `json:"data,omitempty"`
+	Interface  *instruments.InterfaceDetection  `json:"interfaceDetection,omitempty"`
+	Connection *instruments.ConnectionDetection `json:"connectionDetection,omitempty"`
+	Update     *instruments.ConnectionUpdate    `json:"connectionUpdate,omitempty"`
 }
 
 func formatNetworkSample(sample instruments.NetworkSample) string {
 	if JSONdisabled {
+		switch {
+		case sample.Interface != nil:
+			return fmt.Sprintf("type=%d interface=%s index=%d", sample.Type, sample.Interface.Name, sample.Interface.InterfaceIndex)
+		case sample.Connection != nil:
+			c := sample.Connection
+			return fmt.Sprintf("type=%d pid=%d local=%s remote=%s serial=%d", sample.Type, c.PID, c.LocalAddress, c.RemoteAddress, c.SerialNumber)
+		case sample.Update != nil:
+			u := sample.Update
+			return fmt.Sprintf("type=%d serial=%d rxBytes=%d txBytes=%d rxPackets=%d txPackets=%d avgRtt=%d", sample.Type, u.ConnectionSerial, u.RxBytes, u.TxBytes, u.RxPackets, u.TxPackets, u.AvgRTT)
+		}
 		keys := make([]string, 0, len(sample.Data))
 		for key := range sample.Data {
 			keys = append(keys, key)
@@ -211,7 +823,13 @@ func formatNetworkSample(sample instruments.NetworkSample) string {
 		}
 		return builder.String()
 	}
-	return convertToJSONString(networkSampleOutput{Type: sample.Type, Data: sample.Data})
+	return convertToJSONString(networkSampleOutput{
+		Type:       sample.Type,
+		Data:       sample.Data,
+		Interface:  sample.Interface,
+		Connection: sample.Connection,
+		Update:     sample.Update,
+	})
 }
 
 func listenAppStateNotifications(device ios.DeviceEntry) {
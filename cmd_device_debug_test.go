@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
 	"github.com/docopt/docopt-go"
 )
 
@@ -14,9 +16,12 @@ func TestInstrumentsSubcommand(t *testing.T) {
 		args docopt.Opts
 		want string
 	}{
+		{name: "energy", args: docopt.Opts{"instruments": true, "energy": true}, want: "energy"},
 		{name: "fps", args: docopt.Opts{"instruments": true, "fps": true}, want: "fps"},
 		{name: "network", args: docopt.Opts{"instruments": true, "network": true}, want: "network"},
 		{name: "notifications", args: docopt.Opts{"instruments": true, "notifications": true}, want: "notifications"},
+		{name: "profile", args: docopt.Opts{"instruments": true, "profile": true}, want: "profile"},
+		{name: "trace", args: docopt.Opts{"instruments": true, "trace": true}, want: "trace"},
 		{name: "no subcommand", args: docopt.Opts{"instruments": true}, want: ""},
 	}
 
@@ -30,7 +35,7 @@ func TestInstrumentsSubcommand(t *testing.T) {
 }
 
 func TestInstrumentsCommandDispatch(t *testing.T) {
-	for _, subcommand := range []string{"fps", "network", "notifications"} {
+	for _, subcommand := range []string{"energy", "fps", "network", "notifications", "profile", "trace"} {
 		args := docopt.Opts{"instruments": true, subcommand: true}
 		matched := false
 		dispatchCommand(commandContext{Args: args}, []command{
@@ -77,6 +82,13 @@ func TestInstrumentsSampleDuration(t *testing.T) {
 	}
 }
 
+func TestOSTraceSignpostsDurationInSeconds(t *testing.T) {
+	duration, err := instrumentsSampleDuration(parseCLIArgs(t, "ostrace", "signposts", "--duration=30"))
+	if err != nil || duration != 30*time.Second {
+		t.Fatalf("instrumentsSampleDuration() = %v, %v, want 30s", duration, err)
+	}
+}
+
 func withJSONOutput(t *testing.T, disabled bool) {
 	t.Helper()
 	previousDisabled, previousPretty := JSONdisabled, prettyJSON
@@ -134,6 +146,24 @@ func TestFormatNetworkSampleHuman(t *testing.T) {
 	}
 }
 
+func TestFormatKdebugEventJSON(t *testing.T) {
+	withJSONOutput(t, false)
+	e := kdebug.Event{Timestamp: 100, Args: [4]uint64{3}, ThreadID: 0x1234, DebugID: kdebug.DebugID(kdebug.ClassBSD, kdebug.SubclassBSDExcpSyscall, 3) | uint32(kdebug.FuncStart), CPU: 1}
+	want := `{"timestamp":100,"name":"bsd/syscall/read","class":4,"subclass":12,"code":3,"func":1,"thread":4660,"cpu":1,"args":[3,0,0,0]}`
+	if got := formatKdebugEvent(e); got != want {
+		t.Fatalf("formatKdebugEvent() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatKdebugEventHuman(t *testing.T) {
+	withJSONOutput(t, true)
+	e := kdebug.Event{Timestamp: 100, Args: [4]uint64{3}, ThreadID: 0x1234, DebugID: kdebug.DebugID(kdebug.ClassBSD, kdebug.SubclassBSDExcpSyscall, 3) | uint32(kdebug.FuncStart), CPU: 1}
+	want := "100 bsd/syscall/read start thread=0x1234 cpu=1 args=0x3,0x0,0x0,0x0"
+	if got := formatKdebugEvent(e); got != want {
+		t.Fatalf("formatKdebugEvent() = %q, want %q", got, want)
+	}
+}
+
 func TestStreamInstrumentsSamplesStopsAfterDuration(t *testing.T) {
 	samples := make(chan instruments.FramesPerSecondSample)
 	done := make(chan struct{})
@@ -164,3 +194,68 @@ func TestStreamInstrumentsSamplesStopsOnClosedChannel(t *testing.T) {
 		t.Fatal("streamInstrumentsSamples did not stop on a closed channel")
 	}
 }
+
+func TestHandleInstrumentsSamplesStopsOnError(t *testing.T) {
+	samples := make(chan int, 3)
+	samples <- 1
+	samples <- 2
+	samples <- 3
+	failed := errors.New("disk full")
+	var handled []int
+	err := handleInstrumentsSamples(samples, 0, func(sample int) error {
+		handled = append(handled, sample)
+		if sample == 2 {
+			return failed
+		}
+		return nil
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("handleInstrumentsSamples() = %v, want %v", err, failed)
+	}
+	if len(handled) != 2 {
+		t.Fatalf("handled %v, want handling to stop after the error", handled)
+	}
+}
+
+func TestFormatNetworkSampleTyped(t *testing.T) {
+	sample := instruments.NetworkSample{
+		Type:   instruments.NetworkMessageConnectionUpdate,
+		Update: &instruments.ConnectionUpdate{RxBytes: 1500, TxBytes: 200, RxPackets: 3, TxPackets: 2, AvgRTT: 30, ConnectionSerial: 7},
+	}
+
+	withJSONOutput(t, false)
+	want := `{"type":2,"connectionUpdate":{"rxPackets":3,"rxBytes":1500,"txPackets":2,"txBytes":200,"rxDups":0,"rxOutOfOrder":0,"txRetransmits":0,"minRtt":0,"avgRtt":30,"connectionSerial":7}}`
+	if got := formatNetworkSample(sample); got != want {
+		t.Fatalf("formatNetworkSample() = %q, want %q", got, want)
+	}
+
+	withJSONOutput(t, true)
+	want = "type=2 serial=7 rxBytes=1500 txBytes=200 rxPackets=3 txPackets=2 avgRtt=30"
+	if got := formatNetworkSample(sample); got != want {
+		t.Fatalf("formatNetworkSample() = %q, want %q", got, want)
+	}
+}
+
+func TestParsePIDList(t *testing.T) {
+	pids, err := parsePIDList(docopt.Opts{"--pid": "12, 345"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pids) != 2 || pids[0] != 12 || pids[1] != 345 {
+		t.Fatalf("parsePIDList() = %v, want [12 345]", pids)
+	}
+	for _, value := range []interface{}{nil, "", "abc", "12,-1"} {
+		if _, err := parsePIDList(docopt.Opts{"--pid": value}); err == nil {
+			t.Fatalf("parsePIDList(%v) expected error, got nil", value)
+		}
+	}
+}
+
+func TestFormatEnergySampleHuman(t *testing.T) {
+	withJSONOutput(t, true)
+	sample := instruments.EnergySample{PID: 42, TotalCost: 10, CPUCost: 7.5, NetworkingCost: 2.5, Overhead: 490}
+	want := "pid=42 total=10.00 cpu=7.50 gpu=0.00 networking=2.50 location=0.00 display=0.00 overhead=490.00"
+	if got := formatEnergySample(sample); got != want {
+		t.Fatalf("formatEnergySample() = %q, want %q", got, want)
+	}
+}
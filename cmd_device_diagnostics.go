@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/danielpaulus/go-ios/ios"
 	"github.com/danielpaulus/go-ios/ios/afc"
@@ -9,6 +17,7 @@ import (
 	"github.com/danielpaulus/go-ios/ios/diagnostics"
 	"github.com/danielpaulus/go-ios/ios/instruments"
 	"github.com/danielpaulus/go-ios/ios/pcap"
+	"github.com/danielpaulus/go-ios/ios/perf"
 )
 
 func runIPCommand(ctx commandContext) {
@@ -171,5 +180,59 @@ func runLockdownCommand(ctx commandContext) {
 }
 
 func runSysmontapCommand(ctx commandContext) {
-	printSysmontapStats(ctx.Device)
+	var pid uint64
+	if pidStr, _ := ctx.Args.String("--pid"); pidStr != "" {
+		var err error
+		pid, err = strconv.ParseUint(pidStr, 10, 64)
+		exitIfError("invalid --pid value", err)
+	}
+	var processNames []string
+	if process, _ := ctx.Args.String("--process"); process != "" {
+		processNames = strings.Split(process, ",")
+	}
+	var interval time.Duration
+	if intervalStr, _ := ctx.Args.String("--interval"); intervalStr != "" {
+		var err error
+		interval, err = time.ParseDuration(intervalStr)
+		exitIfError("invalid --interval, use a duration like 1s", err)
+	}
+	duration, err := instrumentsSampleDuration(ctx.Args)
+	exitIfError("failed parsing --duration", err)
+	// without any of the sample options, the CPU usage is logged like before they existed
+	if pid == 0 && len(processNames) == 0 && interval == 0 {
+		printSysmontapCPUUsage(ctx.Device, duration)
+		return
+	}
+	printSysmontapStats(ctx.Device, pid, processNames, interval, duration)
+}
+
+func runPerfCommand(ctx commandContext) {
+	var options perf.Options
+	var err error
+	options.Duration, err = instrumentsSampleDuration(ctx.Args)
+	exitIfError("failed parsing --duration", err)
+	if pidStr, _ := ctx.Args.String("--pid"); pidStr != "" {
+		options.PID, err = strconv.ParseUint(pidStr, 10, 64)
+		exitIfError("invalid --pid value", err)
+	}
+	if intervalStr, _ := ctx.Args.String("--interval"); intervalStr != "" {
+		options.SampleInterval, err = time.ParseDuration(intervalStr)
+		exitIfError("invalid --interval, use a duration like 1s", err)
+	}
+	output, _ := ctx.Args.String("--output")
+	if output == "" {
+		output = "trace.json"
+	}
+
+	recordCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("recording performance timeline, press CTRL+C to stop", "duration", options.Duration)
+	timeline, err := perf.Record(recordCtx, ctx.Device, options)
+	exitIfError("failed recording performance timeline", err)
+
+	f, err := os.Create(output)
+	exitIfError("failed creating trace file", err)
+	defer f.Close()
+	exitIfError("failed writing trace", timeline.Write(f))
+	slog.Info("wrote trace, open it with ui.perfetto.dev", "file", output)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+)
+
+func runDTXCommand(ctx commandContext) {
+	service, _ := ctx.Args.String("--service")
+	channelName, _ := ctx.Args.String("--channel")
+	selector, _ := ctx.Args.String("--selector")
+	jsonArgs, _ := ctx.Args["--arg"].([]string)
+	args, err := parseDTXArguments(jsonArgs)
+	exitIfError("invalid --arg", err)
+
+	conn, err := dtx.NewConnection(ctx.Device, service)
+	exitIfError("failed connecting to "+service, err)
+	defer conn.Close()
+
+	if boolArg(ctx.Args, "listen") {
+		listenDTXChannel(conn, channelName, selector, args)
+		return
+	}
+	channel := conn.RequestChannelIdentifier(channelName, dtxAckDispatcher{conn})
+	reply, err := channel.MethodCall(selector, args...)
+	exitIfError("failed calling "+selector, err)
+	fmt.Println(convertToJSONString(newDTXMessageOutput(reply)))
+}
+
+// parseDTXArguments converts the JSON values of --arg to method arguments. They are
+// archived right away, because archiving them later while sending panics on errors.
+func parseDTXArguments(jsonArgs []string) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(jsonArgs))
+	for _, jsonArg := range jsonArgs {
+		arg, err := nskeyedarchiver.FromJSON([]byte(jsonArg))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", jsonArg, err)
+		}
+		if _, err := nskeyedarchiver.ArchiveBin(arg); err != nil {
+			return nil, fmt.Errorf("%s: %w", jsonArg, err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// listenDTXChannel prints all messages the device sends on the channel and the global
+// channel until the connection closes or the process is interrupted. If selector is set,
+// it is called after opening the channel, to start services that only send data after a
+// method call.
+func listenDTXChannel(conn *dtx.Connection, channelName, selector string, args []interface{}) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	dispatcher := dtxPrintDispatcher{conn}
+	conn.MessageDispatcher = dispatcher
+	channel := conn.RequestChannelIdentifier(channelName, dispatcher)
+	if selector != "" {
+		reply, err := channel.MethodCall(selector, args...)
+		exitIfError("failed calling "+selector, err)
+		fmt.Println(convertToJSONString(newDTXMessageOutput(reply)))
+	}
+	select {
+	case <-conn.Closed():
+		if err := conn.Err(); err != nil {
+			slog.Info("connection closed", "err", err)
+		}
+	case <-stop:
+	}
+}
+
+// dtxAckDispatcher acknowledges messages that are not replies to method calls
+type dtxAckDispatcher struct {
+	conn *dtx.Connection
+}
+
+func (d dtxAckDispatcher) Dispatch(msg dtx.Message) {
+	dtx.SendAckIfNeeded(d.conn, msg)
+	slog.Debug("ignoring message", "message", msg)
+}
+
+// dtxPrintDispatcher acknowledges and prints all messages
+type dtxPrintDispatcher struct {
+	conn *dtx.Connection
+}
+
+func (d dtxPrintDispatcher) Dispatch(msg dtx.Message) {
+	dtx.SendAckIfNeeded(d.conn, msg)
+	fmt.Println(convertToJSONString(newDTXMessageOutput(msg)))
+}
+
+type dtxMessageOutput struct {
+	Identifier        int           `json:"identifier"`
+	ConversationIndex int           `json:"conversationIndex"`
+	Channel           int           `json:"channel"`
+	Type              string        `json:"type"`
+	ExpectsReply      bool          `json:"expectsReply"`
+	Selector          string        `json:"selector,omitempty"`
+	Payload           []interface{} `json:"payload,omitempty"`
+	Arguments         []interface{} `json:"arguments,omitempty"`
+}
+
+// newDTXMessageOutput converts a message to its JSON output. The selector of method
+// invocations is moved out of the payload and archived auxiliary arguments are unarchived.
+func newDTXMessageOutput(msg dtx.Message) dtxMessageOutput {
+	output := dtxMessageOutput{
+		Identifier:        msg.Identifier,
+		ConversationIndex: msg.ConversationIndex,
+		Channel:           msg.ChannelCode,
+		Type:              msg.PayloadHeader.MessageType.String(),
+		ExpectsReply:      msg.ExpectsReply,
+		Payload:           msg.Payload,
+	}
+	if msg.PayloadHeader.MessageType == dtx.Methodinvocation && len(msg.Payload) > 0 {
+		if selector, ok := msg.Payload[0].(string); ok {
+			output.Selector = selector
+			output.Payload = msg.Payload[1:]
+		}
+	}
+	for _, arg := range msg.Auxiliary.GetArguments() {
+		if archived, ok := arg.([]byte); ok {
+			if unarchived, err := nskeyedarchiver.Unarchive(archived); err == nil && len(unarchived) == 1 {
+				arg = unarchived[0]
+			}
+		}
+		output.Arguments = append(output.Arguments, arg)
+	}
+	return output
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+)
+
+func TestParseDTXArguments(t *testing.T) {
+	args, err := parseDTXArguments([]string{"1", `"name"`, `{"ur": 1000, "procAttrs": ["pid"]}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []interface{}{int64(1), "name", map[string]interface{}{"ur": int64(1000), "procAttrs": []interface{}{"pid"}}}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("parseDTXArguments() = %#v, want %#v", args, want)
+	}
+
+	if _, err := parseDTXArguments([]string{"{invalid"}); err == nil {
+		t.Fatal("expected error for invalid JSON, got nil")
+	}
+}
+
+func TestFormatDTXMessageJSON(t *testing.T) {
+	withJSONOutput(t, false)
+	archived, err := nskeyedarchiver.ArchiveBin("com.apple.mobile.notification")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auxiliary := dtx.NewPrimitiveDictionary()
+	auxiliary.AddBytes(archived)
+	auxiliary.AddInt32(7)
+	payload, err := nskeyedarchiver.ArchiveBin("applicationStateNotification:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := dtx.Encode(3, 0, 2, true, dtx.Methodinvocation, payload, auxiliary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _, err := dtx.DecodeNonBlocking(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"identifier":3,"conversationIndex":0,"channel":2,"type":"Methodinvocation","expectsReply":true,"selector":"applicationStateNotification:","arguments":["com.apple.mobile.notification",7]}`
+	if got := convertToJSONString(newDTXMessageOutput(msg)); got != want {
+		t.Fatalf("newDTXMessageOutput() = %s, want %s", got, want)
+	}
+}
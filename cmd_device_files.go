@@ -1,17 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/danielpaulus/go-ios/ios"
 	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/afc/davfs"
+	"github.com/danielpaulus/go-ios/ios/appdata"
+	"github.com/danielpaulus/go-ios/ios/crashreport"
 	"github.com/danielpaulus/go-ios/ios/fileservice"
 	"github.com/danielpaulus/go-ios/ios/house_arrest"
+	"github.com/docopt/docopt-go"
 )
 
 func runForwardCommand(ctx commandContext) {
@@ -176,6 +188,137 @@ func runFileCommand(ctx commandContext) {
 	}
 }
 
+// fsyncSyncOptions returns the options for an rsync like pull or push and whether one was requested
+func fsyncSyncOptions(ctx commandContext, containerBundleId string) (afc.SyncOptions, bool) {
+	syncMode, _ := ctx.Args.Bool("--sync")
+	deleteExtraneous, _ := ctx.Args.Bool("--delete")
+	verify, _ := ctx.Args.Bool("--verify")
+	parallelArg, _ := ctx.Args.String("--parallel")
+	if !syncMode && !deleteExtraneous && !verify && parallelArg == "" {
+		return afc.SyncOptions{}, false
+	}
+
+	parallel := 1
+	if parallelArg != "" {
+		var err error
+		parallel, err = strconv.Atoi(parallelArg)
+		if err == nil && parallel < 1 {
+			err = fmt.Errorf("must be at least 1, got %d", parallel)
+		}
+		exitIfError("fsync: invalid --parallel", err)
+	}
+
+	var mu sync.Mutex
+	return afc.SyncOptions{
+		Parallel: parallel,
+		NewClient: func() (*afc.Client, error) {
+			if containerBundleId == "" {
+				return afc.New(ctx.Device)
+			}
+			return house_arrest.New(ctx.Device, containerBundleId)
+		},
+		Delete: deleteExtraneous,
+		Verify: verify,
+		Progress: func(event afc.SyncEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !JSONdisabled {
+				fmt.Println(convertToJSONString(event))
+				return
+			}
+			switch event.Type {
+			case afc.SyncEventResume:
+				slog.Info("resuming", "path", event.Path, "bytes", event.Bytes, "total", event.Total)
+			case afc.SyncEventDone, afc.SyncEventVerified, afc.SyncEventDelete:
+				slog.Info(string(event.Type), "path", event.Path, "bytes", event.Bytes)
+			default:
+				slog.Debug(string(event.Type), "path", event.Path, "bytes", event.Bytes, "total", event.Total)
+			}
+		},
+	}, true
+}
+
+func printFsyncResult(result afc.SyncResult) {
+	if !JSONdisabled {
+		fmt.Println(convertToJSONString(result))
+		return
+	}
+	slog.Info(fmt.Sprintf("Transferred %d files (%d bytes), skipped %d unchanged, deleted %d", result.Transferred, result.Bytes, result.Skipped, result.Deleted))
+}
+
+func runFileServeCommand(ctx commandContext) {
+	bundleID, _ := ctx.Args.String("--app")
+	groupID, _ := ctx.Args.String("--app-group")
+	useCrash, _ := ctx.Args.Bool("--crash")
+	host, _ := ctx.Args.String("--host")
+	port, err := fileServePort(ctx.Args)
+	exitIfError("file serve: invalid --port", err)
+	readOnly, _ := ctx.Args.Bool("--readonly")
+	auth, _ := ctx.Args.String("--auth")
+
+	var fsys afc.WriteFS
+	if groupID != "" {
+		// app group containers are not reachable over AFC, only over the file service of iOS 17+
+		if !ctx.Device.SupportsRsd() {
+			exitIfError("file serve --app-group requires iOS 17+ with tunnel", fmt.Errorf("tunnel not running. Start with: ios tunnel start"))
+		}
+		conn, err := fileservice.New(ctx.Device, fileservice.DomainAppGroupDataContainer, groupID)
+		exitIfError("file serve: failed to connect to file service", err)
+		defer conn.Close()
+		fsys = fileservice.NewFS(conn)
+	} else {
+		var afcService *afc.Client
+		switch {
+		case bundleID != "":
+			afcService, err = house_arrest.New(ctx.Device, bundleID)
+		case useCrash:
+			afcService, err = crashreport.New(ctx.Device)
+		default:
+			afcService, err = afc.New(ctx.Device)
+		}
+		exitIfError("file serve: connect afc service failed", err)
+		defer afcService.Close()
+		fsys = afc.NewFS(afcService, "/")
+	}
+
+	options := davfs.Options{ReadOnly: readOnly}
+	if auth != "" {
+		user, password, ok := strings.Cut(auth, ":")
+		if !ok || user == "" {
+			exitIfError("file serve", fmt.Errorf("--auth must be in the form <user:password>"))
+		}
+		options.Username = user
+		options.Password = password
+	}
+
+	server := davfs.NewServer(fsys, host, port, options)
+	slog.Info("WebDAV server started", "addr", "http://"+server.Addr(), "readonly", readOnly)
+	serverCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = server.Serve(serverCtx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		exitIfError("file serve: WebDAV server failed", err)
+	}
+}
+
+// fileServePort returns the port of --port or 0 for the default port. docopt returns
+// --port as a list for all commands, because forward takes it several times.
+func fileServePort(args docopt.Opts) (int, error) {
+	ports, _ := args["--port"].([]string)
+	switch len(ports) {
+	case 0:
+		return 0, nil
+	case 1:
+		port, err := strconv.Atoi(ports[0])
+		if err == nil && (port < 1 || port > 65535) {
+			err = fmt.Errorf("port must be between 1 and 65535, got %d", port)
+		}
+		return port, err
+	default:
+		return 0, fmt.Errorf("only one port can be given, got %v", ports)
+	}
+}
+
 func runFsyncCommand(ctx commandContext) {
 	containerBundleId, _ := ctx.Args.String("--app")
 	var afcService *afc.Client
@@ -235,14 +378,131 @@ func runFsyncCommand(ctx commandContext) {
 		}
 
 		dp = path.Join(dp, filepath.Base(sp))
-		err = afcService.Pull(sp, dp)
-		exitIfError("fsync: pull failed", err)
+		if options, ok := fsyncSyncOptions(ctx, containerBundleId); ok {
+			result, err := afcService.SyncPull(sp, dp, options)
+			exitIfError("fsync: pull failed", err)
+			printFsyncResult(result)
+		} else {
+			err = afcService.Pull(sp, dp)
+			exitIfError("fsync: pull failed", err)
+		}
 	}
 	if push, _ := ctx.Args.Bool("push"); push {
 		sp, _ := ctx.Args.String("--srcPath")
 		dp, _ := ctx.Args.String("--dstPath")
 
-		err = afcService.Push(sp, dp)
-		exitIfError("fsync: push failed", err)
+		if options, ok := fsyncSyncOptions(ctx, containerBundleId); ok {
+			result, err := afcService.SyncPush(sp, dp, options)
+			exitIfError("fsync: push failed", err)
+			printFsyncResult(result)
+		} else {
+			err = afcService.Push(sp, dp)
+			exitIfError("fsync: push failed", err)
+		}
+	}
+
+	if mv, _ := ctx.Args.Bool("mv"); mv {
+		sp, _ := ctx.Args.String("--srcPath")
+		dp, _ := ctx.Args.String("--dstPath")
+
+		err = afcService.Rename(sp, dp)
+		exitIfError("fsync: mv failed", err)
+	}
+
+	if ln, _ := ctx.Args.Bool("ln"); ln {
+		sp, _ := ctx.Args.String("--srcPath")
+		dp, _ := ctx.Args.String("--dstPath")
+		isSymlink, _ := ctx.Args.Bool("--s")
+		if isSymlink {
+			err = afcService.Symlink(sp, dp)
+		} else {
+			err = afcService.Link(sp, dp)
+		}
+		exitIfError("fsync: ln failed", err)
+	}
+
+	if truncate, _ := ctx.Args.Bool("truncate"); truncate {
+		path, _ := ctx.Args.String("--path")
+		sizeArg, _ := ctx.Args.String("--size")
+		size, err := strconv.ParseInt(sizeArg, 10, 64)
+		exitIfError("fsync: invalid --size", err)
+
+		err = afcService.Truncate(path, size)
+		exitIfError("fsync: truncate failed", err)
+	}
+
+	if touch, _ := ctx.Args.Bool("touch"); touch {
+		path, _ := ctx.Args.String("--path")
+		mtime := time.Now()
+		if mtimeArg, _ := ctx.Args.String("--mtime"); mtimeArg != "" {
+			mtime, err = time.Parse(time.RFC3339, mtimeArg)
+			exitIfError("fsync: invalid --mtime, expected RFC3339", err)
+		}
+
+		if _, statErr := afcService.Stat(path); statErr != nil {
+			if !errors.Is(statErr, fs.ErrNotExist) {
+				exitIfError("fsync: touch failed", statErr)
+			}
+			f, err := afcService.Open(path, afc.WRITE_ONLY_CREATE_APPEND)
+			exitIfError("fsync: touch failed", err)
+			exitIfError("fsync: touch failed", f.Close())
+		}
+		err = afcService.SetModTime(path, mtime)
+		exitIfError("fsync: touch failed", err)
+	}
+
+	if export, _ := ctx.Args.Bool("export"); export {
+		path, _ := ctx.Args.String("--path")
+		compression, _ := ctx.Args.String("--compress")
+		err = afcService.ExportTar(path, os.Stdout, afc.Compression(compression))
+		exitIfError("fsync: export failed", err)
+	}
+
+	if importArchive, _ := ctx.Args.Bool("import"); importArchive {
+		path, _ := ctx.Args.String("--path")
+		err = afcService.ImportTar(os.Stdin, path)
+		exitIfError("fsync: import failed", err)
+	}
+}
+
+func runAppdataCommand(ctx commandContext) {
+	bundleID, _ := ctx.Args.String("<bundleID>")
+	include, _ := ctx.Args["--include"].([]string)
+	exclude, _ := ctx.Args["--exclude"].([]string)
+	compression, _ := ctx.Args.String("--compress")
+	options := appdata.Options{Include: include, Exclude: exclude, Compression: afc.Compression(compression)}
+
+	if snapshot, _ := ctx.Args.Bool("snapshot"); snapshot {
+		outfile, _ := ctx.Args.String("--output")
+		f, err := os.Create(outfile)
+		exitIfError("appdata: creating snapshot file failed", err)
+		err = appdata.Snapshot(ctx.Device, bundleID, f, options)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		exitIfError("appdata: snapshot failed", err)
+		printAppdataResult("snapshot", bundleID, outfile)
+	}
+
+	if restore, _ := ctx.Args.Bool("restore"); restore {
+		file, _ := ctx.Args.String("<file>")
+		f, err := os.Open(file)
+		exitIfError("appdata: opening snapshot file failed", err)
+		defer f.Close()
+		err = appdata.Restore(ctx.Device, bundleID, f, options)
+		exitIfError("appdata: restore failed", err)
+		printAppdataResult("restore", bundleID, file)
+	}
+}
+
+func printAppdataResult(action, bundleID, file string) {
+	if !JSONdisabled {
+		fmt.Println(convertToJSONString(map[string]interface{}{
+			"action":   action,
+			"bundleID": bundleID,
+			"file":     file,
+		}))
+		return
 	}
+	slog.Info(fmt.Sprintf("%s of %s finished", action, bundleID), "file", file)
 }
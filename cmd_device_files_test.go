@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestFileServePort(t *testing.T) {
+	port, err := fileServePort(parseCLIArgs(t, "file", "serve", "--port=9000"))
+	if err != nil || port != 9000 {
+		t.Fatalf("fileServePort() = %d, %v, want 9000", port, err)
+	}
+
+	port, err = fileServePort(parseCLIArgs(t, "file", "serve", "--crash"))
+	if err != nil || port != 0 {
+		t.Fatalf("fileServePort() without --port = %d, %v, want 0", port, err)
+	}
+
+	if _, err := fileServePort(parseCLIArgs(t, "file", "serve", "--port=http")); err == nil {
+		t.Fatal("expected error for a port that is not a number, got nil")
+	}
+}
@@ -32,9 +32,11 @@ var deviceCommands = []command{
 	commandByBool("uninstall", runUninstallCommand),
 	commandByBool("lang", runLangCommand),
 	commandByBool("dproxy", runDproxyCommand),
+	commandByBool("dtx", runDTXCommand),
 	commandByBool("info", runInfoCommand),
 	commandByBool("syslog", runSyslogCommand),
 	commandByBool("ostrace", runOSTraceCommand),
+	commandByBool("flightrecorder", runFlightRecorderCommand),
 	{
 		// "screenshot" is also a subcommand literal of `ios ui screenshot`
 		// (dispatched as a global ui command), so only match the top-level
@@ -100,6 +102,7 @@ var deviceCommands = []command{
 		run: runLaunchCommand,
 	},
 	commandByBool("sysmontap", runSysmontapCommand),
+	commandByBool("perf", runPerfCommand),
 	commandByBool("memlimitoff", runMemlimitOffCommand),
 	commandByBool("kill", runKillCommand),
 	commandByBool("runtest", runTestCommand),
@@ -108,9 +111,17 @@ var deviceCommands = []command{
 	commandByBool("ax", runAXCommand),
 	commandByBool("resetax", runResetAXCommand),
 	commandByBool("debug", runDebugCommand),
+	{
+		name: "file serve",
+		match: func(args docopt.Opts) bool {
+			return boolArg(args, "file") && boolArg(args, "serve")
+		},
+		run: runFileServeCommand,
+	},
 	commandByBool("file", runFileCommand),
 	commandByBool("pasteboard", runPasteboardCommand),
 	commandByBool("fsync", runFsyncCommand),
+	commandByBool("appdata", runAppdataCommand),
 	commandByBool("devmode", runDevModeCommand),
 	commandByBool("webinspector", runWebInspectorCommand),
 }
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/flightrecorder"
 	"github.com/danielpaulus/go-ios/ios/junit"
 	"github.com/danielpaulus/go-ios/ios/testmanagerd"
 )
@@ -54,6 +58,7 @@ func runTestCommand(ctx commandContext) {
 		Device:             ctx.Device,
 	}
 
+	var logWriter io.Writer = io.Discard
 	if rawTestlogErr == nil {
 		var writer *os.File = os.Stdout
 		if rawTestlog != "-" {
@@ -62,13 +67,22 @@ func runTestCommand(ctx commandContext) {
 			writer = file
 		}
 		defer writer.Close()
+		logWriter = writer
+	}
+	config.Listener = testmanagerd.NewTestListener(logWriter, logWriter, os.TempDir())
 
-		config.Listener = testmanagerd.NewTestListener(writer, writer, os.TempDir())
+	var testResults []testmanagerd.TestSuite
+	var err error
+	if strategy, shardErr := ctx.Args.String("--shard"); shardErr == nil || len(ctx.Udids) > 1 {
+		testResults, err = runShardedTests(ctx, config, strategy, logWriter)
 	} else {
-		config.Listener = testmanagerd.NewTestListener(io.Discard, io.Discard, os.TempDir())
+		if dir, _ := ctx.Args.String("--flight-recorder"); dir != "" {
+			recorder, stopRecorder := startTestFlightRecorder(ctx.Device, dir)
+			defer stopRecorder()
+			dumpOnTestFailure(recorder, config.Listener)
+		}
+		testResults, err = testmanagerd.RunTestWithConfig(context.TODO(), config)
 	}
-
-	testResults, err := testmanagerd.RunTestWithConfig(context.TODO(), config)
 	if err != nil {
 		slog.Info("Failed running Xcuitest", "error", err)
 	}
@@ -80,6 +94,159 @@ func runTestCommand(ctx commandContext) {
 	}
 }
 
+// runShardedTests splits the tests of config into shards with the strategy of --shard and
+// runs them in parallel on the devices of all --udid options, or on all connected devices
+func runShardedTests(ctx commandContext, config testmanagerd.TestConfig, strategyName string, logWriter io.Writer) ([]testmanagerd.TestSuite, error) {
+	if strategyName == "" {
+		strategyName = string(testmanagerd.ShardByClass)
+	}
+	strategy, err := testmanagerd.ParseShardStrategy(strategyName)
+	exitIfError("Invalid --shard", err)
+
+	var history []testmanagerd.TestSuite
+	for _, path := range ctx.Args["--shard-history"].([]string) {
+		history = append(history, readJUnitReport(path)...)
+	}
+	tests := config.TestsToRun
+	if len(tests) == 0 {
+		bundle, bundleErr := ctx.Args.String("--test-bundle")
+		if bundleErr != nil {
+			logFatal("Sharded test runs need --test-to-run or --test-bundle")
+		}
+		tests, err = testmanagerd.ListBundleTests(bundle)
+		exitIfError("Cannot list the tests of "+bundle, err)
+	}
+	devices := shardDevices(ctx)
+	shards, err := testmanagerd.ShardTests(tests, config.TestsToSkip, history, strategy, len(devices))
+	exitIfError("Cannot shard tests", err)
+
+	// the logs of all devices go to logWriter, every line is prefixed with the udid of its device
+	var logMutex sync.Mutex
+	logWriters := map[string]*linePrefixWriter{}
+	recorders := map[string]*flightrecorder.Recorder{}
+	flightRecorderDir, _ := ctx.Args.String("--flight-recorder")
+	for _, device := range devices {
+		udid := device.Properties.SerialNumber
+		logWriters[udid] = &linePrefixWriter{mu: &logMutex, w: logWriter, prefix: []byte(udid + ": ")}
+		if flightRecorderDir != "" {
+			recorder, stopRecorder := startTestFlightRecorder(device, flightRecorderDir)
+			defer stopRecorder()
+			recorders[udid] = recorder
+		}
+	}
+
+	slog.Info("Running sharded tests", "strategy", strategy, "devices", len(devices), "shards", len(shards))
+	testResults, err := testmanagerd.RunShardedTests(context.TODO(), testmanagerd.ShardedTestConfig{
+		Config:  config,
+		Devices: devices,
+		Shards:  shards,
+		NewListener: func(device ios.DeviceEntry) *testmanagerd.TestListener {
+			udid := device.Properties.SerialNumber
+			listener := testmanagerd.NewTestListener(logWriters[udid], logWriters[udid], os.TempDir())
+			if recorder, ok := recorders[udid]; ok {
+				dumpOnTestFailure(recorder, listener)
+			}
+			return listener
+		},
+	})
+	for _, writer := range logWriters {
+		writer.Flush()
+	}
+	return testResults, err
+}
+
+// linePrefixWriter writes complete lines with a prefix to w. The writers of all devices
+// share w and mu, so the lines of concurrent test runs do not interleave.
+type linePrefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	// line is the incomplete last line of the previous writes
+	line []byte
+}
+
+func (l *linePrefixWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.line = append(l.line, p...)
+	for {
+		end := bytes.IndexByte(l.line, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if err := l.writeLine(l.line[:end+1]); err != nil {
+			return len(p), err
+		}
+		l.line = l.line[end+1:]
+	}
+}
+
+// Flush writes the incomplete last line
+func (l *linePrefixWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.line) == 0 {
+		return nil
+	}
+	err := l.writeLine(append(l.line, '\n'))
+	l.line = nil
+	return err
+}
+
+func (l *linePrefixWriter) writeLine(line []byte) error {
+	_, err := l.w.Write(append(append([]byte{}, l.prefix...), line...))
+	return err
+}
+
+// shardDevices resolves the devices of all --udid options or all connected devices if
+// there is none
+func shardDevices(ctx commandContext) []ios.DeviceEntry {
+	if len(ctx.Udids) == 1 {
+		return []ios.DeviceEntry{ctx.Device}
+	}
+	udids := ctx.Udids
+	if len(udids) == 0 {
+		list, err := ios.ListDevices()
+		exitIfError("Cannot list devices", err)
+		for _, device := range list.DeviceList {
+			udids = append(udids, device.Properties.SerialNumber)
+		}
+	}
+	tunnelInfo := tunnelInfoConfigFromArgs(ctx.Args)
+	devices := make([]ios.DeviceEntry, 0, len(udids))
+	for _, udid := range udids {
+		devices = append(devices, resolveDeviceWithUdid(ctx.Args, tunnelInfo, udid))
+	}
+	return devices
+}
+
+// readJUnitReport reads the test results of a JUnit report of a previous run
+func readJUnitReport(path string) []testmanagerd.TestSuite {
+	file, err := os.Open(path)
+	exitIfError("Cannot open file "+path, err)
+	defer file.Close()
+	suites, err := junit.Read(file)
+	exitIfError("Cannot read JUnit report "+path, err)
+	return suites
+}
+
+// startTestFlightRecorder records the syslog of device while the tests run, the
+// returned function stops it
+func startTestFlightRecorder(device ios.DeviceEntry, dir string) (*flightrecorder.Recorder, func()) {
+	recorder := flightrecorder.New(device, flightrecorder.Options{Dir: dir})
+	recordCtx, stop := context.WithCancel(context.Background())
+	go recorder.Run(recordCtx)
+	return recorder, stop
+}
+
+// dumpOnTestFailure writes a dump of recorder for every failing test case of listener,
+// the file names of the dumps start with the udid of the device
+func dumpOnTestFailure(recorder *flightrecorder.Recorder, listener *testmanagerd.TestListener) {
+	recorder.DumpOnTestFailure(listener, func(path string, testCase testmanagerd.TestCase) {
+		slog.Info("test failed, flight recorder dump written", "test", testCase.ClassName+"/"+testCase.MethodName, "path", path)
+	})
+}
+
 func runXCTestCommand(ctx commandContext) {
 	xctestrunFilePath, _ := ctx.Args.String("--xctestrun-file-path")
 
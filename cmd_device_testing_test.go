@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSplitUdidArgs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		argv      []string
+		wantArgv  []string
+		wantUdids []string
+	}{
+		{name: "no udid", argv: []string{"ps"}, wantArgv: []string{"ps"}},
+		{name: "single udid stays", argv: []string{"ps", "--udid=a"}, wantArgv: []string{"ps", "--udid=a"}, wantUdids: []string{"a"}},
+		{
+			name:      "repeated udids are removed",
+			argv:      []string{"runtest", "--udid=a", "--bundle-id=x", "--udid", "b", "--udid=c"},
+			wantArgv:  []string{"runtest", "--udid=a", "--bundle-id=x"},
+			wantUdids: []string{"a", "b", "c"},
+		},
+		{name: "separate value of first udid", argv: []string{"runtest", "--udid", "a", "--udid=b"}, wantArgv: []string{"runtest", "--udid", "a"}, wantUdids: []string{"a", "b"}},
+		{name: "stops at double dash", argv: []string{"runtest", "--", "--udid=a"}, wantArgv: []string{"runtest", "--", "--udid=a"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			argv, udids := splitUdidArgs(testCase.argv)
+			if !reflect.DeepEqual(argv, testCase.wantArgv) {
+				t.Fatalf("argv = %v, want %v", argv, testCase.wantArgv)
+			}
+			if !reflect.DeepEqual(udids, testCase.wantUdids) {
+				t.Fatalf("udids = %v, want %v", udids, testCase.wantUdids)
+			}
+		})
+	}
+}
+
+func TestParseShardedRunTest(t *testing.T) {
+	argv, udids := splitUdidArgs([]string{"runtest", "--udid=a", "--udid=b", "--shard=by-duration", "--shard-history=old.xml", "--shard-history=older.xml", "--test-bundle=AppTests.xctest", "--bundle-id=com.example"})
+	args := parseCLIArgs(t, argv...)
+	if udid, _ := args.String("--udid"); udid != "a" || len(udids) != 2 {
+		t.Fatalf("--udid = %q, udids = %v", udid, udids)
+	}
+	if shard, _ := args.String("--shard"); shard != "by-duration" {
+		t.Fatalf("--shard = %q, want by-duration", shard)
+	}
+	if history := args["--shard-history"].([]string); !reflect.DeepEqual(history, []string{"old.xml", "older.xml"}) {
+		t.Fatalf("--shard-history = %v", history)
+	}
+	if bundle, _ := args.String("--test-bundle"); bundle != "AppTests.xctest" {
+		t.Fatalf("--test-bundle = %q, want AppTests.xctest", bundle)
+	}
+}
+
+func TestLinePrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	a := &linePrefixWriter{mu: &mu, w: &out, prefix: []byte("a: ")}
+	b := &linePrefixWriter{mu: &mu, w: &out, prefix: []byte("b: ")}
+
+	a.Write([]byte("first "))
+	b.Write([]byte("other\nlast"))
+	a.Write([]byte("line\nsecond line\n"))
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	a.Flush()
+
+	want := "b: other\na: first line\na: second line\nb: last\n"
+	if out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -24,7 +24,14 @@ var globalCommands = []command{
 		},
 		run: runUICommand,
 	},
-	commandByBool("listen", runListenCommand),
+	{
+		// `ios dtx listen` sets the same "listen" arg, but is a device command
+		name: "listen",
+		match: func(args docopt.Opts) bool {
+			return boolArg(args, "listen") && !boolArg(args, "dtx")
+		},
+		run: runListenCommand,
+	},
 	{
 		name:  "list",
 		match: isDeviceListCommand,
@@ -8,6 +8,8 @@ import (
 type commandContext struct {
 	Args   docopt.Opts
 	Device ios.DeviceEntry
+	// Udids contains every --udid that was given, Device is the one of the first
+	Udids []string
 }
 
 type command struct {
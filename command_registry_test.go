@@ -112,9 +112,17 @@ func TestDispatchSubcommandCollisions(t *testing.T) {
 		{name: "ui install dispatches ui install", argv: []string{"ui", "install", "wda", "--p12file=cert.p12", "--profile=dev.mobileprovision"}, want: "device:ui install"},
 		{name: "plain install dispatches install", argv: []string{"install", "--path=app.ipa"}, want: "device:install"},
 		{name: "ui run dispatches ui run", argv: []string{"ui", "run", "wda"}, want: "device:ui run"},
+		// file serve vs file
+		{name: "file serve dispatches file serve", argv: []string{"file", "serve", "--app=com.example.app", "--readonly"}, want: "device:file serve"},
+		{name: "file ls dispatches file", argv: []string{"file", "ls", "--crash"}, want: "device:file"},
+		{name: "appdata snapshot dispatches appdata", argv: []string{"appdata", "snapshot", "com.example.app", "--output=app.tar"}, want: "device:appdata"},
+		{name: "appdata restore dispatches appdata", argv: []string{"appdata", "restore", "com.example.app", "app.tar", "--exclude=tmp"}, want: "device:appdata"},
 		// webinspector vs list (also guarded by TestDeviceListCommandOnlyMatchesTopLevelList)
 		{name: "webinspector list dispatches webinspector", argv: []string{"webinspector", "list"}, want: "device:webinspector"},
 		{name: "plain list dispatches list", argv: []string{"list"}, want: "global:list"},
+		// dtx listen vs listen
+		{name: "dtx listen dispatches dtx", argv: []string{"dtx", "listen", "--service=com.apple.instruments.dtservicehub", "--channel=com.apple.instruments.server.services.sysmontap"}, want: "device:dtx"},
+		{name: "plain listen dispatches listen", argv: []string{"listen"}, want: "global:listen"},
 	}
 
 	for _, testCase := range testCases {
@@ -146,14 +154,19 @@ func TestNeedsAutomaticTunnelInfo(t *testing.T) {
 		{name: "assistivetouch stays tunnel-free", args: docopt.Opts{"assistivetouch": true}, want: false},
 		{name: "timeformat stays tunnel-free", args: docopt.Opts{"timeformat": true}, want: false},
 		{name: "file needs tunnel", args: docopt.Opts{"file": true}, want: true},
+		{name: "file serve stays tunnel-free (afc)", args: docopt.Opts{"file": true, "serve": true}, want: false},
 		{name: "rsd needs tunnel", args: docopt.Opts{"rsd": true}, want: true},
 		{name: "display info needs tunnel", args: docopt.Opts{"info": true, "display": true}, want: true},
 		{name: "plain info stays tunnel-free", args: docopt.Opts{"info": true}, want: false},
 		{name: "syslog needs tunnel when available", args: docopt.Opts{"syslog": true}, want: true},
+		{name: "flightrecorder needs tunnel (syslog shim)", args: docopt.Opts{"flightrecorder": true}, want: true},
 		{name: "runtest needs tunnel on iOS 17", args: docopt.Opts{"runtest": true}, want: true},
+		{name: "appdata needs tunnel (kills the app)", args: docopt.Opts{"appdata": true, "snapshot": true}, want: true},
 		{name: "devicestate needs tunnel (instruments)", args: docopt.Opts{"devicestate": true}, want: true},
 		{name: "instruments network needs tunnel", args: docopt.Opts{"instruments": true, "network": true}, want: true},
 		{name: "instruments fps needs tunnel", args: docopt.Opts{"instruments": true, "fps": true}, want: true},
+		{name: "perf needs tunnel (instruments)", args: docopt.Opts{"perf": true, "record": true}, want: true},
+		{name: "dtx needs tunnel (RSD services)", args: docopt.Opts{"dtx": true, "call": true}, want: true},
 		{name: "resetlocation needs tunnel (instruments)", args: docopt.Opts{"resetlocation": true}, want: true},
 		{name: "setlocationgpx needs tunnel (instruments)", args: docopt.Opts{"setlocationgpx": true}, want: true},
 		{name: "ui run needs tunnel (testmanagerd)", args: docopt.Opts{"ui": true, "run": true}, want: true},
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// flightRecorderDumpSignals make `ios flightrecorder` write a dump
+var flightRecorderDumpSignals = []os.Signal{syscall.SIGUSR1}
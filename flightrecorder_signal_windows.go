@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// flightRecorderDumpSignals is empty on Windows, which has no user signals. Use the REST API to trigger dumps.
+var flightRecorderDumpSignals []os.Signal
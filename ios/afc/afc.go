@@ -10,6 +10,7 @@ type opcode uint64
 const (
 	status                opcode = 0x00000001
 	readDir               opcode = 0x00000003
+	truncatePath          opcode = 0x00000007
 	removePath            opcode = 0x00000008
 	makeDir               opcode = 0x00000009
 	fileInfo              opcode = 0x0000000A
@@ -19,5 +20,13 @@ const (
 	fileWrite             opcode = 0x00000010
 	fileOpenResult        opcode = 0x0000000E
 	fileRead              opcode = 0x0000000F
+	fileSeek              opcode = 0x00000011
+	fileTell              opcode = 0x00000012
+	fileTellResult        opcode = 0x00000013
+	fileSetSize           opcode = 0x00000015
+	renamePath            opcode = 0x00000018
+	fileLock              opcode = 0x0000001B
+	makeLink              opcode = 0x0000001C
+	setFileModTime        opcode = 0x0000001E
 	removePathAndContents opcode = 0x00000022
 )
@@ -11,7 +11,9 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/danielpaulus/go-ios/ios"
 	"golang.org/x/exp/slices"
@@ -160,6 +162,89 @@ func (c *Client) remove(p string, recursive bool) error {
 	return nil
 }
 
+// Rename moves the file or directory at from to the path to
+func (c *Client) Rename(from, to string) error {
+	headerPayload := append([]byte(from), 0)
+	headerPayload = append(headerPayload, []byte(to)...)
+	headerPayload = append(headerPayload, 0)
+
+	err := c.sendPacket(renamePath, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error renaming file: %w", err)
+	}
+	_, err = c.readPacket()
+	if err != nil {
+		return fmt.Errorf("error renaming file: %w", err)
+	}
+	return nil
+}
+
+// Link creates a hard link at the path link pointing to target
+func (c *Client) Link(target, link string) error {
+	return c.makeLink(HARDLINK, target, link)
+}
+
+// Symlink creates a symbolic link at the path link pointing to target
+func (c *Client) Symlink(target, link string) error {
+	return c.makeLink(SYMLINK, target, link)
+}
+
+func (c *Client) makeLink(linkType LinkType, target, link string) error {
+	headerPayload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(headerPayload, uint64(linkType))
+	headerPayload = append(headerPayload, []byte(target)...)
+	headerPayload = append(headerPayload, 0)
+	headerPayload = append(headerPayload, []byte(link)...)
+	headerPayload = append(headerPayload, 0)
+
+	err := c.sendPacket(makeLink, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error creating link: %w", err)
+	}
+	_, err = c.readPacket()
+	if err != nil {
+		return fmt.Errorf("error creating link: %w", err)
+	}
+	return nil
+}
+
+// Truncate changes the size of the file at the given path
+// If the file is larger than size, the extra data is discarded. If it is smaller, it is zero-padded
+func (c *Client) Truncate(p string, size int64) error {
+	headerPayload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(headerPayload, uint64(size))
+	headerPayload = append(headerPayload, []byte(p)...)
+	headerPayload = append(headerPayload, 0)
+
+	err := c.sendPacket(truncatePath, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error truncating file: %w", err)
+	}
+	_, err = c.readPacket()
+	if err != nil {
+		return fmt.Errorf("error truncating file: %w", err)
+	}
+	return nil
+}
+
+// SetModTime sets the modification time of the file at the given path
+func (c *Client) SetModTime(p string, t time.Time) error {
+	headerPayload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(headerPayload, uint64(t.UnixNano()))
+	headerPayload = append(headerPayload, []byte(p)...)
+	headerPayload = append(headerPayload, 0)
+
+	err := c.sendPacket(setFileModTime, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error setting modification time: %w", err)
+	}
+	_, err = c.readPacket()
+	if err != nil {
+		return fmt.Errorf("error setting modification time: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) sendPacket(operation opcode, headerPayload []byte, payload []byte) error {
 	num := c.packetNum.Add(1)
 
@@ -258,7 +343,9 @@ const (
 	// S_IFDIR marks a directory
 	S_IFDIR FileType = "S_IFDIR"
 	// S_IFDIR marks a regular file
-	S_IFMT  FileType = "S_IFMT"
+	S_IFMT FileType = "S_IFMT"
+	// S_IFREG marks a regular file, this is what devices report for files
+	S_IFREG FileType = "S_IFREG"
 	S_IFLNK FileType = "S_IFLNK"
 )
 
@@ -267,6 +354,7 @@ type FileInfo struct {
 	Type       FileType
 	Mode       uint32
 	Size       int64
+	ModTime    time.Time
 	LinkTarget string
 }
 
@@ -320,6 +408,9 @@ func (c *Client) Stat(s string) (FileInfo, error) {
 		case "st_mode":
 			mode, _ := strconv.ParseUint(value, 8, 32)
 			info.Mode = uint32(mode)
+		case "st_mtime":
+			mtime, _ := strconv.ParseInt(value, 10, 64)
+			info.ModTime = time.Unix(0, mtime)
 		case "st_linktarget":
 			info.LinkTarget = value
 		}
@@ -435,8 +526,16 @@ type packet struct {
 type File struct {
 	client *Client
 	handle uint64
+	// mu serializes ReadAt and WriteAt, which move the file offset and restore it afterwards
+	mu sync.Mutex
 }
 
+var (
+	_ io.ReadWriteSeeker = (*File)(nil)
+	_ io.ReaderAt        = (*File)(nil)
+	_ io.WriterAt        = (*File)(nil)
+)
+
 func (f *File) Read(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
@@ -488,6 +587,129 @@ func (f *File) Close() error {
 	return nil
 }
 
+// Seek sets the offset for the next Read or Write on the file and returns the new offset
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart, io.SeekCurrent, io.SeekEnd:
+	default:
+		return 0, fmt.Errorf("error seeking file: invalid whence %d", whence)
+	}
+	headerPayload := make([]byte, 24)
+	binary.LittleEndian.PutUint64(headerPayload, f.handle)
+	binary.LittleEndian.PutUint64(headerPayload[8:], uint64(whence))
+	binary.LittleEndian.PutUint64(headerPayload[16:], uint64(offset))
+	err := f.client.sendPacket(fileSeek, headerPayload, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error seeking file: %w", err)
+	}
+	_, err = f.client.readPacket()
+	if err != nil {
+		return 0, fmt.Errorf("error seeking file: %w", err)
+	}
+	return f.tell()
+}
+
+func (f *File) tell() (int64, error) {
+	headerPayload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(headerPayload, f.handle)
+	err := f.client.sendPacket(fileTell, headerPayload, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error getting file offset: %w", err)
+	}
+	resp, err := f.client.readPacket()
+	if err != nil {
+		return 0, fmt.Errorf("error getting file offset: %w", err)
+	}
+	if resp.Header.Operation != fileTellResult || len(resp.HeaderPayload) < 8 {
+		return 0, fmt.Errorf("error getting file offset: unexpected response operation %d", resp.Header.Operation)
+	}
+	return int64(binary.LittleEndian.Uint64(resp.HeaderPayload)), nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off. The current file offset is not changed
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	restore, err := f.seekTemporarily(off)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(f, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	if restoreErr := restore(); err == nil {
+		err = restoreErr
+	}
+	return n, err
+}
+
+// WriteAt writes len(p) bytes starting at offset off. The current file offset is not changed
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	restore, err := f.seekTemporarily(off)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.Write(p)
+	if restoreErr := restore(); err == nil {
+		err = restoreErr
+	}
+	return n, err
+}
+
+// seekTemporarily moves the file offset to off and returns a function that moves it back
+func (f *File) seekTemporarily(off int64) (func() error, error) {
+	if off < 0 {
+		return nil, fmt.Errorf("error seeking file: negative offset %d", off)
+	}
+	current, err := f.tell()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := f.Seek(current, io.SeekStart)
+		return err
+	}, nil
+}
+
+// Truncate changes the size of the open file
+func (f *File) Truncate(size int64) error {
+	headerPayload := make([]byte, 16)
+	binary.LittleEndian.PutUint64(headerPayload, f.handle)
+	binary.LittleEndian.PutUint64(headerPayload[8:], uint64(size))
+	err := f.client.sendPacket(fileSetSize, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error truncating file: %w", err)
+	}
+	_, err = f.client.readPacket()
+	if err != nil {
+		return fmt.Errorf("error truncating file: %w", err)
+	}
+	return nil
+}
+
+// Lock applies or removes an advisory lock on the open file
+// Locks are non-blocking, if the lock is held by someone else an error is returned
+func (f *File) Lock(op LockType) error {
+	headerPayload := make([]byte, 16)
+	binary.LittleEndian.PutUint64(headerPayload, f.handle)
+	binary.LittleEndian.PutUint64(headerPayload[8:], uint64(op))
+	err := f.client.sendPacket(fileLock, headerPayload, nil)
+	if err != nil {
+		return fmt.Errorf("error locking file: %w", err)
+	}
+	_, err = f.client.readPacket()
+	if err != nil {
+		return fmt.Errorf("error locking file: %w", err)
+	}
+	return nil
+}
+
 type Mode uint64
 
 const (
@@ -498,3 +720,19 @@ const (
 	WRITE_ONLY_CREATE_APPEND = Mode(0x00000005)
 	READ_WRITE_CREATE_APPEND = Mode(0x00000006)
 )
+
+type LinkType uint64
+
+const (
+	HARDLINK = LinkType(0x00000001)
+	SYMLINK  = LinkType(0x00000002)
+)
+
+// LockType is the operation passed to [File.Lock]. All lock types are non-blocking
+type LockType uint64
+
+const (
+	LOCK_SH = LockType(0x00000001 | 0x00000004)
+	LOCK_EX = LockType(0x00000002 | 0x00000004)
+	LOCK_UN = LockType(0x00000008 | 0x00000004)
+)
@@ -78,3 +78,115 @@ func TestAfcErrorDescriptiveMessage(t *testing.T) {
 	assert.Contains(t, err.Error(), "ObjectNotFound")
 	assert.Contains(t, err.Error(), "8")
 }
+
+// recordingConn replays canned device responses and records everything the
+// client writes so the request encoding can be asserted.
+type recordingConn struct {
+	r       io.Reader
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *recordingConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *recordingConn) Close() error                { return nil }
+
+func statusPacket(code uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, code)
+	return encodeAfcPacket(status, b, nil)
+}
+
+func tellPacket(pos uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, pos)
+	return encodeAfcPacket(fileTellResult, b, nil)
+}
+
+// TestRenameEncodesBothPaths verifies Rename sends both NUL-terminated paths
+// in the header payload of a single renamePath packet.
+func TestRenameEncodesBothPaths(t *testing.T) {
+	conn := &recordingConn{r: bytes.NewReader(statusPacket(errSuccess))}
+	c := &Client{connection: conn}
+
+	err := c.Rename("/a.txt", "/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, encodeSentPacket(1, renamePath, []byte("/a.txt\x00/b.txt\x00")), conn.written.Bytes())
+}
+
+// TestSymlinkEncodesLinkType verifies the link type precedes target and link name.
+func TestSymlinkEncodesLinkType(t *testing.T) {
+	conn := &recordingConn{r: bytes.NewReader(statusPacket(errSuccess))}
+	c := &Client{connection: conn}
+
+	err := c.Symlink("target", "link")
+	assert.NoError(t, err)
+	want := []byte{2, 0, 0, 0, 0, 0, 0, 0}
+	want = append(want, []byte("target\x00link\x00")...)
+	assert.Equal(t, encodeSentPacket(1, makeLink, want), conn.written.Bytes())
+}
+
+// TestRenameReturnsDeviceError verifies a non-success status is surfaced.
+func TestRenameReturnsDeviceError(t *testing.T) {
+	conn := &recordingConn{r: bytes.NewReader(statusPacket(errObjectNotFound))}
+	c := &Client{connection: conn}
+
+	err := c.Rename("/missing", "/b")
+	assert.ErrorContains(t, err, "ObjectNotFound")
+}
+
+// TestFileSeekReturnsNewOffset verifies Seek issues a seek followed by a tell
+// and reports the offset from the tell response.
+func TestFileSeekReturnsNewOffset(t *testing.T) {
+	responses := append(statusPacket(errSuccess), tellPacket(42)...)
+	conn := &recordingConn{r: bytes.NewReader(responses)}
+	f := &File{client: &Client{connection: conn}, handle: 7}
+
+	pos, err := f.Seek(-8, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), pos)
+
+	seekPayload := make([]byte, 24)
+	binary.LittleEndian.PutUint64(seekPayload, 7)
+	binary.LittleEndian.PutUint64(seekPayload[8:], uint64(io.SeekEnd))
+	binary.LittleEndian.PutUint64(seekPayload[16:], uint64(0xFFFFFFFFFFFFFFF8))
+	tellPayload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tellPayload, 7)
+	want := append(encodeSentPacket(1, fileSeek, seekPayload), encodeSentPacket(2, fileTell, tellPayload)...)
+	assert.Equal(t, want, conn.written.Bytes())
+}
+
+// TestFileReadAtRestoresOffset verifies ReadAt reads from the requested offset
+// and moves the file offset back to where it was.
+func TestFileReadAtRestoresOffset(t *testing.T) {
+	var responses []byte
+	responses = append(responses, tellPacket(3)...)            // current offset
+	responses = append(responses, statusPacket(errSuccess)...) // seek to 10
+	responses = append(responses, tellPacket(10)...)           // tell after seek
+	responses = append(responses, encodeAfcPacket(fileRead, nil, []byte("abcd"))...)
+	responses = append(responses, statusPacket(errSuccess)...) // seek back to 3
+	responses = append(responses, tellPacket(3)...)            // tell after seek back
+	conn := &recordingConn{r: bytes.NewReader(responses)}
+	f := &File{client: &Client{connection: conn}, handle: 1}
+
+	p := make([]byte, 4)
+	n, err := f.ReadAt(p, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []byte("abcd"), p)
+}
+
+// encodeSentPacket builds the bytes the client is expected to write for a
+// request without a data payload.
+func encodeSentPacket(num uint64, op opcode, headerPayload []byte) []byte {
+	thisLen := headerSize + uint64(len(headerPayload))
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, header{
+		Magic:     magic,
+		EntireLen: thisLen,
+		ThisLen:   thisLen,
+		PacketNum: num,
+		Operation: op,
+	})
+	buf.Write(headerPayload)
+	return buf.Bytes()
+}
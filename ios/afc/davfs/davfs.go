@@ -0,0 +1,153 @@
+// Package davfs serves the filesystem of an AFC client over WebDAV, so desktop
+// file managers and tools like rclone can mount device storage without FUSE.
+package davfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem implements [webdav.FileSystem] on top of an [afc.WriteFS].
+// An AFC connection handles one request at a time, so all operations,
+// including reads and writes on open files, are serialized.
+type FileSystem struct {
+	fsys     afc.WriteFS
+	readOnly bool
+	mu       sync.Mutex
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// NewFileSystem creates a [webdav.FileSystem] for fsys.
+// If readOnly is set, every operation that would modify the device fails with [fs.ErrPermission]
+func NewFileSystem(fsys afc.WriteFS, readOnly bool) *FileSystem {
+	return &FileSystem{fsys: fsys, readOnly: readOnly}
+}
+
+// toFSPath converts a slash-rooted WebDAV name into an [fs.ValidPath] name
+func toFSPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (d *FileSystem) Mkdir(_ context.Context, name string, perm os.FileMode) error {
+	if d.readOnly {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fsys.Mkdir(toFSPath(name), perm)
+}
+
+func (d *FileSystem) OpenFile(_ context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if d.readOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := d.fsys.OpenFile(toFSPath(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &file{f: f, name: name, mu: &d.mu}, nil
+}
+
+func (d *FileSystem) RemoveAll(_ context.Context, name string) error {
+	if d.readOnly {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrPermission}
+	}
+	p := toFSPath(name)
+	if p == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrPermission}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fsys.RemoveAll(p)
+}
+
+func (d *FileSystem) Rename(_ context.Context, oldName, newName string) error {
+	if d.readOnly {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fsys.Rename(toFSPath(oldName), toFSPath(newName))
+}
+
+func (d *FileSystem) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return fs.Stat(d.fsys, toFSPath(name))
+}
+
+// file implements [webdav.File] for an open [afc.WritableFile]
+type file struct {
+	f    afc.WritableFile
+	name string
+	mu   *sync.Mutex
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Read(p)
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Write(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.f.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return seeker.Seek(offset, whence)
+}
+
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	dir, ok := f.f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries, err := dir.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return infos, infoErr
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Stat()
+}
+
+func (f *file) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
@@ -0,0 +1,171 @@
+package davfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memFS is a minimal afc.WriteFS backed by fstest.MapFS
+type memFS struct {
+	fstest.MapFS
+}
+
+type memWriteFile struct {
+	fs.File
+	fsys memFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (f *memWriteFile) Write(p []byte) (int, error) { return f.buf.Write(p) }
+
+func (f *memWriteFile) Stat() (fs.FileInfo, error) {
+	return fs.Stat(fstest.MapFS{f.name: {Data: f.buf.Bytes(), ModTime: time.Now()}}, f.name)
+}
+
+func (f *memWriteFile) Close() error {
+	f.fsys.MapFS[f.name] = &fstest.MapFile{Data: f.buf.Bytes(), Mode: 0o644, ModTime: time.Now()}
+	return nil
+}
+
+type memReadFile struct {
+	fs.File
+}
+
+func (memReadFile) Write([]byte) (int, error) { return 0, fs.ErrPermission }
+
+func (f memReadFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (f memReadFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.File.(fs.ReadDirFile).ReadDir(n)
+}
+
+func (m memFS) OpenFile(name string, flag int, _ fs.FileMode) (afc.WritableFile, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return &memWriteFile{fsys: m, name: name}, nil
+	}
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return memReadFile{File: f}, nil
+}
+
+func (m memFS) Mkdir(name string, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+	return nil
+}
+
+func (m memFS) Remove(name string) error {
+	delete(m.MapFS, name)
+	return nil
+}
+
+func (m memFS) RemoveAll(name string) error {
+	for p := range m.MapFS {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(m.MapFS, p)
+		}
+	}
+	return nil
+}
+
+func (m memFS) Rename(oldname, newname string) error {
+	m.MapFS[newname] = m.MapFS[oldname]
+	delete(m.MapFS, oldname)
+	return nil
+}
+
+func newTestServer(t *testing.T, options Options) (*httptest.Server, memFS) {
+	fsys := memFS{fstest.MapFS{
+		"Documents/notes.txt": {Data: []byte("hello"), Mode: 0o644, ModTime: time.Unix(1700000000, 0)},
+	}}
+	server := httptest.NewServer(NewServer(fsys, "", 0, options).Handler())
+	t.Cleanup(server.Close)
+	return server, fsys
+}
+
+func do(t *testing.T, method, url string, body io.Reader, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeListAndGet(t *testing.T) {
+	server, _ := newTestServer(t, Options{})
+
+	resp := do(t, "PROPFIND", server.URL+"/Documents/", nil, map[string]string{"Depth": "1"})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "/Documents/notes.txt")
+
+	resp = do(t, http.MethodGet, server.URL+"/Documents/notes.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestServePut(t *testing.T) {
+	server, fsys := newTestServer(t, Options{})
+
+	resp := do(t, http.MethodPut, server.URL+"/Documents/new.txt", strings.NewReader("fixture"), nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "fixture", string(fsys.MapFS[path.Join("Documents", "new.txt")].Data))
+}
+
+func TestServeReadOnly(t *testing.T) {
+	server, fsys := newTestServer(t, Options{ReadOnly: true})
+
+	resp := do(t, http.MethodPut, server.URL+"/Documents/new.txt", strings.NewReader("fixture"), nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = do(t, http.MethodDelete, server.URL+"/Documents/notes.txt", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, fsys.MapFS, "Documents/notes.txt")
+
+	resp = do(t, http.MethodGet, server.URL+"/Documents/notes.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServeBasicAuth(t *testing.T) {
+	server, _ := newTestServer(t, Options{Username: "user", Password: "secret"})
+
+	resp := do(t, http.MethodGet, server.URL+"/Documents/notes.txt", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/Documents/notes.txt", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("user", "secret")
+	authed, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer authed.Body.Close()
+	assert.Equal(t, http.StatusOK, authed.StatusCode)
+}
+
+func TestToFSPath(t *testing.T) {
+	assert.Equal(t, ".", toFSPath("/"))
+	assert.Equal(t, ".", toFSPath(""))
+	assert.Equal(t, "Documents/a.txt", toFSPath("/Documents/a.txt"))
+	assert.Equal(t, "a.txt", toFSPath("/../a.txt"))
+}
@@ -0,0 +1,120 @@
+package davfs
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"golang.org/x/net/webdav"
+)
+
+const logModule = "go-ios/davfs"
+
+// Options configures a WebDAV [Server]
+type Options struct {
+	// ReadOnly rejects every request that would modify the device
+	ReadOnly bool
+	// Username and Password enable HTTP basic auth if Username is not empty
+	Username string
+	Password string
+}
+
+// Server serves an [afc.WriteFS] over WebDAV
+type Server struct {
+	fsys    afc.WriteFS
+	host    string
+	port    int
+	options Options
+	server  *http.Server
+}
+
+// NewServer creates a WebDAV server for fsys. It listens on 127.0.0.1:8080 unless host and port are set
+func NewServer(fsys afc.WriteFS, host string, port int, options Options) *Server {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if port == 0 {
+		port = 8080
+	}
+	return &Server{fsys: fsys, host: host, port: port, options: options}
+}
+
+func (s *Server) Addr() string {
+	return fmt.Sprintf("%s:%d", s.host, s.port)
+}
+
+// Handler returns the http.Handler serving WebDAV requests, including locking, read-only and auth checks
+func (s *Server) Handler() http.Handler {
+	var handler http.Handler = &webdav.Handler{
+		FileSystem: NewFileSystem(s.fsys, s.options.ReadOnly),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				golog.Debug("webdav request failed", "module", logModule, "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+	if s.options.ReadOnly {
+		handler = readOnly(handler)
+	}
+	if s.options.Username != "" {
+		handler = basicAuth(handler, s.options.Username, s.options.Password)
+	}
+	return handler
+}
+
+// Serve runs the server until ctx is cancelled
+func (s *Server) Serve(ctx context.Context) error {
+	s.server = &http.Server{Addr: s.Addr(), Handler: s.Handler()}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	}
+}
+
+// readOnly rejects all WebDAV methods that modify resources. LOCK and UNLOCK stay
+// allowed, because clients like Finder refuse to mount shares that do not support them.
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE", "PROPPATCH":
+			http.Error(w, "read-only WebDAV share", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func basicAuth(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		userOk := subtle.ConstantTimeCompare([]byte(u), []byte(username)) == 1
+		passOk := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		if !ok || !userOk || !passOk {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-ios"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,6 +3,7 @@ package afc
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 )
 
 const (
@@ -112,6 +113,22 @@ func (a afcError) Error() string {
 	return fmt.Sprintf("afc error code: %d (%s)", a.code, getError(uint64(a.code)))
 }
 
+// Is maps AFC error codes to the matching io/fs sentinel errors, so callers can
+// use errors.Is(err, fs.ErrNotExist) and similar checks on AFC errors
+func (a afcError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return a.code == errObjectNotFound
+	case fs.ErrExist:
+		return a.code == errObjectExists
+	case fs.ErrPermission:
+		return a.code == errPermDenied
+	case fs.ErrInvalid:
+		return a.code == errInvalidArgument
+	}
+	return false
+}
+
 func isPermissionDeniedError(err error) bool {
 	var aError afcError
 	return errors.As(err, &aError) && aError.code == errPermDenied
@@ -0,0 +1,343 @@
+package afc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDevice is an in-memory AFC server. It speaks the AFC wire protocol so
+// Client can be exercised end to end without a real device.
+type fakeDevice struct {
+	mu         sync.Mutex
+	nodes      map[string]*fakeNode
+	handles    map[uint64]*fakeHandle
+	nextHandle uint64
+	// statErrors makes file info requests of the paths fail with the error code
+	statErrors map[string]uint64
+}
+
+type fakeNode struct {
+	dir   bool
+	data  []byte
+	mtime time.Time
+	link  string
+}
+
+type fakeHandle struct {
+	path   string
+	pos    int64
+	append bool
+}
+
+func newFakeDevice() *fakeDevice {
+	return &fakeDevice{
+		nodes: map[string]*fakeNode{
+			"/": {dir: true, mtime: time.Unix(1700000000, 0)},
+		},
+		handles:    map[uint64]*fakeHandle{},
+		statErrors: map[string]uint64{},
+	}
+}
+
+// newClient connects a new Client to the fake device. Every client gets its
+// own connection, like separate AFC service connections to the same device.
+func (d *fakeDevice) newClient(t *testing.T) *Client {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	go d.serve(serverConn)
+	c := &Client{connection: clientConn}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// put creates a file with the given content and all missing parent directories.
+func (d *fakeDevice) put(p string, content string, mtime time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p = fakeClean(p)
+	d.mkdirAll(path.Dir(p))
+	d.nodes[p] = &fakeNode{data: []byte(content), mtime: mtime}
+}
+
+func (d *fakeDevice) get(p string) (*fakeNode, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n, ok := d.nodes[fakeClean(p)]
+	return n, ok
+}
+
+func (d *fakeDevice) mkdirAll(p string) {
+	for dir := p; dir != "/"; dir = path.Dir(dir) {
+		if _, ok := d.nodes[dir]; !ok {
+			d.nodes[dir] = &fakeNode{dir: true, mtime: time.Unix(1700000000, 0)}
+		}
+	}
+}
+
+func fakeClean(p string) string {
+	p = strings.TrimRight(p, "\x00")
+	return path.Clean("/" + p)
+}
+
+func (d *fakeDevice) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var h header
+		if err := binary.Read(conn, binary.LittleEndian, &h); err != nil {
+			return
+		}
+		headerPayload := make([]byte, h.ThisLen-headerSize)
+		if _, err := io.ReadFull(conn, headerPayload); err != nil {
+			return
+		}
+		payload := make([]byte, h.EntireLen-h.ThisLen)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		op, respHeader, respPayload := d.handle(h.Operation, headerPayload, payload)
+		thisLen := headerSize + uint64(len(respHeader))
+		resp := new(bytes.Buffer)
+		_ = binary.Write(resp, binary.LittleEndian, header{
+			Magic:     magic,
+			EntireLen: thisLen + uint64(len(respPayload)),
+			ThisLen:   thisLen,
+			PacketNum: h.PacketNum,
+			Operation: op,
+		})
+		resp.Write(respHeader)
+		resp.Write(respPayload)
+		if _, err := conn.Write(resp.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func fakeStatus(code uint64) (opcode, []byte, []byte) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, code)
+	return status, b, nil
+}
+
+func fakeU64(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i*8:])
+}
+
+func fakeStrings(b []byte) []string {
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+}
+
+const fakeData opcode = 0x00000002
+
+func (d *fakeDevice) handle(op opcode, hp []byte, payload []byte) (opcode, []byte, []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch op {
+	case readDir:
+		p := fakeClean(string(hp))
+		n, ok := d.nodes[p]
+		if !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		if !n.dir {
+			return fakeStatus(errInvalidArgument)
+		}
+		names := []string{".", ".."}
+		for candidate := range d.nodes {
+			if candidate != "/" && path.Dir(candidate) == p {
+				names = append(names, path.Base(candidate))
+			}
+		}
+		sort.Strings(names[2:])
+		return fakeData, nil, []byte(strings.Join(names, "\x00") + "\x00")
+	case fileInfo:
+		if code, ok := d.statErrors[fakeClean(string(hp))]; ok {
+			return fakeStatus(code)
+		}
+		n, ok := d.nodes[fakeClean(string(hp))]
+		if !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		ifmt, mode := "S_IFREG", "644"
+		if n.dir {
+			ifmt, mode = "S_IFDIR", "755"
+		} else if n.link != "" {
+			ifmt = "S_IFLNK"
+		}
+		info := fmt.Sprintf("st_size\x00%d\x00st_ifmt\x00%s\x00st_mode\x00%s\x00st_mtime\x00%d\x00", len(n.data), ifmt, mode, n.mtime.UnixNano())
+		if n.link != "" {
+			info += fmt.Sprintf("st_linktarget\x00%s\x00", n.link)
+		}
+		return fakeData, nil, []byte(info)
+	case deviceInfo:
+		return fakeData, nil, []byte("Model\x00iPhone\x00FSTotalBytes\x001000\x00FSFreeBytes\x00500\x00FSBlockSize\x004096\x00")
+	case makeDir:
+		p := fakeClean(string(hp))
+		if _, ok := d.nodes[path.Dir(p)]; !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		if _, ok := d.nodes[p]; !ok {
+			d.nodes[p] = &fakeNode{dir: true, mtime: time.Now()}
+		}
+		return fakeStatus(errSuccess)
+	case removePath, removePathAndContents:
+		p := fakeClean(string(hp))
+		if _, ok := d.nodes[p]; !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		for candidate := range d.nodes {
+			if strings.HasPrefix(candidate, p+"/") {
+				if op == removePath {
+					return fakeStatus(errDirNotEmpty)
+				}
+				delete(d.nodes, candidate)
+			}
+		}
+		delete(d.nodes, p)
+		return fakeStatus(errSuccess)
+	case renamePath:
+		parts := fakeStrings(hp)
+		from, to := fakeClean(parts[0]), fakeClean(parts[1])
+		if _, ok := d.nodes[from]; !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		for candidate, n := range d.nodes {
+			if candidate == from || strings.HasPrefix(candidate, from+"/") {
+				delete(d.nodes, candidate)
+				d.nodes[to+strings.TrimPrefix(candidate, from)] = n
+			}
+		}
+		return fakeStatus(errSuccess)
+	case makeLink:
+		parts := fakeStrings(hp[8:])
+		link := fakeClean(parts[1])
+		if fakeU64(hp, 0) == uint64(SYMLINK) {
+			d.nodes[link] = &fakeNode{link: parts[0], mtime: time.Now()}
+			return fakeStatus(errSuccess)
+		}
+		target, ok := d.nodes[fakeClean(parts[0])]
+		if !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		d.nodes[link] = target
+		return fakeStatus(errSuccess)
+	case truncatePath:
+		n, ok := d.nodes[fakeClean(string(hp[8:]))]
+		if !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		n.data = resize(n.data, int64(fakeU64(hp, 0)))
+		return fakeStatus(errSuccess)
+	case setFileModTime:
+		n, ok := d.nodes[fakeClean(string(hp[8:]))]
+		if !ok {
+			return fakeStatus(errObjectNotFound)
+		}
+		n.mtime = time.Unix(0, int64(fakeU64(hp, 0)))
+		return fakeStatus(errSuccess)
+	case fileOpen:
+		mode := Mode(fakeU64(hp, 0))
+		p := fakeClean(string(hp[8:]))
+		n, ok := d.nodes[p]
+		switch mode {
+		case READ_ONLY, READ_WRITE_CREATE:
+			if !ok {
+				return fakeStatus(errObjectNotFound)
+			}
+		default:
+			if _, parentOk := d.nodes[path.Dir(p)]; !parentOk {
+				return fakeStatus(errObjectNotFound)
+			}
+			if !ok {
+				n = &fakeNode{mtime: time.Now()}
+				d.nodes[p] = n
+			}
+		}
+		if n.dir {
+			return fakeStatus(errObjectIsDir)
+		}
+		if mode == WRITE_ONLY_CREATE_TRUNC || mode == READ_WRITE_CREATE_TRUNC {
+			n.data = nil
+		}
+		d.nextHandle++
+		d.handles[d.nextHandle] = &fakeHandle{
+			path:   p,
+			append: mode == WRITE_ONLY_CREATE_APPEND || mode == READ_WRITE_CREATE_APPEND,
+		}
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, d.nextHandle)
+		return fileOpenResult, b, nil
+	}
+
+	// all remaining operations work on an open file handle
+	fh, ok := d.handles[fakeU64(hp, 0)]
+	if !ok {
+		return fakeStatus(errInvalidArgument)
+	}
+	n, ok := d.nodes[fh.path]
+	if !ok {
+		return fakeStatus(errObjectNotFound)
+	}
+	switch op {
+	case fileRead:
+		length := int64(fakeU64(hp, 1))
+		if fh.pos >= int64(len(n.data)) {
+			return fakeData, nil, nil
+		}
+		end := min(fh.pos+length, int64(len(n.data)))
+		chunk := n.data[fh.pos:end]
+		fh.pos = end
+		return fakeData, nil, chunk
+	case fileWrite:
+		if fh.append {
+			fh.pos = int64(len(n.data))
+		}
+		end := fh.pos + int64(len(payload))
+		if end > int64(len(n.data)) {
+			n.data = resize(n.data, end)
+		}
+		copy(n.data[fh.pos:], payload)
+		fh.pos = end
+		n.mtime = time.Now()
+		return fakeStatus(errSuccess)
+	case fileSeek:
+		offset := int64(fakeU64(hp, 2))
+		switch int(fakeU64(hp, 1)) {
+		case io.SeekStart:
+			fh.pos = offset
+		case io.SeekCurrent:
+			fh.pos += offset
+		case io.SeekEnd:
+			fh.pos = int64(len(n.data)) + offset
+		}
+		return fakeStatus(errSuccess)
+	case fileTell:
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(fh.pos))
+		return fileTellResult, b, nil
+	case fileSetSize:
+		n.data = resize(n.data, int64(fakeU64(hp, 1)))
+		return fakeStatus(errSuccess)
+	case fileLock:
+		return fakeStatus(errSuccess)
+	case fileClose:
+		delete(d.handles, fakeU64(hp, 0))
+		return fakeStatus(errSuccess)
+	}
+	return fakeStatus(errOperationNotSupported)
+}
+
+func resize(b []byte, size int64) []byte {
+	if size <= int64(len(b)) {
+		return b[:size]
+	}
+	return append(b, make([]byte, size-int64(len(b)))...)
+}
@@ -0,0 +1,410 @@
+package afc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// FS exposes the filesystem of an AFC client as an [io/fs.FS].
+// Besides [fs.FS] it implements [fs.ReadDirFS], [fs.StatFS], [fs.ReadFileFS] and [fs.ReadLinkFS],
+// so all helpers of the standard library like [fs.WalkDir], [fs.Glob] or [fs.Sub] work against a device.
+// It also implements [WriteFS] for modifying files.
+//
+// Names passed to FS follow the [fs.ValidPath] rules and are resolved relative to the root
+// the FS was created with. FS is not safe for concurrent use, just like the underlying [Client].
+type FS struct {
+	client *Client
+	root   string
+}
+
+// WriteFS is a filesystem that allows modifications on top of reading files
+type WriteFS interface {
+	fs.FS
+	// OpenFile opens the named file with the given os.O_* flags.
+	// perm is used as file mode hint only, AFC does not allow setting permissions
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+	// Mkdir creates the named directory
+	Mkdir(name string, perm fs.FileMode) error
+	// Remove deletes the named file or empty directory
+	Remove(name string) error
+	// RemoveAll deletes the named path and everything it contains
+	RemoveAll(name string) error
+	// Rename moves oldname to newname
+	Rename(oldname, newname string) error
+}
+
+// WritableFile is an open file of a [WriteFS] that can be written to
+type WritableFile interface {
+	fs.File
+	io.Writer
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.ReadLinkFS = (*FS)(nil)
+	_ WriteFS       = (*FS)(nil)
+)
+
+// NewFS creates an [FS] for the client. All names are resolved relative to root,
+// for example "/" for the media partition or "/Documents" for an app container
+func NewFS(c *Client, root string) *FS {
+	if root == "" {
+		root = "/"
+	}
+	return &FS{
+		client: c,
+		root:   root,
+	}
+}
+
+// WriteFile writes data to the named file of fsys, creating it if necessary
+// and truncating it otherwise
+func WriteFile(fsys WriteFS, name string, data []byte) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (f *FS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(f.root, name), nil
+}
+
+// Open opens the named file for reading
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	if info.IsDir() {
+		return &fsDir{fsys: f, name: name, info: info}, nil
+	}
+	p, _ := f.resolve("open", name)
+	file, err := f.client.Open(p, READ_ONLY)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{File: file, info: info}, nil
+}
+
+// OpenFile opens the named file with the given os.O_* flags. Directories can only be opened read-only
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	p, err := f.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := f.Stat(name)
+	exists := statErr == nil
+	if statErr != nil && !errors.Is(statErr, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(statErr)}
+	}
+	if exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	if !exists && flag&os.O_CREATE == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if exists && info.IsDir() {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		return &fsDir{fsys: f, name: name, info: info}, nil
+	}
+
+	file, err := f.client.Open(p, openMode(flag, exists))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !exists {
+		info = fsFileInfo{info: FileInfo{Name: path.Base(name), Type: S_IFREG, Mode: uint32(perm.Perm()), ModTime: time.Now()}}
+	}
+	return &fsFile{File: file, info: info}, nil
+}
+
+// openMode maps os.O_* flags to the closest AFC open mode.
+// AFC has no mode that creates a file without truncating or appending, so a
+// missing file is created by opening it with truncation instead.
+func openMode(flag int, exists bool) Mode {
+	readWrite := flag&os.O_RDWR != 0
+	switch {
+	case flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return READ_ONLY
+	case flag&os.O_APPEND != 0:
+		if readWrite {
+			return READ_WRITE_CREATE_APPEND
+		}
+		return WRITE_ONLY_CREATE_APPEND
+	case flag&os.O_TRUNC != 0 || !exists:
+		if readWrite {
+			return READ_WRITE_CREATE_TRUNC
+		}
+		return WRITE_ONLY_CREATE_TRUNC
+	default:
+		return READ_WRITE_CREATE
+	}
+}
+
+// Stat returns information about the named file, following symbolic links
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	p, err := f.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.client.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if info.IsLink() {
+		target := info.LinkTarget
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		info, err = f.client.Stat(target)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+	}
+	info.Name = path.Base(name)
+	return fsFileInfo{info: info}, nil
+}
+
+// Lstat returns information about the named file without following symbolic links
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := f.resolve("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.client.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	info.Name = path.Base(name)
+	return fsFileInfo{info: info}, nil
+}
+
+// ReadLink returns the destination of the named symbolic link
+func (f *FS) ReadLink(name string) (string, error) {
+	p, err := f.resolve("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	info, err := f.client.Stat(p)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if !info.IsLink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return info.LinkTarget, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename.
+// Entries that cannot be stat'ed are reported in the returned error together with
+// all other entries, like os.ReadDir does.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := f.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.client.List(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	slices.Sort(names)
+	entries := make([]fs.DirEntry, 0, len(names))
+	var errs []error
+	for _, n := range names {
+		info, err := f.Lstat(path.Join(name, n))
+		if err != nil {
+			// like os.ReadDir, entries removed since listing the directory are left out
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			errs = append(errs, err)
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	if len(errs) > 0 {
+		return entries, &fs.PathError{Op: "readdir", Path: name, Err: errors.Join(errs...)}
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, ok := file.(*fsDir); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Mkdir creates the named directory
+func (f *FS) Mkdir(name string, _ fs.FileMode) error {
+	p, err := f.resolve("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := f.client.MkDir(p); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Remove deletes the named file or empty directory
+func (f *FS) Remove(name string) error {
+	p, err := f.resolve("remove", name)
+	if err != nil {
+		return err
+	}
+	if err := f.client.Remove(p); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// RemoveAll deletes the named path and everything it contains
+func (f *FS) RemoveAll(name string) error {
+	p, err := f.resolve("removeall", name)
+	if err != nil {
+		return err
+	}
+	if err := f.client.RemoveAll(p); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename moves oldname to newname
+func (f *FS) Rename(oldname, newname string) error {
+	oldPath, err := f.resolve("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newPath, err := f.resolve("rename", newname)
+	if err != nil {
+		return err
+	}
+	if err := f.client.Rename(oldPath, newPath); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fmt.Errorf("to %s: %w", newname, err)}
+	}
+	return nil
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// fsFileInfo implements [fs.FileInfo] for an AFC [FileInfo]
+type fsFileInfo struct {
+	info FileInfo
+}
+
+func (i fsFileInfo) Name() string       { return i.info.Name }
+func (i fsFileInfo) Size() int64        { return i.info.Size }
+func (i fsFileInfo) ModTime() time.Time { return i.info.ModTime }
+func (i fsFileInfo) IsDir() bool        { return i.info.IsDir() }
+
+// Sys returns the underlying AFC [FileInfo]
+func (i fsFileInfo) Sys() any { return i.info }
+
+func (i fsFileInfo) Mode() fs.FileMode {
+	mode := fs.FileMode(i.info.Mode).Perm()
+	switch i.info.Type {
+	case S_IFDIR:
+		mode |= fs.ModeDir
+	case S_IFLNK:
+		mode |= fs.ModeSymlink
+	}
+	return mode
+}
+
+// fsFile is a regular file opened through [FS]
+type fsFile struct {
+	*File
+	info fs.FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDir is a directory opened through [FS]
+type fsDir struct {
+	fsys    *FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements [fs.ReadDirFile]
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,112 @@
+package afc
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFS(t *testing.T) (*FS, *fakeDevice) {
+	device := newFakeDevice()
+	mtime := time.Unix(1700000000, 0)
+	device.put("/hello.txt", "hello world", mtime)
+	device.put("/Documents/notes.md", "# notes", mtime)
+	device.put("/Documents/data/db.sqlite", "sqlite", mtime)
+	device.put("/Library/Preferences/app.plist", "<plist/>", mtime)
+	return NewFS(device.newClient(t), "/"), device
+}
+
+func TestFSConformsToIOFS(t *testing.T) {
+	fsys, _ := newTestFS(t)
+
+	err := fstest.TestFS(fsys, "hello.txt", "Documents/notes.md", "Documents/data/db.sqlite", "Library/Preferences/app.plist")
+	assert.NoError(t, err)
+}
+
+func TestFSSubAndGlob(t *testing.T) {
+	fsys, _ := newTestFS(t)
+
+	docs, err := fs.Sub(fsys, "Documents")
+	require.NoError(t, err)
+	content, err := fs.ReadFile(docs, "notes.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# notes", string(content))
+
+	matches, err := fs.Glob(fsys, "*/*.md")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Documents/notes.md"}, matches)
+}
+
+func TestFSErrorsMatchSentinels(t *testing.T) {
+	fsys, _ := newTestFS(t)
+
+	_, err := fsys.Stat("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "got %v", err)
+
+	_, err = fsys.Open("../escape")
+	assert.True(t, errors.Is(err, fs.ErrInvalid), "got %v", err)
+
+	_, err = fsys.OpenFile("hello.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	assert.True(t, errors.Is(err, fs.ErrExist), "got %v", err)
+}
+
+func TestFSReadDirReportsStatErrors(t *testing.T) {
+	fsys, device := newTestFS(t)
+	device.put("/Documents/secret.db", "secret", time.Unix(1700000000, 0))
+	device.statErrors["/Documents/secret.db"] = errPermDenied
+
+	entries, err := fsys.ReadDir("Documents")
+	assert.True(t, errors.Is(err, fs.ErrPermission), "got %v", err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "data", entries[0].Name())
+	assert.Equal(t, "notes.md", entries[1].Name())
+}
+
+func TestFSWrite(t *testing.T) {
+	fsys, device := newTestFS(t)
+
+	require.NoError(t, fsys.Mkdir("tmp", 0o755))
+	require.NoError(t, WriteFile(fsys, "tmp/new.txt", []byte("fixture")))
+	require.NoError(t, fsys.Rename("tmp/new.txt", "tmp/renamed.txt"))
+
+	content, err := fsys.ReadFile("tmp/renamed.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "fixture", string(content))
+
+	f, err := fsys.OpenFile("tmp/renamed.txt", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("-appended"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	node, _ := device.get("/tmp/renamed.txt")
+	assert.Equal(t, "fixture-appended", string(node.data))
+
+	require.NoError(t, fsys.RemoveAll("tmp"))
+	_, err = fsys.Stat("tmp")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "got %v", err)
+}
+
+func TestOpenMode(t *testing.T) {
+	testCases := []struct {
+		flag   int
+		exists bool
+		want   Mode
+	}{
+		{flag: os.O_RDONLY, exists: true, want: READ_ONLY},
+		{flag: os.O_WRONLY | os.O_CREATE | os.O_TRUNC, exists: true, want: WRITE_ONLY_CREATE_TRUNC},
+		{flag: os.O_RDWR | os.O_CREATE | os.O_TRUNC, exists: false, want: READ_WRITE_CREATE_TRUNC},
+		{flag: os.O_WRONLY | os.O_APPEND, exists: true, want: WRITE_ONLY_CREATE_APPEND},
+		{flag: os.O_RDWR | os.O_APPEND, exists: true, want: READ_WRITE_CREATE_APPEND},
+		{flag: os.O_RDWR, exists: true, want: READ_WRITE_CREATE},
+		{flag: os.O_WRONLY | os.O_CREATE, exists: false, want: WRITE_ONLY_CREATE_TRUNC},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.want, openMode(testCase.flag, testCase.exists), "flag %#x exists %t", testCase.flag, testCase.exists)
+	}
+}
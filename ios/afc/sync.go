@@ -0,0 +1,746 @@
+package afc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+const logModule = "go-ios/afc"
+
+// SyncEventType describes what a [SyncEvent] reports
+type SyncEventType string
+
+const (
+	SyncEventSkip     SyncEventType = "skip"
+	SyncEventStart    SyncEventType = "start"
+	SyncEventResume   SyncEventType = "resume"
+	SyncEventProgress SyncEventType = "progress"
+	SyncEventDone     SyncEventType = "done"
+	SyncEventVerified SyncEventType = "verified"
+	SyncEventDelete   SyncEventType = "delete"
+)
+
+// SyncEvent reports the progress of a single file during [Client.SyncPush] or [Client.SyncPull]
+type SyncEvent struct {
+	Type SyncEventType `json:"type"`
+	// Path is the slash separated path relative to the synced directory
+	Path string `json:"path"`
+	// Bytes is the number of bytes of the file present on the destination
+	Bytes int64 `json:"bytes"`
+	// Total is the size of the source file
+	Total int64 `json:"total"`
+}
+
+// SyncOptions configures [Client.SyncPush] and [Client.SyncPull]
+type SyncOptions struct {
+	// Parallel is the number of files transferred at the same time. Every transfer
+	// needs its own AFC connection, so NewClient must be set to use more than one.
+	Parallel int
+	// NewClient opens an additional AFC connection to the same service as the client the sync was started on
+	NewClient func() (*Client, error)
+	// Delete removes files and directories on the destination that do not exist on the source
+	Delete bool
+	// Verify reads back every transferred file and compares its SHA-256 with the source
+	Verify bool
+	// Progress is called for every SyncEvent, it must be safe for concurrent use if Parallel > 1
+	Progress func(SyncEvent)
+}
+
+// SyncResult summarizes a finished sync
+type SyncResult struct {
+	Transferred int   `json:"transferred"`
+	Skipped     int   `json:"skipped"`
+	Deleted     int   `json:"deleted"`
+	Bytes       int64 `json:"bytes"`
+}
+
+const (
+	partialSuffix = ".partial"
+	// resumeCheckSize is the number of bytes at the end of a partial file compared with
+	// the source before a transfer is resumed instead of restarted
+	resumeCheckSize    = 64 * 1024
+	progressInterval   = 4 * 1024 * 1024
+	syncTransferBuffer = 1024 * 1024
+)
+
+// SyncPush makes dstPath on the device a copy of the local srcPath, like rsync.
+// Files with the same size and modification time as the source are skipped.
+// Files are written to a hidden partial file that is renamed once complete, so an
+// interrupted sync resumes where it stopped. If srcPath is a directory, its contents
+// are synced into dstPath. If srcPath is a file and dstPath an existing directory,
+// the file is synced into dstPath.
+func (c *Client) SyncPush(srcPath, dstPath string, opts SyncOptions) (SyncResult, error) {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	src := localTree{root: srcPath}
+	dst := &deviceTree{client: c, root: dstPath, newClient: opts.NewClient}
+	if !info.IsDir() {
+		src = localTree{root: filepath.Dir(srcPath), file: filepath.Base(srcPath)}
+		if dstInfo, err := c.Stat(dstPath); err == nil && dstInfo.IsDir() {
+			dstPath = path.Join(dstPath, filepath.Base(srcPath))
+		}
+		dst.root, dst.file = path.Dir(dstPath), path.Base(dstPath)
+	}
+	return runSync(src, dst, opts)
+}
+
+// SyncPull makes the local dstPath a copy of srcPath on the device, like rsync.
+// It behaves like [Client.SyncPush] in the other direction. Device supplied names
+// are checked so no file is written outside of dstPath.
+func (c *Client) SyncPull(srcPath, dstPath string, opts SyncOptions) (SyncResult, error) {
+	info, err := c.Stat(srcPath)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	src := &deviceTree{client: c, root: srcPath, newClient: opts.NewClient}
+	dst := localTree{root: dstPath}
+	if !info.IsDir() {
+		src.root, src.file = path.Dir(srcPath), path.Base(srcPath)
+		if dstInfo, err := os.Stat(dstPath); err == nil && dstInfo.IsDir() {
+			dstPath = filepath.Join(dstPath, path.Base(srcPath))
+		}
+		dst = localTree{root: filepath.Dir(dstPath), file: filepath.Base(dstPath)}
+	}
+	return runSync(src, dst, opts)
+}
+
+// syncEntry describes a file or directory of a synced tree
+type syncEntry struct {
+	dir   bool
+	size  int64
+	mtime time.Time
+}
+
+func (e syncEntry) sameContentAs(other syncEntry) bool {
+	return e.size == other.size && e.mtime.Unix() == other.mtime.Unix()
+}
+
+// syncTree abstracts the local filesystem and the device for runSync.
+// Paths are slash separated and relative to the root of the tree, "" is the root itself.
+// A tree can also consist of a single file, then "" is that file and partialSuffix its partial file.
+type syncTree interface {
+	list() (map[string]syncEntry, error)
+	mkdir(rel string) error
+	open(rel string, offset int64) (io.ReadCloser, error)
+	// create opens rel for writing. If offset is 0 the file is truncated, otherwise
+	// writes are appended to the first offset bytes of the existing file.
+	create(rel string, offset int64) (io.WriteCloser, error)
+	rename(from, to string) error
+	setModTime(rel string, t time.Time) error
+	remove(rel string, recursive bool) error
+	// fork returns a tree that can be used concurrently with the original one
+	fork() (syncTree, io.Closer, error)
+}
+
+func partialPath(rel string, rootIsFile bool) string {
+	if rel == "" && rootIsFile {
+		return partialSuffix
+	}
+	dir, base := path.Split(rel)
+	return dir + "." + base + partialSuffix
+}
+
+func runSync(src, dst syncTree, opts SyncOptions) (SyncResult, error) {
+	var result SyncResult
+	emit := func(e SyncEvent) {
+		if opts.Progress != nil {
+			opts.Progress(e)
+		}
+	}
+
+	srcEntries, err := src.list()
+	if err != nil {
+		return result, fmt.Errorf("sync: listing source failed: %w", err)
+	}
+	dstEntries, err := dst.list()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return result, fmt.Errorf("sync: listing destination failed: %w", err)
+	}
+	if dstEntries == nil {
+		dstEntries = map[string]syncEntry{}
+	}
+	rootIsFile := false
+	if root, ok := srcEntries[""]; ok && !root.dir {
+		rootIsFile = true
+		// the partial file of a single file source is never synced
+		delete(srcEntries, partialSuffix)
+	}
+
+	paths := make([]string, 0, len(srcEntries))
+	for p := range srcEntries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var files []string
+	for _, p := range paths {
+		entry := srcEntries[p]
+		existing, exists := dstEntries[p]
+		if entry.dir {
+			if exists && existing.dir {
+				continue
+			}
+			if exists {
+				if err := dst.remove(p, true); err != nil {
+					return result, fmt.Errorf("sync: replacing %s with a directory failed: %w", p, err)
+				}
+			}
+			if err := dst.mkdir(p); err != nil {
+				return result, fmt.Errorf("sync: creating directory %s failed: %w", p, err)
+			}
+			continue
+		}
+		if exists && !existing.dir && existing.sameContentAs(entry) {
+			result.Skipped++
+			emit(SyncEvent{Type: SyncEventSkip, Path: p, Bytes: existing.size, Total: entry.size})
+			continue
+		}
+		if exists && existing.dir {
+			if err := dst.remove(p, true); err != nil {
+				return result, fmt.Errorf("sync: replacing directory %s with a file failed: %w", p, err)
+			}
+		}
+		files = append(files, p)
+	}
+
+	workers := opts.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	pool := []syncWorker{{src: src, dst: dst}}
+	for len(pool) < workers {
+		w, err := forkWorker(src, dst)
+		if err != nil {
+			golog.Warn("sync: opening parallel connection failed, continuing with fewer workers", "module", logModule, "workers", len(pool), "err", err)
+			break
+		}
+		pool = append(pool, w)
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, w := range pool {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer w.close()
+			for p := range jobs {
+				partial, hasPartial := dstEntries[partialPath(p, rootIsFile)]
+				n, err := transferFile(w.src, w.dst, p, srcEntries[p], partial, hasPartial, rootIsFile, opts.Verify, emit)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					result.Transferred++
+					result.Bytes += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, p := range files {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return result, firstErr
+	}
+
+	if opts.Delete && !rootIsFile {
+		// the partial files of the transferred files were renamed to the files already
+		renamed := make(map[string]bool, len(files))
+		for _, p := range files {
+			renamed[partialPath(p, rootIsFile)] = true
+		}
+		extraneous := make([]string, 0)
+		for p := range dstEntries {
+			if _, ok := srcEntries[p]; ok || p == "" || renamed[p] {
+				continue
+			}
+			extraneous = append(extraneous, p)
+		}
+		sort.Strings(extraneous)
+		deleted := map[string]bool{}
+		for _, p := range extraneous {
+			if deleted[path.Dir(p)] {
+				deleted[p] = true
+				continue
+			}
+			if err := dst.remove(p, dstEntries[p].dir); err != nil {
+				return result, fmt.Errorf("sync: deleting %s failed: %w", p, err)
+			}
+			deleted[p] = true
+			result.Deleted++
+			emit(SyncEvent{Type: SyncEventDelete, Path: p})
+		}
+	}
+	return result, nil
+}
+
+// syncWorker holds the trees one transfer goroutine works on
+type syncWorker struct {
+	src, dst syncTree
+	closers  []io.Closer
+}
+
+func (w syncWorker) close() {
+	for _, closer := range w.closers {
+		closer.Close()
+	}
+}
+
+// forkWorker opens the connections for an additional transfer goroutine
+func forkWorker(src, dst syncTree) (syncWorker, error) {
+	forkedSrc, srcCloser, err := src.fork()
+	if err != nil {
+		return syncWorker{}, err
+	}
+	forkedDst, dstCloser, err := dst.fork()
+	if err != nil {
+		srcCloser.Close()
+		return syncWorker{}, err
+	}
+	return syncWorker{src: forkedSrc, dst: forkedDst, closers: []io.Closer{srcCloser, dstCloser}}, nil
+}
+
+// transferFile copies a single file through a partial file and returns the number of bytes sent
+func transferFile(src, dst syncTree, p string, entry syncEntry, partial syncEntry, hasPartial bool, rootIsFile bool, verify bool, emit func(SyncEvent)) (int64, error) {
+	partialName := partialPath(p, rootIsFile)
+	offset := int64(0)
+	if hasPartial && !partial.dir && partial.size > 0 && partial.size <= entry.size {
+		ok, err := partialMatches(src, dst, p, partialName, partial.size)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			offset = partial.size
+		}
+	}
+	if offset > 0 {
+		emit(SyncEvent{Type: SyncEventResume, Path: p, Bytes: offset, Total: entry.size})
+	} else {
+		emit(SyncEvent{Type: SyncEventStart, Path: p, Total: entry.size})
+	}
+
+	reader, err := src.open(p, offset)
+	if err != nil {
+		return 0, fmt.Errorf("sync: opening %s failed: %w", p, err)
+	}
+	defer reader.Close()
+	writer, err := dst.create(partialName, offset)
+	if err != nil {
+		return 0, fmt.Errorf("sync: creating %s failed: %w", partialName, err)
+	}
+	progress := &progressWriter{
+		w:      writer,
+		offset: offset,
+		emit: func(n int64) {
+			emit(SyncEvent{Type: SyncEventProgress, Path: p, Bytes: n, Total: entry.size})
+		},
+	}
+	n, err := io.CopyBuffer(progress, reader, make([]byte, syncTransferBuffer))
+	closeErr := writer.Close()
+	if err != nil {
+		return n, fmt.Errorf("sync: transferring %s failed: %w", p, err)
+	}
+	if closeErr != nil {
+		return n, fmt.Errorf("sync: closing %s failed: %w", partialName, closeErr)
+	}
+	if err := dst.rename(partialName, p); err != nil {
+		return n, fmt.Errorf("sync: renaming %s failed: %w", partialName, err)
+	}
+	if err := dst.setModTime(p, entry.mtime); err != nil {
+		return n, fmt.Errorf("sync: setting modification time of %s failed: %w", p, err)
+	}
+	emit(SyncEvent{Type: SyncEventDone, Path: p, Bytes: entry.size, Total: entry.size})
+
+	if verify {
+		if err := verifyFile(src, dst, p); err != nil {
+			return n, err
+		}
+		emit(SyncEvent{Type: SyncEventVerified, Path: p, Bytes: entry.size, Total: entry.size})
+	}
+	return n, nil
+}
+
+// partialMatches compares the end of a partial file with the same range of the source
+func partialMatches(src, dst syncTree, p, partialName string, size int64) (bool, error) {
+	checkFrom := max(size-resumeCheckSize, 0)
+	srcTail, err := readRange(src, p, checkFrom, size-checkFrom)
+	if err != nil {
+		return false, fmt.Errorf("sync: reading %s failed: %w", p, err)
+	}
+	dstTail, err := readRange(dst, partialName, checkFrom, size-checkFrom)
+	if err != nil {
+		return false, fmt.Errorf("sync: reading %s failed: %w", partialName, err)
+	}
+	return bytes.Equal(srcTail, dstTail), nil
+}
+
+func readRange(tree syncTree, p string, offset, length int64) ([]byte, error) {
+	r, err := tree.open(p, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	return buf, err
+}
+
+func verifyFile(src, dst syncTree, p string) error {
+	srcHash, err := hashFile(src, p)
+	if err != nil {
+		return fmt.Errorf("sync: verifying %s failed: %w", p, err)
+	}
+	dstHash, err := hashFile(dst, p)
+	if err != nil {
+		return fmt.Errorf("sync: verifying %s failed: %w", p, err)
+	}
+	if !bytes.Equal(srcHash, dstHash) {
+		return fmt.Errorf("sync: verifying %s failed: checksum mismatch %x != %x", p, srcHash, dstHash)
+	}
+	return nil
+}
+
+func hashFile(tree syncTree, p string) ([]byte, error) {
+	r, err := tree.open(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.CopyBuffer(h, r, make([]byte, syncTransferBuffer)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// progressWriter reports the number of written bytes every progressInterval bytes
+type progressWriter struct {
+	w        io.Writer
+	offset   int64
+	reported int64
+	emit     func(int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	if p.offset-p.reported >= progressInterval {
+		p.reported = p.offset
+		p.emit(p.offset)
+	}
+	return n, err
+}
+
+// localTree is a syncTree on the host filesystem
+type localTree struct {
+	root string
+	// file restricts the tree to a single file in root
+	file string
+}
+
+func (l localTree) resolve(rel string) (string, error) {
+	if l.file != "" {
+		switch rel {
+		case "":
+			return filepath.Join(l.root, l.file), nil
+		case partialSuffix:
+			return filepath.Join(l.root, "."+l.file+partialSuffix), nil
+		}
+		return "", fmt.Errorf("afc: %q is not part of %q", rel, l.file)
+	}
+	if rel == "" {
+		return l.root, nil
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if unsafeEntryName(part) {
+			return "", fmt.Errorf("afc: refusing to use unsafe path %q under %q", rel, l.root)
+		}
+	}
+	p := filepath.Join(l.root, filepath.FromSlash(rel))
+	if !containedIn(l.root, p) {
+		return "", fmt.Errorf("afc: refusing to use %q outside destination %q", p, l.root)
+	}
+	return p, nil
+}
+
+func (l localTree) list() (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	if l.file != "" {
+		for _, rel := range []string{"", partialSuffix} {
+			p, _ := l.resolve(rel)
+			info, err := os.Stat(p)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entries[rel] = syncEntry{dir: info.IsDir(), size: info.Size(), mtime: info.ModTime()}
+		}
+		return entries, nil
+	}
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		entries[rel] = syncEntry{dir: d.IsDir(), size: info.Size(), mtime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (l localTree) mkdir(rel string) error {
+	p, err := l.resolve(rel)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, os.ModePerm)
+}
+
+func (l localTree) open(rel string, offset int64) (io.ReadCloser, error) {
+	p, err := l.resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l localTree) create(rel string, offset int64) (io.WriteCloser, error) {
+	p, err := l.resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 {
+		return os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l localTree) rename(from, to string) error {
+	fromPath, err := l.resolve(from)
+	if err != nil {
+		return err
+	}
+	toPath, err := l.resolve(to)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+func (l localTree) setModTime(rel string, t time.Time) error {
+	p, err := l.resolve(rel)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, t, t)
+}
+
+func (l localTree) remove(rel string, recursive bool) error {
+	p, err := l.resolve(rel)
+	if err != nil {
+		return err
+	}
+	if recursive {
+		return os.RemoveAll(p)
+	}
+	return os.Remove(p)
+}
+
+func (l localTree) fork() (syncTree, io.Closer, error) {
+	return l, io.NopCloser(nil), nil
+}
+
+// deviceTree is a syncTree on the device
+type deviceTree struct {
+	client *Client
+	root   string
+	// file restricts the tree to a single file in root
+	file      string
+	newClient func() (*Client, error)
+}
+
+func (d *deviceTree) resolve(rel string) string {
+	if d.file != "" {
+		if rel == partialSuffix {
+			return path.Join(d.root, "."+d.file+partialSuffix)
+		}
+		return path.Join(d.root, d.file)
+	}
+	if rel == "" {
+		return d.root
+	}
+	return path.Join(d.root, rel)
+}
+
+func (d *deviceTree) list() (map[string]syncEntry, error) {
+	if d.file != "" {
+		entries := map[string]syncEntry{}
+		for _, rel := range []string{"", partialSuffix} {
+			info, err := d.client.Stat(d.resolve(rel))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entries[rel] = syncEntry{dir: info.IsDir(), size: info.Size, mtime: info.ModTime}
+		}
+		return entries, nil
+	}
+	info, err := d.client.Stat(d.root)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]syncEntry{
+		"": {dir: info.IsDir(), size: info.Size, mtime: info.ModTime},
+	}
+	if !info.IsDir() {
+		return entries, nil
+	}
+	err = d.client.WalkDir(d.root, func(p string, info FileInfo, err error) error {
+		if info.IsLink() {
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, d.root), "/")
+		entries[rel] = syncEntry{dir: info.IsDir(), size: info.Size, mtime: info.ModTime}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (d *deviceTree) mkdir(rel string) error {
+	return d.client.MkDir(d.resolve(rel))
+}
+
+func (d *deviceTree) open(rel string, offset int64) (io.ReadCloser, error) {
+	f, err := d.client.Open(d.resolve(rel), READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (d *deviceTree) create(rel string, offset int64) (io.WriteCloser, error) {
+	if offset == 0 {
+		return d.client.Open(d.resolve(rel), WRITE_ONLY_CREATE_TRUNC)
+	}
+	f, err := d.client.Open(d.resolve(rel), READ_WRITE_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *deviceTree) rename(from, to string) error {
+	return d.client.Rename(d.resolve(from), d.resolve(to))
+}
+
+func (d *deviceTree) setModTime(rel string, t time.Time) error {
+	return d.client.SetModTime(d.resolve(rel), t)
+}
+
+func (d *deviceTree) remove(rel string, recursive bool) error {
+	if recursive {
+		return d.client.RemoveAll(d.resolve(rel))
+	}
+	return d.client.Remove(d.resolve(rel))
+}
+
+func (d *deviceTree) fork() (syncTree, io.Closer, error) {
+	if d.newClient == nil {
+		return nil, nil, errors.New("parallel sync needs SyncOptions.NewClient")
+	}
+	c, err := d.newClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &deviceTree{client: c, root: d.root, file: d.file, newClient: d.newClient}, c, nil
+}
@@ -0,0 +1,183 @@
+package afc
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []SyncEvent
+}
+
+func (r *eventRecorder) record(e SyncEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) paths(eventType SyncEventType) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var paths []string
+	for _, e := range r.events {
+		if e.Type == eventType {
+			paths = append(paths, e.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func writeLocal(t *testing.T, p, content string, mtime time.Time) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	require.NoError(t, os.Chtimes(p, mtime, mtime))
+}
+
+func TestSyncPushSkipsUnchangedFiles(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	src := t.TempDir()
+	mtime := time.Unix(1700000000, 0)
+	writeLocal(t, filepath.Join(src, "a.txt"), "alpha", mtime)
+	writeLocal(t, filepath.Join(src, "sub", "b.txt"), "beta", mtime)
+
+	result, err := client.SyncPush(src, "/Documents", SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SyncResult{Transferred: 2, Bytes: 9}, result)
+	node, ok := device.get("/Documents/sub/b.txt")
+	require.True(t, ok)
+	assert.Equal(t, "beta", string(node.data))
+	assert.True(t, node.mtime.Equal(mtime), "mtime %v", node.mtime)
+
+	writeLocal(t, filepath.Join(src, "a.txt"), "changed", mtime.Add(time.Hour))
+	recorder := &eventRecorder{}
+	result, err = client.SyncPush(src, "/Documents", SyncOptions{Progress: recorder.record})
+	require.NoError(t, err)
+	assert.Equal(t, SyncResult{Transferred: 1, Skipped: 1, Bytes: 7}, result)
+	assert.Equal(t, []string{"sub/b.txt"}, recorder.paths(SyncEventSkip))
+	assert.Equal(t, []string{"a.txt"}, recorder.paths(SyncEventDone))
+}
+
+func TestSyncPullResumesPartialFile(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	content := strings.Repeat("0123456789", 1000)
+	device.put("/Media/video.mov", content, time.Unix(1700000000, 0))
+	dst := t.TempDir()
+	writeLocal(t, filepath.Join(dst, ".video.mov.partial"), content[:4000], time.Now())
+
+	recorder := &eventRecorder{}
+	result, err := client.SyncPull("/Media", dst, SyncOptions{Progress: recorder.record})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6000), result.Bytes)
+	require.Equal(t, []string{"video.mov"}, recorder.paths(SyncEventResume))
+	assert.Equal(t, int64(4000), recorder.events[0].Bytes)
+
+	pulled, err := os.ReadFile(filepath.Join(dst, "video.mov"))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(pulled))
+	assert.NoFileExists(t, filepath.Join(dst, ".video.mov.partial"))
+}
+
+func TestSyncPullResumeWithDelete(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	content := strings.Repeat("0123456789", 1000)
+	device.put("/Media/video.mov", content, time.Unix(1700000000, 0))
+	dst := t.TempDir()
+	writeLocal(t, filepath.Join(dst, ".video.mov.partial"), content[:4000], time.Now())
+	writeLocal(t, filepath.Join(dst, "stale.txt"), "stale", time.Now())
+
+	recorder := &eventRecorder{}
+	result, err := client.SyncPull("/Media", dst, SyncOptions{Delete: true, Progress: recorder.record})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Transferred)
+	assert.Equal(t, 1, result.Deleted)
+	assert.Equal(t, []string{"video.mov"}, recorder.paths(SyncEventResume))
+	assert.Equal(t, []string{"stale.txt"}, recorder.paths(SyncEventDelete))
+
+	pulled, err := os.ReadFile(filepath.Join(dst, "video.mov"))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(pulled))
+}
+
+func TestSyncPullRestartsMismatchingPartialFile(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	device.put("/Media/photo.heic", "the real content", time.Unix(1700000000, 0))
+	dst := t.TempDir()
+	writeLocal(t, filepath.Join(dst, ".photo.heic.partial"), "garbage", time.Now())
+
+	recorder := &eventRecorder{}
+	result, err := client.SyncPull("/Media/photo.heic", dst, SyncOptions{Progress: recorder.record})
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), result.Bytes)
+	assert.Empty(t, recorder.paths(SyncEventResume))
+
+	pulled, err := os.ReadFile(filepath.Join(dst, "photo.heic"))
+	require.NoError(t, err)
+	assert.Equal(t, "the real content", string(pulled))
+}
+
+func TestSyncPushParallelDeleteAndVerify(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	device.put("/Documents/stale.txt", "stale", time.Unix(1600000000, 0))
+	device.put("/Documents/old/nested.txt", "stale", time.Unix(1600000000, 0))
+	src := t.TempDir()
+	var want []string
+	for _, name := range []string{"1.txt", "2.txt", "3.txt", "4.txt", "dir/5.txt"} {
+		writeLocal(t, filepath.Join(src, name), "content of "+name, time.Unix(1700000000, 0))
+		want = append(want, name)
+	}
+
+	var mu sync.Mutex
+	connections := 0
+	recorder := &eventRecorder{}
+	result, err := client.SyncPush(src, "/Documents", SyncOptions{
+		Parallel: 3,
+		NewClient: func() (*Client, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			connections++
+			return device.newClient(t), nil
+		},
+		Delete:   true,
+		Verify:   true,
+		Progress: recorder.record,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, connections)
+	assert.Equal(t, 5, result.Transferred)
+	assert.Equal(t, 2, result.Deleted)
+	assert.Equal(t, want, recorder.paths(SyncEventVerified))
+	assert.Equal(t, []string{"old", "stale.txt"}, recorder.paths(SyncEventDelete))
+
+	_, ok := device.get("/Documents/old/nested.txt")
+	assert.False(t, ok)
+	node, ok := device.get("/Documents/dir/5.txt")
+	require.True(t, ok)
+	assert.Equal(t, "content of dir/5.txt", string(node.data))
+}
+
+func TestLocalTreeRejectsEscapingPaths(t *testing.T) {
+	tree := localTree{root: t.TempDir()}
+	_, err := tree.resolve("../outside.txt")
+	assert.Error(t, err)
+	_, err = tree.resolve("sub/../../outside.txt")
+	assert.Error(t, err)
+	p, err := tree.resolve("sub/inside.txt")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tree.root, "sub", "inside.txt"), p)
+}
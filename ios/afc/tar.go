@@ -0,0 +1,397 @@
+package afc
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how [Client.ExportTar] compresses the archive
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// TarFilter decides if the entry with the slash separated name relative to the
+// archive root is exported or imported. Skipping a directory skips everything in it.
+type TarFilter func(name string, isDir bool) bool
+
+// ExportTar streams the file or directory tree at p as a tar archive to w.
+// Entry names are relative to p, modification times and the permission bits
+// reported by the device are kept and symlinks are stored as links.
+func (c *Client) ExportTar(p string, w io.Writer, compression Compression) error {
+	return c.ExportTarFiltered(p, w, compression, nil)
+}
+
+// ExportTarFiltered works like [Client.ExportTar] but only exports entries accepted by filter
+func (c *Client) ExportTarFiltered(p string, w io.Writer, compression Compression, filter TarFilter) (err error) {
+	cw, err := compressWriter(w, compression)
+	if err != nil {
+		return err
+	}
+	// closing the compressor on errors as well releases the goroutines and buffers of the zstd encoder
+	defer func() {
+		err = errors.Join(err, cw.Close())
+	}()
+	tw := tar.NewWriter(cw)
+
+	info, err := c.Stat(p)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		err = c.writeTarEntry(tw, p, path.Base(p), info)
+	} else {
+		err = c.WalkDir(p, func(entryPath string, info FileInfo, err error) error {
+			name := strings.TrimPrefix(strings.TrimPrefix(entryPath, p), "/")
+			if filter != nil && !filter(name, info.IsDir()) {
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			return c.writeTarEntry(tw, entryPath, name, info)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (c *Client) writeTarEntry(tw *tar.Writer, devicePath, name string, info FileInfo) error {
+	hdr := &tar.Header{
+		Name:    name,
+		ModTime: info.ModTime,
+		Mode:    int64(info.Mode & 0o7777),
+	}
+	switch {
+	case info.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o755
+		}
+	case info.IsLink():
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = info.LinkTarget
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o777
+		}
+	case info.Type == S_IFREG:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = info.Size
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+	default:
+		golog.Debug("skipping unsupported file type in tar export", "module", logModule, "path", devicePath, "type", info.Type)
+		return nil
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	f, err := c.Open(devicePath, READ_ONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// tar.Writer fails if the file changed size while it was exported
+	_, err = io.Copy(tw, f)
+	if err != nil {
+		return fmt.Errorf("afc: exporting %s failed: %w", devicePath, err)
+	}
+	return nil
+}
+
+// ImportTar extracts the tar archive read from r into the directory p on the
+// device. Gzip and zstd compressed archives are detected automatically.
+// Modification times are restored, file modes are ignored because AFC cannot
+// change them. Entries that would end up outside of p are rejected.
+func (c *Client) ImportTar(r io.Reader, p string) error {
+	return c.ImportTarFiltered(r, p, nil)
+}
+
+// ImportTarFiltered works like [Client.ImportTar] but only imports entries accepted by filter
+func (c *Client) ImportTarFiltered(r io.Reader, p string, filter TarFilter) error {
+	return c.importTar(r, p, filter)
+}
+
+// ImportTarOnto works like [Client.ImportTarFiltered] but calls prepare before anything is
+// written. r is first read completely into a temporary file and prepare is only called once
+// the whole archive could be decompressed and all of its entries are contained in p. Empty
+// archives are rejected. Callers can clear p in prepare without losing its contents to an
+// archive that is truncated, corrupt or unsafe.
+func (c *Client) ImportTarOnto(r io.Reader, p string, filter TarFilter, prepare func() error) error {
+	spool, err := os.CreateTemp("", "go-ios-import-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	if _, err := io.Copy(spool, r); err != nil {
+		return fmt.Errorf("afc: reading archive failed: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := validateTar(spool, p); err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := prepare(); err != nil {
+		return err
+	}
+	return c.importTar(spool, p, filter)
+}
+
+// validateTar reads the whole archive and checks every entry like importTar does,
+// without writing anything
+func validateTar(r io.Reader, p string) error {
+	p = path.Clean(p)
+	dr, err := decompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	tr := tar.NewReader(dr)
+	entries := 0
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("afc: reading archive failed: %w", err)
+		}
+		if _, err := checkTarEntry(p, hdr); err != nil {
+			return err
+		}
+		// reading the contents detects archives that end in the middle of a file
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("afc: reading %s failed: %w", hdr.Name, err)
+		}
+		entries++
+	}
+	if entries == 0 {
+		return errors.New("afc: archive is empty")
+	}
+	return nil
+}
+
+func (c *Client) importTar(r io.Reader, p string, filter TarFilter) error {
+	p = path.Clean(p)
+	dr, err := decompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	tr := tar.NewReader(dr)
+
+	created := map[string]bool{}
+	dirTimes := map[string]time.Time{}
+	var skippedDirs []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("afc: reading archive failed: %w", err)
+		}
+		target, err := checkTarEntry(p, hdr)
+		if err != nil {
+			return err
+		}
+		if filter != nil && target != p {
+			name := strings.TrimPrefix(strings.TrimPrefix(target, p), "/")
+			if slices.ContainsFunc(skippedDirs, func(dir string) bool { return strings.HasPrefix(name, dir+"/") }) {
+				continue
+			}
+			if !filter(name, hdr.Typeflag == tar.TypeDir) {
+				if hdr.Typeflag == tar.TypeDir {
+					skippedDirs = append(skippedDirs, name)
+				}
+				continue
+			}
+		}
+		if target != p {
+			if err := c.mkdirAll(p, path.Dir(target), created); err != nil {
+				return err
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := c.mkdirAll(p, target, created); err != nil {
+				return err
+			}
+			dirTimes[target] = hdr.ModTime
+		case tar.TypeReg:
+			if err := c.WriteToFile(tr, target); err != nil {
+				return fmt.Errorf("afc: importing %s failed: %w", hdr.Name, err)
+			}
+			if err := c.SetModTime(target, hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := c.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkTarget, _ := archiveTarget(p, hdr.Linkname)
+			if err := c.Link(linkTarget, target); err != nil {
+				return err
+			}
+		default:
+			golog.Debug("skipping unsupported tar entry", "module", logModule, "name", hdr.Name, "type", hdr.Typeflag)
+		}
+	}
+
+	// directory times change whenever an entry is created in them, so they are set last, deepest first
+	dirs := make([]string, 0, len(dirTimes))
+	for dir := range dirTimes {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	slices.Reverse(dirs)
+	for _, dir := range dirs {
+		if err := c.SetModTime(dir, dirTimes[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTarEntry returns the device path of the archive entry hdr in p, or an error if the
+// entry or the target of a link in it would not be contained in p
+func checkTarEntry(p string, hdr *tar.Header) (string, error) {
+	target, err := archiveTarget(p, hdr.Name)
+	if err != nil {
+		return "", err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		// a link pointing outside of p would let later entries escape through it
+		if path.IsAbs(hdr.Linkname) || !devicePathContained(p, path.Join(path.Dir(target), hdr.Linkname)) {
+			return "", fmt.Errorf("afc: refusing to import symlink %q pointing outside of %q", hdr.Name, p)
+		}
+	case tar.TypeLink:
+		if _, err := archiveTarget(p, hdr.Linkname); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// archiveTarget returns the device path for the archive entry name, or an error if
+// the name is unsafe or the path would not be contained in root
+func archiveTarget(root, name string) (string, error) {
+	trimmed := strings.TrimPrefix(name, "./")
+	if trimmed == "" || trimmed == "." {
+		return root, nil
+	}
+	if unsafeEntryName(trimmed) {
+		return "", fmt.Errorf("afc: refusing to import entry with unsafe name %q", name)
+	}
+	target := path.Join(root, trimmed)
+	if !devicePathContained(root, target) {
+		return "", fmt.Errorf("afc: refusing to write %q outside destination %q", target, root)
+	}
+	return target, nil
+}
+
+// devicePathContained is containedIn for slash separated device paths
+func devicePathContained(root, candidate string) bool {
+	root = path.Clean(root)
+	candidate = path.Clean(candidate)
+	return candidate == root || root == "/" || strings.HasPrefix(candidate, root+"/")
+}
+
+// mkdirAll creates dir and all its missing parents below root
+func (c *Client) mkdirAll(root, dir string, created map[string]bool) error {
+	if created[dir] {
+		return nil
+	}
+	if dir != root && devicePathContained(root, path.Dir(dir)) {
+		if err := c.mkdirAll(root, path.Dir(dir), created); err != nil {
+			return err
+		}
+	}
+	if info, err := c.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+	} else if err := c.MkDir(dir); err != nil {
+		return err
+	}
+	created[dir] = true
+	return nil
+}
+
+func compressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("afc: unsupported compression %q", compression)
+	}
+}
+
+// decompressReader detects gzip and zstd compressed streams by their magic bytes
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,159 @@
+package afc
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			device := newFakeDevice()
+			client := device.newClient(t)
+			mtime := time.Unix(1700000000, 0)
+			device.put("/Documents/a.txt", "alpha", mtime)
+			device.put("/Documents/sub/b.txt", "beta", mtime.Add(time.Hour))
+			require.NoError(t, client.Symlink("sub/b.txt", "/Documents/link"))
+
+			var archive bytes.Buffer
+			require.NoError(t, client.ExportTar("/Documents", &archive, compression))
+			require.NoError(t, client.MkDir("/Restored"))
+			require.NoError(t, client.ImportTar(&archive, "/Restored"))
+
+			node, ok := device.get("/Restored/sub/b.txt")
+			require.True(t, ok)
+			assert.Equal(t, "beta", string(node.data))
+			assert.True(t, node.mtime.Equal(mtime.Add(time.Hour)), "mtime %v", node.mtime)
+			node, ok = device.get("/Restored/link")
+			require.True(t, ok)
+			assert.Equal(t, "sub/b.txt", node.link)
+			node, ok = device.get("/Restored/a.txt")
+			require.True(t, ok)
+			assert.Equal(t, "alpha", string(node.data))
+		})
+	}
+}
+
+func TestImportTarRejectsEscapingEntries(t *testing.T) {
+	testCases := map[string]tar.Header{
+		"parent":          {Name: "../evil.txt", Typeflag: tar.TypeReg},
+		"nested parent":   {Name: "sub/../../evil.txt", Typeflag: tar.TypeReg},
+		"absolute":        {Name: "/evil.txt", Typeflag: tar.TypeReg},
+		"symlink outside": {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"},
+		"absolute link":   {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/var"},
+		"hardlink":        {Name: "link", Typeflag: tar.TypeLink, Linkname: "../secret"},
+	}
+	for name, hdr := range testCases {
+		t.Run(name, func(t *testing.T) {
+			device := newFakeDevice()
+			client := device.newClient(t)
+			require.NoError(t, client.MkDir("/Restored"))
+
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			require.NoError(t, tw.WriteHeader(&hdr))
+			require.NoError(t, tw.Close())
+
+			assert.Error(t, client.ImportTar(&archive, "/Restored"))
+			_, ok := device.get("/evil.txt")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestImportTarOntoValidatesBeforePrepare(t *testing.T) {
+	archiveWith := func(compression Compression, hdrs ...tar.Header) []byte {
+		var archive bytes.Buffer
+		cw, err := compressWriter(&archive, compression)
+		require.NoError(t, err)
+		tw := tar.NewWriter(cw)
+		for _, hdr := range hdrs {
+			require.NoError(t, tw.WriteHeader(&hdr))
+			_, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, cw.Close())
+		return archive.Bytes()
+	}
+	file := func(name string, size int64) tar.Header {
+		return tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: size}
+	}
+	valid := archiveWith(CompressionNone, file("first.txt", 1024), file("second.txt", 1024))
+	validGzip := archiveWith(CompressionGzip, file("first.txt", 1024), file("second.txt", 1024))
+	testCases := map[string][]byte{
+		"corrupt":         []byte("this is not an archive"),
+		"empty":           archiveWith(CompressionNone),
+		"escaping":        archiveWith(CompressionNone, file("../evil.txt", 0)),
+		"escaping later":  archiveWith(CompressionNone, file("first.txt", 1), file("../evil.txt", 0)),
+		"symlink later":   archiveWith(CompressionNone, file("first.txt", 1), tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/var"}),
+		"truncated":       valid[:1024+512+512],
+		"truncated gzip":  validGzip[:len(validGzip)-16],
+		"corrupt in gzip": append(validGzip[:len(validGzip)/2:len(validGzip)/2], []byte("garbage")...),
+	}
+	for name, archive := range testCases {
+		t.Run(name, func(t *testing.T) {
+			device := newFakeDevice()
+			client := device.newClient(t)
+			device.put("/old.txt", "old", time.Unix(1700000000, 0))
+			err := client.ImportTarOnto(bytes.NewReader(archive), "/", nil, func() error {
+				return client.Remove("/old.txt")
+			})
+			assert.Error(t, err)
+			_, ok := device.get("/old.txt")
+			assert.True(t, ok, "nothing is removed")
+			_, ok = device.get("/first.txt")
+			assert.False(t, ok, "nothing is imported")
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		device := newFakeDevice()
+		client := device.newClient(t)
+		device.put("/old.txt", "old", time.Unix(1700000000, 0))
+		err := client.ImportTarOnto(bytes.NewReader(validGzip), "/", nil, func() error {
+			return client.Remove("/old.txt")
+		})
+		require.NoError(t, err)
+		_, ok := device.get("/old.txt")
+		assert.False(t, ok)
+		node, ok := device.get("/second.txt")
+		require.True(t, ok)
+		assert.Len(t, node.data, 1024)
+	})
+}
+
+func TestTarFilter(t *testing.T) {
+	device := newFakeDevice()
+	client := device.newClient(t)
+	mtime := time.Unix(1700000000, 0)
+	device.put("/Documents/keep.txt", "keep", mtime)
+	device.put("/Documents/skip.log", "skip", mtime)
+	device.put("/Library/Caches/big.bin", "cache", mtime)
+	noLogs := func(name string, isDir bool) bool {
+		return !strings.HasSuffix(name, ".log")
+	}
+	noCaches := func(name string, isDir bool) bool {
+		return name != "Library/Caches"
+	}
+
+	var archive bytes.Buffer
+	require.NoError(t, client.ExportTarFiltered("/", &archive, CompressionNone, noLogs))
+	require.NoError(t, client.MkDir("/Restored"))
+	require.NoError(t, client.ImportTarFiltered(&archive, "/Restored", noCaches))
+
+	_, ok := device.get("/Restored/Documents/keep.txt")
+	assert.True(t, ok)
+	_, ok = device.get("/Restored/Documents/skip.log")
+	assert.False(t, ok)
+	_, ok = device.get("/Restored/Library/Caches/big.bin")
+	assert.False(t, ok)
+	_, ok = device.get("/Restored/Library")
+	assert.True(t, ok)
+}
@@ -0,0 +1,251 @@
+// Package appdata takes snapshots of the data container of an app and restores them,
+// so tests can start from the same app state without reinstalling the app.
+package appdata
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/appservice"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/house_arrest"
+	"github.com/danielpaulus/go-ios/ios/installationproxy"
+	"github.com/danielpaulus/go-ios/ios/instruments"
+)
+
+const logModule = "go-ios/appdata"
+
+// ContainerDirs are the directories of the app container that are part of a snapshot
+var ContainerDirs = []string{"Documents", "Library", "tmp"}
+
+// Options configures [Snapshot] and [Restore]
+type Options struct {
+	// Include limits the snapshot or restore to paths matching one of the globs.
+	// Paths are relative to the container, like "Documents/db.sqlite". A glob
+	// matching a directory matches everything in it, "**" matches any number of directories.
+	Include []string
+	// Exclude skips paths matching one of the globs. On restore, excluded files on the device are kept.
+	Exclude []string
+	// Compression is used for the snapshot archive, Restore detects it automatically
+	Compression afc.Compression
+}
+
+// Snapshot kills the app with the given bundleID and writes the Documents, Library
+// and tmp directories of its container as a tar archive to w.
+func Snapshot(device ios.DeviceEntry, bundleID string, w io.Writer, options Options) error {
+	if err := KillApp(device, bundleID); err != nil {
+		return err
+	}
+	client, err := house_arrest.New(device, bundleID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return SnapshotContainer(client, w, options)
+}
+
+// Restore kills the app with the given bundleID, removes the contents of the Documents,
+// Library and tmp directories of its container and extracts the snapshot read from r into it.
+func Restore(device ios.DeviceEntry, bundleID string, r io.Reader, options Options) error {
+	if err := KillApp(device, bundleID); err != nil {
+		return err
+	}
+	client, err := house_arrest.New(device, bundleID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return RestoreContainer(client, r, options)
+}
+
+// SnapshotContainer writes the container client is connected to as a tar archive to w
+func SnapshotContainer(client *afc.Client, w io.Writer, options Options) error {
+	return client.ExportTarFiltered("/", w, options.Compression, options.filter)
+}
+
+// RestoreContainer wipes the container client is connected to and extracts the archive read from r into it.
+// The archive is read and checked completely before the container is wiped, so a truncated, corrupt
+// or unsafe archive leaves the container as it is.
+func RestoreContainer(client *afc.Client, r io.Reader, options Options) error {
+	err := client.ImportTarOnto(r, "/", options.filter, func() error {
+		if err := wipeContainer(client, options); err != nil {
+			return fmt.Errorf("wiping container failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("appdata: restoring snapshot failed: %w", err)
+	}
+	return nil
+}
+
+// filter accepts paths in one of the ContainerDirs that match the include and exclude globs.
+// Directories are only rejected by excludes, files in them might still be included.
+func (o Options) filter(name string, isDir bool) bool {
+	top, _, _ := strings.Cut(name, "/")
+	if !slices.Contains(ContainerDirs, top) {
+		return false
+	}
+	if matchesAny(o.Exclude, name) {
+		return false
+	}
+	return isDir || len(o.Include) == 0 || matchesAny(o.Include, name)
+}
+
+// wipeContainer removes all files accepted by the filter and the directories that are empty afterwards.
+// The ContainerDirs themselves are never walked as entries, so they are kept.
+func wipeContainer(client *afc.Client, options Options) error {
+	var dirs []string
+	for _, top := range ContainerDirs {
+		if _, err := client.Stat("/" + top); err != nil {
+			continue
+		}
+		err := client.WalkDir("/"+top, func(p string, info afc.FileInfo, err error) error {
+			name := strings.TrimPrefix(p, "/")
+			if !options.filter(name, info.IsDir()) {
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				dirs = append(dirs, p)
+				return nil
+			}
+			golog.Debug("removing", "module", logModule, "path", p)
+			return client.Remove(p)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// deepest first, so parents are empty once their children are gone
+	slices.Sort(dirs)
+	slices.Reverse(dirs)
+	for _, dir := range dirs {
+		entries, err := client.List(dir)
+		if err != nil {
+			return err
+		}
+		// empty directories outside of the includes are kept, they were empty before
+		if len(entries) > 0 || (len(options.Include) > 0 && !matchesAny(options.Include, strings.TrimPrefix(dir, "/"))) {
+			continue
+		}
+		golog.Debug("removing", "module", logModule, "path", dir)
+		if err := client.Remove(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KillApp kills the app with the given bundleID if it is running.
+// It uses appservice on iOS 17+ and instruments on older versions.
+func KillApp(device ios.DeviceEntry, bundleID string) error {
+	processName, err := executableName(device, bundleID)
+	if err != nil {
+		return err
+	}
+
+	if device.SupportsRsd() {
+		conn, err := appservice.New(device)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		processes, err := conn.ListProcesses()
+		if err != nil {
+			return err
+		}
+		for _, p := range processes {
+			if p.ExecutableName() == processName {
+				golog.Info("killing app", "module", logModule, "bundleID", bundleID, "pid", p.Pid)
+				return conn.KillProcess(p.Pid)
+			}
+		}
+		return nil
+	}
+
+	pControl, err := instruments.NewProcessControl(device)
+	if err != nil {
+		return err
+	}
+	defer pControl.Close()
+	service, err := instruments.NewDeviceInfoService(device)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	processes, err := service.ProcessList()
+	if err != nil {
+		return err
+	}
+	for _, p := range processes {
+		if p.Name == processName {
+			golog.Info("killing app", "module", logModule, "bundleID", bundleID, "pid", p.Pid)
+			return pControl.KillProcess(p.Pid)
+		}
+	}
+	return nil
+}
+
+func executableName(device ios.DeviceEntry, bundleID string) (string, error) {
+	svc, err := installationproxy.New(device)
+	if err != nil {
+		return "", err
+	}
+	defer svc.Close()
+	apps, err := svc.BrowseAllApps()
+	if err != nil {
+		return "", err
+	}
+	for _, app := range apps {
+		if app.CFBundleIdentifier() == bundleID {
+			return app.CFBundleExecutable(), nil
+		}
+	}
+	return "", fmt.Errorf("appdata: %s is not installed", bundleID)
+}
+
+// matchesAny reports whether name or one of its parent directories matches one of the globs
+func matchesAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+			if matchGlob(strings.Split(strings.Trim(glob, "/"), "/"), strings.Split(p, "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchGlob matches path segments against glob segments. Each segment is
+// matched with [path.Match], a "**" segment matches zero or more segments.
+func matchGlob(glob, segments []string) bool {
+	if len(glob) == 0 {
+		return len(segments) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(glob[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, err := path.Match(glob[0], segments[0])
+	if err != nil || !ok {
+		return false
+	}
+	return matchGlob(glob[1:], segments[1:])
+}
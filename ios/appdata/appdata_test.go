@@ -0,0 +1,44 @@
+package appdata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesAny(t *testing.T) {
+	testCases := []struct {
+		glob  string
+		name  string
+		match bool
+	}{
+		{glob: "Documents", name: "Documents/db.sqlite", match: true},
+		{glob: "Documents/*.sqlite", name: "Documents/db.sqlite", match: true},
+		{glob: "Documents/*.sqlite", name: "Documents/sub/db.sqlite", match: false},
+		{glob: "**/*.sqlite", name: "Documents/sub/db.sqlite", match: true},
+		{glob: "**/*.sqlite", name: "db.sqlite", match: true},
+		{glob: "Library/Caches", name: "Library/Caches/com.apple/data", match: true},
+		{glob: "Library/Caches", name: "Library/CachesOld/data", match: false},
+		{glob: "tmp/**", name: "tmp/a/b/c", match: true},
+		{glob: "[", name: "Documents", match: false},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.match, matchesAny([]string{testCase.glob}, testCase.name), "%s %s", testCase.glob, testCase.name)
+	}
+}
+
+func TestOptionsFilter(t *testing.T) {
+	options := Options{
+		Include: []string{"Documents", "Library/Preferences/*.plist"},
+		Exclude: []string{"**/*.log"},
+	}
+
+	assert.True(t, options.filter("Documents/db.sqlite", false))
+	assert.False(t, options.filter("Documents/debug.log", false))
+	assert.True(t, options.filter("Library/Preferences/com.example.plist", false))
+	assert.False(t, options.filter("Library/Caches/data", false))
+	assert.True(t, options.filter("Library/Caches", true), "directories are only rejected by excludes")
+	assert.False(t, options.filter("SystemData/com.apple.x", false), "only container dirs are part of a snapshot")
+	assert.False(t, options.filter(".com.apple.mobile_container_manager.metadata.plist", false))
+	assert.True(t, Options{}.filter("tmp/upload", false))
+}
@@ -17,6 +17,20 @@ const (
 	crashReportCopyMobileService = "com.apple.crashreportcopymobile"
 )
 
+// New triggers the crash report mover and returns an AFC client for the directory
+// the crash reports were moved to. Wrap it with [afc.NewFS] to use it as an [io/fs.FS].
+func New(device ios.DeviceEntry) (*afc.Client, error) {
+	err := moveReports(device)
+	if err != nil {
+		return nil, err
+	}
+	deviceConn, err := ios.ConnectToService(device, crashReportCopyMobileService)
+	if err != nil {
+		return nil, err
+	}
+	return afc.NewFromConn(deviceConn), nil
+}
+
 // DownloadReports gets all crashreports based on the provided file pattern and writes them to targetdir.
 // Directories will be recursively added without applying the pattern recursively.
 // pattern can be typical filepattern, if you want all files use "*"
@@ -24,16 +38,11 @@ func DownloadReports(device ios.DeviceEntry, pattern string, targetdir string) e
 	if pattern == "" {
 		return fmt.Errorf("empty pattern not ok, just use *")
 	}
-	err := moveReports(device)
+	afcConn, err := New(device)
 	if err != nil {
 		return err
 	}
-	deviceConn, err := ios.ConnectToService(device, crashReportCopyMobileService)
-	if err != nil {
-		return err
-	}
-	defer deviceConn.Close()
-	afcConn := afc.NewFromConn(deviceConn)
+	defer afcConn.Close()
 	err = afcConn.WalkDir(".", func(p string, info afc.FileInfo, err error) error {
 		if info.Type == afc.S_IFDIR {
 			return nil
@@ -51,16 +60,11 @@ func RemoveReports(device ios.DeviceEntry, cwd string, pattern string) error {
 		return fmt.Errorf("empty pattern not ok, just use *")
 	}
 	golog.Info("deleting", "module", logModule, "udid", device.Properties.SerialNumber, "cwd", cwd, "pattern", pattern)
-	err := moveReports(device)
-	if err != nil {
-		return err
-	}
-	deviceConn, err := ios.ConnectToService(device, crashReportCopyMobileService)
+	afcClient, err := New(device)
 	if err != nil {
 		return err
 	}
-	defer deviceConn.Close()
-	afcClient := afc.NewFromConn(deviceConn)
+	defer afcClient.Close()
 	return afcClient.WalkDir(cwd, func(path string, info afc.FileInfo, err error) error {
 		if info.Type == afc.S_IFDIR {
 			return nil
@@ -73,16 +77,11 @@ func RemoveReports(device ios.DeviceEntry, cwd string, pattern string) error {
 }
 
 func ListReports(device ios.DeviceEntry, pattern string) ([]string, error) {
-	err := moveReports(device)
-	if err != nil {
-		return []string{}, err
-	}
-	deviceConn, err := ios.ConnectToService(device, crashReportCopyMobileService)
+	afcClient, err := New(device)
 	if err != nil {
 		return []string{}, err
 	}
-	defer deviceConn.Close()
-	afcClient := afc.NewFromConn(deviceConn)
+	defer afcClient.Close()
 
 	var files []string
 	err = afcClient.WalkDir(".", func(path string, info afc.FileInfo, err error) error {
@@ -0,0 +1,300 @@
+package crashreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+// bugTypeCrash is the bug_type of .ips reports for crashed processes
+const bugTypeCrash = "309"
+
+// Report is a parsed .ips crash report. Modern iOS versions write reports as a
+// JSON header line followed by a JSON body.
+type Report struct {
+	// Name is the path of the report in the crash report directory
+	Name   string `json:"name"`
+	Header Header `json:"header"`
+	// Crash is the parsed body of crash reports (bug type 309), it is nil for other report types
+	Crash *Crash `json:"crash,omitempty"`
+	// Body is the raw body of the report
+	Body json.RawMessage `json:"-"`
+
+	rawHeader []byte
+}
+
+// Header is the first line of an .ips report
+type Header struct {
+	AppName      string `json:"app_name"`
+	AppVersion   string `json:"app_version"`
+	BuildVersion string `json:"build_version"`
+	BundleID     string `json:"bundleID"`
+	BugType      string `json:"bug_type"`
+	Name         string `json:"name"`
+	OSVersion    string `json:"os_version"`
+	Timestamp    string `json:"timestamp"`
+	IncidentID   string `json:"incident_id"`
+	SliceUUID    string `json:"slice_uuid"`
+}
+
+// Crash is the body of a crash report
+type Crash struct {
+	ProcessName    string        `json:"procName"`
+	ProcessPath    string        `json:"procPath"`
+	PID            int           `json:"pid"`
+	ParentProcess  string        `json:"parentProc"`
+	CPUType        string        `json:"cpuType"`
+	ModelCode      string        `json:"modelCode"`
+	CaptureTime    string        `json:"captureTime"`
+	OSVersion      OSVersion     `json:"osVersion"`
+	BundleInfo     BundleInfo    `json:"bundleInfo"`
+	Exception      Exception     `json:"exception"`
+	Termination    Termination   `json:"termination"`
+	FaultingThread int           `json:"faultingThread"`
+	Threads        []Thread      `json:"threads"`
+	UsedImages     []BinaryImage `json:"usedImages"`
+}
+
+type OSVersion struct {
+	Train       string `json:"train"`
+	Build       string `json:"build"`
+	ReleaseType string `json:"releaseType"`
+}
+
+type BundleInfo struct {
+	ShortVersion string `json:"CFBundleShortVersionString"`
+	Version      string `json:"CFBundleVersion"`
+	Identifier   string `json:"CFBundleIdentifier"`
+}
+
+type Exception struct {
+	Type    string `json:"type"`
+	Signal  string `json:"signal"`
+	Codes   string `json:"codes"`
+	Subtype string `json:"subtype,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type Termination struct {
+	Namespace string   `json:"namespace"`
+	Code      int64    `json:"code"`
+	Indicator string   `json:"indicator"`
+	ByProc    string   `json:"byProc"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+type Thread struct {
+	ID        uint64  `json:"id"`
+	Name      string  `json:"name,omitempty"`
+	Queue     string  `json:"queue,omitempty"`
+	Triggered bool    `json:"triggered,omitempty"`
+	Frames    []Frame `json:"frames"`
+}
+
+// Frame is a stack frame. ImageIndex refers to [Crash.UsedImages], the address of the
+// frame is the base of that image plus ImageOffset.
+type Frame struct {
+	ImageOffset    uint64 `json:"imageOffset"`
+	ImageIndex     int    `json:"imageIndex"`
+	Symbol         string `json:"symbol,omitempty"`
+	SymbolLocation uint64 `json:"symbolLocation,omitempty"`
+	SourceFile     string `json:"sourceFile,omitempty"`
+	SourceLine     int    `json:"sourceLine,omitempty"`
+}
+
+type BinaryImage struct {
+	Source string `json:"source"`
+	Arch   string `json:"arch"`
+	Base   uint64 `json:"base"`
+	Size   uint64 `json:"size"`
+	UUID   string `json:"uuid"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+}
+
+// Summary contains the details of a report needed for triage
+type Summary struct {
+	Name          string   `json:"name"`
+	Process       string   `json:"process"`
+	BundleID      string   `json:"bundleID"`
+	AppVersion    string   `json:"appVersion"`
+	OSVersion     string   `json:"osVersion"`
+	BugType       string   `json:"bugType"`
+	Timestamp     string   `json:"timestamp"`
+	ExceptionType string   `json:"exceptionType,omitempty"`
+	Signal        string   `json:"signal,omitempty"`
+	Termination   string   `json:"termination,omitempty"`
+	CrashedThread *int     `json:"crashedThread,omitempty"`
+	TopFrames     []string `json:"topFrames,omitempty"`
+}
+
+// ParseReport parses an .ips report. The header is required, the body is only
+// parsed for crash reports and kept as raw JSON for all other report types.
+func ParseReport(name string, data []byte) (Report, error) {
+	headerLine, body, _ := bytes.Cut(data, []byte("\n"))
+	report := Report{Name: name, Body: bytes.TrimSpace(body), rawHeader: bytes.TrimSpace(headerLine)}
+	if err := json.Unmarshal(headerLine, &report.Header); err != nil {
+		return Report{}, fmt.Errorf("crashreport: %s is not an .ips report, invalid header: %w", name, err)
+	}
+	if report.Header.BugType != bugTypeCrash || len(report.Body) == 0 {
+		return report, nil
+	}
+	var crash Crash
+	if err := json.Unmarshal(report.Body, &crash); err != nil {
+		return Report{}, fmt.Errorf("crashreport: invalid body in %s: %w", name, err)
+	}
+	report.Crash = &crash
+	return report, nil
+}
+
+// Bytes returns the report in the .ips format
+func (r Report) Bytes() []byte {
+	var b bytes.Buffer
+	b.Write(r.rawHeader)
+	b.WriteByte('\n')
+	b.Write(r.Body)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// CrashedThread returns the index of the thread that caused the crash, or -1 if the report has none
+func (c *Crash) CrashedThread() int {
+	for i := range c.Threads {
+		if c.Threads[i].Triggered {
+			return i
+		}
+	}
+	if c.FaultingThread >= 0 && c.FaultingThread < len(c.Threads) {
+		return c.FaultingThread
+	}
+	return -1
+}
+
+// FormatFrame returns a line like "MyApp 0x100f2c3a8 main + 20 (main.swift:12)"
+func (c *Crash) FormatFrame(f Frame) string {
+	image := "???"
+	address := f.ImageOffset
+	if f.ImageIndex >= 0 && f.ImageIndex < len(c.UsedImages) {
+		img := c.UsedImages[f.ImageIndex]
+		image = img.Name
+		if image == "" {
+			image = path.Base(img.Path)
+		}
+		address += img.Base
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 0x%x", image, address)
+	if f.Symbol != "" {
+		fmt.Fprintf(&b, " %s + %d", f.Symbol, f.SymbolLocation)
+	}
+	if f.SourceFile != "" {
+		fmt.Fprintf(&b, " (%s:%d)", path.Base(f.SourceFile), f.SourceLine)
+	}
+	return b.String()
+}
+
+// Summary returns the triage details of the report with at most maxFrames frames
+// of the crashed thread. A negative maxFrames returns all frames.
+func (r Report) Summary(maxFrames int) Summary {
+	s := Summary{
+		Name:       r.Name,
+		Process:    r.Header.AppName,
+		BundleID:   r.Header.BundleID,
+		AppVersion: r.Header.AppVersion,
+		OSVersion:  r.Header.OSVersion,
+		BugType:    r.Header.BugType,
+		Timestamp:  r.Header.Timestamp,
+	}
+	if s.Process == "" {
+		s.Process = r.Header.Name
+	}
+	if r.Crash == nil {
+		return s
+	}
+	c := r.Crash
+	if c.ProcessName != "" {
+		s.Process = c.ProcessName
+	}
+	if s.BundleID == "" {
+		s.BundleID = c.BundleInfo.Identifier
+	}
+	if s.AppVersion == "" {
+		s.AppVersion = c.BundleInfo.ShortVersion
+	}
+	s.ExceptionType = c.Exception.Type
+	s.Signal = c.Exception.Signal
+	s.Termination = c.Termination.Indicator
+	if index := c.CrashedThread(); index >= 0 {
+		s.CrashedThread = &index
+		frames := c.Threads[index].Frames
+		if maxFrames >= 0 && len(frames) > maxFrames {
+			frames = frames[:maxFrames]
+		}
+		for _, f := range frames {
+			s.TopFrames = append(s.TopFrames, c.FormatFrame(f))
+		}
+	}
+	return s
+}
+
+// ReadReport reads and parses the report with the given name from the crash report directory
+func ReadReport(client *afc.Client, name string) (Report, error) {
+	f, err := client.Open(name, afc.READ_ONLY)
+	if err != nil {
+		return Report{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return Report{}, err
+	}
+	return ParseReport(name, data)
+}
+
+// GetReport moves new crash reports and reads the report with the given name straight off the device
+func GetReport(device ios.DeviceEntry, name string) (Report, error) {
+	afcClient, err := New(device)
+	if err != nil {
+		return Report{}, err
+	}
+	defer afcClient.Close()
+	return ReadReport(afcClient, name)
+}
+
+// ListReportDetails parses all .ips reports matching pattern. Reports that cannot
+// be parsed are returned with their name only.
+func ListReportDetails(device ios.DeviceEntry, pattern string) ([]Report, error) {
+	afcClient, err := New(device)
+	if err != nil {
+		return nil, err
+	}
+	defer afcClient.Close()
+
+	var reports []Report
+	err = afcClient.WalkDir(".", func(p string, info afc.FileInfo, err error) error {
+		if info.Type == afc.S_IFDIR || !strings.HasSuffix(p, ".ips") {
+			return nil
+		}
+		if ok, _ := path.Match(pattern, path.Base(p)); !ok {
+			return nil
+		}
+		report, err := ReadReport(afcClient, p)
+		if err != nil {
+			golog.Debug("failed parsing crash report", "module", logModule, "name", p, "err", err)
+			report = Report{Name: p}
+		}
+		reports = append(reports, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
@@ -0,0 +1,61 @@
+package crashreport
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCrashReport(t *testing.T) {
+	data, err := os.ReadFile("testdata/SampleApp-2024-05-01-101010.ips")
+	require.NoError(t, err)
+
+	report, err := ParseReport("SampleApp-2024-05-01-101010.ips", data)
+	require.NoError(t, err)
+	assert.Equal(t, "com.example.sampleapp", report.Header.BundleID)
+	require.NotNil(t, report.Crash)
+	assert.Equal(t, 4711, report.Crash.PID)
+	assert.Equal(t, "21E236", report.Crash.OSVersion.Build)
+	assert.Len(t, report.Crash.Threads, 2)
+	assert.Len(t, report.Crash.UsedImages, 4)
+
+	crashedThread := 0
+	assert.Equal(t, Summary{
+		Name:          "SampleApp-2024-05-01-101010.ips",
+		Process:       "SampleApp",
+		BundleID:      "com.example.sampleapp",
+		AppVersion:    "2.3.1",
+		OSVersion:     "iPhone OS 17.4.1 (21E236)",
+		BugType:       "309",
+		Timestamp:     "2024-05-01 10:10:10.00 +0200",
+		ExceptionType: "EXC_BREAKPOINT",
+		Signal:        "SIGTRAP",
+		Termination:   "Trace/BPT trap: 5",
+		CrashedThread: &crashedThread,
+		TopFrames: []string{
+			"SampleApp 0x1000081a4 ContentView.crash() + 48",
+			"SampleApp 0x10000791c closure #1 in ContentView.body.getter + 28 (ContentView.swift:42)",
+		},
+	}, report.Summary(2))
+	assert.Len(t, report.Summary(-1).TopFrames, 4)
+}
+
+func TestParseNonCrashReport(t *testing.T) {
+	data := []byte(`{"bug_type":"298","timestamp":"2024-05-01 10:10:10.00 +0200","os_version":"iPhone OS 17.4.1 (21E236)","incident_id":"A"}
+{"crashReporterKey":"abc","processes":[]}`)
+
+	report, err := ParseReport("JetsamEvent-2024-05-01-101010.ips", data)
+	require.NoError(t, err)
+	assert.Nil(t, report.Crash)
+	assert.JSONEq(t, `{"crashReporterKey":"abc","processes":[]}`, string(report.Body))
+	summary := report.Summary(5)
+	assert.Equal(t, "298", summary.BugType)
+	assert.Nil(t, summary.CrashedThread)
+}
+
+func TestParseRejectsLegacyTextReports(t *testing.T) {
+	_, err := ParseReport("old.crash", []byte("Incident Identifier: 8E0B7A0C\nCrashReporter Key: abc\n"))
+	assert.Error(t, err)
+}
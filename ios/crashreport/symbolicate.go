@@ -0,0 +1,472 @@
+package crashreport
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/macho"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+// loadCmdUUID is LC_UUID, debug/macho does not parse it
+const loadCmdUUID macho.LoadCmd = 0x1b
+
+// Symbolicator resolves addresses in binary images to functions, source files
+// and lines using the DWARF debug info of dSYM bundles. Images are matched by UUID.
+type Symbolicator struct {
+	images map[string]*debugImage
+}
+
+// Symbol is a resolved address
+type Symbol struct {
+	Function string
+	// Offset is the distance of the address from the start of Function
+	Offset uint64
+	File   string
+	Line   int
+}
+
+type debugImage struct {
+	path     string
+	textAddr uint64
+	dwarf    *dwarf.Data
+	// functions and symbols are sorted by address
+	functions []function
+	symbols   []function
+}
+
+type function struct {
+	name      string
+	low, high uint64
+}
+
+// NewSymbolicator loads the debug info of all dSYM bundles in paths. A path can be a
+// dSYM bundle, a directory that is searched for dSYM bundles or a Mach-O file.
+// Fat binaries contribute every architecture slice.
+func NewSymbolicator(paths ...string) (*Symbolicator, error) {
+	s := &Symbolicator{images: map[string]*debugImage{}}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := s.loadFile(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Base(filepath.Dir(file)) != "DWARF" || !strings.Contains(file, ".dSYM"+string(filepath.Separator)) {
+				return nil
+			}
+			if err := s.loadFile(file); err != nil {
+				golog.Debug("skipping invalid dSYM", "module", logModule, "path", file, "err", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// UUIDs returns the UUIDs of all loaded images
+func (s *Symbolicator) UUIDs() []string {
+	uuids := make([]string, 0, len(s.images))
+	for uuid := range s.images {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// ImageName returns the file name of the binary of the image with the given UUID,
+// the name of the DWARF file in a dSYM bundle is the name of the binary it belongs to.
+func (s *Symbolicator) ImageName(uuid string) (string, bool) {
+	image, ok := s.images[normalizeUUID(uuid)]
+	if !ok {
+		return "", false
+	}
+	return filepath.Base(image.path), true
+}
+
+func (s *Symbolicator) loadFile(p string) error {
+	fat, err := macho.OpenFat(p)
+	if err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			if err := s.loadMachO(p, arch.File); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !errors.Is(err, macho.ErrNotFat) {
+		return err
+	}
+	f, err := macho.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.loadMachO(p, f)
+}
+
+func (s *Symbolicator) loadMachO(p string, f *macho.File) error {
+	uuid := ""
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) >= 24 && macho.LoadCmd(f.ByteOrder.Uint32(raw)) == loadCmdUUID {
+			uuid = hex.EncodeToString(raw[8:24])
+		}
+	}
+	if uuid == "" {
+		return fmt.Errorf("crashreport: %s has no LC_UUID", p)
+	}
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return fmt.Errorf("crashreport: %s has no __TEXT segment", p)
+	}
+
+	image := &debugImage{path: p, textAddr: text.Addr}
+	if d, err := f.DWARF(); err == nil {
+		image.dwarf = d
+		image.functions = dwarfFunctions(d)
+	} else {
+		golog.Debug("no DWARF in image, falling back to the symbol table", "module", logModule, "path", p, "err", err)
+	}
+	image.symbols = symtabFunctions(f)
+	s.images[uuid] = image
+	return nil
+}
+
+func dwarfFunctions(d *dwarf.Data) []function {
+	var functions []function
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil || entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		if name == "" {
+			name, _ = entry.Val(dwarf.AttrLinkageName).(string)
+		}
+		ranges, err := d.Ranges(entry)
+		if err != nil || name == "" {
+			continue
+		}
+		for _, rng := range ranges {
+			functions = append(functions, function{name: name, low: rng[0], high: rng[1]})
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].low < functions[j].low })
+	return functions
+}
+
+func symtabFunctions(f *macho.File) []function {
+	if f.Symtab == nil {
+		return nil
+	}
+	var symbols []function
+	for _, sym := range f.Symtab.Syms {
+		// only defined symbols in a section, stabs debugging entries are skipped
+		if sym.Sect == 0 || sym.Type&0xe0 != 0 || sym.Value == 0 {
+			continue
+		}
+		symbols = append(symbols, function{name: strings.TrimPrefix(sym.Name, "_"), low: sym.Value})
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].low < symbols[j].low })
+	return symbols
+}
+
+// Lookup resolves the address at imageOffset bytes from the load address of the image with the given UUID
+func (s *Symbolicator) Lookup(uuid string, imageOffset uint64) (Symbol, bool) {
+	image, ok := s.images[normalizeUUID(uuid)]
+	if !ok {
+		return Symbol{}, false
+	}
+	addr := image.textAddr + imageOffset
+
+	var symbol Symbol
+	i := sort.Search(len(image.functions), func(i int) bool { return image.functions[i].low > addr }) - 1
+	if i >= 0 && addr < image.functions[i].high {
+		symbol.Function = image.functions[i].name
+		symbol.Offset = addr - image.functions[i].low
+	} else if i := sort.Search(len(image.symbols), func(i int) bool { return image.symbols[i].low > addr }) - 1; i >= 0 {
+		symbol.Function = image.symbols[i].name
+		symbol.Offset = addr - image.symbols[i].low
+	}
+
+	if image.dwarf != nil {
+		r := image.dwarf.Reader()
+		if cu, err := r.SeekPC(addr); err == nil {
+			if lr, err := image.dwarf.LineReader(cu); err == nil && lr != nil {
+				var line dwarf.LineEntry
+				if lr.SeekPC(addr, &line) == nil && line.File != nil {
+					symbol.File = line.File.Name
+					symbol.Line = line.Line
+				}
+			}
+		}
+	}
+	return symbol, symbol.Function != ""
+}
+
+// Symbolicate rewrites all frames of the report that belong to an image with a
+// loaded dSYM and returns how many frames were resolved. The raw body is
+// updated as well, so [Report.Bytes] returns the symbolicated .ips file. Only the
+// resolved frame objects of the body are rewritten, everything else is kept byte for byte.
+func (s *Symbolicator) Symbolicate(r *Report) (int, error) {
+	if r.Crash == nil {
+		return 0, nil
+	}
+	spans, err := frameSpans(r.Body)
+	if err != nil {
+		return 0, fmt.Errorf("crashreport: invalid body in %s: %w", r.Name, err)
+	}
+
+	resolved := 0
+	var patches []bodyPatch
+	for t := range r.Crash.Threads {
+		frames := r.Crash.Threads[t].Frames
+		for i := range frames {
+			f := &frames[i]
+			if f.ImageIndex < 0 || f.ImageIndex >= len(r.Crash.UsedImages) {
+				continue
+			}
+			offset := f.ImageOffset
+			// all but the first frame are return addresses that point behind the call
+			if i > 0 && offset > 0 {
+				offset--
+			}
+			symbol, ok := s.Lookup(r.Crash.UsedImages[f.ImageIndex].UUID, offset)
+			if !ok {
+				continue
+			}
+			f.Symbol = symbol.Function
+			f.SymbolLocation = symbol.Offset + (f.ImageOffset - offset)
+			f.SourceFile = symbol.File
+			f.SourceLine = symbol.Line
+			resolved++
+			if t >= len(spans) || i >= len(spans[t]) {
+				continue
+			}
+			patch, err := rawFramePatch(r.Body, spans[t][i], *f)
+			if err != nil {
+				return resolved, fmt.Errorf("crashreport: invalid frame in %s: %w", r.Name, err)
+			}
+			patches = append(patches, patch)
+		}
+	}
+
+	// frames are patched back to front, so the spans of the earlier ones stay valid
+	body := bytes.Clone(r.Body)
+	for i := len(patches) - 1; i >= 0; i-- {
+		p := patches[i]
+		body = append(body[:p.start:p.start], append(p.data, body[p.end:]...)...)
+	}
+	r.Body = body
+	return resolved, nil
+}
+
+// bodyPatch replaces the bytes between start and end of a report body with data
+type bodyPatch struct {
+	start, end int
+	data       []byte
+}
+
+// frameSpans returns the byte ranges of the frame objects of every thread of the body
+func frameSpans(body []byte) ([][]bodyPatch, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	var threads [][]bodyPatch
+	err := decodeObject(decoder, func(key string) error {
+		if key != "threads" {
+			return skipValue(decoder)
+		}
+		return decodeArray(decoder, func() error {
+			var frames []bodyPatch
+			err := decodeObject(decoder, func(key string) error {
+				if key != "frames" {
+					return skipValue(decoder)
+				}
+				return decodeArray(decoder, func() error {
+					var raw json.RawMessage
+					if err := decoder.Decode(&raw); err != nil {
+						return err
+					}
+					end := int(decoder.InputOffset())
+					frames = append(frames, bodyPatch{start: end - len(raw), end: end})
+					return nil
+				})
+			})
+			threads = append(threads, frames)
+			return err
+		})
+	})
+	return threads, err
+}
+
+// rawFramePatch sets the symbol fields of the frame object at span in body. The other
+// fields keep their order and encoding.
+func rawFramePatch(body []byte, span bodyPatch, f Frame) (bodyPatch, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body[span.start:span.end]))
+	var keys []string
+	values := map[string]json.RawMessage{}
+	err := decodeObject(decoder, func(key string) error {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+		return nil
+	})
+	if err != nil {
+		return bodyPatch{}, err
+	}
+	set := func(key string, value any) error {
+		encoded, err := marshalNoHTMLEscape(value)
+		if err != nil {
+			return err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = encoded
+		return nil
+	}
+	if err := set("symbol", f.Symbol); err != nil {
+		return bodyPatch{}, err
+	}
+	if err := set("symbolLocation", f.SymbolLocation); err != nil {
+		return bodyPatch{}, err
+	}
+	if f.SourceFile != "" {
+		if err := set("sourceFile", f.SourceFile); err != nil {
+			return bodyPatch{}, err
+		}
+		if err := set("sourceLine", f.SourceLine); err != nil {
+			return bodyPatch{}, err
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		encodedKey, err := marshalNoHTMLEscape(key)
+		if err != nil {
+			return bodyPatch{}, err
+		}
+		b.Write(encodedKey)
+		b.WriteByte(':')
+		b.Write(values[key])
+	}
+	b.WriteByte('}')
+	span.data = b.Bytes()
+	return span, nil
+}
+
+// marshalNoHTMLEscape encodes v like json.Marshal but keeps <, > and & as they are
+func marshalNoHTMLEscape(v any) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// decodeObject reads a JSON object and calls value for every key, which has to consume its value
+func decodeObject(decoder *json.Decoder, value func(key string) error) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key %v", token)
+		}
+		if err := value(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+// decodeArray reads a JSON array and calls element for every element, which has to consume it
+func decodeArray(decoder *json.Decoder, element func() error) error {
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+func skipValue(decoder *json.Decoder) error {
+	var raw json.RawMessage
+	return decoder.Decode(&raw)
+}
+
+// SymbolicateFile symbolicates the .ips report at p in place and returns how many frames were resolved
+func (s *Symbolicator) SymbolicateFile(p string) (int, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	report, err := ParseReport(filepath.Base(p), data)
+	if err != nil {
+		return 0, err
+	}
+	resolved, err := s.Symbolicate(&report)
+	if err != nil || resolved == 0 {
+		return resolved, err
+	}
+	return resolved, os.WriteFile(p, report.Bytes(), 0o644)
+}
+
+func normalizeUUID(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
@@ -0,0 +1,115 @@
+package crashreport
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtureProgram = `package main
+
+//go:noinline
+func crash(p *int) int {
+	return *p + 1
+}
+
+func main() { println(crash(nil)) }
+`
+
+// buildDSYM cross compiles a small darwin/arm64 program, Go binaries contain
+// DWARF and an LC_UUID just like the DWARF file in a dSYM bundle.
+func buildDSYM(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building a Mach-O fixture is slow")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(fixtureProgram), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module fixture\n\ngo 1.21\n"), 0o644))
+	dwarfDir := filepath.Join(dir, "Fixture.app.dSYM", "Contents", "Resources", "DWARF")
+	require.NoError(t, os.MkdirAll(dwarfDir, 0o755))
+
+	cmd := exec.Command(goBin, "build", "-gcflags=all=-N -l", "-o", filepath.Join(dwarfDir, "Fixture"), ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH=arm64", "CGO_ENABLED=0", "GOFLAGS=", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return dir
+}
+
+func TestSymbolicate(t *testing.T) {
+	dir := buildDSYM(t)
+	symbolicator, err := NewSymbolicator(dir)
+	require.NoError(t, err)
+	require.Len(t, symbolicator.UUIDs(), 1)
+	uuid := symbolicator.UUIDs()[0]
+	image := symbolicator.images[uuid]
+
+	var crashFunc function
+	for _, f := range image.functions {
+		if f.name == "main.crash" {
+			crashFunc = f
+		}
+	}
+	require.NotZero(t, crashFunc.low, "main.crash not found in DWARF")
+	offset := crashFunc.low - image.textAddr + 8
+
+	dashedUUID := fmt.Sprintf("%s-%s-%s-%s-%s", uuid[0:8], uuid[8:12], uuid[12:16], uuid[16:20], uuid[20:])
+	data := fmt.Sprintf(`{"app_name":"Fixture","bug_type":"309","bundleID":"com.example.fixture"}
+{"procName":"Fixture","procPath":"/<Fixture> & more","faultingThread":0,"extraField":{"kept":true},
+ "threads":[{"triggered":true,"frames":[{"imageOffset":%d,"imageIndex":0},{"imageOffset":4,"imageIndex":1}]}],
+ "usedImages":[{"base":4294967296,"uuid":"%s","name":"Fixture"},{"base":8589934592,"uuid":"00000000-0000-0000-0000-000000000000","name":"libsystem_c.dylib"}]}`, offset, strings.ToUpper(dashedUUID))
+	report, err := ParseReport("Fixture.ips", []byte(data))
+	require.NoError(t, err)
+	name, ok := symbolicator.ImageName(strings.ToUpper(dashedUUID))
+	assert.True(t, ok)
+	assert.Equal(t, "Fixture", name)
+
+	resolved, err := symbolicator.Symbolicate(&report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved)
+	frame := report.Crash.Threads[0].Frames[0]
+	assert.Equal(t, "main.crash", frame.Symbol)
+	assert.Equal(t, uint64(8), frame.SymbolLocation)
+	assert.Equal(t, "main.go", filepath.Base(frame.SourceFile))
+	assert.Greater(t, frame.SourceLine, 0)
+	assert.Empty(t, report.Crash.Threads[0].Frames[1].Symbol)
+
+	// the rewritten .ips parses to the same frames, only the resolved frame changed
+	reparsed, err := ParseReport("Fixture.ips", report.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, report.Crash.Threads, reparsed.Crash.Threads)
+	original, err := ParseReport("Fixture.ips", []byte(data))
+	require.NoError(t, err)
+	resolvedFrame := fmt.Sprintf(`{"imageOffset":%d,"imageIndex":0,"symbol":"main.crash","symbolLocation":8,"sourceFile":%q,"sourceLine":%d}`, offset, frame.SourceFile, frame.SourceLine)
+	expected := strings.Replace(string(original.Body), fmt.Sprintf(`{"imageOffset":%d,"imageIndex":0}`, offset), resolvedFrame, 1)
+	assert.Equal(t, expected, string(report.Body))
+}
+
+func TestSymbolicatorRejectsNonMachO(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(p, []byte("not a binary"), 0o644))
+	_, err := NewSymbolicator(p)
+	assert.Error(t, err)
+}
+
+func TestRawFramePatchKeepsHTMLCharacters(t *testing.T) {
+	body := []byte(`{"threads":[{"frames":[{"imageOffset":1,"imageIndex":0}]}]}`)
+	spans, err := frameSpans(body)
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0], 1)
+	patch, err := rawFramePatch(body, spans[0][0], Frame{Symbol: "closure #1 in <Lambda> & more", SymbolLocation: 4})
+	require.NoError(t, err)
+	assert.Equal(t, `{"imageOffset":1,"imageIndex":0,"symbol":"closure #1 in <Lambda> & more","symbolLocation":4}`, string(patch.data))
+}
@@ -0,0 +1,250 @@
+package crashreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+// DefaultWatchInterval is the poll interval of [Watch] if none is configured
+const DefaultWatchInterval = 5 * time.Second
+
+// WatchOptions configures [Watch]
+type WatchOptions struct {
+	// BundleID only emits reports of the app with this bundle identifier if set
+	BundleID string
+	// Interval between two polls of the crash report directory, defaults to DefaultWatchInterval
+	Interval time.Duration
+	// DownloadDir is the directory new reports are copied to, they are not downloaded if empty
+	DownloadDir string
+	// StatePath is the file the names of already emitted reports are stored in, so a restarted
+	// watch does not emit them again. If the file does not exist yet, the reports that are on
+	// the device when the watch starts are recorded without emitting events.
+	StatePath string
+}
+
+// WatchEvent is emitted once for every new crash report
+type WatchEvent struct {
+	// Name is the path of the report in the crash report directory
+	Name   string `json:"name"`
+	Header Header `json:"header"`
+	// LocalPath is the path of the downloaded report if WatchOptions.DownloadDir is set
+	LocalPath string    `json:"localPath,omitempty"`
+	Time      time.Time `json:"time"`
+	// Error is set if the report could not be parsed, Header is empty then. Such reports
+	// are emitted regardless of WatchOptions.BundleID because their app is unknown.
+	Error string `json:"error,omitempty"`
+}
+
+// WatchState is the set of report names a watch has already seen
+type WatchState struct {
+	Seen map[string]time.Time `json:"seen"`
+	path string
+}
+
+// LoadWatchState reads the state stored at p. A missing file returns an empty state and exists=false.
+func LoadWatchState(p string) (state *WatchState, exists bool, err error) {
+	state = &WatchState{Seen: map[string]time.Time{}, path: p}
+	if p == "" {
+		return state, false, nil
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, false, err
+	}
+	if state.Seen == nil {
+		state.Seen = map[string]time.Time{}
+	}
+	return state, true, nil
+}
+
+// Save writes the state atomically to the file it was loaded from
+func (s *WatchState) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// unseen returns the names not in the state yet and forgets names that are gone from the device
+func (s *WatchState) unseen(names []string) []string {
+	present := make(map[string]bool, len(names))
+	var result []string
+	for _, name := range names {
+		present[name] = true
+		if _, ok := s.Seen[name]; !ok {
+			result = append(result, name)
+		}
+	}
+	for name := range s.Seen {
+		if !present[name] {
+			delete(s.Seen, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Watch polls the crash report directory of the device until ctx is done and calls
+// handler once for every new .ips report. The crash report mover is triggered before
+// each poll, so reports show up shortly after the crash. Poll errors, like a
+// disconnected device, are logged and the watch keeps polling.
+func Watch(ctx context.Context, device ios.DeviceEntry, options WatchOptions, handler func(WatchEvent)) error {
+	if options.Interval <= 0 {
+		options.Interval = DefaultWatchInterval
+	}
+	state, exists, err := LoadWatchState(options.StatePath)
+	if err != nil {
+		return err
+	}
+	if options.DownloadDir != "" {
+		if err := os.MkdirAll(options.DownloadDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	w := watcher{device: device, options: options, state: state, handler: handler, baseline: !exists, unparsed: map[string]int{}}
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(); err != nil {
+			golog.Warn("polling crash reports failed", "module", logModule, "udid", device.Properties.SerialNumber, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type watcher struct {
+	device  ios.DeviceEntry
+	options WatchOptions
+	state   *WatchState
+	handler func(WatchEvent)
+	// baseline records the reports of the first poll without emitting them
+	baseline bool
+	// unparsed are the sizes of reports that could not be parsed in the last poll
+	unparsed map[string]int
+}
+
+func (w *watcher) poll() error {
+	client, err := New(w.device)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var names []string
+	err = client.WalkDir(".", func(p string, info afc.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Type != afc.S_IFDIR && strings.HasSuffix(p, ".ips") {
+			names = append(names, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	newNames := w.state.unseen(names)
+	for name := range w.unparsed {
+		if !slices.Contains(newNames, name) {
+			delete(w.unparsed, name)
+		}
+	}
+	if w.baseline {
+		golog.Info("recording existing crash reports", "module", logModule, "count", len(newNames))
+		now := time.Now()
+		for _, name := range newNames {
+			w.state.Seen[name] = now
+		}
+		w.baseline = false
+		return w.state.Save()
+	}
+	for _, name := range newNames {
+		if err := w.emit(client, name); err != nil {
+			return err
+		}
+	}
+	return w.state.Save()
+}
+
+func (w *watcher) emit(client *afc.Client, name string) error {
+	f, err := client.Open(name, afc.READ_ONLY)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return w.emitReport(name, data)
+}
+
+// emitReport emits the report name with the contents data. Reports are written in place, so a
+// report that cannot be parsed is read again on the next poll. Once its size did not change
+// between two polls it is complete and emitted with the parse error.
+func (w *watcher) emitReport(name string, data []byte) error {
+	event := WatchEvent{Name: name, Time: time.Now()}
+	report, err := ParseReport(name, data)
+	if err != nil {
+		if size, ok := w.unparsed[name]; !ok || size != len(data) {
+			golog.Debug("crash report cannot be parsed yet", "module", logModule, "name", name, "err", err)
+			w.unparsed[name] = len(data)
+			return nil
+		}
+		delete(w.unparsed, name)
+		event.Error = err.Error()
+	} else {
+		delete(w.unparsed, name)
+		event.Header = report.Header
+		data = report.Bytes()
+	}
+	w.state.Seen[name] = event.Time
+	if event.Error == "" && w.options.BundleID != "" && report.Summary(0).BundleID != w.options.BundleID {
+		return nil
+	}
+	if w.options.DownloadDir != "" {
+		event.LocalPath = filepath.Join(w.options.DownloadDir, path.Base(name))
+		if err := os.WriteFile(event.LocalPath, data, 0o644); err != nil {
+			return err
+		}
+	}
+	w.handler(event)
+	// saved after every event, so a crash of the watcher does not emit it again
+	return w.state.Save()
+}
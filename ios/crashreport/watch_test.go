@@ -0,0 +1,61 @@
+package crashreport
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchStatePersistsSeenReports(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "state", "watch.json")
+	state, exists, err := LoadWatchState(p)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Equal(t, []string{"a.ips", "b.ips"}, state.unseen([]string{"b.ips", "a.ips"}))
+	state.Seen["a.ips"] = time.Now()
+	require.NoError(t, state.Save())
+
+	reloaded, exists, err := LoadWatchState(p)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []string{"b.ips", "c.ips"}, reloaded.unseen([]string{"a.ips", "b.ips", "c.ips"}))
+}
+
+func TestWatchStateForgetsRemovedReports(t *testing.T) {
+	state, _, err := LoadWatchState("")
+	require.NoError(t, err)
+	state.Seen["old.ips"] = time.Now()
+	state.Seen["kept.ips"] = time.Now()
+
+	assert.Empty(t, state.unseen([]string{"kept.ips"}))
+	assert.NotContains(t, state.Seen, "old.ips")
+	assert.Contains(t, state.Seen, "kept.ips")
+}
+
+func TestWatcherEmitsUnparsableReportsOnceComplete(t *testing.T) {
+	var events []WatchEvent
+	dir := t.TempDir()
+	w := watcher{
+		options:  WatchOptions{BundleID: "com.example.app", DownloadDir: dir},
+		state:    &WatchState{Seen: map[string]time.Time{}},
+		handler:  func(event WatchEvent) { events = append(events, event) },
+		unparsed: map[string]int{},
+	}
+
+	require.NoError(t, w.emitReport("a.ips", []byte("{\"app_na")))
+	require.NoError(t, w.emitReport("a.ips", []byte("{\"app_name\":")))
+	assert.Empty(t, events, "reports are read again while they grow")
+	assert.NotContains(t, w.state.Seen, "a.ips")
+
+	require.NoError(t, w.emitReport("a.ips", []byte("{\"app_name\":")))
+	require.Len(t, events, 1)
+	assert.Equal(t, "a.ips", events[0].Name)
+	assert.NotEmpty(t, events[0].Error)
+	assert.Equal(t, filepath.Join(dir, "a.ips"), events[0].LocalPath)
+	assert.Contains(t, w.state.Seen, "a.ips")
+	assert.Empty(t, w.unparsed)
+}
@@ -173,22 +173,36 @@ func notifyOfPublishedCapabilities(msg Message) {
 
 // NewUsbmuxdConnection connects and starts reading from a Dtx based service on the device
 func NewUsbmuxdConnection(device ios.DeviceEntry, serviceName string) (*Connection, error) {
+	if conn, ok, err := replayedConnection(serviceName); ok {
+		return conn, err
+	}
 	conn, err := ios.ConnectToService(device, serviceName)
 	if err != nil {
 		return nil, err
 	}
 
-	return newDtxConnection(conn)
+	return newDtxConnection(recordConnection(conn, serviceName))
 }
 
 // NewTunnelConnection connects and starts reading from a Dtx based service on the device, using tunnel interface instead of usbmuxd
 func NewTunnelConnection(device ios.DeviceEntry, serviceName string) (*Connection, error) {
+	if conn, ok, err := replayedConnection(serviceName); ok {
+		return conn, err
+	}
 	conn, err := ios.ConnectToServiceTunnelIface(device, serviceName)
 	if err != nil {
 		return nil, err
 	}
 
-	return newDtxConnection(conn)
+	return newDtxConnection(recordConnection(conn, serviceName))
+}
+
+// NewConnection connects to a Dtx based service over the tunnel interface if the device supports RSD and over usbmuxd otherwise
+func NewConnection(device ios.DeviceEntry, serviceName string) (*Connection, error) {
+	if device.SupportsRsd() {
+		return NewTunnelConnection(device, serviceName)
+	}
+	return NewUsbmuxdConnection(device, serviceName)
 }
 
 func newDtxConnection(conn ios.DeviceConnectionInterface) (*Connection, error) {
@@ -96,6 +96,11 @@ func ReadMessage(reader io.Reader) (Message, error) {
 			return Message{}, err
 		}
 
+		// type 1 messages carry raw data like kdebug buffers instead of an archived object
+		if result.PayloadHeader.MessageType == UnknownTypeOne {
+			result.Payload = []interface{}{payloadBytes}
+			return result, nil
+		}
 		payload, err := nskeyedarchiver.Unarchive(payloadBytes)
 		if err != nil {
 			return Message{}, err
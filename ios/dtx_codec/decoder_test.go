@@ -218,3 +218,14 @@ func TestDecoder(t *testing.T) {
 		}
 	}
 }
+
+func TestReadMessageRawPayload(t *testing.T) {
+	raw := []byte{0x00, 0x10, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef}
+	messageBytes, err := dtx.Encode(7, 0, 3, false, dtx.UnknownTypeOne, raw, dtx.NewPrimitiveDictionary())
+	assert.NoError(t, err)
+
+	msg, err := dtx.ReadMessage(bufio.NewReader(bytes.NewReader(messageBytes)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []interface{}{raw}, msg.Payload)
+	}
+}
@@ -0,0 +1,271 @@
+package dtx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+)
+
+// Direction tells if a recorded frame was sent to or received from the device
+type Direction string
+
+const (
+	DirectionSent     Direction = "sent"
+	DirectionReceived Direction = "received"
+)
+
+// RecordedFrame is one frame of a recorded DTX session. Fragmented messages are recorded
+// frame by frame, the first fragment is only a header. Bytes contains the frame exactly as
+// it was sent or received, the other fields are decoded from it for reading and matching.
+type RecordedFrame struct {
+	// Connection numbers the DTX connections of a recording in the order they were opened
+	Connection        int           `json:"connection"`
+	Service           string        `json:"service,omitempty"`
+	Direction         Direction     `json:"direction"`
+	Identifier        int           `json:"identifier"`
+	ConversationIndex int           `json:"conversationIndex"`
+	Channel           int           `json:"channel"`
+	ExpectsReply      bool          `json:"expectsReply"`
+	FragmentIndex     uint16        `json:"fragmentIndex"`
+	Fragments         uint16        `json:"fragments"`
+	Type              string        `json:"type,omitempty"`
+	Selector          string        `json:"selector,omitempty"`
+	Auxiliary         []interface{} `json:"auxiliary,omitempty"`
+	Bytes             []byte        `json:"bytes"`
+}
+
+// Recorder writes every frame sent and received by DTX connections as JSON lines. Each line
+// is written with a single call to Write, so a recording stays readable if the process exits
+// without closing it.
+type Recorder struct {
+	mu          sync.Mutex
+	w           io.Writer
+	connections int
+}
+
+// NewRecorder creates a Recorder that writes to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+var activeRecorder atomic.Pointer[Recorder]
+
+// SetRecorder records all DTX connections that are opened afterwards with r. Passing nil
+// stops recording new connections.
+func SetRecorder(r *Recorder) {
+	activeRecorder.Store(r)
+}
+
+// recordConnection wraps conn with the active Recorder, if there is one
+func recordConnection(conn ios.DeviceConnectionInterface, service string) ios.DeviceConnectionInterface {
+	r := activeRecorder.Load()
+	if r == nil {
+		return conn
+	}
+	return r.Wrap(conn, service)
+}
+
+// Wrap returns a connection that records all frames sent with Send and read from Reader
+// before passing them on to conn. Use it with connections that are not opened by the
+// functions of this package.
+func (r *Recorder) Wrap(conn ios.DeviceConnectionInterface, service string) ios.DeviceConnectionInterface {
+	r.mu.Lock()
+	index := r.connections
+	r.connections++
+	r.mu.Unlock()
+	return &recordingConnection{
+		DeviceConnectionInterface: conn,
+		sent:                      &frameSplitter{recorder: r, connection: index, service: service, direction: DirectionSent},
+		received:                  &frameSplitter{recorder: r, connection: index, service: service, direction: DirectionReceived},
+	}
+}
+
+func (r *Recorder) write(frame RecordedFrame) {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		// the raw bytes still contain the auxiliary arguments
+		golog.Debug("failed encoding auxiliary arguments of recorded frame", "module", logModule, "error", err)
+		frame.Auxiliary = nil
+		if line, err = json.Marshal(frame); err != nil {
+			golog.Warn("failed encoding recorded frame", "module", logModule, "error", err)
+			return
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		golog.Warn("failed writing recorded frame", "module", logModule, "error", err)
+	}
+}
+
+type recordingConnection struct {
+	ios.DeviceConnectionInterface
+	sent     *frameSplitter
+	received *frameSplitter
+}
+
+func (c *recordingConnection) Send(message []byte) error {
+	c.sent.Write(message)
+	return c.DeviceConnectionInterface.Send(message)
+}
+
+func (c *recordingConnection) Reader() io.Reader {
+	return io.TeeReader(c.DeviceConnectionInterface.Reader(), c.received)
+}
+
+// frameSplitter cuts the bytes of one direction of a connection into frames and records them
+type frameSplitter struct {
+	recorder   *Recorder
+	connection int
+	service    string
+	direction  Direction
+
+	mu  sync.Mutex
+	buf []byte
+	// outOfSync is set after a frame without DTX header, nothing is recorded afterwards
+	outOfSync bool
+}
+
+// Write never fails, so it does not interrupt the connection it records
+func (s *frameSplitter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outOfSync {
+		return len(p), nil
+	}
+	s.buf = append(s.buf, p...)
+	for {
+		length, complete := frameLength(s.buf)
+		if length < 0 {
+			golog.Warn("stopped recording after invalid frame header", "module", logModule, "connection", s.connection, "direction", s.direction)
+			s.buf = nil
+			s.outOfSync = true
+			break
+		}
+		if !complete {
+			break
+		}
+		frame := append([]byte(nil), s.buf[:length]...)
+		s.buf = s.buf[length:]
+		s.recorder.write(newRecordedFrame(s.connection, s.service, s.direction, frame))
+	}
+	return len(p), nil
+}
+
+// frameLength returns the length of the frame at the start of b and if b contains all of
+// it. The length is -1 if b does not start with a valid DTX header.
+func frameLength(b []byte) (int, bool) {
+	if len(b) < 32 {
+		return 0, false
+	}
+	if binary.BigEndian.Uint32(b) != DtxMessageMagic {
+		return -1, false
+	}
+	header := readHeader(b)
+	length := 32
+	if !header.IsFirstFragment() {
+		if header.MessageLength < 0 || header.MessageLength > maxMessageSize {
+			return -1, false
+		}
+		length += header.MessageLength
+	}
+	return length, len(b) >= length
+}
+
+func newRecordedFrame(connection int, service string, direction Direction, frame []byte) RecordedFrame {
+	header := readHeader(frame)
+	recorded := RecordedFrame{
+		Connection:        connection,
+		Service:           service,
+		Direction:         direction,
+		Identifier:        header.Identifier,
+		ConversationIndex: header.ConversationIndex,
+		Channel:           header.ChannelCode,
+		ExpectsReply:      header.ExpectsReply,
+		FragmentIndex:     header.FragmentIndex,
+		Fragments:         header.Fragments,
+		Bytes:             frame,
+	}
+	if header.IsFragment() {
+		return recorded
+	}
+	msg, _, err := DecodeNonBlocking(frame)
+	if err != nil {
+		golog.Debug("recording undecodable frame", "module", logModule, "error", err)
+		return recorded
+	}
+	recorded.Type = msg.PayloadHeader.MessageType.String()
+	recorded.Selector = selectorOf(msg)
+	for _, arg := range msg.Auxiliary.GetArguments() {
+		recorded.Auxiliary = append(recorded.Auxiliary, readableArgument(arg))
+	}
+	return recorded
+}
+
+func selectorOf(msg Message) string {
+	if msg.PayloadHeader.MessageType != Methodinvocation || len(msg.Payload) == 0 {
+		return ""
+	}
+	selector, _ := msg.Payload[0].(string)
+	return selector
+}
+
+// readableArgument unarchives archived auxiliary arguments that can be written as JSON,
+// everything else is recorded as it is
+func readableArgument(arg interface{}) interface{} {
+	archived, ok := arg.([]byte)
+	if !ok {
+		return arg
+	}
+	unarchived, err := nskeyedarchiver.Unarchive(archived)
+	if err != nil || len(unarchived) != 1 {
+		return arg
+	}
+	if _, err := json.Marshal(unarchived[0]); err != nil {
+		return arg
+	}
+	return unarchived[0]
+}
+
+// Recording is the list of frames of a recorded session
+type Recording []RecordedFrame
+
+// ReadRecording reads a recording written by a Recorder
+func ReadRecording(r io.Reader) (Recording, error) {
+	var recording Recording
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 2*maxMessageSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame RecordedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if length, _ := frameLength(frame.Bytes); length != len(frame.Bytes) {
+			return nil, fmt.Errorf("line %d: bytes are not one DTX frame", line)
+		}
+		recording = append(recording, frame)
+	}
+	return recording, scanner.Err()
+}
+
+// Connection returns the frames of one connection of the recording
+func (r Recording) Connection(index int) Recording {
+	var frames Recording
+	for _, frame := range r {
+		if frame.Connection == index {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
@@ -0,0 +1,150 @@
+package dtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testService = "com.apple.instruments.test"
+
+// deviceScript is a session of a device answering a channel request and a "hello" call with
+// a reply in three fragments. The identifier of the channel request is not the one a
+// Connection uses, the replay has to fix it in the reply.
+func deviceScript(t *testing.T) Recording {
+	frame := func(direction Direction, b []byte) RecordedFrame {
+		return newRecordedFrame(0, testService, direction, b)
+	}
+	archived := func(v interface{}) []byte {
+		b, err := nskeyedarchiver.ArchiveBin(v)
+		require.NoError(t, err)
+		return b
+	}
+	encode := func(identifier, conversationIndex, channel int, messageType MessageType, payload []byte, aux PrimitiveDictionary) []byte {
+		b, err := Encode(identifier, conversationIndex, channel, conversationIndex == 0, messageType, payload, aux)
+		require.NoError(t, err)
+		return b
+	}
+
+	capabilities := encode(1, 0, 0, Methodinvocation, archived("_notifyOfPublishedCapabilities:"), NewPrimitiveDictionary())
+	binary.LittleEndian.PutUint32(capabilities[28:], 0)
+	requestAux := NewPrimitiveDictionary()
+	requestAux.AddInt32(1)
+	requestAux.AddBytes(archived("com.test.channel"))
+
+	script := Recording{
+		frame(DirectionReceived, capabilities),
+		frame(DirectionSent, encode(99, 0, 0, Methodinvocation, archived(requestChannel), requestAux)),
+		frame(DirectionReceived, encode(99, 1, 0, ResponseWithReturnValueInPayload, nil, NewPrimitiveDictionary())),
+		frame(DirectionSent, encode(1, 0, 1, Methodinvocation, archived("hello"), NewPrimitiveDictionary())),
+	}
+	for _, fragment := range fragment(encode(1, 1, 1, ResponseWithReturnValueInPayload, archived("world"), NewPrimitiveDictionary()), 2) {
+		script = append(script, frame(DirectionReceived, fragment))
+	}
+	return script
+}
+
+// fragment splits message into a header fragment and n fragments with the body
+func fragment(message []byte, n int) [][]byte {
+	header := func(index int, length int) []byte {
+		h := append([]byte(nil), message[:32]...)
+		binary.LittleEndian.PutUint16(h[8:], uint16(index))
+		binary.LittleEndian.PutUint16(h[10:], uint16(n+1))
+		binary.LittleEndian.PutUint32(h[12:], uint32(length))
+		return h
+	}
+	body := message[32:]
+	fragments := [][]byte{header(0, len(body))}
+	size := (len(body) + n - 1) / n
+	for i := 0; i < n; i++ {
+		part := body[i*size : min((i+1)*size, len(body))]
+		fragments = append(fragments, append(header(i+1, len(part)), part...))
+	}
+	return fragments
+}
+
+func findFrame(t *testing.T, recording Recording, direction Direction, channel, conversationIndex int) RecordedFrame {
+	for _, frame := range recording {
+		if frame.Direction == direction && frame.Channel == channel && frame.ConversationIndex == conversationIndex {
+			return frame
+		}
+	}
+	require.Fail(t, "frame not recorded", "%s on channel %d", direction, channel)
+	return RecordedFrame{}
+}
+
+func callHello(t *testing.T, conn *Connection) {
+	channel := conn.RequestChannelIdentifier("com.test.channel", noopDispatcher{})
+	reply, err := channel.MethodCall("hello")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"world"}, reply.Payload)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var recorded bytes.Buffer
+	recorder := NewRecorder(&recorded)
+	conn, err := newDtxConnection(recorder.Wrap(NewReplayConnection(deviceScript(t)), testService))
+	require.NoError(t, err)
+	callHello(t, conn)
+	conn.Close()
+
+	recording, err := ReadRecording(&recorded)
+	require.NoError(t, err)
+	require.Len(t, recording, 7)
+
+	t.Run("frames", func(t *testing.T) {
+		// the capabilities message is read concurrently to the channel request, so the
+		// order of the first two frames is not fixed
+		request := findFrame(t, recording, DirectionSent, 0, 0)
+		assert.Equal(t, testService, request.Service)
+		assert.Equal(t, 5, request.Identifier)
+		assert.Equal(t, "Methodinvocation", request.Type)
+		assert.Equal(t, requestChannel, request.Selector)
+		assert.Equal(t, []interface{}{float64(1), "com.test.channel"}, request.Auxiliary)
+
+		reply := findFrame(t, recording, DirectionReceived, 0, 1)
+		assert.Equal(t, 5, reply.Identifier, "identifier of the reply is the one of the request")
+
+		for i, frame := range recording[4:] {
+			assert.Equal(t, 1, frame.Channel)
+			assert.Equal(t, uint16(i), frame.FragmentIndex)
+			assert.Equal(t, uint16(3), frame.Fragments)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		SetReplay(recording)
+		defer SetReplay(nil)
+
+		conn, err := NewUsbmuxdConnection(ios.DeviceEntry{}, testService)
+		require.NoError(t, err)
+		defer conn.Close()
+		callHello(t, conn)
+
+		_, err = NewUsbmuxdConnection(ios.DeviceEntry{}, testService)
+		assert.Error(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		replay := NewReplayConnection(recording)
+		conn, err := NewReplayedConnection(replay)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		channel := conn.RequestChannelIdentifier("com.test.channel", noopDispatcher{})
+		_, err = channel.MethodCall("goodbye")
+		assert.True(t, errors.Is(err, ErrReplayMismatch))
+		assert.Equal(t, 4, replay.Remaining(), "the call and its three fragments were not replayed")
+	})
+}
+
+func TestReadRecordingRejectsInvalidFrames(t *testing.T) {
+	_, err := ReadRecording(bytes.NewBufferString(`{"connection":0,"direction":"sent","bytes":"AAAA"}`))
+	assert.Error(t, err)
+}
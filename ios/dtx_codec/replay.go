@@ -0,0 +1,235 @@
+package dtx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danielpaulus/go-ios/ios"
+)
+
+// ErrReplayMismatch is returned by ReplayConnection.Send if a message does not match the
+// next recorded message
+var ErrReplayMismatch = errors.New("message does not match the recording")
+
+// ReplayConnection plays back one connection of a recording in place of a device, so code
+// using a Connection can be tested against captured sessions. Received frames become
+// readable as soon as the sent messages recorded before them were sent. Sent messages have
+// to arrive in recorded order and match the channel and selector of the recorded message.
+// Acks are neither matched nor required, when they are sent depends on the dispatching
+// goroutines. Replies get the identifier of the message they answer, in case it differs
+// from the recording.
+type ReplayConnection struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	frames Recording
+	next   int
+	buf    []byte
+	closed bool
+	// identifiers maps recorded identifiers of sent messages to the identifiers used in replay
+	identifiers map[replayKey]int
+}
+
+type replayKey struct {
+	channel    int
+	identifier int
+}
+
+var _ ios.DeviceConnectionInterface = (*ReplayConnection)(nil)
+
+// NewReplayConnection creates a ReplayConnection for the frames of one connection, see
+// Recording.Connection
+func NewReplayConnection(frames Recording) *ReplayConnection {
+	c := &ReplayConnection{frames: frames, identifiers: map[replayKey]int{}}
+	c.cond = sync.NewCond(&c.mu)
+	c.release()
+	return c
+}
+
+// replaySession hands out the recorded connections of a recording, see SetReplay
+type replaySession struct {
+	mu          sync.Mutex
+	recording   Recording
+	connections []int
+}
+
+var activeReplay atomic.Pointer[replaySession]
+
+// SetReplay makes the functions of this package that connect to DTX services replay the
+// recording instead of connecting to the device. Each new connection to a service replays
+// the next recorded connection to it. Passing nil connects to the device again.
+func SetReplay(recording Recording) {
+	if recording == nil {
+		activeReplay.Store(nil)
+		return
+	}
+	session := &replaySession{recording: recording}
+	for _, frame := range recording {
+		if !slices.Contains(session.connections, frame.Connection) {
+			session.connections = append(session.connections, frame.Connection)
+		}
+	}
+	activeReplay.Store(session)
+}
+
+// replayedConnection returns the next recorded connection to service if a replay is set
+func replayedConnection(service string) (*Connection, bool, error) {
+	session := activeReplay.Load()
+	if session == nil {
+		return nil, false, nil
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for i, index := range session.connections {
+		frames := session.recording.Connection(index)
+		if frames[0].Service == service {
+			session.connections = slices.Delete(session.connections, i, i+1)
+			conn, err := newDtxConnection(NewReplayConnection(frames))
+			return conn, true, err
+		}
+	}
+	return nil, true, fmt.Errorf("replay: no recorded connection to %s left", service)
+}
+
+// NewReplayedConnection creates a Connection that reads from and sends to a ReplayConnection
+func NewReplayedConnection(replay *ReplayConnection) (*Connection, error) {
+	return newDtxConnection(replay)
+}
+
+// Send matches message with the next recorded sent message and makes the frames received
+// after it readable
+func (c *ReplayConnection) Send(message []byte) error {
+	msg, _, err := DecodeNonBlocking(message)
+	if err != nil {
+		return fmt.Errorf("replay: failed decoding sent message: %w", err)
+	}
+	if msg.PayloadHeader.MessageType == Ack {
+		return nil
+	}
+	selector := selectorOf(msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if c.next >= len(c.frames) {
+		return fmt.Errorf("%w: unexpected message on channel %d with selector %q after the end of the recording", ErrReplayMismatch, msg.ChannelCode, selector)
+	}
+	expected := c.frames[c.next]
+	if expected.Channel != msg.ChannelCode || expected.Selector != selector {
+		return fmt.Errorf("%w: got channel %d with selector %q, recorded channel %d with selector %q", ErrReplayMismatch, msg.ChannelCode, selector, expected.Channel, expected.Selector)
+	}
+	c.identifiers[replayKey{expected.Channel, expected.Identifier}] = msg.Identifier
+	c.next++
+	c.release()
+	return nil
+}
+
+// release makes all received frames up to the next sent message readable. Sent acks are
+// skipped.
+func (c *ReplayConnection) release() {
+	for ; c.next < len(c.frames); c.next++ {
+		frame := c.frames[c.next]
+		if frame.Direction == DirectionSent {
+			if frame.Type == Ack.String() {
+				continue
+			}
+			break
+		}
+		c.buf = append(c.buf, c.rewriteIdentifier(frame)...)
+	}
+	c.cond.Broadcast()
+}
+
+func (c *ReplayConnection) rewriteIdentifier(frame RecordedFrame) []byte {
+	identifier, ok := c.identifiers[replayKey{frame.Channel, frame.Identifier}]
+	if frame.ConversationIndex == 0 || !ok || identifier == frame.Identifier {
+		return frame.Bytes
+	}
+	rewritten := append([]byte(nil), frame.Bytes...)
+	binary.LittleEndian.PutUint32(rewritten[16:], uint32(identifier))
+	return rewritten
+}
+
+// Remaining returns how many recorded frames were not replayed yet, not counting sent acks
+func (c *ReplayConnection) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remaining := 0
+	for _, frame := range c.frames[c.next:] {
+		if frame.Direction == DirectionReceived || frame.Type != Ack.String() {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Read reads the released received frames. It blocks until there are frames or the
+// connection was closed.
+func (c *ReplayConnection) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 && !c.closed {
+		c.cond.Wait()
+	}
+	if len(c.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write sends p, which has to be a complete message
+func (c *ReplayConnection) Write(p []byte) (int, error) {
+	if err := c.Send(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close makes Read return io.EOF once the released frames were read
+func (c *ReplayConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *ReplayConnection) Reader() io.Reader {
+	return c
+}
+
+func (c *ReplayConnection) Writer() io.Writer {
+	return c
+}
+
+// Conn returns nil, there is no network connection
+func (c *ReplayConnection) Conn() net.Conn {
+	return nil
+}
+
+func (c *ReplayConnection) EnableSessionSsl(ios.PairRecord) error {
+	return nil
+}
+
+func (c *ReplayConnection) EnableSessionSslServerMode(ios.PairRecord) error {
+	return nil
+}
+
+func (c *ReplayConnection) EnableSessionSslHandshakeOnly(ios.PairRecord) error {
+	return nil
+}
+
+func (c *ReplayConnection) EnableSessionSslServerModeHandshakeOnly(ios.PairRecord) error {
+	return nil
+}
+
+func (c *ReplayConnection) DisableSessionSSL() {}
@@ -0,0 +1,291 @@
+package fileservice
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/afc"
+)
+
+// fileConn are the operations of a [Connection] that [FS] uses
+type fileConn interface {
+	ListDirectory(path string) ([]string, error)
+	PullFile(path string, writer io.Writer) error
+	PushFile(path string, reader io.Reader, fileSize int64, permissions int64, uid, gid int64) error
+}
+
+// FS exposes the domain of a [Connection] as an [afc.WriteFS], so it can be served over
+// WebDAV like an AFC client. The file service only lists names and transfers whole files:
+// sizes and modification times are only known for opened files, opening a file downloads
+// it to a temporary file and written files are uploaded when they are closed. Directories
+// cannot be created and nothing can be removed or renamed, those operations fail with
+// [errors.ErrUnsupported]. FS is not safe for concurrent use, just like the [Connection].
+type FS struct {
+	conn fileConn
+}
+
+var _ afc.WriteFS = (*FS)(nil)
+
+// NewFS creates an [FS] for the domain conn was created for
+func NewFS(conn *Connection) *FS {
+	return &FS{conn: conn}
+}
+
+// Open opens the named file for reading
+func (f *FS) Open(name string) (fs.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the given os.O_* flags. Directories can only be opened read-only
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (afc.WritableFile, error) {
+	info, err := f.Stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	if exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	if !exists && flag&os.O_CREATE == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if exists && info.IsDir() {
+		if writable {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		return &dir{fsys: f, name: name, info: info}, nil
+	}
+
+	spool, err := os.CreateTemp("", "go-ios-fileservice-*")
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	file := &file{conn: f.conn, name: name, spool: spool, writable: writable, dirty: !exists, perm: perm.Perm()}
+	if file.perm == 0 {
+		file.perm = 0o644
+	}
+	if exists && !(writable && flag&os.O_TRUNC != 0) {
+		if err := f.conn.PullFile(name, spool); err != nil {
+			file.discard()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		whence := io.SeekStart
+		if flag&os.O_APPEND != 0 {
+			whence = io.SeekEnd
+		}
+		if _, err := spool.Seek(0, whence); err != nil {
+			file.discard()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if exists && writable && flag&os.O_TRUNC != 0 {
+		file.dirty = true
+	}
+	return file, nil
+}
+
+// Stat returns information about the named file. The size and modification time of
+// files are unknown, see [FS].
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return fileInfo{name: ".", dir: true}, nil
+	}
+	names, err := f.conn.ListDirectory(path.Dir(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if !slices.Contains(names, path.Base(name)) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.entryInfo(name), nil
+}
+
+// entryInfo returns the info of an existing entry, only directories can be listed
+func (f *FS) entryInfo(name string) fileInfo {
+	_, err := f.conn.ListDirectory(name)
+	return fileInfo{name: path.Base(name), dir: err == nil}
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	names, err := f.conn.ListDirectory(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	slices.Sort(names)
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, n := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(f.entryInfo(path.Join(name, n))))
+	}
+	return entries, nil
+}
+
+// Mkdir is not supported by the file service
+func (f *FS) Mkdir(name string, _ fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Remove is not supported by the file service
+func (f *FS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errors.ErrUnsupported}
+}
+
+// RemoveAll is not supported by the file service
+func (f *FS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "removeall", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Rename is not supported by the file service
+func (f *FS) Rename(oldname, _ string) error {
+	return &fs.PathError{Op: "rename", Path: oldname, Err: errors.ErrUnsupported}
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// fileInfo implements [fs.FileInfo] for the names the file service lists
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// file is a file opened through [FS], its contents are kept in a temporary file
+type file struct {
+	conn     fileConn
+	name     string
+	spool    *os.File
+	writable bool
+	// dirty is true if the file has to be uploaded on Close
+	dirty bool
+	perm  fs.FileMode
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	return f.spool.Read(p)
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.dirty = true
+	return f.spool.Write(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	return f.spool.Seek(offset, whence)
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	info, err := f.spool.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: path.Base(f.name), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// Close uploads the file if it was created or written to
+func (f *file) Close() error {
+	defer f.discard()
+	if !f.writable || !f.dirty {
+		return nil
+	}
+	info, err := f.spool.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// like ios file push, files belong to the mobile user
+	if err := f.conn.PushFile(f.name, f.spool, info.Size(), int64(f.perm), 501, 501); err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *file) discard() {
+	f.spool.Close()
+	os.Remove(f.spool.Name())
+}
+
+// dir is a directory opened through [FS]
+type dir struct {
+	fsys    *FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+// ReadDir implements [fs.ReadDirFile]
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,158 @@
+package fileservice
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn is a file service domain with the given files, directories are derived from their paths
+type fakeConn struct {
+	files  map[string]string
+	pushed map[string]int64
+}
+
+func (c *fakeConn) ListDirectory(p string) ([]string, error) {
+	if _, ok := c.files[p]; ok {
+		return nil, errors.New("device error: not a directory")
+	}
+	var names []string
+	found := p == "."
+	for name := range c.files {
+		rest, ok := strings.CutPrefix(name, p+"/")
+		if p == "." {
+			rest, ok = name, true
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		child, _, _ := strings.Cut(rest, "/")
+		if !slices.Contains(names, child) {
+			names = append(names, child)
+		}
+	}
+	if !found {
+		return nil, errors.New("device error: no such directory")
+	}
+	return names, nil
+}
+
+func (c *fakeConn) PullFile(p string, writer io.Writer) error {
+	data, ok := c.files[p]
+	if !ok {
+		return errors.New("device error: no such file")
+	}
+	_, err := io.WriteString(writer, data)
+	return err
+}
+
+func (c *fakeConn) PushFile(p string, reader io.Reader, fileSize int64, permissions int64, _, _ int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != fileSize {
+		return errors.New("size mismatch")
+	}
+	c.files[p] = string(data)
+	c.pushed[p] = permissions
+	return nil
+}
+
+func newFakeFS() (*FS, *fakeConn) {
+	conn := &fakeConn{
+		files: map[string]string{
+			"Library/Preferences/group.plist": "prefs",
+			"Documents/shared.txt":            "shared",
+		},
+		pushed: map[string]int64{},
+	}
+	return &FS{conn: conn}, conn
+}
+
+func TestFS(t *testing.T) {
+	fsys, conn := newFakeFS()
+
+	t.Run("read", func(t *testing.T) {
+		data, err := fs.ReadFile(fsys, "Documents/shared.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "shared", string(data))
+
+		info, err := fs.Stat(fsys, "Library/Preferences")
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+
+		_, err = fs.Stat(fsys, "Documents/missing.txt")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		var files []string
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, p)
+			}
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Documents/shared.txt", "Library/Preferences/group.plist"}, files)
+	})
+
+	t.Run("open has the size of the file", func(t *testing.T) {
+		f, err := fsys.Open("Documents/shared.txt")
+		require.NoError(t, err)
+		defer f.Close()
+		info, err := f.Stat()
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("shared")), info.Size())
+		assert.Equal(t, "shared.txt", info.Name())
+	})
+
+	t.Run("write uploads on close", func(t *testing.T) {
+		f, err := fsys.OpenFile("Documents/new.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("new"))
+		require.NoError(t, err)
+		_, ok := conn.files["Documents/new.txt"]
+		assert.False(t, ok, "uploaded before close")
+		require.NoError(t, f.Close())
+		assert.Equal(t, "new", conn.files["Documents/new.txt"])
+		assert.Equal(t, int64(0o600), conn.pushed["Documents/new.txt"])
+	})
+
+	t.Run("append keeps the contents", func(t *testing.T) {
+		f, err := fsys.OpenFile("Documents/shared.txt", os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(" more"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		assert.Equal(t, "shared more", conn.files["Documents/shared.txt"])
+	})
+
+	t.Run("files that are only read are not uploaded", func(t *testing.T) {
+		conn.pushed = map[string]int64{}
+		data, err := fs.ReadFile(fsys, "Library/Preferences/group.plist")
+		require.NoError(t, err)
+		assert.Equal(t, "prefs", string(data))
+		assert.Empty(t, conn.pushed)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		assert.ErrorIs(t, fsys.Mkdir("Documents/sub", 0o755), errors.ErrUnsupported)
+		assert.ErrorIs(t, fsys.RemoveAll(path.Join("Documents", "shared.txt")), errors.ErrUnsupported)
+		assert.ErrorIs(t, fsys.Rename("Documents/shared.txt", "Documents/moved.txt"), errors.ErrUnsupported)
+		_, err := fsys.OpenFile("Documents", os.O_WRONLY, 0)
+		assert.Error(t, err)
+		_, err = fsys.OpenFile("Documents/shared.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0)
+		assert.ErrorIs(t, err, fs.ErrExist)
+	})
+}
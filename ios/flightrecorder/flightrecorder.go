@@ -0,0 +1,309 @@
+// Package flightrecorder keeps the most recent device logs in memory, so the logs
+// leading up to a failure can be written to a file after the failure happened.
+package flightrecorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/ostrace"
+	"github.com/danielpaulus/go-ios/ios/syslog"
+)
+
+const logModule = "go-ios/flightrecorder"
+
+const (
+	// DefaultWindow is the time span of logs kept if Options.Window is not set
+	DefaultWindow = 5 * time.Minute
+	// DefaultMaxEntries bounds the memory used if Options.MaxEntries is not set
+	DefaultMaxEntries = 200000
+	// reconnectInterval is how often a recorder without log streams tries to reconnect,
+	// in case the streams ended without the device being detached
+	reconnectInterval = 10 * time.Second
+)
+
+// Source is a log stream of the device
+type Source string
+
+const (
+	SourceSyslog  Source = "syslog"
+	SourceOsTrace Source = "ostrace"
+)
+
+// ParseSource validates a source name
+func ParseSource(name string) (Source, error) {
+	switch Source(name) {
+	case SourceSyslog, SourceOsTrace:
+		return Source(name), nil
+	}
+	return "", fmt.Errorf("unknown log source %q, use syslog or ostrace", name)
+}
+
+// Options configures a [Recorder]
+type Options struct {
+	// Sources are the log streams to record, defaults to syslog
+	Sources []Source
+	// Window is how far back a dump reaches, defaults to DefaultWindow
+	Window time.Duration
+	// MaxEntries is the capacity of the ring buffer, defaults to DefaultMaxEntries.
+	// Once it is full, the oldest entries are dropped even if they are inside the window.
+	MaxEntries int
+	// Dir is the directory [Recorder.DumpFile] writes to, defaults to the current directory
+	Dir string
+}
+
+// Entry is a recorded log line
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Source Source    `json:"source"`
+	// Message is the raw syslog line, or the message of an ostrace entry
+	Message string            `json:"message"`
+	OsTrace *ostrace.LogEntry `json:"ostrace,omitempty"`
+}
+
+// Recorder records the logs of one device into a ring buffer. Create it with [New]
+// and start recording with [Recorder.Run].
+type Recorder struct {
+	options Options
+	ring    *ring
+
+	mu     sync.Mutex
+	device ios.DeviceEntry
+}
+
+// New creates a recorder for the device
+func New(device ios.DeviceEntry, options Options) *Recorder {
+	if len(options.Sources) == 0 {
+		options.Sources = []Source{SourceSyslog}
+	}
+	if options.Window <= 0 {
+		options.Window = DefaultWindow
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultMaxEntries
+	}
+	return &Recorder{options: options, ring: newRing(options.MaxEntries), device: device}
+}
+
+// Run records until ctx is done. When the log streams end, because the device was
+// detached or rebooted, Run waits for the device to be attached again through
+// [ios.Listen] and resumes recording. The buffer is kept across reconnects.
+func (r *Recorder) Run(ctx context.Context) error {
+	attached := make(chan ios.AttachedMessage, 1)
+	go r.listen(ctx, attached)
+
+	for {
+		r.mu.Lock()
+		device := r.device
+		r.mu.Unlock()
+		r.record(ctx, device)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-attached:
+			r.mu.Lock()
+			// the usbmuxd device id changes on every attach, tunnel settings stay the same
+			r.device.DeviceID = msg.DeviceID
+			r.mu.Unlock()
+			golog.Info("device attached again, resuming recording", "module", logModule, "udid", msg.Properties.SerialNumber)
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+// listen forwards attach events of the recorded device until ctx is done
+func (r *Recorder) listen(ctx context.Context, attached chan<- ios.AttachedMessage) {
+	udid := r.udid()
+	for ctx.Err() == nil {
+		receive, closeFunc, err := ios.Listen()
+		if err != nil {
+			golog.Warn("failed listening for devices", "module", logModule, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectInterval):
+				continue
+			}
+		}
+		stop := context.AfterFunc(ctx, func() { closeFunc() })
+		for {
+			msg, err := receive()
+			if err != nil {
+				break
+			}
+			if msg.DeviceAttached() && msg.Properties.SerialNumber == udid {
+				select {
+				case attached <- msg:
+				default:
+				}
+			}
+		}
+		stop()
+		closeFunc()
+	}
+}
+
+func (r *Recorder) udid() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.device.Properties.SerialNumber
+}
+
+// record streams all sources into the ring buffer until all streams ended or ctx is done
+func (r *Recorder) record(ctx context.Context, device ios.DeviceEntry) {
+	var wg sync.WaitGroup
+	for _, source := range r.options.Sources {
+		var closer io.Closer
+		var read func() (Entry, error)
+		switch source {
+		case SourceSyslog:
+			conn, err := syslog.New(device)
+			if err != nil {
+				golog.Warn("failed connecting to syslog", "module", logModule, "err", err)
+				continue
+			}
+			closer = conn
+			read = func() (Entry, error) {
+				line, err := conn.ReadLogMessage()
+				return Entry{Time: time.Now(), Source: SourceSyslog, Message: trimLine(line)}, err
+			}
+		case SourceOsTrace:
+			levels := ostrace.DefaultLevelFilter()
+			conn, err := ostrace.New(device, -1, levels.MessageFilter, levels.StreamFlags)
+			if err != nil {
+				golog.Warn("failed connecting to os_trace_relay", "module", logModule, "err", err)
+				continue
+			}
+			closer = conn
+			read = func() (Entry, error) {
+				entry, err := conn.ReadFilteredEntry(ostrace.ClientFilter{})
+				return Entry{Time: time.Now(), Source: SourceOsTrace, Message: entry.Message, OsTrace: &entry}, err
+			}
+		}
+
+		wg.Add(1)
+		stop := context.AfterFunc(ctx, func() { closer.Close() })
+		go func() {
+			defer wg.Done()
+			defer stop()
+			defer closer.Close()
+			for {
+				entry, err := read()
+				if err != nil {
+					if ctx.Err() == nil {
+						golog.Info("log stream ended", "module", logModule, "source", source, "err", err)
+					}
+					return
+				}
+				r.ring.add(entry)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+var lineEnd = regexp.MustCompile(`[\x00\n]+$`)
+
+func trimLine(line string) string {
+	return lineEnd.ReplaceAllString(line, "")
+}
+
+// Add records an entry, for logs that come from elsewhere than the device streams
+func (r *Recorder) Add(entry Entry) {
+	r.ring.add(entry)
+}
+
+// Entries returns the recorded entries inside the window, oldest first
+func (r *Recorder) Entries() []Entry {
+	return r.ring.since(time.Now().Add(-r.options.Window))
+}
+
+// Dump writes the entries inside the window as JSON lines to w and returns how many were written
+func (r *Recorder) Dump(w io.Writer) (int, error) {
+	entries := r.Entries()
+	encoder := json.NewEncoder(w)
+	for i, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DumpFile writes the entries inside the window to a new file in Options.Dir and returns its path.
+// The file name contains the udid, the time and the reason, like "<udid>-20240501-101010-crash.jsonl".
+func (r *Recorder) DumpFile(reason string) (string, error) {
+	name := r.udid() + "-" + time.Now().Format("20060102-150405.000")
+	if reason != "" {
+		name += "-" + unsafeFileChars.ReplaceAllString(reason, "_")
+	}
+	p := filepath.Join(r.options.Dir, name+".jsonl")
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	n, err := r.Dump(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	golog.Info("flight recorder dump written", "module", logModule, "path", p, "entries", n, "reason", reason)
+	return p, nil
+}
+
+// ring is a fixed size buffer that overwrites its oldest entries
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	// next is the index the next entry is written to
+	next int
+	full bool
+}
+
+func newRing(capacity int) *ring {
+	return &ring{entries: make([]Entry, capacity)}
+}
+
+func (r *ring) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the entries at or after t, oldest first
+func (r *ring) since(t time.Time) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ordered := r.entries[:r.next]
+	if r.full {
+		ordered = append(append([]Entry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+	}
+	var result []Entry
+	for _, e := range ordered {
+		if !e.Time.Before(t) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package flightrecorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/testmanagerd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDevice() ios.DeviceEntry {
+	return ios.DeviceEntry{Properties: ios.DeviceProperties{SerialNumber: "00008030-TEST"}}
+}
+
+func messages(entries []Entry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.Message)
+	}
+	return result
+}
+
+func TestRingDropsOldestEntries(t *testing.T) {
+	r := New(testDevice(), Options{MaxEntries: 3})
+	now := time.Now()
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		r.Add(Entry{Time: now, Source: SourceSyslog, Message: m})
+	}
+	assert.Equal(t, []string{"c", "d", "e"}, messages(r.Entries()))
+}
+
+func TestEntriesOutsideWindowAreNotDumped(t *testing.T) {
+	r := New(testDevice(), Options{Window: time.Minute})
+	r.Add(Entry{Time: time.Now().Add(-2 * time.Minute), Source: SourceSyslog, Message: "old"})
+	r.Add(Entry{Time: time.Now(), Source: SourceSyslog, Message: "new"})
+
+	var b bytes.Buffer
+	n, err := r.Dump(&b)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	var entry Entry
+	require.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+	assert.Equal(t, "new", entry.Message)
+}
+
+func TestDumpFile(t *testing.T) {
+	dir := t.TempDir()
+	r := New(testDevice(), Options{Dir: dir})
+	r.Add(Entry{Time: time.Now(), Source: SourceSyslog, Message: "one"})
+	r.Add(Entry{Time: time.Now(), Source: SourceSyslog, Message: "two"})
+
+	p, err := r.DumpFile("crash-My App/1")
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(p))
+	assert.True(t, strings.HasPrefix(filepath.Base(p), "00008030-TEST-"))
+	assert.True(t, strings.HasSuffix(p, "-crash-My_App_1.jsonl"))
+
+	f, err := os.Open(p)
+	require.NoError(t, err)
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestDumpOnTestFailureDumpsEachTestOnce(t *testing.T) {
+	r := New(testDevice(), Options{Dir: t.TempDir()})
+	r.Add(Entry{Time: time.Now(), Source: SourceSyslog, Message: "log"})
+	listener := testmanagerd.NewTestListener(nil, nil, "")
+	var dumps []string
+	r.DumpOnTestFailure(listener, func(path string, _ testmanagerd.TestCase) {
+		dumps = append(dumps, path)
+	})
+
+	failing := testmanagerd.TestCase{ClassName: "LoginTests", MethodName: "testLogin"}
+	listener.OnTestFailure(failing)
+	listener.OnTestFailure(failing)
+	listener.OnTestFailure(testmanagerd.TestCase{ClassName: "LoginTests", MethodName: "testLogout"})
+
+	require.Len(t, dumps, 2)
+	assert.Contains(t, dumps[0], "test-LoginTests.testLogin")
+}
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("ostrace")
+	require.NoError(t, err)
+	assert.Equal(t, SourceOsTrace, source)
+	_, err = ParseSource("kernel")
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package flightrecorder
+
+import (
+	"context"
+	"sync"
+
+	"github.com/danielpaulus/go-ios/ios/crashreport"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/testmanagerd"
+)
+
+// DumpOnCrash watches the crash reports of the device until ctx is done and writes a
+// dump for every new report, see [crashreport.Watch] for the meaning of statePath.
+// onDump is called with the path of every dump and may be nil.
+func (r *Recorder) DumpOnCrash(ctx context.Context, statePath string, onDump func(path string, event crashreport.WatchEvent)) error {
+	r.mu.Lock()
+	device := r.device
+	r.mu.Unlock()
+	return crashreport.Watch(ctx, device, crashreport.WatchOptions{StatePath: statePath}, func(event crashreport.WatchEvent) {
+		p, err := r.DumpFile("crash-" + event.Header.AppName)
+		if err != nil {
+			golog.Warn("failed writing flight recorder dump", "module", logModule, "report", event.Name, "err", err)
+			return
+		}
+		if onDump != nil {
+			onDump(p, event)
+		}
+	})
+}
+
+// DumpOnTestFailure makes the listener write a dump when a test case fails.
+// Test cases that report several failures are dumped once.
+// onDump is called with the path of every dump and may be nil.
+func (r *Recorder) DumpOnTestFailure(listener *testmanagerd.TestListener, onDump func(path string, testCase testmanagerd.TestCase)) {
+	var mu sync.Mutex
+	dumped := map[string]bool{}
+	listener.OnTestFailure = func(testCase testmanagerd.TestCase) {
+		name := testCase.ClassName + "." + testCase.MethodName
+		mu.Lock()
+		seen := dumped[name]
+		dumped[name] = true
+		mu.Unlock()
+		if seen {
+			return
+		}
+		p, err := r.DumpFile("test-" + name)
+		if err != nil {
+			golog.Warn("failed writing flight recorder dump", "module", logModule, "test", name, "err", err)
+			return
+		}
+		if onDump != nil {
+			onDump(p, testCase)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package instruments
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/danielpaulus/go-ios/ios"
 	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
@@ -27,6 +28,45 @@ func (p loggingDispatcher) Dispatch(m dtx.Message) {
 	golog.Debug("dispatch message", "module", logModule, "message", m)
 }
 
+// messageDispatcher hands the messages of a DTX connection to the receive loop of a service.
+// The reader of the connection can still dispatch while the service is closed, so messages
+// is never closed. Receivers stop once done is closed instead.
+type messageDispatcher struct {
+	messages  chan dtx.Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMessageDispatcher() *messageDispatcher {
+	return &messageDispatcher{messages: make(chan dtx.Message), done: make(chan struct{})}
+}
+
+func (d *messageDispatcher) Dispatch(m dtx.Message) {
+	select {
+	case d.messages <- m:
+	case <-d.done:
+	}
+}
+
+// receive returns the next message, ok is false once the dispatcher is closed
+func (d *messageDispatcher) receive() (m dtx.Message, ok bool) {
+	select {
+	case <-d.done:
+		return dtx.Message{}, false
+	default:
+	}
+	select {
+	case m = <-d.messages:
+		return m, true
+	case <-d.done:
+		return dtx.Message{}, false
+	}
+}
+
+func (d *messageDispatcher) close() {
+	d.closeOnce.Do(func() { close(d.done) })
+}
+
 func connectInstrumentsWithMsgDispatcher(device ios.DeviceEntry, dispatcher dtx.Dispatcher) (*dtx.Connection, error) {
 	dtxConn, err := connectInstruments(device)
 	if err != nil {
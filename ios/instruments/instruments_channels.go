@@ -19,3 +19,7 @@ const (
 	assetsChannel           = "com.apple.instruments.server.services.assets"
 	activityTraceTapChannel = "com.apple.instruments.server.services.activitytracetap"
 )
+
+const energyChannel = "com.apple.xcode.debug-gauge-data-providers.Energy"
+
+const coreProfileSessionTapChannel = "com.apple.instruments.server.services.coreprofilesessiontap"
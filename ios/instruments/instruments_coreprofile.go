@@ -0,0 +1,184 @@
+package instruments
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+	"github.com/google/uuid"
+)
+
+// AllKdebugClasses is the kdebug filter that records the events of all classes
+const AllKdebugClasses uint32 = 0xffffffff
+
+// CoreProfileConfig configures the kernel trace of the core profile session tap
+type CoreProfileConfig struct {
+	// Filters are the kdebug filters, class<<24 | subclass<<16 values. Nil records all classes.
+	Filters []uint32
+	// CallstackDepth is the maximum number of frames of sampled callstacks, 128 if zero
+	CallstackDepth int
+	// SampleInterval enables the kperf timer that samples the callstacks of the running threads
+	SampleInterval time.Duration
+}
+
+// toMap builds the configuration dictionary in the format Instruments uses. Every trigger
+// ("tc") has a kind ("tk"), 3 for kdebug events and 1 for the kperf timer, and a list of
+// actions ("ta") that includes sampling the user callstack.
+func (c CoreProfileConfig) toMap() map[string]interface{} {
+	filters := c.Filters
+	if len(filters) == 0 {
+		filters = []uint32{AllKdebugClasses}
+	}
+	filterSet := make([]interface{}, len(filters))
+	for i, f := range filters {
+		filterSet[i] = uint64(f)
+	}
+	depth := c.CallstackDepth
+	if depth == 0 {
+		depth = 128
+	}
+	actions := func() []interface{} {
+		return []interface{}{[]interface{}{3}, []interface{}{0}, []interface{}{2}, []interface{}{1, 1, 0}}
+	}
+	triggers := []interface{}{
+		map[string]interface{}{
+			"csd":  depth,
+			"kdf2": nskeyedarchiver.NSSet{Objects: filterSet},
+			"ta":   actions(),
+			"tk":   3,
+			"uuid": uuid.New().String(),
+		},
+	}
+	if c.SampleInterval > 0 {
+		triggers = append(triggers, map[string]interface{}{
+			"csd":  depth,
+			"si":   uint64(c.SampleInterval.Nanoseconds()),
+			"ta":   actions(),
+			"tk":   1,
+			"uuid": uuid.New().String(),
+		})
+	}
+	return map[string]interface{}{
+		"tc": triggers,
+		"rp": 100,
+		"bm": 0,
+	}
+}
+
+type coreProfileDispatcher struct {
+	conn *dtx.Connection
+	data chan []byte
+	done chan struct{}
+}
+
+func (d *coreProfileDispatcher) Dispatch(m dtx.Message) {
+	dtx.SendAckIfNeeded(d.conn, m)
+	if len(m.Payload) == 0 {
+		return
+	}
+	data, ok := m.Payload[0].([]byte)
+	if !ok {
+		golog.Debug("core profile tap message without data", "module", logModule, "message", m)
+		return
+	}
+	select {
+	case d.data <- data:
+	case <-d.done:
+	}
+}
+
+// CoreProfileSessionTap streams the kernel trace of the device. The stream consists of
+// kcdata stackshots and kdebug buffers, see the kdebug package for decoding them.
+type CoreProfileSessionTap struct {
+	channel    *dtx.Channel
+	conn       *dtx.Connection
+	dispatcher *coreProfileDispatcher
+
+	closeOnce sync.Once
+}
+
+// NewCoreProfileSessionTap configures and starts a kernel trace
+func NewCoreProfileSessionTap(device ios.DeviceEntry, config CoreProfileConfig) (*CoreProfileSessionTap, error) {
+	dtxConn, err := connectInstruments(device)
+	if err != nil {
+		return nil, err
+	}
+	dispatcher := &coreProfileDispatcher{conn: dtxConn, data: make(chan []byte, 16), done: make(chan struct{})}
+	channel := dtxConn.RequestChannelIdentifier(coreProfileSessionTapChannel, dispatcher)
+	if _, err := channel.MethodCall("setConfig:", config.toMap()); err != nil {
+		dtxConn.Close()
+		return nil, err
+	}
+	if _, err := channel.MethodCall("start"); err != nil {
+		dtxConn.Close()
+		return nil, err
+	}
+	return &CoreProfileSessionTap{channel: channel, conn: dtxConn, dispatcher: dispatcher}, nil
+}
+
+// ReceiveData returns the raw trace data. Archived property lists the tap sends in
+// between are skipped. The chan is closed when the tap is closed.
+func (t *CoreProfileSessionTap) ReceiveData() chan []byte {
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+
+		for {
+			select {
+			case data := <-t.dispatcher.data:
+				if bytes.HasPrefix(data, []byte("bplist")) {
+					continue
+				}
+				select {
+				case messages <- data:
+				case <-t.dispatcher.done:
+					return
+				}
+			case <-t.dispatcher.done:
+				return
+			}
+		}
+	}()
+	return messages
+}
+
+// ReceiveEvents decodes the kdebug events of the trace, stackshots are skipped. Use either
+// ReceiveData or ReceiveEvents. The chan is closed when the tap is closed.
+func (t *CoreProfileSessionTap) ReceiveEvents() chan kdebug.Event {
+	events := make(chan kdebug.Event)
+	go func() {
+		defer close(events)
+
+		decoder := kdebug.NewDecoder()
+		for data := range t.ReceiveData() {
+			if kdebug.IsStackshot(data) {
+				continue
+			}
+			decoded, err := decoder.Decode(data)
+			if err != nil {
+				golog.Warn("failed decoding kdebug events", "module", logModule, "error", err)
+				continue
+			}
+			for _, e := range decoded {
+				select {
+				case events <- e:
+				case <-t.dispatcher.done:
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// Close stops the trace and closes the DTX connection
+func (t *CoreProfileSessionTap) Close() error {
+	t.closeOnce.Do(func() { close(t.dispatcher.done) })
+	_ = t.channel.MethodCallAsync("stop")
+	return t.conn.Close()
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/danielpaulus/go-ios/ios"
 	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
 	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
 )
 
@@ -102,6 +103,42 @@ func (d DeviceInfoService) HardwareInformation() (map[string]interface{}, error)
 	return extractMapPayload(response)
 }
 
+// MachTimeInfo is the mach absolute time of the device when it answered machTimeInfo and
+// the timebase that converts mach absolute time to nanoseconds
+type MachTimeInfo struct {
+	MachAbsoluteTime uint64
+	Timebase         kdebug.Timebase
+}
+
+// MachTimeInfo returns the current mach absolute time and the timebase of the device. Sysmontap
+// samples, app state notifications and kdebug events are timestamped in mach absolute time.
+func (d DeviceInfoService) MachTimeInfo() (MachTimeInfo, error) {
+	resp, err := d.channel.MethodCall("machTimeInfo")
+	if err != nil {
+		return MachTimeInfo{}, err
+	}
+	return parseMachTimeInfo(resp.Payload)
+}
+
+// parseMachTimeInfo parses the machTimeInfo response, an array that starts with the mach
+// absolute time, the numerator and the denominator of the timebase
+func parseMachTimeInfo(payload []interface{}) (MachTimeInfo, error) {
+	if len(payload) == 0 {
+		return MachTimeInfo{}, fmt.Errorf("machTimeInfo: empty payload")
+	}
+	values, ok := payload[0].([]interface{})
+	if !ok || len(values) < 3 {
+		return MachTimeInfo{}, fmt.Errorf("machTimeInfo: expected array with at least 3 values, got %+v", payload[0])
+	}
+	machTime, ok := toUint64(values[0])
+	numer, numerOk := toUint64(values[1])
+	denom, denomOk := toUint64(values[2])
+	if !ok || !numerOk || !denomOk || denom == 0 {
+		return MachTimeInfo{}, fmt.Errorf("machTimeInfo: invalid values %+v", values)
+	}
+	return MachTimeInfo{MachAbsoluteTime: machTime, Timebase: kdebug.Timebase{Numer: uint32(numer), Denom: uint32(denom)}}, nil
+}
+
 // NetworkInformation gets a list of all network interfaces for the device. Example result:
 // map[en0:Wi-Fi en1:Ethernet Adaptor (en1) en2:Ethernet Adaptor (en2) lo0:Loopback pdp_ip0:Cellular (pdp_ip0)
 // pdp_ip1:Cellular (pdp_ip1) pdp_ip2:Cellular (pdp_ip2) pdp_ip3:Cellular (pdp_ip3) pdp_ip4:Cellular (pdp_ip4)]
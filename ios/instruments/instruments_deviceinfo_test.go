@@ -0,0 +1,20 @@
+package instruments
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMachTimeInfo(t *testing.T) {
+	info, err := parseMachTimeInfo([]interface{}{[]interface{}{uint64(123456789), uint64(125), uint64(3), 1.5}})
+	require.NoError(t, err)
+	assert.Equal(t, MachTimeInfo{MachAbsoluteTime: 123456789, Timebase: kdebug.Timebase{Numer: 125, Denom: 3}}, info)
+
+	_, err = parseMachTimeInfo([]interface{}{[]interface{}{uint64(1), uint64(1)}})
+	assert.Error(t, err)
+	_, err = parseMachTimeInfo([]interface{}{[]interface{}{uint64(1), uint64(1), uint64(0)}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package instruments
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+// EnergyService samples the energy impact of processes like the energy gauge of Xcode
+type EnergyService struct {
+	channel *dtx.Channel
+	conn    *dtx.Connection
+	pids    []interface{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// EnergySample is the energy impact of one process. The costs use the unitless scale of
+// the Xcode energy gauge, Overhead is the cost of waking up the radios and other hardware
+// that is shared with other processes.
+type EnergySample struct {
+	PID            uint64    `json:"pid"`
+	Time           time.Time `json:"time"`
+	TotalCost      float64   `json:"totalCost"`
+	CPUCost        float64   `json:"cpuCost"`
+	GPUCost        float64   `json:"gpuCost"`
+	NetworkingCost float64   `json:"networkingCost"`
+	LocationCost   float64   `json:"locationCost"`
+	DisplayCost    float64   `json:"displayCost"`
+	AppStateCost   float64   `json:"appStateCost"`
+	Overhead       float64   `json:"overhead"`
+	// Attributes contains all values sent by the device
+	Attributes map[string]interface{} `json:"-"`
+}
+
+// NewEnergyService starts energy sampling for the given processes
+func NewEnergyService(device ios.DeviceEntry, pids []uint64) (*EnergyService, error) {
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("energy sampling needs at least one pid")
+	}
+	dtxConn, err := connectInstruments(device)
+	if err != nil {
+		return nil, err
+	}
+
+	pidList := make([]interface{}, len(pids))
+	for i, pid := range pids {
+		pidList[i] = pid
+	}
+	channel := dtxConn.RequestChannelIdentifier(energyChannel, loggingDispatcher{dtxConn})
+	// stop a sampling session left over by an earlier client first, like Xcode does
+	if _, err := channel.MethodCall("stopSamplingForPIDs:", pidList); err != nil {
+		dtxConn.Close()
+		return nil, err
+	}
+	if _, err := channel.MethodCall("startSamplingForPIDs:", pidList); err != nil {
+		dtxConn.Close()
+		return nil, err
+	}
+
+	return &EnergyService{channel: channel, conn: dtxConn, pids: pidList, done: make(chan struct{})}, nil
+}
+
+// Close stops sampling and closes the DTX connection
+func (s *EnergyService) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	_ = s.channel.MethodCallAsync("stopSamplingForPIDs:", s.pids)
+	return s.conn.Close()
+}
+
+// Sample returns the energy impact of all processes since the previous sample
+func (s *EnergyService) Sample() ([]EnergySample, error) {
+	msg, err := s.channel.MethodCall("sampleAttributes:forPIDs:", map[string]interface{}{}, s.pids)
+	if err != nil {
+		return nil, err
+	}
+	return mapToEnergySamples(msg, time.Now())
+}
+
+// ReceiveEnergySamples samples every interval and returns a chan of EnergySample with one sample
+// per process and interval. The chan is closed when the service is closed.
+func (s *EnergyService) ReceiveEnergySamples(interval time.Duration) chan EnergySample {
+	messages := make(chan EnergySample)
+	go func() {
+		defer close(messages)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+			samples, err := s.Sample()
+			if err != nil {
+				golog.Debug("failed sampling energy", "module", logModule, "error", err)
+				continue
+			}
+			for _, sample := range samples {
+				select {
+				case messages <- sample:
+				case <-s.done:
+					return
+				}
+			}
+		}
+	}()
+
+	return messages
+}
+
+// mapToEnergySamples parses the reply to sampleAttributes:forPIDs:, a dictionary with
+// the attributes of every process keyed by pid.
+func mapToEnergySamples(msg dtx.Message, t time.Time) ([]EnergySample, error) {
+	if len(msg.Payload) == 0 {
+		return nil, fmt.Errorf("empty energy payload")
+	}
+	data, ok := msg.Payload[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("energy payload should be map[string]interface{}: %T", msg.Payload[0])
+	}
+
+	samples := make([]EnergySample, 0, len(data))
+	for key, value := range data {
+		pid, ok := parsePIDKey(key)
+		if !ok {
+			return nil, fmt.Errorf("energy payload key should be a pid: %s", key)
+		}
+		attributes, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("energy attributes of pid %d should be map[string]interface{}: %T", pid, value)
+		}
+		cost := func(keys ...string) float64 {
+			for _, key := range keys {
+				if v, ok := toFloat64(attributes[key]); ok {
+					return v
+				}
+			}
+			return 0
+		}
+		samples = append(samples, EnergySample{
+			PID:       pid,
+			Time:      t,
+			TotalCost: cost("energy.cost"),
+			CPUCost:   cost("energy.cpu.cost"),
+			GPUCost:   cost("energy.gpu.cost"),
+			// the device misspells networking in some iOS versions
+			NetworkingCost: cost("energy.networking.cost", "energy.networkning.cost"),
+			LocationCost:   cost("energy.location.cost"),
+			DisplayCost:    cost("energy.display.cost"),
+			AppStateCost:   cost("energy.appstate.cost"),
+			Overhead:       cost("energy.overhead"),
+			Attributes:     attributes,
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].PID < samples[j].PID })
+	return samples, nil
+}
@@ -0,0 +1,71 @@
+package instruments
+
+import (
+	"testing"
+	"time"
+
+	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapToEnergySamples(t *testing.T) {
+	now := time.Now()
+	msg := dtx.Message{
+		Payload: []interface{}{
+			map[string]interface{}{
+				"uint64{412}": map[string]interface{}{
+					"energy.cost":             float64(44.5),
+					"energy.cpu.cost":         float64(23.1),
+					"energy.gpu.cost":         uint64(2),
+					"energy.networkning.cost": float64(9),
+					"energy.location.cost":    int64(0),
+					"energy.display.cost":     float64(1.5),
+					"energy.appstate.cost":    float64(8),
+					"energy.overhead":         float64(490),
+				},
+				"uint64{77}": map[string]interface{}{
+					"energy.cost": float64(1),
+				},
+			},
+		},
+	}
+
+	samples, err := mapToEnergySamples(msg, now)
+
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, uint64(77), samples[0].PID)
+	sample := samples[1]
+	assert.Equal(t, uint64(412), sample.PID)
+	assert.Equal(t, now, sample.Time)
+	assert.Equal(t, 44.5, sample.TotalCost)
+	assert.Equal(t, 23.1, sample.CPUCost)
+	assert.Equal(t, 2.0, sample.GPUCost)
+	assert.Equal(t, 9.0, sample.NetworkingCost)
+	assert.Equal(t, 0.0, sample.LocationCost)
+	assert.Equal(t, 1.5, sample.DisplayCost)
+	assert.Equal(t, 8.0, sample.AppStateCost)
+	assert.Equal(t, 490.0, sample.Overhead)
+}
+
+func TestMapToEnergySamplesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       dtx.Message
+		errSubstr string
+	}{
+		{"empty payload", dtx.Message{}, "empty energy payload"},
+		{"bad payload", dtx.Message{Payload: []interface{}{"energy"}}, "energy payload should be"},
+		{"bad key", dtx.Message{Payload: []interface{}{map[string]interface{}{"app": map[string]interface{}{}}}}, "should be a pid"},
+		{"bad attributes", dtx.Message{Payload: []interface{}{map[string]interface{}{"uint64{1}": "cost"}}}, "energy attributes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mapToEnergySamples(tt.msg, time.Now())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errSubstr)
+		})
+	}
+}
@@ -8,22 +8,10 @@ import (
 	"github.com/danielpaulus/go-ios/ios/golog"
 )
 
-type graphicsOpenGLMsgDispatcher struct {
-	messages chan dtx.Message
-}
-
-func newGraphicsOpenGLMsgDispatcher() *graphicsOpenGLMsgDispatcher {
-	return &graphicsOpenGLMsgDispatcher{make(chan dtx.Message)}
-}
-
-func (p *graphicsOpenGLMsgDispatcher) Dispatch(m dtx.Message) {
-	p.messages <- m
-}
-
 type GraphicsOpenGLService struct {
 	channel       *dtx.Channel
 	conn          *dtx.Connection
-	msgDispatcher *graphicsOpenGLMsgDispatcher
+	msgDispatcher *messageDispatcher
 }
 
 type FramesPerSecondSample struct {
@@ -31,7 +19,7 @@ type FramesPerSecondSample struct {
 }
 
 func NewGraphicsOpenGLService(device ios.DeviceEntry) (*GraphicsOpenGLService, error) {
-	msgDispatcher := newGraphicsOpenGLMsgDispatcher()
+	msgDispatcher := newMessageDispatcher()
 	dtxConn, err := connectInstrumentsWithMsgDispatcher(device, msgDispatcher)
 	if err != nil {
 		return nil, err
@@ -47,7 +35,7 @@ func NewGraphicsOpenGLService(device ios.DeviceEntry) (*GraphicsOpenGLService, e
 }
 
 func (s *GraphicsOpenGLService) Close() error {
-	close(s.msgDispatcher.messages)
+	s.msgDispatcher.close()
 	_ = s.channel.MethodCallAsync("stopSampling:")
 	return s.conn.Close()
 }
@@ -57,14 +45,21 @@ func (s *GraphicsOpenGLService) ReceiveFramesPerSecondSamples() chan FramesPerSe
 	go func() {
 		defer close(messages)
 
-		for msg := range s.msgDispatcher.messages {
+		for {
+			msg, ok := s.msgDispatcher.receive()
+			if !ok {
+				break
+			}
 			sample, err := mapToFramesPerSecondSample(msg)
 			if err != nil {
 				golog.Debug("expected FPS sample from global channel, but received different message", "module", logModule, "message", msg, "error", err)
 				continue
 			}
 
-			messages <- sample
+			select {
+			case messages <- sample:
+			case <-s.msgDispatcher.done:
+			}
 		}
 	}()
 
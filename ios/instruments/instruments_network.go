@@ -1,38 +1,117 @@
 package instruments
 
 import (
+	"encoding/binary"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 
 	"github.com/danielpaulus/go-ios/ios"
 	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
 	"github.com/danielpaulus/go-ios/ios/golog"
 )
 
-type networkMsgDispatcher struct {
-	messages chan dtx.Message
+type NetworkService struct {
+	channel       *dtx.Channel
+	conn          *dtx.Connection
+	msgDispatcher *messageDispatcher
 }
 
-func newNetworkMsgDispatcher() *networkMsgDispatcher {
-	return &networkMsgDispatcher{make(chan dtx.Message)}
+// Message types of the networking service
+const (
+	NetworkMessageInterfaceDetection  uint64 = 0
+	NetworkMessageConnectionDetection uint64 = 1
+	NetworkMessageConnectionUpdate    uint64 = 2
+)
+
+// NetworkSample is a message of the networking service. Depending on Type, one of
+// Interface, Connection or Update is set. Data is only set for messages that
+// contain a dictionary instead of the usual list of values.
+type NetworkSample struct {
+	Type       uint64
+	Data       map[string]interface{}
+	Interface  *InterfaceDetection
+	Connection *ConnectionDetection
+	Update     *ConnectionUpdate
 }
 
-func (p *networkMsgDispatcher) Dispatch(m dtx.Message) {
-	p.messages <- m
+// InterfaceDetection reports a network interface of the device
+type InterfaceDetection struct {
+	InterfaceIndex uint64 `json:"interfaceIndex"`
+	Name           string `json:"name"`
 }
 
-type NetworkService struct {
-	channel       *dtx.Channel
-	conn          *dtx.Connection
-	msgDispatcher *networkMsgDispatcher
+// ConnectionDetection reports a new socket connection. SerialNumber identifies the
+// connection in later ConnectionUpdate messages.
+type ConnectionDetection struct {
+	LocalAddress   SocketAddress `json:"localAddress"`
+	RemoteAddress  SocketAddress `json:"remoteAddress"`
+	InterfaceIndex uint64        `json:"interfaceIndex"`
+	PID            uint64        `json:"pid"`
+	RecvBufferSize uint64        `json:"recvBufferSize"`
+	RecvBufferUsed uint64        `json:"recvBufferUsed"`
+	SerialNumber   uint64        `json:"serialNumber"`
+	Kind           uint64        `json:"kind"`
 }
 
-type NetworkSample struct {
-	Type uint64
-	Data map[string]interface{}
+// ConnectionUpdate contains the traffic counters of a connection since it was opened.
+// The round trip times are in milliseconds.
+type ConnectionUpdate struct {
+	RxPackets        uint64 `json:"rxPackets"`
+	RxBytes          uint64 `json:"rxBytes"`
+	TxPackets        uint64 `json:"txPackets"`
+	TxBytes          uint64 `json:"txBytes"`
+	RxDups           uint64 `json:"rxDups"`
+	RxOutOfOrder     uint64 `json:"rxOutOfOrder"`
+	TxRetransmits    uint64 `json:"txRetransmits"`
+	MinRTT           uint64 `json:"minRtt"`
+	AvgRTT           uint64 `json:"avgRtt"`
+	ConnectionSerial uint64 `json:"connectionSerial"`
+}
+
+// SocketAddress is a decoded sockaddr_in or sockaddr_in6
+type SocketAddress struct {
+	Family   uint8  `json:"family"`
+	IP       net.IP `json:"ip"`
+	Port     uint16 `json:"port"`
+	FlowInfo uint32 `json:"flowInfo,omitempty"`
+	ScopeID  uint32 `json:"scopeId,omitempty"`
+}
+
+func (a SocketAddress) String() string {
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(int(a.Port)))
+}
+
+const (
+	sockaddrInLen  = 0x10
+	sockaddrIn6Len = 0x1c
+)
+
+// parseSocketAddress decodes a sockaddr blob: 1 byte length, 1 byte family, 2 bytes
+// port in network byte order, then the IPv4 address or the IPv6 flow info, address and scope id.
+func parseSocketAddress(data []byte) (SocketAddress, error) {
+	if len(data) < 2 || len(data) < int(data[0]) {
+		return SocketAddress{}, fmt.Errorf("sockaddr too short: %x", data)
+	}
+	address := SocketAddress{Family: data[1]}
+	switch data[0] {
+	case sockaddrInLen:
+		address.Port = binary.BigEndian.Uint16(data[2:4])
+		address.IP = net.IP(slices.Clone(data[4:8]))
+	case sockaddrIn6Len:
+		address.Port = binary.BigEndian.Uint16(data[2:4])
+		address.FlowInfo = binary.LittleEndian.Uint32(data[4:8])
+		address.IP = net.IP(slices.Clone(data[8:24]))
+		address.ScopeID = binary.LittleEndian.Uint32(data[24:28])
+	default:
+		return SocketAddress{}, fmt.Errorf("unsupported sockaddr length %d", data[0])
+	}
+	return address, nil
 }
 
 func NewNetworkService(device ios.DeviceEntry) (*NetworkService, error) {
-	msgDispatcher := newNetworkMsgDispatcher()
+	msgDispatcher := newMessageDispatcher()
 	dtxConn, err := connectInstrumentsWithMsgDispatcher(device, msgDispatcher)
 	if err != nil {
 		return nil, err
@@ -48,7 +127,7 @@ func NewNetworkService(device ios.DeviceEntry) (*NetworkService, error) {
 }
 
 func (s *NetworkService) Close() error {
-	close(s.msgDispatcher.messages)
+	s.msgDispatcher.close()
 	_ = s.channel.MethodCallAsync("stopMonitoring")
 	return s.conn.Close()
 }
@@ -58,14 +137,21 @@ func (s *NetworkService) ReceiveNetworkSamples() chan NetworkSample {
 	go func() {
 		defer close(messages)
 
-		for msg := range s.msgDispatcher.messages {
+		for {
+			msg, ok := s.msgDispatcher.receive()
+			if !ok {
+				break
+			}
 			sample, err := mapToNetworkSample(msg)
 			if err != nil {
 				golog.Debug("expected network sample from global channel, but received different message", "module", logModule, "message", msg, "error", err)
 				continue
 			}
 
-			messages <- sample
+			select {
+			case messages <- sample:
+			case <-s.msgDispatcher.done:
+			}
 		}
 	}()
 
@@ -82,10 +168,81 @@ func mapToNetworkSample(msg dtx.Message) (NetworkSample, error) {
 		return NetworkSample{}, fmt.Errorf("network sample type should be numeric: %T", msg.Payload[0])
 	}
 
-	data, ok := msg.Payload[1].(map[string]interface{})
-	if !ok {
-		return NetworkSample{}, fmt.Errorf("network sample data should be map[string]interface{}: %T", msg.Payload[1])
+	switch data := msg.Payload[1].(type) {
+	case map[string]interface{}:
+		return NetworkSample{Type: sampleType, Data: data}, nil
+	case []interface{}:
+		return decodeNetworkValues(sampleType, data)
+	default:
+		return NetworkSample{}, fmt.Errorf("network sample data should be map[string]interface{} or []interface{}: %T", msg.Payload[1])
 	}
+}
 
-	return NetworkSample{Type: sampleType, Data: data}, nil
+// decodeNetworkValues converts the value list of a message into the typed struct for its type
+func decodeNetworkValues(sampleType uint64, values []interface{}) (NetworkSample, error) {
+	sample := NetworkSample{Type: sampleType}
+	number := func(i int) uint64 {
+		if i >= len(values) {
+			return 0
+		}
+		v, _ := toUint64(values[i])
+		return v
+	}
+	switch sampleType {
+	case NetworkMessageInterfaceDetection:
+		if len(values) < 2 {
+			return NetworkSample{}, fmt.Errorf("interface detection should have 2 values: %+v", values)
+		}
+		name, _ := values[1].(string)
+		sample.Interface = &InterfaceDetection{InterfaceIndex: number(0), Name: name}
+	case NetworkMessageConnectionDetection:
+		if len(values) < 8 {
+			return NetworkSample{}, fmt.Errorf("connection detection should have 8 values: %+v", values)
+		}
+		local, err := socketAddressValue(values[0])
+		if err != nil {
+			return NetworkSample{}, fmt.Errorf("invalid local address: %w", err)
+		}
+		remote, err := socketAddressValue(values[1])
+		if err != nil {
+			return NetworkSample{}, fmt.Errorf("invalid remote address: %w", err)
+		}
+		sample.Connection = &ConnectionDetection{
+			LocalAddress:   local,
+			RemoteAddress:  remote,
+			InterfaceIndex: number(2),
+			PID:            number(3),
+			RecvBufferSize: number(4),
+			RecvBufferUsed: number(5),
+			SerialNumber:   number(6),
+			Kind:           number(7),
+		}
+	case NetworkMessageConnectionUpdate:
+		if len(values) < 10 {
+			return NetworkSample{}, fmt.Errorf("connection update should have at least 10 values: %+v", values)
+		}
+		sample.Update = &ConnectionUpdate{
+			RxPackets:        number(0),
+			RxBytes:          number(1),
+			TxPackets:        number(2),
+			TxBytes:          number(3),
+			RxDups:           number(4),
+			RxOutOfOrder:     number(5),
+			TxRetransmits:    number(6),
+			MinRTT:           number(7),
+			AvgRTT:           number(8),
+			ConnectionSerial: number(9),
+		}
+	default:
+		return NetworkSample{}, fmt.Errorf("unknown network message type %d", sampleType)
+	}
+	return sample, nil
+}
+
+func socketAddressValue(v interface{}) (SocketAddress, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return SocketAddress{}, fmt.Errorf("expected []byte for sockaddr, got %T", v)
+	}
+	return parseSocketAddress(data)
 }
@@ -0,0 +1,145 @@
+package instruments
+
+import (
+	"sort"
+	"sync"
+)
+
+// NetworkTraffic contains traffic counters summed over connections
+type NetworkTraffic struct {
+	Connections int    `json:"connections"`
+	RxBytes     uint64 `json:"rxBytes"`
+	TxBytes     uint64 `json:"txBytes"`
+	RxPackets   uint64 `json:"rxPackets"`
+	TxPackets   uint64 `json:"txPackets"`
+}
+
+func (t *NetworkTraffic) add(update ConnectionUpdate) {
+	t.RxBytes += update.RxBytes
+	t.TxBytes += update.TxBytes
+	t.RxPackets += update.RxPackets
+	t.TxPackets += update.TxPackets
+}
+
+// ProcessNetworkStats is the traffic of one process
+type ProcessNetworkStats struct {
+	PID  uint64 `json:"pid"`
+	Name string `json:"name,omitempty"`
+	NetworkTraffic
+}
+
+// RemoteHostNetworkStats is the traffic between one process and one remote host
+type RemoteHostNetworkStats struct {
+	PID        uint64 `json:"pid"`
+	Name       string `json:"name,omitempty"`
+	RemoteHost string `json:"remoteHost"`
+	NetworkTraffic
+}
+
+// NetworkAggregator collects connection detection and update messages and sums up
+// the traffic per process and per remote host. It is safe for concurrent use.
+type NetworkAggregator struct {
+	mu           sync.Mutex
+	connections  map[uint64]ConnectionDetection
+	updates      map[uint64]ConnectionUpdate
+	processNames map[uint64]string
+}
+
+// NewNetworkAggregator creates an empty aggregator
+func NewNetworkAggregator() *NetworkAggregator {
+	return &NetworkAggregator{
+		connections:  map[uint64]ConnectionDetection{},
+		updates:      map[uint64]ConnectionUpdate{},
+		processNames: map[uint64]string{},
+	}
+}
+
+// SetProcessNames sets the names used for the pids in the results
+func (a *NetworkAggregator) SetProcessNames(processes []ProcessInfo) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range processes {
+		a.processNames[p.Pid] = p.Name
+	}
+}
+
+// Add records a sample. Updates contain the counters since the connection was opened,
+// so only the latest update of every connection is kept.
+func (a *NetworkAggregator) Add(sample NetworkSample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if sample.Connection != nil {
+		a.connections[sample.Connection.SerialNumber] = *sample.Connection
+	}
+	if sample.Update != nil {
+		a.updates[sample.Update.ConnectionSerial] = *sample.Update
+	}
+}
+
+// ByProcess returns the traffic per process, sorted by received and sent bytes in descending order.
+// Updates of connections that were opened before monitoring started are not included.
+func (a *NetworkAggregator) ByProcess() []ProcessNetworkStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	byPID := map[uint64]*ProcessNetworkStats{}
+	for serial, connection := range a.connections {
+		stats, ok := byPID[connection.PID]
+		if !ok {
+			stats = &ProcessNetworkStats{PID: connection.PID, Name: a.processNames[connection.PID]}
+			byPID[connection.PID] = stats
+		}
+		stats.Connections++
+		stats.add(a.updates[serial])
+	}
+	result := make([]ProcessNetworkStats, 0, len(byPID))
+	for _, stats := range byPID {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if total(result[i].NetworkTraffic) != total(result[j].NetworkTraffic) {
+			return total(result[i].NetworkTraffic) > total(result[j].NetworkTraffic)
+		}
+		return result[i].PID < result[j].PID
+	})
+	return result
+}
+
+// ByRemoteHost returns the traffic per process and remote IP address, sorted by received
+// and sent bytes in descending order.
+func (a *NetworkAggregator) ByRemoteHost() []RemoteHostNetworkStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	type key struct {
+		pid  uint64
+		host string
+	}
+	byHost := map[key]*RemoteHostNetworkStats{}
+	for serial, connection := range a.connections {
+		k := key{connection.PID, connection.RemoteAddress.IP.String()}
+		stats, ok := byHost[k]
+		if !ok {
+			stats = &RemoteHostNetworkStats{PID: k.pid, Name: a.processNames[k.pid], RemoteHost: k.host}
+			byHost[k] = stats
+		}
+		stats.Connections++
+		stats.add(a.updates[serial])
+	}
+	result := make([]RemoteHostNetworkStats, 0, len(byHost))
+	for _, stats := range byHost {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if total(result[i].NetworkTraffic) != total(result[j].NetworkTraffic) {
+			return total(result[i].NetworkTraffic) > total(result[j].NetworkTraffic)
+		}
+		if result[i].PID != result[j].PID {
+			return result[i].PID < result[j].PID
+		}
+		return result[i].RemoteHost < result[j].RemoteHost
+	})
+	return result
+}
+
+func total(t NetworkTraffic) uint64 {
+	return t.RxBytes + t.TxBytes
+}
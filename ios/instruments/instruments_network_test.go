@@ -1,6 +1,9 @@
 package instruments
 
 import (
+	"encoding/binary"
+	"net"
+	"sync"
 	"testing"
 
 	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
@@ -61,3 +64,128 @@ func TestMapToNetworkSampleErrors(t *testing.T) {
 		})
 	}
 }
+
+func sockaddrIn(ip [4]byte, port uint16) []byte {
+	data := make([]byte, 16)
+	data[0], data[1] = 0x10, 2
+	binary.BigEndian.PutUint16(data[2:4], port)
+	copy(data[4:8], ip[:])
+	return data
+}
+
+func sockaddrIn6(ip net.IP, port uint16, scopeID uint32) []byte {
+	data := make([]byte, 28)
+	data[0], data[1] = 0x1c, 30
+	binary.BigEndian.PutUint16(data[2:4], port)
+	copy(data[8:24], ip.To16())
+	binary.LittleEndian.PutUint32(data[24:28], scopeID)
+	return data
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	address, err := parseSocketAddress(sockaddrIn([4]byte{192, 168, 1, 10}, 443))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(2), address.Family)
+	assert.Equal(t, "192.168.1.10:443", address.String())
+
+	address, err = parseSocketAddress(sockaddrIn6(net.ParseIP("2001:db8::1"), 8080, 4))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(30), address.Family)
+	assert.Equal(t, uint32(4), address.ScopeID)
+	assert.Equal(t, "[2001:db8::1]:8080", address.String())
+
+	_, err = parseSocketAddress([]byte{0x10, 2, 0})
+	assert.Error(t, err)
+	_, err = parseSocketAddress([]byte{0x04, 2, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestMapToNetworkSampleTyped(t *testing.T) {
+	sample, err := mapToNetworkSample(dtx.Message{Payload: []interface{}{uint64(0), []interface{}{uint64(3), "en0"}}})
+	require.NoError(t, err)
+	assert.Equal(t, &InterfaceDetection{InterfaceIndex: 3, Name: "en0"}, sample.Interface)
+
+	sample, err = mapToNetworkSample(dtx.Message{Payload: []interface{}{uint64(1), []interface{}{
+		sockaddrIn([4]byte{10, 0, 0, 2}, 52000), sockaddrIn([4]byte{17, 253, 144, 10}, 443),
+		uint64(3), uint64(321), uint64(131072), uint64(0), uint64(7), uint64(1),
+	}}})
+	require.NoError(t, err)
+	require.NotNil(t, sample.Connection)
+	assert.Equal(t, "10.0.0.2:52000", sample.Connection.LocalAddress.String())
+	assert.Equal(t, "17.253.144.10:443", sample.Connection.RemoteAddress.String())
+	assert.Equal(t, uint64(321), sample.Connection.PID)
+	assert.Equal(t, uint64(7), sample.Connection.SerialNumber)
+
+	sample, err = mapToNetworkSample(dtx.Message{Payload: []interface{}{uint64(2), []interface{}{
+		uint64(10), uint64(15000), uint64(8), uint64(900), uint64(0), uint64(1), uint64(2), uint64(20), uint64(35), uint64(7), uint64(0), uint64(0),
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, &ConnectionUpdate{
+		RxPackets: 10, RxBytes: 15000, TxPackets: 8, TxBytes: 900, RxOutOfOrder: 1, TxRetransmits: 2, MinRTT: 20, AvgRTT: 35, ConnectionSerial: 7,
+	}, sample.Update)
+
+	_, err = mapToNetworkSample(dtx.Message{Payload: []interface{}{uint64(1), []interface{}{"bad"}}})
+	assert.Error(t, err)
+	_, err = mapToNetworkSample(dtx.Message{Payload: []interface{}{uint64(9), []interface{}{}}})
+	assert.Error(t, err)
+}
+
+func TestNetworkAggregator(t *testing.T) {
+	connection := func(serial, pid uint64, remote [4]byte) NetworkSample {
+		return NetworkSample{Type: NetworkMessageConnectionDetection, Connection: &ConnectionDetection{
+			RemoteAddress: SocketAddress{IP: net.IP(remote[:]), Port: 443},
+			PID:           pid,
+			SerialNumber:  serial,
+		}}
+	}
+	update := func(serial, rx, tx uint64) NetworkSample {
+		return NetworkSample{Type: NetworkMessageConnectionUpdate, Update: &ConnectionUpdate{ConnectionSerial: serial, RxBytes: rx, TxBytes: tx, RxPackets: 1, TxPackets: 1}}
+	}
+
+	a := NewNetworkAggregator()
+	a.SetProcessNames([]ProcessInfo{{Pid: 100, Name: "MyApp"}})
+	a.Add(connection(1, 100, [4]byte{1, 1, 1, 1}))
+	a.Add(connection(2, 100, [4]byte{1, 1, 1, 1}))
+	a.Add(connection(3, 100, [4]byte{8, 8, 8, 8}))
+	a.Add(connection(4, 200, [4]byte{8, 8, 8, 8}))
+	a.Add(update(1, 100, 10))
+	a.Add(update(1, 1000, 50)) // counters since the connection was opened, replaces the first update
+	a.Add(update(2, 500, 5))
+	a.Add(update(3, 10, 1))
+	a.Add(update(99, 10, 10)) // connection opened before monitoring started
+
+	assert.Equal(t, []ProcessNetworkStats{
+		{PID: 100, Name: "MyApp", NetworkTraffic: NetworkTraffic{Connections: 3, RxBytes: 1510, TxBytes: 56, RxPackets: 3, TxPackets: 3}},
+		{PID: 200, NetworkTraffic: NetworkTraffic{Connections: 1}},
+	}, a.ByProcess())
+
+	assert.Equal(t, []RemoteHostNetworkStats{
+		{PID: 100, Name: "MyApp", RemoteHost: "1.1.1.1", NetworkTraffic: NetworkTraffic{Connections: 2, RxBytes: 1500, TxBytes: 55, RxPackets: 2, TxPackets: 2}},
+		{PID: 100, Name: "MyApp", RemoteHost: "8.8.8.8", NetworkTraffic: NetworkTraffic{Connections: 1, RxBytes: 10, TxBytes: 1, RxPackets: 1, TxPackets: 1}},
+		{PID: 200, RemoteHost: "8.8.8.8", NetworkTraffic: NetworkTraffic{Connections: 1}},
+	}, a.ByRemoteHost())
+}
+
+func TestNetworkServiceStopsWhileMessagesArrive(t *testing.T) {
+	s := &NetworkService{msgDispatcher: newMessageDispatcher()}
+	samples := s.ReceiveNetworkSamples()
+	msg := dtx.Message{Payload: []interface{}{uint64(2), map[string]interface{}{}}}
+
+	// dispatchers keep sending like the reader of a DTX connection that is not closed yet
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.msgDispatcher.Dispatch(msg)
+			}
+		}()
+	}
+	<-samples
+	s.msgDispatcher.close()
+
+	for range samples {
+	}
+	wg.Wait()
+}
@@ -0,0 +1,268 @@
+package instruments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/crashreport"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/danielpaulus/go-ios/ios/pprof"
+)
+
+// DefaultProfileSampleInterval is the sample interval of the Time Profiler of Instruments
+const DefaultProfileSampleInterval = time.Millisecond
+
+// sharedCacheFile is the mapping name of the dyld shared cache in profiles
+const sharedCacheFile = "dyld_shared_cache"
+
+// ProfileOptions configures RecordProfile
+type ProfileOptions struct {
+	PID uint64
+	// Duration is the recording time, zero records until the context is done
+	Duration time.Duration
+	// SampleInterval is DefaultProfileSampleInterval if zero
+	SampleInterval time.Duration
+	// Symbolicator resolves frames of images with a dSYM, it is optional
+	Symbolicator *crashreport.Symbolicator
+}
+
+// RecordProfile samples the user space callstacks of a process with the core profile
+// session tap for the given duration, or until ctx is done, and returns them as pprof profile.
+func RecordProfile(ctx context.Context, device ios.DeviceEntry, options ProfileOptions) (*pprof.Profile, error) {
+	if options.SampleInterval == 0 {
+		options.SampleInterval = DefaultProfileSampleInterval
+	}
+	tap, err := NewCoreProfileSessionTap(device, CoreProfileConfig{SampleInterval: options.SampleInterval})
+	if err != nil {
+		return nil, err
+	}
+	defer tap.Close()
+
+	builder := NewProfileBuilder(int32(options.PID), options.SampleInterval, options.Symbolicator)
+	decoder := kdebug.NewDecoder()
+	collector := kdebug.NewCallstackCollector()
+	data := tap.ReceiveData()
+	var timeout <-chan time.Time
+	if options.Duration > 0 {
+		timer := time.NewTimer(options.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	start := time.Now()
+loop:
+	for {
+		select {
+		case chunk, ok := <-data:
+			if !ok {
+				break loop
+			}
+			if kdebug.IsStackshot(chunk) {
+				stackshot, err := kdebug.ParseStackshot(chunk)
+				if err != nil {
+					golog.Warn("failed parsing stackshot", "module", logModule, "error", err)
+					continue
+				}
+				builder.AddStackshot(stackshot)
+				continue
+			}
+			events, err := decoder.Decode(chunk)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range events {
+				if stack, ok := collector.Add(e); ok {
+					builder.Add(stack)
+				}
+			}
+		case <-timeout:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	if builder.Samples() == 0 {
+		return nil, fmt.Errorf("no callstacks of pid %d were sampled", options.PID)
+	}
+	return builder.Build(start, time.Since(start)), nil
+}
+
+type stackKey struct {
+	threadID uint64
+	frames   string
+}
+
+type sampledStack struct {
+	threadID uint64
+	frames   []uint64
+	count    int64
+}
+
+// ProfileBuilder aggregates the callstacks of one process into a pprof profile. Frames are
+// resolved against the images of the process in the stackshot of the trace and, if a
+// symbolicator is set, symbolicated with dSYMs.
+type ProfileBuilder struct {
+	pid          int32
+	interval     time.Duration
+	symbolicator *crashreport.Symbolicator
+
+	processName     string
+	images          *kdebug.ImageMap
+	sharedCacheUUID string
+	stacks          map[stackKey]*sampledStack
+	// order keeps the samples in the order they were first seen
+	order []stackKey
+}
+
+// NewProfileBuilder creates a builder for the process with the given pid
+func NewProfileBuilder(pid int32, interval time.Duration, symbolicator *crashreport.Symbolicator) *ProfileBuilder {
+	return &ProfileBuilder{
+		pid:          pid,
+		interval:     interval,
+		symbolicator: symbolicator,
+		images:       kdebug.NewImageMap(kdebug.Task{}),
+		stacks:       map[stackKey]*sampledStack{},
+	}
+}
+
+// AddStackshot uses the images of the process in the stackshot to resolve frames
+func (b *ProfileBuilder) AddStackshot(stackshot kdebug.Stackshot) {
+	task, ok := stackshot.Task(b.pid)
+	if !ok {
+		return
+	}
+	b.processName = task.Name
+	b.images = kdebug.NewImageMap(task)
+	if task.SharedCache != nil {
+		b.sharedCacheUUID = task.SharedCache.UUID
+	}
+}
+
+// Add records a callstack if it belongs to the profiled process
+func (b *ProfileBuilder) Add(stack kdebug.Callstack) bool {
+	if stack.PID != b.pid || len(stack.Frames) == 0 {
+		return false
+	}
+	var frames strings.Builder
+	for _, frame := range stack.Frames {
+		frames.WriteString(strconv.FormatUint(frame, 16))
+		frames.WriteByte(',')
+	}
+	key := stackKey{threadID: stack.ThreadID, frames: frames.String()}
+	sampled, ok := b.stacks[key]
+	if !ok {
+		sampled = &sampledStack{threadID: stack.ThreadID, frames: stack.Frames}
+		b.stacks[key] = sampled
+		b.order = append(b.order, key)
+	}
+	sampled.count++
+	return true
+}
+
+// Samples returns the number of recorded callstacks
+func (b *ProfileBuilder) Samples() int {
+	n := 0
+	for _, stack := range b.stacks {
+		n += int(stack.count)
+	}
+	return n
+}
+
+type locationKey struct {
+	address uint64
+	// callers are symbolicated at the address before the return address
+	caller bool
+}
+
+// Build creates the profile. Every sample has the number of times the callstack was
+// sampled and the CPU time it represents, labeled with the thread ID.
+func (b *ProfileBuilder) Build(start time.Time, duration time.Duration) *pprof.Profile {
+	profile := &pprof.Profile{
+		SampleType:    []pprof.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		TimeNanos:     start.UnixNano(),
+		DurationNanos: duration.Nanoseconds(),
+		PeriodType:    pprof.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        b.interval.Nanoseconds(),
+	}
+	if b.processName != "" {
+		profile.Comments = []string{fmt.Sprintf("%s (pid %d)", b.processName, b.pid)}
+	}
+
+	images := b.images.Images()
+	mappings := map[string]*pprof.Mapping{}
+	for i, image := range images {
+		limit := uint64(math.MaxUint64)
+		if i+1 < len(images) {
+			limit = images[i+1].LoadAddress
+		}
+		// stackshots only contain the UUIDs of images, their names are only known from dSYMs
+		mapping := &pprof.Mapping{Start: image.LoadAddress, Limit: limit, BuildID: image.UUID}
+		if image.UUID == b.sharedCacheUUID {
+			mapping.File = sharedCacheFile
+		} else if b.symbolicator != nil {
+			mapping.File, _ = b.symbolicator.ImageName(image.UUID)
+		}
+		mappings[image.UUID] = mapping
+		profile.Mapping = append(profile.Mapping, mapping)
+	}
+
+	locations := map[locationKey]*pprof.Location{}
+	functions := map[[2]string]*pprof.Function{}
+	location := func(address uint64, caller bool) *pprof.Location {
+		key := locationKey{address: address, caller: caller}
+		if l, ok := locations[key]; ok {
+			return l
+		}
+		l := &pprof.Location{Address: address}
+		locations[key] = l
+		profile.Location = append(profile.Location, l)
+		image, ok := b.images.Lookup(address)
+		if !ok {
+			return l
+		}
+		l.Mapping = mappings[image.UUID]
+		if b.symbolicator == nil {
+			return l
+		}
+		offset := address - image.LoadAddress
+		if caller && offset > 0 {
+			offset--
+		}
+		symbol, ok := b.symbolicator.Lookup(image.UUID, offset)
+		if !ok {
+			return l
+		}
+		functionKey := [2]string{symbol.Function, symbol.File}
+		function, ok := functions[functionKey]
+		if !ok {
+			function = &pprof.Function{Name: symbol.Function, SystemName: symbol.Function, Filename: symbol.File}
+			functions[functionKey] = function
+			profile.Function = append(profile.Function, function)
+		}
+		l.Line = []pprof.Line{{Function: function, Line: int64(symbol.Line)}}
+		l.Mapping.HasFunctions = true
+		if symbol.File != "" {
+			l.Mapping.HasFilenames = true
+			l.Mapping.HasLineNumbers = true
+		}
+		return l
+	}
+
+	for _, key := range b.order {
+		stack := b.stacks[key]
+		sample := &pprof.Sample{
+			Value: []int64{stack.count, stack.count * b.interval.Nanoseconds()},
+			Label: []pprof.Label{{Key: "thread", Num: int64(stack.threadID)}},
+		}
+		for i, frame := range stack.frames {
+			sample.Location = append(sample.Location, location(frame, i > 0))
+		}
+		profile.Sample = append(profile.Sample, sample)
+	}
+	return profile
+}
@@ -0,0 +1,72 @@
+package instruments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+	"github.com/danielpaulus/go-ios/ios/pprof"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoreProfileConfig(t *testing.T) {
+	config := CoreProfileConfig{SampleInterval: time.Millisecond}.toMap()
+	triggers := config["tc"].([]interface{})
+	require.Len(t, triggers, 2)
+	kdebugTrigger := triggers[0].(map[string]interface{})
+	assert.Equal(t, 3, kdebugTrigger["tk"])
+	assert.Equal(t, 128, kdebugTrigger["csd"])
+	assert.Equal(t, nskeyedarchiver.NSSet{Objects: []interface{}{uint64(AllKdebugClasses)}}, kdebugTrigger["kdf2"])
+	timerTrigger := triggers[1].(map[string]interface{})
+	assert.Equal(t, 1, timerTrigger["tk"])
+	assert.Equal(t, uint64(1000000), timerTrigger["si"])
+
+	_, err := nskeyedarchiver.ArchiveBin(config)
+	assert.NoError(t, err)
+	assert.Len(t, CoreProfileConfig{}.toMap()["tc"], 1)
+}
+
+func TestProfileBuilder(t *testing.T) {
+	b := NewProfileBuilder(42, time.Millisecond, nil)
+	b.AddStackshot(kdebug.Stackshot{Tasks: []kdebug.Task{
+		{PID: 1, Name: "launchd"},
+		{
+			PID:         42,
+			Name:        "MyApp",
+			Images:      []kdebug.Image{{UUID: "AA000000-0000-0000-0000-000000000000", LoadAddress: 0x100000000}},
+			SharedCache: &kdebug.Image{UUID: "CC000000-0000-0000-0000-000000000000", LoadAddress: 0x180000000},
+		},
+	}})
+
+	assert.True(t, b.Add(kdebug.Callstack{PID: 42, ThreadID: 7, Frames: []uint64{0x100001000, 0x190000000}}))
+	assert.True(t, b.Add(kdebug.Callstack{PID: 42, ThreadID: 7, Frames: []uint64{0x100001000, 0x190000000}}))
+	assert.True(t, b.Add(kdebug.Callstack{PID: 42, ThreadID: 8, Frames: []uint64{0x190000000}}))
+	assert.False(t, b.Add(kdebug.Callstack{PID: 1, ThreadID: 9, Frames: []uint64{0x1000}}))
+	assert.Equal(t, 3, b.Samples())
+
+	start := time.Unix(1700000000, 0)
+	profile := b.Build(start, 5*time.Second)
+	assert.Equal(t, []string{"MyApp (pid 42)"}, profile.Comments)
+	assert.Equal(t, int64(5000000000), profile.DurationNanos)
+	assert.Equal(t, int64(1000000), profile.Period)
+
+	require.Len(t, profile.Mapping, 2)
+	app, sharedCache := profile.Mapping[0], profile.Mapping[1]
+	assert.Equal(t, pprof.Mapping{Start: 0x100000000, Limit: 0x180000000, BuildID: "AA000000-0000-0000-0000-000000000000"}, *app)
+	assert.Equal(t, "dyld_shared_cache", sharedCache.File)
+	assert.Equal(t, "CC000000-0000-0000-0000-000000000000", sharedCache.BuildID)
+
+	require.Len(t, profile.Sample, 2)
+	assert.Equal(t, []int64{2, 2000000}, profile.Sample[0].Value)
+	assert.Equal(t, []pprof.Label{{Key: "thread", Num: 7}}, profile.Sample[0].Label)
+	leaf, caller := profile.Sample[0].Location[0], profile.Sample[0].Location[1]
+	assert.Equal(t, uint64(0x100001000), leaf.Address)
+	assert.Same(t, app, leaf.Mapping)
+	assert.Same(t, sharedCache, caller.Mapping)
+	// the same address as leaf and as caller is symbolicated differently
+	assert.NotSame(t, caller, profile.Sample[1].Location[0])
+	assert.Len(t, profile.Location, 3)
+	assert.NotEmpty(t, profile.Encode())
+}
@@ -3,24 +3,17 @@ package instruments
 import (
 	"fmt"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/danielpaulus/go-ios/ios"
 	dtx "github.com/danielpaulus/go-ios/ios/dtx_codec"
 	"github.com/danielpaulus/go-ios/ios/golog"
 )
 
-type sysmontapMsgDispatcher struct {
-	messages chan dtx.Message
-}
-
-func newSysmontapMsgDispatcher() *sysmontapMsgDispatcher {
-	return &sysmontapMsgDispatcher{make(chan dtx.Message)}
-}
-
-func (p *sysmontapMsgDispatcher) Dispatch(m dtx.Message) {
-	p.messages <- m
-}
-
 const sysmontapName = "com.apple.instruments.server.services.sysmontap"
 
 type sysmontapService struct {
@@ -28,7 +21,10 @@ type sysmontapService struct {
 	conn    *dtx.Connection
 
 	deviceInfoService *DeviceInfoService
-	msgDispatcher     *sysmontapMsgDispatcher
+	msgDispatcher     *messageDispatcher
+
+	procAttrs []string
+	sysAttrs  []string
 }
 
 // NewSysmontapService creates a new sysmontapService
@@ -37,12 +33,26 @@ type sysmontapService struct {
 // the expected rate and the actual rate of samples delivery. We can only conclude, that the lower the rate in digits,
 // the faster the samples are delivered
 func NewSysmontapService(device ios.DeviceEntry, samplingInterval int) (*sysmontapService, error) {
+	return newSysmontapService(device, samplingInterval, 500*time.Millisecond)
+}
+
+// NewSysmontapServiceWithInterval creates a new sysmontapService that delivers a sample every interval.
+// If interval is 0, Xcode's default sampling rate is used like with NewSysmontapService.
+func NewSysmontapServiceWithInterval(device ios.DeviceEntry, interval time.Duration) (*sysmontapService, error) {
+	if interval <= 0 {
+		const xcodeDefaultSamplingRate = 10
+		return NewSysmontapService(device, xcodeDefaultSamplingRate)
+	}
+	return newSysmontapService(device, int(interval.Milliseconds()), interval)
+}
+
+func newSysmontapService(device ios.DeviceEntry, updateRate int, sampleInterval time.Duration) (*sysmontapService, error) {
 	deviceInfoService, err := NewDeviceInfoService(device)
 	if err != nil {
 		return nil, err
 	}
 
-	msgDispatcher := newSysmontapMsgDispatcher()
+	msgDispatcher := newMessageDispatcher()
 	dtxConn, err := connectInstrumentsWithMsgDispatcher(device, msgDispatcher)
 	if err != nil {
 		deviceInfoService.Close()
@@ -66,13 +76,13 @@ func NewSysmontapService(device ios.DeviceEntry, samplingInterval int) (*sysmont
 	}
 
 	config := map[string]interface{}{
-		"ur":             samplingInterval,
+		"ur":             updateRate,
 		"bm":             0,
 		"procAttrs":      procAttrs,
 		"sysAttrs":       sysAttrs,
 		"cpuUsage":       true,
 		"physFootprint":  true,
-		"sampleInterval": 500000000,
+		"sampleInterval": sampleInterval.Nanoseconds(),
 	}
 	_, err = processControlChannel.MethodCall("setConfig:", config)
 	if err != nil {
@@ -88,36 +98,58 @@ func NewSysmontapService(device ios.DeviceEntry, samplingInterval int) (*sysmont
 		return nil, err
 	}
 
-	return &sysmontapService{processControlChannel, dtxConn, deviceInfoService, msgDispatcher}, nil
+	return &sysmontapService{
+		channel:           processControlChannel,
+		conn:              dtxConn,
+		deviceInfoService: deviceInfoService,
+		msgDispatcher:     msgDispatcher,
+		procAttrs:         toStrings(procAttrs),
+		sysAttrs:          toStrings(sysAttrs),
+	}, nil
 }
 
-// Close closes up the DTX connection, message dispatcher and dtx.Message channel
+func toStrings(values []interface{}) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i], _ = v.(string)
+	}
+	return result
+}
+
+// Close stops the receivers and closes the DTX connection
 func (s *sysmontapService) Close() error {
-	close(s.msgDispatcher.messages)
+	s.msgDispatcher.close()
 
 	s.deviceInfoService.Close()
 	return s.conn.Close()
 }
 
 // ReceiveCPUUsage returns a chan of SysmontapMessage with CPU Usage info
-// The method will close the result channel automatically as soon as sysmontapMsgDispatcher's
-// dtx.Message channel is closed.
+// The method will close the result channel automatically as soon as the service is closed.
+// Use either ReceiveCPUUsage or ReceiveSamples, not both.
 func (s *sysmontapService) ReceiveCPUUsage() chan SysmontapMessage {
 	messages := make(chan SysmontapMessage)
 	go func() {
 		defer close(messages)
 
-		for msg := range s.msgDispatcher.messages {
+		for {
+			msg, ok := s.msgDispatcher.receive()
+			if !ok {
+				break
+			}
 			sysmontapMessage, err := mapToCPUUsage(msg)
 			if err != nil {
 				golog.Debug("expected `sysmontapMessage` from global channel, but received different message", "module", logModule, "message", msg)
 				continue
 			}
 
-			messages <- sysmontapMessage
+			select {
+			case messages <- sysmontapMessage:
+			case <-s.msgDispatcher.done:
+			}
 		}
 
-		golog.Info("sysmontap message dispatcher channel closed", "module", logModule)
+		golog.Info("sysmontap message dispatcher closed", "module", logModule)
 	}()
 
 	return messages
@@ -272,3 +304,223 @@ func mapToCPUUsage(msg dtx.Message) (SysmontapMessage, error) {
 		SystemCPUUsage: CPUUsage{CPU_TotalLoad: cpuTotalLoad},
 	}, nil
 }
+
+// ReceiveSamples returns a chan of SysmontapSample with system and per-process metrics.
+// The method will close the result channel automatically as soon as the service is closed.
+// Use either ReceiveCPUUsage or ReceiveSamples, not both.
+func (s *sysmontapService) ReceiveSamples() chan SysmontapSample {
+	samples := make(chan SysmontapSample)
+	go func() {
+		defer close(samples)
+
+		for {
+			msg, ok := s.msgDispatcher.receive()
+			if !ok {
+				break
+			}
+			sample, err := mapToSysmontapSample(msg, s.procAttrs, s.sysAttrs)
+			if err != nil {
+				golog.Debug("expected sysmontap sample from global channel, but received different message", "module", logModule, "message", msg, "err", err)
+				continue
+			}
+			sample.Time = time.Now()
+			select {
+			case samples <- sample:
+			case <-s.msgDispatcher.done:
+			}
+		}
+
+		golog.Info("sysmontap message dispatcher closed", "module", logModule)
+	}()
+
+	return samples
+}
+
+// SysmontapSample contains the system and process metrics of one sampling interval.
+// System and SystemCPUUsage are nil if the device did not send them in this interval.
+type SysmontapSample struct {
+	Time           time.Time       `json:"time"`
+	EndMachAbsTime uint64          `json:"endMachAbsTime,omitempty"`
+	SystemCPUUsage *CPUUsage       `json:"systemCpuUsage,omitempty"`
+	System         *SystemSample   `json:"system,omitempty"`
+	Processes      []ProcessSample `json:"processes,omitempty"`
+}
+
+// SystemSample contains the system wide memory, disk and network counters. Memory
+// values are counted in pages, disk and network values are totals since boot.
+type SystemSample struct {
+	PhysMemSize           uint64 `json:"physMemSize"`
+	VMFreeCount           uint64 `json:"vmFreeCount"`
+	VMActiveCount         uint64 `json:"vmActiveCount"`
+	VMInactiveCount       uint64 `json:"vmInactiveCount"`
+	VMWireCount           uint64 `json:"vmWireCount"`
+	VMCompressorPageCount uint64 `json:"vmCompressorPageCount"`
+	VMPurgeableCount      uint64 `json:"vmPurgeableCount"`
+	DiskBytesRead         uint64 `json:"diskBytesRead"`
+	DiskBytesWritten      uint64 `json:"diskBytesWritten"`
+	DiskReadOps           uint64 `json:"diskReadOps"`
+	DiskWriteOps          uint64 `json:"diskWriteOps"`
+	NetBytesIn            uint64 `json:"netBytesIn"`
+	NetBytesOut           uint64 `json:"netBytesOut"`
+	NetPacketsIn          uint64 `json:"netPacketsIn"`
+	NetPacketsOut         uint64 `json:"netPacketsOut"`
+	// Attributes contains all system attributes sent by the device
+	Attributes map[string]interface{} `json:"-"`
+}
+
+// ProcessSample contains the metrics of one process. Memory sizes are in bytes,
+// disk values are totals since the process started.
+type ProcessSample struct {
+	PID              uint64  `json:"pid"`
+	Name             string  `json:"name"`
+	CPUUsage         float64 `json:"cpuUsage"`
+	PhysFootprint    uint64  `json:"physFootprint"`
+	MemResidentSize  uint64  `json:"memResidentSize"`
+	MemVirtualSize   uint64  `json:"memVirtualSize"`
+	MemAnon          uint64  `json:"memAnon"`
+	MemCompressed    uint64  `json:"memCompressed"`
+	ThreadCount      uint64  `json:"threadCount"`
+	DiskBytesRead    uint64  `json:"diskBytesRead"`
+	DiskBytesWritten uint64  `json:"diskBytesWritten"`
+	// Attributes contains all process attributes sent by the device
+	Attributes map[string]interface{} `json:"-"`
+}
+
+// zipAttributes maps the attribute names configured with setConfig: to the values of a sample row
+func zipAttributes(names []string, row interface{}) (map[string]interface{}, error) {
+	values, ok := row.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected []interface{} for sample row, got %T", row)
+	}
+	attributes := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if i < len(values) && name != "" {
+			attributes[name] = values[i]
+		}
+	}
+	return attributes, nil
+}
+
+func attributeUint64(attributes map[string]interface{}, key string) uint64 {
+	v, _ := toUint64(attributes[key])
+	return v
+}
+
+func newSystemSample(attributes map[string]interface{}) *SystemSample {
+	return &SystemSample{
+		PhysMemSize:           attributeUint64(attributes, "physMemSize"),
+		VMFreeCount:           attributeUint64(attributes, "vmFreeCount"),
+		VMActiveCount:         attributeUint64(attributes, "vmActiveCount"),
+		VMInactiveCount:       attributeUint64(attributes, "vmInactiveCount"),
+		VMWireCount:           attributeUint64(attributes, "vmWireCount"),
+		VMCompressorPageCount: attributeUint64(attributes, "vmCompressorPageCount"),
+		VMPurgeableCount:      attributeUint64(attributes, "vmPurgeableCount"),
+		DiskBytesRead:         attributeUint64(attributes, "diskBytesRead"),
+		DiskBytesWritten:      attributeUint64(attributes, "diskBytesWritten"),
+		DiskReadOps:           attributeUint64(attributes, "diskReadOps"),
+		DiskWriteOps:          attributeUint64(attributes, "diskWriteOps"),
+		NetBytesIn:            attributeUint64(attributes, "netBytesIn"),
+		NetBytesOut:           attributeUint64(attributes, "netBytesOut"),
+		NetPacketsIn:          attributeUint64(attributes, "netPacketsIn"),
+		NetPacketsOut:         attributeUint64(attributes, "netPacketsOut"),
+		Attributes:            attributes,
+	}
+}
+
+func newProcessSample(attributes map[string]interface{}) ProcessSample {
+	name, _ := attributes["name"].(string)
+	cpuUsage, _ := toFloat64(attributes["cpuUsage"])
+	return ProcessSample{
+		PID:              attributeUint64(attributes, "pid"),
+		Name:             name,
+		CPUUsage:         cpuUsage,
+		PhysFootprint:    attributeUint64(attributes, "physFootprint"),
+		MemResidentSize:  attributeUint64(attributes, "memResidentSize"),
+		MemVirtualSize:   attributeUint64(attributes, "memVirtualSize"),
+		MemAnon:          attributeUint64(attributes, "memAnon"),
+		MemCompressed:    attributeUint64(attributes, "memCompressed"),
+		ThreadCount:      attributeUint64(attributes, "threadCount"),
+		DiskBytesRead:    attributeUint64(attributes, "diskBytesRead"),
+		DiskBytesWritten: attributeUint64(attributes, "diskBytesWritten"),
+		Attributes:       attributes,
+	}
+}
+
+// parsePIDKey parses a key of the Processes dictionary. The keys are NSNumbers, which
+// the unarchiver turns into strings like "uint64{123}".
+func parsePIDKey(key string) (uint64, bool) {
+	key = strings.TrimSuffix(strings.TrimPrefix(key, "uint64{"), "}")
+	pid, err := strconv.ParseUint(key, 10, 64)
+	return pid, err == nil
+}
+
+// mapToSysmontapSample parses a DTX sysmontap message into a SysmontapSample. The rows of
+// the "System" array and the "Processes" dictionary contain the values of procAttrs and
+// sysAttrs in the order they were configured.
+func mapToSysmontapSample(msg dtx.Message, procAttrs []string, sysAttrs []string) (SysmontapSample, error) {
+	if len(msg.Payload) == 0 {
+		return SysmontapSample{}, fmt.Errorf("empty payload in sysmontap message")
+	}
+	results, ok := msg.Payload[0].([]interface{})
+	if !ok {
+		return SysmontapSample{}, fmt.Errorf("expected []interface{} as payload[0], got %T: %+v", msg.Payload[0], msg.Payload[0])
+	}
+
+	var sample SysmontapSample
+	found := false
+	for _, result := range results {
+		resultMap, ok := result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if endMachAbsTime, ok := toUint64(resultMap["EndMachAbsTime"]); ok {
+			sample.EndMachAbsTime = endMachAbsTime
+		}
+		if cpuMap, ok := resultMap["SystemCPUUsage"].(map[string]interface{}); ok {
+			if load, ok := toFloat64(cpuMap["CPU_TotalLoad"]); ok {
+				sample.SystemCPUUsage = &CPUUsage{CPU_TotalLoad: load}
+				found = true
+			}
+		}
+		if system, ok := resultMap["System"]; ok {
+			attributes, err := zipAttributes(sysAttrs, system)
+			if err != nil {
+				return SysmontapSample{}, fmt.Errorf("failed decoding System: %w", err)
+			}
+			sample.System = newSystemSample(attributes)
+			found = true
+		}
+		if processes, ok := resultMap["Processes"].(map[string]interface{}); ok {
+			found = true
+			for key, row := range processes {
+				attributes, err := zipAttributes(procAttrs, row)
+				if err != nil {
+					return SysmontapSample{}, fmt.Errorf("failed decoding process %s: %w", key, err)
+				}
+				process := newProcessSample(attributes)
+				if pid, ok := parsePIDKey(key); ok && process.PID == 0 {
+					process.PID = pid
+				}
+				sample.Processes = append(sample.Processes, process)
+			}
+		}
+	}
+	if !found {
+		return SysmontapSample{}, fmt.Errorf("no System, Processes or SystemCPUUsage in sysmontap message")
+	}
+	sort.Slice(sample.Processes, func(i, j int) bool { return sample.Processes[i].PID < sample.Processes[j].PID })
+	return sample, nil
+}
+
+// FilterProcesses returns a copy of the sample that only contains the processes
+// with the given pid or one of the given names. A pid of 0 and empty names match nothing.
+func (s SysmontapSample) FilterProcesses(pid uint64, names []string) SysmontapSample {
+	result := s
+	result.Processes = nil
+	for _, p := range s.Processes {
+		if (pid != 0 && p.PID == pid) || slices.Contains(names, p.Name) {
+			result.Processes = append(result.Processes, p)
+		}
+	}
+	return result
+}
@@ -205,3 +205,76 @@ func TestMapToCPUUsage_MultiElementPayloadUsesFirst(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, uint64(8), result.CPUCount)
 }
+
+func TestMapToSysmontapSample(t *testing.T) {
+	procAttrs := []string{"pid", "name", "cpuUsage", "physFootprint", "memResidentSize", "threadCount", "diskBytesRead", "diskBytesWritten"}
+	sysAttrs := []string{"physMemSize", "vmFreeCount", "diskBytesRead", "netBytesIn", "netBytesOut"}
+	msg := dtx.Message{
+		Payload: []interface{}{
+			[]interface{}{
+				validResultMap(),
+				map[string]interface{}{
+					"EndMachAbsTime": uint64(987654321),
+					"System":         []interface{}{uint64(4 << 30), uint64(1000), uint64(2048), uint64(300), uint64(400)},
+					"Processes": map[string]interface{}{
+						"uint64{321}": []interface{}{uint64(321), "MyApp", float64(12.5), uint64(50 << 20), uint64(80 << 20), uint64(14), uint64(4096), uint64(8192)},
+						"uint64{1}":   []interface{}{uint64(1), "launchd", float64(0.1), uint64(1 << 20), uint64(2 << 20), uint64(3), uint64(0), uint64(0)},
+					},
+				},
+			},
+		},
+	}
+
+	sample, err := mapToSysmontapSample(msg, procAttrs, sysAttrs)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(987654321), sample.EndMachAbsTime)
+	require.NotNil(t, sample.SystemCPUUsage)
+	assert.Equal(t, 25.5, sample.SystemCPUUsage.CPU_TotalLoad)
+
+	require.NotNil(t, sample.System)
+	assert.Equal(t, uint64(4<<30), sample.System.PhysMemSize)
+	assert.Equal(t, uint64(1000), sample.System.VMFreeCount)
+	assert.Equal(t, uint64(300), sample.System.NetBytesIn)
+	assert.Equal(t, uint64(400), sample.System.NetBytesOut)
+
+	require.Len(t, sample.Processes, 2)
+	assert.Equal(t, "launchd", sample.Processes[0].Name)
+	app := sample.Processes[1]
+	assert.Equal(t, uint64(321), app.PID)
+	assert.Equal(t, "MyApp", app.Name)
+	assert.Equal(t, 12.5, app.CPUUsage)
+	assert.Equal(t, uint64(50<<20), app.PhysFootprint)
+	assert.Equal(t, uint64(80<<20), app.MemResidentSize)
+	assert.Equal(t, uint64(14), app.ThreadCount)
+	assert.Equal(t, uint64(4096), app.DiskBytesRead)
+	assert.Equal(t, uint64(8192), app.DiskBytesWritten)
+
+	filtered := sample.FilterProcesses(0, []string{"MyApp"})
+	require.Len(t, filtered.Processes, 1)
+	assert.Equal(t, uint64(321), filtered.Processes[0].PID)
+	assert.Len(t, sample.FilterProcesses(1, nil).Processes, 1)
+}
+
+func TestMapToSysmontapSample_PIDFromKey(t *testing.T) {
+	msg := buildSysmontapMsg(map[string]interface{}{
+		"Processes": map[string]interface{}{
+			"uint64{77}": []interface{}{"backboardd"},
+		},
+	})
+	sample, err := mapToSysmontapSample(msg, []string{"name"}, nil)
+	require.NoError(t, err)
+	require.Len(t, sample.Processes, 1)
+	assert.Equal(t, uint64(77), sample.Processes[0].PID)
+	assert.Equal(t, "backboardd", sample.Processes[0].Name)
+}
+
+func TestMapToSysmontapSample_ErrorCases(t *testing.T) {
+	_, err := mapToSysmontapSample(dtx.Message{}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = mapToSysmontapSample(buildSysmontapMsg(map[string]interface{}{"Type": uint64(1)}), nil, nil)
+	assert.Error(t, err)
+
+	_, err = mapToSysmontapSample(buildSysmontapMsg(map[string]interface{}{"System": "invalid"}), nil, []string{"physMemSize"})
+	assert.Error(t, err)
+}
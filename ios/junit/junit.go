@@ -1,7 +1,8 @@
 // Package junit converts the test results collected by testmanagerd
 // (TestSuite/TestCase structs) into standard JUnit XML, so `ios runtest`
-// results can be consumed by CI systems and device farms.
-// It is a pure formatter: it only reads the testmanagerd result structs.
+// results can be consumed by CI systems and device farms. Read parses reports
+// of previous runs back, e.g. to balance test shards by their durations.
+// It is a pure formatter: it only reads and creates the testmanagerd result structs.
 package junit
 
 import (
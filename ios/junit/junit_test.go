@@ -183,3 +183,66 @@ func TestMultipleSuitesAggregateCounts(t *testing.T) {
 `
 	assert.Equal(t, expected, render(t, suites))
 }
+
+func TestReadWrittenReport(t *testing.T) {
+	suites := []testmanagerd.TestSuite{
+		{
+			Name:         "ExampleUITests",
+			StartDate:    time.Date(2026, 8, 5, 10, 30, 0, 0, time.UTC),
+			TestDuration: 4500 * time.Millisecond,
+			TestCases: []testmanagerd.TestCase{
+				{ClassName: "LoginTests", MethodName: "testLoginSucceeds", Status: testmanagerd.StatusPassed, Duration: 1500 * time.Millisecond},
+				{
+					ClassName:  "LoginTests",
+					MethodName: "testLoginFails",
+					Status:     testmanagerd.StatusFailed,
+					Duration:   1250 * time.Millisecond,
+					Err:        testmanagerd.TestError{Message: "XCTAssertTrue failed", File: "LoginTests.swift", Line: 42},
+				},
+				{
+					ClassName:  "LoginTests",
+					MethodName: "testStalls",
+					Status:     testmanagerd.StatusStalled,
+					Duration:   time.Second,
+					Err:        testmanagerd.TestError{Message: "Test case stalled", File: "LoginTests.swift", Line: 7},
+				},
+				{
+					ClassName:  "LoginTests",
+					MethodName: "testExpectedFailure",
+					Status:     testmanagerd.StatusExpectedFailure,
+					Duration:   500 * time.Millisecond,
+					Err:        testmanagerd.TestError{Message: "known bug"},
+				},
+				{
+					ClassName:  "LoginTests",
+					MethodName: "testSkipped",
+					Status:     testmanagerd.TestCaseStatus("skipped"),
+					Duration:   250 * time.Millisecond,
+					Err:        testmanagerd.TestError{Message: "not on iPad"},
+				},
+			},
+		},
+	}
+
+	parsed, err := junit.Read(bytes.NewBufferString(render(t, suites)))
+	require.NoError(t, err)
+	assert.Equal(t, suites, parsed)
+}
+
+func TestReadSingleSuiteReport(t *testing.T) {
+	report := `<testsuite name="Other" tests="1" time="0.5">
+  <testcase classname="OtherTests" name="testOne" time="0.5"/>
+</testsuite>`
+	parsed, err := junit.Read(bytes.NewBufferString(report))
+	require.NoError(t, err)
+	assert.Equal(t, []testmanagerd.TestSuite{{
+		Name:         "Other",
+		TestDuration: 500 * time.Millisecond,
+		TestCases:    []testmanagerd.TestCase{{ClassName: "OtherTests", MethodName: "testOne", Status: testmanagerd.StatusPassed, Duration: 500 * time.Millisecond}},
+	}}, parsed)
+
+	_, err = junit.Read(bytes.NewBufferString(`<report/>`))
+	assert.Error(t, err)
+	_, err = junit.Read(bytes.NewBufferString(`<testsuites><testsuite time="soon"/></testsuites>`))
+	assert.Error(t, err)
+}
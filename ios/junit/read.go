@@ -0,0 +1,117 @@
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/testmanagerd"
+)
+
+// Read parses a JUnit XML report with a testsuites or a single testsuite root
+// element. Test cases get the status Write would have converted to the element
+// they have, durations are rounded to what the report contains.
+func Read(r io.Reader) ([]testmanagerd.TestSuite, error) {
+	var report struct {
+		XMLName xml.Name
+		xmlTestSuite
+		Suites []xmlTestSuite `xml:"testsuite"`
+	}
+	if err := xml.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("cannot parse JUnit report: %w", err)
+	}
+	var suites []xmlTestSuite
+	switch report.XMLName.Local {
+	case "testsuites":
+		suites = report.Suites
+	case "testsuite":
+		suites = []xmlTestSuite{report.xmlTestSuite}
+	default:
+		return nil, fmt.Errorf("cannot parse JUnit report: unexpected root element %s", report.XMLName.Local)
+	}
+
+	result := make([]testmanagerd.TestSuite, 0, len(suites))
+	for _, suite := range suites {
+		parsed, err := parseSuite(suite)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+func parseSuite(suite xmlTestSuite) (testmanagerd.TestSuite, error) {
+	parsed := testmanagerd.TestSuite{
+		Name:      suite.Name,
+		TestCases: make([]testmanagerd.TestCase, 0, len(suite.Cases)),
+	}
+	if suite.Timestamp != "" {
+		start, err := time.Parse(timestampFormat, suite.Timestamp)
+		if err != nil {
+			return testmanagerd.TestSuite{}, fmt.Errorf("invalid timestamp of test suite %s: %w", suite.Name, err)
+		}
+		parsed.StartDate = start
+	}
+	duration, err := parseSeconds(suite.Time)
+	if err != nil {
+		return testmanagerd.TestSuite{}, fmt.Errorf("invalid time of test suite %s: %w", suite.Name, err)
+	}
+	parsed.TestDuration = duration
+
+	for _, testCase := range suite.Cases {
+		duration, err := parseSeconds(testCase.Time)
+		if err != nil {
+			return testmanagerd.TestSuite{}, fmt.Errorf("invalid time of test case %s/%s: %w", testCase.ClassName, testCase.Name, err)
+		}
+		parsedCase := testmanagerd.TestCase{
+			ClassName:  testCase.ClassName,
+			MethodName: testCase.Name,
+			Status:     testmanagerd.StatusPassed,
+			Duration:   duration,
+		}
+		switch {
+		case testCase.Failure != nil:
+			parsedCase.Status = testmanagerd.StatusFailed
+			parsedCase.Err = parseError(testCase.Failure)
+		case testCase.Error != nil:
+			parsedCase.Status = testmanagerd.StatusStalled
+			parsedCase.Err = parseError(testCase.Error)
+		case testCase.Skipped != nil:
+			parsedCase.Status = testmanagerd.TestCaseStatus("skipped")
+			parsedCase.Err = testmanagerd.TestError{Message: testCase.Skipped.Message}
+			if message, ok := strings.CutPrefix(testCase.Skipped.Message, "expected failure"); ok {
+				parsedCase.Status = testmanagerd.StatusExpectedFailure
+				parsedCase.Err.Message = strings.TrimPrefix(message, ": ")
+			}
+		}
+		parsed.TestCases = append(parsed.TestCases, parsedCase)
+	}
+	return parsed, nil
+}
+
+// parseError reverses convertError, the content is file:line if there is any
+func parseError(result *xmlResult) testmanagerd.TestError {
+	testError := testmanagerd.TestError{Message: result.Message}
+	if i := strings.LastIndex(result.Content, ":"); i > 0 {
+		if line, err := strconv.ParseUint(strings.TrimSpace(result.Content[i+1:]), 10, 64); err == nil {
+			testError.File = strings.TrimSpace(result.Content[:i])
+			testError.Line = line
+		}
+	}
+	return testError
+}
+
+func parseSeconds(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond), nil
+}
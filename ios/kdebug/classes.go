@@ -0,0 +1,268 @@
+package kdebug
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Event classes from bsd/sys/kdebug.h
+const (
+	ClassMach       uint8 = 1
+	ClassNetwork    uint8 = 2
+	ClassFSystem    uint8 = 3
+	ClassBSD        uint8 = 4
+	ClassIOKit      uint8 = 5
+	ClassDrivers    uint8 = 6
+	ClassTrace      uint8 = 7
+	ClassDLIL       uint8 = 8
+	ClassPThread    uint8 = 9
+	ClassMisc       uint8 = 20
+	ClassSecurity   uint8 = 30
+	ClassDyld       uint8 = 31
+	ClassQT         uint8 = 32
+	ClassApps       uint8 = 33
+	ClassLaunchd    uint8 = 34
+	ClassImportance uint8 = 38
+	ClassBank       uint8 = 40
+	ClassXPC        uint8 = 41
+	ClassDispatch   uint8 = 46
+	ClassIMG        uint8 = 49
+	ClassTurnstile  uint8 = 53
+	ClassMIG        uint8 = 255
+)
+
+// Subclasses of ClassMach and ClassBSD
+const (
+	SubclassMachDataFault  uint8 = 0x03
+	SubclassMachInstFault  uint8 = 0x04
+	SubclassMachInterrupt  uint8 = 0x05
+	SubclassMachSyscall    uint8 = 0x0c
+	SubclassMachIPC        uint8 = 0x20
+	SubclassMachVM         uint8 = 0x30
+	SubclassMachSched      uint8 = 0x40
+	SubclassBSDProc        uint8 = 0x01
+	SubclassBSDExcpSyscall uint8 = 0x0c
+)
+
+var classNames = map[uint8]string{
+	ClassMach:       "mach",
+	ClassNetwork:    "net",
+	ClassFSystem:    "fs",
+	ClassBSD:        "bsd",
+	ClassIOKit:      "iokit",
+	ClassDrivers:    "drivers",
+	ClassTrace:      "trace",
+	ClassDLIL:       "dlil",
+	ClassPThread:    "pthread",
+	ClassMisc:       "misc",
+	ClassSecurity:   "security",
+	ClassDyld:       "dyld",
+	ClassQT:         "qt",
+	ClassApps:       "apps",
+	ClassLaunchd:    "launchd",
+	ClassPerf:       "perf",
+	ClassImportance: "importance",
+	ClassBank:       "bank",
+	ClassXPC:        "xpc",
+	ClassDispatch:   "dispatch",
+	ClassIMG:        "img",
+	ClassTurnstile:  "turnstile",
+	ClassMIG:        "mig",
+}
+
+type subclassID struct {
+	class, subclass uint8
+}
+
+var subclassNames = map[subclassID]string{
+	{ClassMach, SubclassMachDataFault}:  "data_fault",
+	{ClassMach, SubclassMachInstFault}:  "instruction_fault",
+	{ClassMach, SubclassMachInterrupt}:  "interrupt",
+	{ClassMach, SubclassMachSyscall}:    "mach_trap",
+	{ClassMach, SubclassMachIPC}:        "ipc",
+	{ClassMach, SubclassMachVM}:         "vm",
+	{ClassMach, SubclassMachSched}:      "sched",
+	{ClassBSD, SubclassBSDProc}:         "proc",
+	{ClassBSD, SubclassBSDExcpSyscall}:  "syscall",
+	{ClassPerf, perfSubclassGeneric}:    "generic",
+	{ClassPerf, perfSubclassThreadInfo}: "thread_info",
+	{ClassPerf, perfSubclassCallstack}:  "callstack",
+	{ClassDyld, 5}:                      "uuid",
+	{ClassFSystem, 1}:                   "rw",
+	{ClassFSystem, 2}:                   "dkrw",
+	{ClassNetwork, 1}:                   "ip",
+	{ClassTrace, 0}:                     "data",
+	{ClassTrace, 1}:                     "string",
+	{ClassTrace, 2}:                     "info",
+}
+
+// codeNames contains the names of the most common events, the codes of the
+// syscall subclasses are the BSD syscall and Mach trap numbers.
+var codeNames = map[subclassID]map[uint16]string{
+	{ClassBSD, SubclassBSDExcpSyscall}: {
+		1: "exit", 2: "fork", 3: "read", 4: "write", 5: "open", 6: "close", 7: "wait4",
+		9: "link", 10: "unlink", 12: "chdir", 20: "getpid", 33: "access", 37: "kill",
+		54: "ioctl", 73: "munmap", 74: "mprotect", 92: "fcntl", 93: "select", 95: "fsync",
+		97: "socket", 98: "connect", 116: "gettimeofday", 153: "pread", 154: "pwrite",
+		197: "mmap", 199: "lseek", 202: "sysctl", 301: "psynch_mutexwait", 302: "psynch_mutexdrop",
+		303: "psynch_cvbroad", 304: "psynch_cvsignal", 305: "psynch_cvwait", 338: "stat64",
+		339: "fstat64", 340: "lstat64", 360: "bsdthread_create", 361: "bsdthread_terminate",
+		362: "kqueue", 363: "kevent", 368: "workq_kernreturn", 369: "kevent64", 374: "kevent_qos",
+		396: "read_nocancel", 397: "write_nocancel", 398: "open_nocancel", 399: "close_nocancel",
+		463: "openat", 515: "ulock_wait", 516: "ulock_wake",
+	},
+	{ClassMach, SubclassMachSyscall}: {
+		10: "mach_vm_allocate", 12: "mach_vm_deallocate", 14: "mach_vm_protect",
+		26: "mach_reply_port", 27: "thread_self", 28: "task_self", 29: "host_self",
+		31: "mach_msg", 32: "mach_msg_overwrite", 33: "semaphore_signal", 36: "semaphore_wait",
+		89: "mach_timebase_info", 90: "mach_wait_until", 91: "mk_timer_create", 93: "mk_timer_arm",
+		100: "iokit_user_client",
+	},
+	{ClassMach, SubclassMachSched}: {
+		0x0: "context_switch", 0x1: "stack_attach", 0x2: "stack_handoff", 0x3: "call_continuation",
+		0x4: "callout", 0x5: "stack_detach", 0x6: "make_runnable", 0x7: "promote", 0x8: "demote",
+		0x9: "idle", 0xa: "stack_depth", 0xb: "moved",
+	},
+	{ClassMach, SubclassMachVM}: {
+		0x2: "vm_fault",
+	},
+}
+
+// ClassName returns the name of an event class, or its number for unknown classes
+func ClassName(class uint8) string {
+	if name, ok := classNames[class]; ok {
+		return name
+	}
+	return strconv.Itoa(int(class))
+}
+
+// SubclassName returns the name of a subclass, or its number in hex for unknown subclasses
+func SubclassName(class, subclass uint8) string {
+	if name, ok := subclassNames[subclassID{class, subclass}]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", subclass)
+}
+
+// Name returns a readable name of the event like "bsd/syscall/read". Events without a
+// known name use the code in hex as last element.
+func (e Event) Name() string {
+	id := subclassID{e.Class(), e.Subclass()}
+	code, ok := codeNames[id][e.Code()]
+	if !ok {
+		code = fmt.Sprintf("0x%x", e.Code())
+	}
+	return ClassName(id.class) + "/" + SubclassName(id.class, id.subclass) + "/" + code
+}
+
+type filterRule struct {
+	class    uint8
+	subclass uint8
+	// anySubclass matches all subclasses of class
+	anySubclass bool
+}
+
+// filterGroups are the named filters in addition to the class names
+var filterGroups = map[string][]filterRule{
+	"syscall": {{class: ClassBSD, subclass: SubclassBSDExcpSyscall}, {class: ClassMach, subclass: SubclassMachSyscall}},
+	"sched":   {{class: ClassMach, subclass: SubclassMachSched}},
+	"vm":      {{class: ClassMach, subclass: SubclassMachVM}, {class: ClassMach, subclass: SubclassMachDataFault}, {class: ClassMach, subclass: SubclassMachInstFault}},
+	"ipc":     {{class: ClassMach, subclass: SubclassMachIPC}},
+}
+
+// FilterNames returns the names ParseFilter accepts
+func FilterNames() []string {
+	names := make([]string, 0, len(filterGroups)+len(classNames))
+	for name := range filterGroups {
+		names = append(names, name)
+	}
+	for _, name := range classNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filter selects events by class and subclass. The zero Filter matches all events.
+type Filter struct {
+	rules []filterRule
+}
+
+// ParseFilter parses a comma separated list of filters. A filter is a name returned by
+// FilterNames, a class number like 4 or a class and subclass like 0x040c.
+func ParseFilter(s string) (Filter, error) {
+	var f Filter
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if rules, ok := filterGroups[field]; ok {
+			f.rules = append(f.rules, rules...)
+			continue
+		}
+		if class, ok := classByName(field); ok {
+			f.rules = append(f.rules, filterRule{class: class, anySubclass: true})
+			continue
+		}
+		value, err := strconv.ParseUint(field, 0, 16)
+		if err != nil {
+			return Filter{}, fmt.Errorf("unknown kdebug filter %q, use a number or one of %s", field, strings.Join(FilterNames(), ", "))
+		}
+		if value <= 0xff {
+			f.rules = append(f.rules, filterRule{class: uint8(value), anySubclass: true})
+		} else {
+			f.rules = append(f.rules, filterRule{class: uint8(value >> 8), subclass: uint8(value)})
+		}
+	}
+	return f, nil
+}
+
+func classByName(name string) (uint8, bool) {
+	for class, className := range classNames {
+		if className == name {
+			return class, true
+		}
+	}
+	return 0, false
+}
+
+// Values returns the filter as class<<24 | subclass<<16 values like the kdebug typefilter of
+// a trace configuration expects them. A whole class contributes all of its subclasses.
+// The zero Filter returns nil.
+func (f Filter) Values() []uint32 {
+	seen := map[uint32]bool{}
+	var values []uint32
+	add := func(class, subclass uint8) {
+		value := DebugID(class, subclass, 0)
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	for _, rule := range f.rules {
+		if !rule.anySubclass {
+			add(rule.class, rule.subclass)
+			continue
+		}
+		for subclass := 0; subclass <= 0xff; subclass++ {
+			add(rule.class, uint8(subclass))
+		}
+	}
+	return values
+}
+
+// Match returns true if the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if len(f.rules) == 0 {
+		return true
+	}
+	for _, rule := range f.rules {
+		if rule.class == e.Class() && (rule.anySubclass || rule.subclass == e.Subclass()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package kdebug
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// kcdata item types from osfmk/kern/kcdata.h
+const (
+	kcdataTypeArray          = 0x11
+	kcdataTypeContainerBegin = 0x13
+	kcdataTypeContainerEnd   = 0x14
+	kcdataTypeArrayPad0      = 0x20
+	kcdataTypeArrayPadF      = 0x2f
+	kcdataTypeLoadInfo       = 0x30
+	kcdataTypeLoadInfo64     = 0x31
+	kcdataTypeBufferEnd      = 0xf19158ed
+
+	kcdataBeginStackshot      = 0x59a25807
+	kcdataBeginDeltaStackshot = 0xde17a59a
+
+	stackshotContainerTask     = 0x903
+	stackshotTypeTaskSnapshot  = 0x905
+	stackshotTypeSharedCache   = 0x908
+	kcdataItemHeaderSize       = 16
+	taskSnapshotPIDOffset      = 84
+	taskSnapshotCommandOffset  = 88
+	taskSnapshotCommandLength  = 32
+	defaultSharedCacheBaseAddr = 0x180000000
+)
+
+// IsStackshot returns true if data starts with a kcdata stackshot header
+func IsStackshot(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	return magic == kcdataBeginStackshot || magic == kcdataBeginDeltaStackshot
+}
+
+// Image is a binary image loaded in a process
+type Image struct {
+	UUID        string `json:"uuid"`
+	LoadAddress uint64 `json:"loadAddress"`
+}
+
+// Task contains the binary images of a process at the time of a stackshot.
+// SharedCache is the dyld shared cache the process uses, if the stackshot contains it.
+type Task struct {
+	PID         int32   `json:"pid"`
+	Name        string  `json:"name"`
+	Images      []Image `json:"images"`
+	SharedCache *Image  `json:"sharedCache,omitempty"`
+}
+
+// Stackshot contains the processes of a kcdata stackshot
+type Stackshot struct {
+	Tasks []Task `json:"tasks"`
+	// SharedCache is the system wide dyld shared cache
+	SharedCache *Image `json:"sharedCache,omitempty"`
+}
+
+// Task returns the task with the given pid
+func (s Stackshot) Task(pid int32) (Task, bool) {
+	for _, task := range s.Tasks {
+		if task.PID == pid {
+			return task, true
+		}
+	}
+	return Task{}, false
+}
+
+// ParseStackshot decodes the tasks and their images from a kcdata stackshot
+func ParseStackshot(data []byte) (Stackshot, error) {
+	if !IsStackshot(data) {
+		return Stackshot{}, fmt.Errorf("not a kcdata stackshot")
+	}
+	var stackshot Stackshot
+	var task *Task
+	depth := 0
+	taskDepth := 0
+	ended := false
+	for len(data) >= kcdataItemHeaderSize {
+		itemType := binary.LittleEndian.Uint32(data)
+		size := uint64(binary.LittleEndian.Uint32(data[4:]))
+		flags := binary.LittleEndian.Uint64(data[8:])
+		if itemType == kcdataTypeBufferEnd {
+			ended = true
+			break
+		}
+		if size > uint64(len(data)-kcdataItemHeaderSize) {
+			return Stackshot{}, fmt.Errorf("kcdata item 0x%x of size %d exceeds the buffer", itemType, size)
+		}
+		item := data[kcdataItemHeaderSize : kcdataItemHeaderSize+size]
+		data = data[kcdataItemHeaderSize+size:]
+
+		switch {
+		case itemType == kcdataTypeContainerBegin:
+			depth++
+			if len(item) >= 4 && binary.LittleEndian.Uint32(item) == stackshotContainerTask {
+				stackshot.Tasks = append(stackshot.Tasks, Task{})
+				task = &stackshot.Tasks[len(stackshot.Tasks)-1]
+				taskDepth = depth
+			}
+		case itemType == kcdataTypeContainerEnd:
+			if task != nil && depth == taskDepth {
+				task = nil
+			}
+			depth--
+		case itemType == stackshotTypeTaskSnapshot && task != nil:
+			if len(item) >= taskSnapshotCommandOffset+taskSnapshotCommandLength {
+				task.PID = int32(binary.LittleEndian.Uint32(item[taskSnapshotPIDOffset:]))
+				task.Name = cString(item[taskSnapshotCommandOffset : taskSnapshotCommandOffset+taskSnapshotCommandLength])
+			}
+		case itemType == stackshotTypeSharedCache:
+			sharedCache, ok := parseSharedCache(item)
+			if !ok {
+				continue
+			}
+			if task != nil {
+				task.SharedCache = &sharedCache
+			} else {
+				stackshot.SharedCache = &sharedCache
+			}
+		case itemType == kcdataTypeArray || (itemType >= kcdataTypeArrayPad0 && itemType <= kcdataTypeArrayPadF):
+			if task == nil {
+				continue
+			}
+			if itemType != kcdataTypeArray {
+				padding := uint64(itemType - kcdataTypeArrayPad0)
+				if padding > size {
+					continue
+				}
+				item = item[:size-padding]
+			}
+			task.Images = append(task.Images, parseLoadInfos(uint32(flags>>32), uint32(flags), item)...)
+		}
+	}
+	if !ended {
+		return Stackshot{}, fmt.Errorf("kcdata stackshot is truncated")
+	}
+	for i := range stackshot.Tasks {
+		if stackshot.Tasks[i].SharedCache == nil {
+			stackshot.Tasks[i].SharedCache = stackshot.SharedCache
+		}
+	}
+	return stackshot, nil
+}
+
+// parseLoadInfos decodes an array of dyld_uuid_info_32 or dyld_uuid_info_64
+func parseLoadInfos(elementType, count uint32, data []byte) []Image {
+	var addressSize int
+	switch elementType {
+	case kcdataTypeLoadInfo:
+		addressSize = 4
+	case kcdataTypeLoadInfo64:
+		addressSize = 8
+	default:
+		return nil
+	}
+	if count == 0 || len(data)/int(count) < addressSize+16 {
+		return nil
+	}
+	elementSize := len(data) / int(count)
+	images := make([]Image, 0, count)
+	for i := 0; i < int(count); i++ {
+		element := data[i*elementSize:]
+		var address uint64
+		if addressSize == 4 {
+			address = uint64(binary.LittleEndian.Uint32(element))
+		} else {
+			address = binary.LittleEndian.Uint64(element)
+		}
+		images = append(images, Image{UUID: formatUUID(element[addressSize : addressSize+16]), LoadAddress: address})
+	}
+	return images
+}
+
+// parseSharedCache decodes a dyld_shared_cache_loadinfo. Older devices only send the
+// slide, the cache is then at the default base address of arm64.
+func parseSharedCache(data []byte) (Image, bool) {
+	if len(data) < 24 {
+		return Image{}, false
+	}
+	slide := binary.LittleEndian.Uint64(data)
+	image := Image{UUID: formatUUID(data[8:24]), LoadAddress: defaultSharedCacheBaseAddr + slide}
+	if len(data) >= 32 {
+		if base := binary.LittleEndian.Uint64(data[24:]); base != 0 {
+			image.LoadAddress = base
+		}
+	}
+	return image, true
+}
+
+func formatUUID(b []byte) string {
+	id, _ := uuid.FromBytes(b)
+	return strings.ToUpper(id.String())
+}
+
+// ImageMap finds the image that contains an address
+type ImageMap struct {
+	// images are sorted by load address
+	images []Image
+}
+
+// NewImageMap creates a map of the images of a task, including the shared cache
+func NewImageMap(task Task) *ImageMap {
+	images := append([]Image(nil), task.Images...)
+	if task.SharedCache != nil {
+		images = append(images, *task.SharedCache)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].LoadAddress < images[j].LoadAddress })
+	return &ImageMap{images: images}
+}
+
+// Images returns the images sorted by load address
+func (m *ImageMap) Images() []Image {
+	return m.images
+}
+
+// Lookup returns the image with the highest load address below address. Stackshots do
+// not contain the size of images, so the result can be wrong for addresses outside of all images.
+func (m *ImageMap) Lookup(address uint64) (Image, bool) {
+	i := sort.Search(len(m.images), func(i int) bool { return m.images[i].LoadAddress > address }) - 1
+	if i < 0 {
+		return Image{}, false
+	}
+	return m.images[i], true
+}
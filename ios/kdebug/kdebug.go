@@ -0,0 +1,266 @@
+// Package kdebug decodes kernel trace (kdebug) events like they are recorded by ktrace
+// and streamed by the core profile session tap of instruments.
+package kdebug
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EventSize is the size of a kd_buf record on 64 bit devices
+const EventSize = 64
+
+// Event is one kd_buf record. Timestamp is in mach absolute time units.
+type Event struct {
+	Timestamp uint64
+	Args      [4]uint64
+	ThreadID  uint64
+	DebugID   uint32
+	CPU       uint32
+}
+
+// Function qualifiers stored in the lowest two bits of a debug ID
+const (
+	FuncNone  uint8 = 0
+	FuncStart uint8 = 1
+	FuncEnd   uint8 = 2
+)
+
+// Class returns the event class, the highest byte of the debug ID
+func (e Event) Class() uint8 {
+	return uint8(e.DebugID >> 24)
+}
+
+// Subclass returns the event subclass
+func (e Event) Subclass() uint8 {
+	return uint8(e.DebugID >> 16)
+}
+
+// Code returns the event code within the subclass
+func (e Event) Code() uint16 {
+	return uint16(e.DebugID>>2) & 0x3fff
+}
+
+// Func returns FuncStart or FuncEnd for events that mark the begin or end of an interval
+func (e Event) Func() uint8 {
+	return uint8(e.DebugID & 0x3)
+}
+
+// EventID returns the debug ID without the function qualifier
+func (e Event) EventID() uint32 {
+	return e.DebugID &^ 0x3
+}
+
+// DebugID builds the debug ID of an event like the KDBG_CODE macro
+func DebugID(class, subclass uint8, code uint16) uint32 {
+	return uint32(class)<<24 | uint32(subclass)<<16 | uint32(code&0x3fff)<<2
+}
+
+// ParseEvents decodes a buffer of kd_buf records
+func ParseEvents(data []byte) ([]Event, error) {
+	if len(data)%EventSize != 0 {
+		return nil, fmt.Errorf("kdebug buffer size %d is not a multiple of %d", len(data), EventSize)
+	}
+	events := make([]Event, len(data)/EventSize)
+	for i := range events {
+		events[i] = parseEvent(data[i*EventSize:])
+	}
+	return events, nil
+}
+
+func parseEvent(b []byte) Event {
+	return Event{
+		Timestamp: binary.LittleEndian.Uint64(b),
+		Args: [4]uint64{
+			binary.LittleEndian.Uint64(b[8:]),
+			binary.LittleEndian.Uint64(b[16:]),
+			binary.LittleEndian.Uint64(b[24:]),
+			binary.LittleEndian.Uint64(b[32:]),
+		},
+		ThreadID: binary.LittleEndian.Uint64(b[40:]),
+		DebugID:  binary.LittleEndian.Uint32(b[48:]),
+		CPU:      binary.LittleEndian.Uint32(b[52:]),
+	}
+}
+
+// MarshalBinary encodes the event as kd_buf record
+func (e Event) MarshalBinary() ([]byte, error) {
+	b := make([]byte, EventSize)
+	binary.LittleEndian.PutUint64(b, e.Timestamp)
+	for i, arg := range e.Args {
+		binary.LittleEndian.PutUint64(b[8+8*i:], arg)
+	}
+	binary.LittleEndian.PutUint64(b[40:], e.ThreadID)
+	binary.LittleEndian.PutUint32(b[48:], e.DebugID)
+	binary.LittleEndian.PutUint32(b[52:], e.CPU)
+	return b, nil
+}
+
+// Chunk tags of the ktrace version 3 file format
+const (
+	chunkTagHeader    = 0x00001000
+	chunkTagThreadMap = 0x00001001
+	chunkTagEvents    = 0x00001e00
+)
+
+const (
+	chunkHeaderSize = 16
+	threadMapSize   = 32
+)
+
+// Thread is an entry of the thread map of a trace
+type Thread struct {
+	ThreadID uint64 `json:"threadId"`
+	PID      int32  `json:"pid"`
+	Command  string `json:"command"`
+}
+
+// Timebase converts mach absolute time to nanoseconds
+type Timebase struct {
+	Numer uint32
+	Denom uint32
+}
+
+// Nanoseconds converts a mach absolute time to nanoseconds. A zero timebase
+// is treated as 1/1, which is correct for Intel devices and the simulator.
+func (t Timebase) Nanoseconds(machTime uint64) uint64 {
+	if t.Numer == 0 || t.Denom == 0 || t.Numer == t.Denom {
+		return machTime
+	}
+	return machTime * uint64(t.Numer) / uint64(t.Denom)
+}
+
+// Decoder decodes a kdebug stream that arrives in pieces. The stream is either a
+// sequence of kd_buf records or a ktrace version 3 file, which is detected
+// from the first chunk. Records and chunks may be split across calls to Decode.
+type Decoder struct {
+	buf      []byte
+	detected bool
+	v3       bool
+	// remaining is the number of bytes left in the current v3 events chunk
+	remaining uint64
+
+	timebase Timebase
+	threads  map[uint64]Thread
+}
+
+// NewDecoder creates a decoder for a new stream
+func NewDecoder() *Decoder {
+	return &Decoder{threads: map[uint64]Thread{}}
+}
+
+// Decode appends data to the stream and returns all events that are complete
+func (d *Decoder) Decode(data []byte) ([]Event, error) {
+	d.buf = append(d.buf, data...)
+	if !d.detected {
+		if len(d.buf) < 4 {
+			return nil, nil
+		}
+		d.detected = true
+		d.v3 = binary.LittleEndian.Uint32(d.buf) == chunkTagHeader
+	}
+	if !d.v3 {
+		n := len(d.buf) / EventSize * EventSize
+		events, err := ParseEvents(d.buf[:n])
+		d.buf = d.buf[n:]
+		return events, err
+	}
+
+	var events []Event
+	for {
+		if d.remaining >= EventSize {
+			n := min(d.remaining, uint64(len(d.buf))) / EventSize * EventSize
+			if n == 0 {
+				break
+			}
+			chunkEvents, _ := ParseEvents(d.buf[:n])
+			events = append(events, chunkEvents...)
+			d.buf = d.buf[n:]
+			d.remaining -= n
+			continue
+		}
+		if d.remaining > 0 {
+			// skip the padding at the end of an events chunk
+			if uint64(len(d.buf)) < d.remaining {
+				break
+			}
+			d.buf = d.buf[d.remaining:]
+			d.remaining = 0
+			continue
+		}
+		if len(d.buf) < chunkHeaderSize {
+			break
+		}
+		tag := binary.LittleEndian.Uint32(d.buf)
+		length := binary.LittleEndian.Uint64(d.buf[8:])
+		if tag == chunkTagEvents {
+			d.buf = d.buf[chunkHeaderSize:]
+			d.remaining = length
+			continue
+		}
+		if length > uint64(len(d.buf)-chunkHeaderSize) {
+			break
+		}
+		d.parseChunk(tag, d.buf[chunkHeaderSize:chunkHeaderSize+length])
+		d.buf = d.buf[chunkHeaderSize+length:]
+	}
+	return events, nil
+}
+
+func (d *Decoder) parseChunk(tag uint32, data []byte) {
+	switch tag {
+	case chunkTagHeader:
+		if len(data) >= 8 {
+			d.timebase = Timebase{Numer: binary.LittleEndian.Uint32(data), Denom: binary.LittleEndian.Uint32(data[4:])}
+		}
+	case chunkTagThreadMap:
+		for len(data) >= threadMapSize {
+			thread := Thread{
+				ThreadID: binary.LittleEndian.Uint64(data),
+				PID:      int32(binary.LittleEndian.Uint32(data[8:])),
+				Command:  cString(data[12:threadMapSize]),
+			}
+			d.threads[thread.ThreadID] = thread
+			data = data[threadMapSize:]
+		}
+	}
+}
+
+// Timebase returns the timebase of a version 3 file, it is zero for raw records
+func (d *Decoder) Timebase() Timebase {
+	return d.timebase
+}
+
+// Threads returns the thread map of a version 3 file
+func (d *Decoder) Threads() map[uint64]Thread {
+	return d.threads
+}
+
+// Trace is a decoded kdebug buffer or ktrace file
+type Trace struct {
+	Timebase Timebase
+	Threads  map[uint64]Thread
+	Events   []Event
+}
+
+// Decode decodes a complete kdebug buffer or ktrace version 3 file
+func Decode(data []byte) (Trace, error) {
+	d := NewDecoder()
+	events, err := d.Decode(data)
+	if err != nil {
+		return Trace{}, err
+	}
+	if len(d.buf) != 0 || d.remaining != 0 {
+		return Trace{}, fmt.Errorf("kdebug trace is truncated, %d bytes left", len(d.buf))
+	}
+	return Trace{Timebase: d.timebase, Threads: d.threads, Events: events}, nil
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,230 @@
+package kdebug
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func eventBytes(e Event) []byte {
+	b, _ := e.MarshalBinary()
+	return b
+}
+
+func chunk(tag uint32, data []byte) []byte {
+	b := make([]byte, chunkHeaderSize, chunkHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(b, tag)
+	binary.LittleEndian.PutUint64(b[8:], uint64(len(data)))
+	return append(b, data...)
+}
+
+func TestEventFields(t *testing.T) {
+	e := Event{DebugID: DebugID(ClassPerf, perfSubclassCallstack, perfCodeUserHeader) | uint32(FuncEnd)}
+	assert.Equal(t, ClassPerf, e.Class())
+	assert.Equal(t, perfSubclassCallstack, e.Subclass())
+	assert.Equal(t, perfCodeUserHeader, e.Code())
+	assert.Equal(t, FuncEnd, e.Func())
+	assert.Equal(t, uint32(0x25020018), e.EventID())
+}
+
+func TestDecodeRawEvents(t *testing.T) {
+	first := Event{Timestamp: 100, Args: [4]uint64{1, 2, 3, 4}, ThreadID: 7, DebugID: 0x1400008, CPU: 2}
+	second := Event{Timestamp: 200, DebugID: 0x40c0004}
+	data := append(eventBytes(first), eventBytes(second)...)
+
+	d := NewDecoder()
+	events, err := d.Decode(data[:80])
+	require.NoError(t, err)
+	assert.Equal(t, []Event{first}, events)
+	events, err = d.Decode(data[80:])
+	require.NoError(t, err)
+	assert.Equal(t, []Event{second}, events)
+
+	_, err = ParseEvents(data[:70])
+	assert.Error(t, err)
+}
+
+func TestDecodeV3(t *testing.T) {
+	header := make([]byte, 40)
+	binary.LittleEndian.PutUint32(header, 125)
+	binary.LittleEndian.PutUint32(header[4:], 3)
+	threadMap := make([]byte, threadMapSize)
+	binary.LittleEndian.PutUint64(threadMap, 0x1234)
+	binary.LittleEndian.PutUint32(threadMap[8:], 42)
+	copy(threadMap[12:], "MyApp")
+	event := Event{Timestamp: 24, ThreadID: 0x1234, DebugID: 0x1400008}
+	// the events chunk ends with padding that is shorter than a record
+	events := append(append(eventBytes(event), eventBytes(event)...), 0, 0, 0, 0)
+
+	var data []byte
+	data = append(data, chunk(chunkTagHeader, header)...)
+	data = append(data, chunk(chunkTagThreadMap, threadMap)...)
+	data = append(data, chunk(chunkTagEvents, events)...)
+	data = append(data, chunk(0x1c00, []byte{1, 2, 3})...)
+
+	trace, err := Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, Timebase{Numer: 125, Denom: 3}, trace.Timebase)
+	assert.Equal(t, uint64(1000), trace.Timebase.Nanoseconds(24))
+	assert.Equal(t, map[uint64]Thread{0x1234: {ThreadID: 0x1234, PID: 42, Command: "MyApp"}}, trace.Threads)
+	assert.Equal(t, []Event{event, event}, trace.Events)
+
+	// the same stream split at arbitrary positions
+	d := NewDecoder()
+	var decoded []Event
+	for i := 0; i < len(data); i += 13 {
+		e, err := d.Decode(data[i:min(i+13, len(data))])
+		require.NoError(t, err)
+		decoded = append(decoded, e...)
+	}
+	assert.Equal(t, []Event{event, event}, decoded)
+
+	_, err = Decode(data[:len(data)-5])
+	assert.Error(t, err)
+}
+
+func TestCallstackCollector(t *testing.T) {
+	perf := func(subclass uint8, code uint16, fn uint8, cpu uint32, args ...uint64) Event {
+		e := Event{DebugID: DebugID(ClassPerf, subclass, code) | uint32(fn), CPU: cpu}
+		copy(e.Args[:], args)
+		return e
+	}
+	c := NewCallstackCollector()
+	events := []Event{
+		perf(perfSubclassGeneric, perfCodeGenericEvent, FuncStart, 0),
+		perf(perfSubclassGeneric, perfCodeGenericEvent, FuncStart, 1),
+		perf(perfSubclassThreadInfo, perfCodeThreadInfoData, FuncNone, 0, 42, 0x1234),
+		perf(perfSubclassThreadInfo, perfCodeThreadInfoData, FuncNone, 1, 99, 0x5678),
+		perf(perfSubclassCallstack, perfCodeUserHeader, FuncNone, 0, callstackValid, 6),
+		// an invalid callstack on the other CPU is skipped
+		perf(perfSubclassCallstack, perfCodeUserHeader, FuncNone, 1, 0, 3),
+		perf(perfSubclassCallstack, perfCodeUserData, FuncNone, 1, 1, 2, 3),
+		{DebugID: 0x1400008},
+		perf(perfSubclassCallstack, perfCodeUserData, FuncNone, 0, 0x1000, 0x2000, 0x3000, 0x4000),
+	}
+	for _, e := range events {
+		_, ok := c.Add(e)
+		assert.False(t, ok)
+	}
+	stack, ok := c.Add(perf(perfSubclassCallstack, perfCodeUserData, FuncNone, 0, 0x5000, 0xfefe))
+	require.True(t, ok)
+	assert.Equal(t, Callstack{PID: 42, ThreadID: 0x1234, Frames: []uint64{0x1000, 0x2000, 0x3000, 0x4000, 0x5000}}, stack)
+}
+
+func kcdataItem(itemType uint32, flags uint64, data []byte) []byte {
+	padded := (len(data) + 15) / 16 * 16
+	b := make([]byte, kcdataItemHeaderSize+padded)
+	binary.LittleEndian.PutUint32(b, itemType)
+	binary.LittleEndian.PutUint32(b[4:], uint32(padded))
+	binary.LittleEndian.PutUint64(b[8:], flags)
+	copy(b[kcdataItemHeaderSize:], data)
+	return b
+}
+
+func TestParseStackshot(t *testing.T) {
+	uuidBytes := func(first byte) []byte {
+		b := make([]byte, 16)
+		b[0] = first
+		return b
+	}
+	loadInfo := func(address uint64, first byte) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, address)
+		return append(b, uuidBytes(first)...)
+	}
+	taskSnapshot := make([]byte, taskSnapshotCommandOffset+taskSnapshotCommandLength)
+	binary.LittleEndian.PutUint32(taskSnapshot[taskSnapshotPIDOffset:], 42)
+	copy(taskSnapshot[taskSnapshotCommandOffset:], "MyApp")
+	sharedCache := make([]byte, 8, 32)
+	binary.LittleEndian.PutUint64(sharedCache, 0x4000)
+	sharedCache = append(sharedCache, uuidBytes(0xcc)...)
+	sharedCache = binary.LittleEndian.AppendUint64(sharedCache, 0x180004000)
+	images := append(loadInfo(0x100000000, 0xaa), loadInfo(0x102000000, 0xbb)...)
+
+	var data []byte
+	data = append(data, kcdataItem(kcdataBeginStackshot, 0, nil)...)
+	data = append(data, kcdataItem(stackshotTypeSharedCache, 0, sharedCache)...)
+	data = append(data, kcdataItem(kcdataTypeContainerBegin, 1, binary.LittleEndian.AppendUint32(nil, stackshotContainerTask))...)
+	data = append(data, kcdataItem(stackshotTypeTaskSnapshot, 0, taskSnapshot)...)
+	// 48 bytes of images padded to 48, so the array type has no padding
+	data = append(data, kcdataItem(kcdataTypeArrayPad0, uint64(kcdataTypeLoadInfo64)<<32|2, images)...)
+	data = append(data, kcdataItem(kcdataTypeContainerBegin, 2, binary.LittleEndian.AppendUint32(nil, 0x904))...)
+	data = append(data, kcdataItem(kcdataTypeContainerEnd, 2, nil)...)
+	data = append(data, kcdataItem(kcdataTypeContainerEnd, 1, nil)...)
+	data = append(data, kcdataItem(kcdataTypeBufferEnd, 0, nil)...)
+
+	require.True(t, IsStackshot(data))
+	stackshot, err := ParseStackshot(data)
+	require.NoError(t, err)
+	task, ok := stackshot.Task(42)
+	require.True(t, ok)
+	assert.Equal(t, "MyApp", task.Name)
+	assert.Equal(t, []Image{
+		{UUID: "AA000000-0000-0000-0000-000000000000", LoadAddress: 0x100000000},
+		{UUID: "BB000000-0000-0000-0000-000000000000", LoadAddress: 0x102000000},
+	}, task.Images)
+	require.NotNil(t, task.SharedCache)
+	assert.Equal(t, uint64(0x180004000), task.SharedCache.LoadAddress)
+
+	imageMap := NewImageMap(task)
+	image, ok := imageMap.Lookup(0x100001234)
+	require.True(t, ok)
+	assert.Equal(t, uint64(0x100000000), image.LoadAddress)
+	image, ok = imageMap.Lookup(0x190000000)
+	require.True(t, ok)
+	assert.Equal(t, "CC000000-0000-0000-0000-000000000000", image.UUID)
+	_, ok = imageMap.Lookup(0x1000)
+	assert.False(t, ok)
+
+	_, err = ParseStackshot(data[:len(data)-40])
+	assert.Error(t, err)
+}
+
+func TestEventName(t *testing.T) {
+	assert.Equal(t, "bsd/syscall/read", Event{DebugID: DebugID(ClassBSD, SubclassBSDExcpSyscall, 3) | uint32(FuncStart)}.Name())
+	assert.Equal(t, "mach/sched/context_switch", Event{DebugID: DebugID(ClassMach, SubclassMachSched, 0)}.Name())
+	assert.Equal(t, "mach/0x99/0x7", Event{DebugID: DebugID(ClassMach, 0x99, 7)}.Name())
+	assert.Equal(t, "200/0x01/0x2", Event{DebugID: DebugID(200, 1, 2)}.Name())
+}
+
+func TestFilter(t *testing.T) {
+	read := Event{DebugID: DebugID(ClassBSD, SubclassBSDExcpSyscall, 3)}
+	machMsg := Event{DebugID: DebugID(ClassMach, SubclassMachSyscall, 31)}
+	contextSwitch := Event{DebugID: DebugID(ClassMach, SubclassMachSched, 0)}
+	dyld := Event{DebugID: DebugID(ClassDyld, 5, 0)}
+
+	f, err := ParseFilter("")
+	require.NoError(t, err)
+	assert.True(t, f.Match(dyld))
+
+	f, err = ParseFilter("syscall, dyld")
+	require.NoError(t, err)
+	assert.True(t, f.Match(read))
+	assert.True(t, f.Match(machMsg))
+	assert.True(t, f.Match(dyld))
+	assert.False(t, f.Match(contextSwitch))
+
+	f, err = ParseFilter("0x0140")
+	require.NoError(t, err)
+	assert.True(t, f.Match(contextSwitch))
+	assert.False(t, f.Match(machMsg))
+
+	f, err = ParseFilter("1")
+	require.NoError(t, err)
+	assert.True(t, f.Match(contextSwitch))
+	assert.True(t, f.Match(machMsg))
+	assert.False(t, f.Match(read))
+	assert.Len(t, f.Values(), 256)
+	assert.Contains(t, f.Values(), uint32(0x01400000))
+
+	f, err = ParseFilter("0x0140,0x0140")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0x01400000}, f.Values())
+	assert.Nil(t, Filter{}.Values())
+
+	_, err = ParseFilter("syscalls")
+	assert.ErrorContains(t, err, "sched")
+	assert.Contains(t, FilterNames(), "vm")
+}
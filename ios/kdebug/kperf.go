@@ -0,0 +1,107 @@
+package kdebug
+
+// ClassPerf is the DBG_PERF class of the events kperf writes for its samples
+const ClassPerf uint8 = 37
+
+// kperf subclasses and codes from osfmk/kperf/buffer.h
+const (
+	perfSubclassGeneric    uint8 = 0
+	perfSubclassThreadInfo uint8 = 1
+	perfSubclassCallstack  uint8 = 2
+
+	perfCodeGenericEvent   uint16 = 0
+	perfCodeThreadInfoData uint16 = 1
+	perfCodeUserData       uint16 = 4
+	perfCodeUserHeader     uint16 = 6
+)
+
+// callstackValid is the CALLSTACK_VALID flag of a callstack header
+const callstackValid = 0x1
+
+// Callstack is a user space callstack that kperf sampled from a thread.
+// Frames are return addresses, starting with the program counter of the thread.
+type Callstack struct {
+	Timestamp uint64
+	CPU       uint32
+	PID       int32
+	ThreadID  uint64
+	Frames    []uint64
+}
+
+type cpuSample struct {
+	pid      int32
+	threadID uint64
+	// frames is nil while no user callstack is being collected
+	frames    []uint64
+	numFrames int
+	timestamp uint64
+}
+
+// CallstackCollector reassembles the user callstacks of kperf samples. kperf writes a
+// sample as a sequence of events on one CPU: a thread info event with the pid and
+// thread ID of the sampled thread, a callstack header with the number of frames and
+// the frames in data events with four frames each.
+type CallstackCollector struct {
+	cpus map[uint32]*cpuSample
+}
+
+// NewCallstackCollector creates an empty collector
+func NewCallstackCollector() *CallstackCollector {
+	return &CallstackCollector{cpus: map[uint32]*cpuSample{}}
+}
+
+// Add processes an event and returns a callstack when it was the last event of one
+func (c *CallstackCollector) Add(e Event) (Callstack, bool) {
+	if e.Class() != ClassPerf {
+		return Callstack{}, false
+	}
+	sample, ok := c.cpus[e.CPU]
+	if !ok {
+		sample = &cpuSample{}
+		c.cpus[e.CPU] = sample
+	}
+
+	switch {
+	case e.Subclass() == perfSubclassGeneric && e.Code() == perfCodeGenericEvent && e.Func() == FuncStart:
+		*sample = cpuSample{}
+	case e.Subclass() == perfSubclassThreadInfo && e.Code() == perfCodeThreadInfoData:
+		sample.pid = int32(e.Args[0])
+		sample.threadID = e.Args[1]
+	case e.Subclass() == perfSubclassCallstack && e.Code() == perfCodeUserHeader:
+		sample.frames = nil
+		if e.Args[0]&callstackValid == 0 || e.Args[1] == 0 {
+			return Callstack{}, false
+		}
+		sample.numFrames = int(e.Args[1])
+		sample.frames = make([]uint64, 0, sample.numFrames)
+		sample.timestamp = e.Timestamp
+	case e.Subclass() == perfSubclassCallstack && e.Code() == perfCodeUserData:
+		if sample.frames == nil {
+			return Callstack{}, false
+		}
+		for _, frame := range e.Args {
+			if len(sample.frames) == sample.numFrames {
+				break
+			}
+			sample.frames = append(sample.frames, frame)
+		}
+		if len(sample.frames) < sample.numFrames {
+			return Callstack{}, false
+		}
+		frames := sample.frames
+		sample.frames = nil
+		// the last frame of a user callstack is the fixup value, the link register
+		// or stack pointer, and not a return address
+		if len(frames) > 1 {
+			frames = frames[:len(frames)-1]
+		}
+		return Callstack{
+			Timestamp: sample.timestamp,
+			CPU:       e.CPU,
+			PID:       sample.pid,
+			ThreadID:  sample.threadID,
+			Frames:    frames,
+		}, true
+	}
+	return Callstack{}, false
+}
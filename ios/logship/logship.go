@@ -0,0 +1,153 @@
+// Package logship ships device logs to observability backends. It converts os_trace
+// and syslog entries into OpenTelemetry log records or Loki push batches and sends
+// them in batches, retrying failed requests.
+package logship
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/ostrace"
+	"github.com/danielpaulus/go-ios/ios/syslog"
+)
+
+const logModule = "go-ios/logship"
+
+// Resource attribute keys, they follow the OpenTelemetry semantic conventions
+const (
+	AttributeDeviceID    = "device.id"
+	AttributeDeviceModel = "device.model.identifier"
+	AttributeDeviceName  = "device.name"
+	AttributeOSName      = "os.name"
+	AttributeOSVersion   = "os.version"
+	AttributeOSBuild     = "os.build_id"
+)
+
+// Record attribute keys
+const (
+	AttributeSource    = "log.source"
+	AttributeProcess   = "process.executable.name"
+	AttributePID       = "process.pid"
+	AttributeThreadID  = "thread.id"
+	AttributeSubsystem = "log.subsystem"
+	AttributeCategory  = "log.category"
+	AttributeImage     = "log.image"
+)
+
+// Severity numbers of the OpenTelemetry log data model
+const (
+	SeverityDebug  = 5
+	SeverityInfo   = 9
+	SeverityInfo2  = 10
+	SeverityWarn   = 13
+	SeverityError  = 17
+	SeverityError3 = 19
+	SeverityFatal  = 21
+)
+
+// Record is a log entry in the OpenTelemetry log data model
+type Record struct {
+	Time           time.Time
+	SeverityNumber int
+	SeverityText   string
+	Body           string
+	Attributes     map[string]string
+}
+
+// Resource describes the device the logs come from
+type Resource map[string]string
+
+// DeviceResource reads the resource attributes of the device from lockdown
+func DeviceResource(device ios.DeviceEntry) (Resource, error) {
+	values, err := ios.GetValues(device)
+	if err != nil {
+		return nil, fmt.Errorf("logship: failed reading device values: %w", err)
+	}
+	return Resource{
+		AttributeDeviceID:    device.Properties.SerialNumber,
+		AttributeDeviceModel: values.Value.ProductType,
+		AttributeDeviceName:  values.Value.DeviceName,
+		AttributeOSName:      "iOS",
+		AttributeOSVersion:   values.Value.ProductVersion,
+		AttributeOSBuild:     values.Value.BuildVersion,
+	}, nil
+}
+
+// FromOsTrace converts an os_trace entry
+func FromOsTrace(e ostrace.LogEntry) Record {
+	r := Record{
+		Time:         e.Timestamp,
+		SeverityText: e.LevelName,
+		Body:         e.Message,
+		Attributes: map[string]string{
+			AttributeSource:   "ostrace",
+			AttributeProcess:  lastPathElement(e.Filename),
+			AttributePID:      strconv.FormatUint(uint64(e.PID), 10),
+			AttributeThreadID: strconv.FormatUint(uint64(e.ThreadID), 10),
+		},
+	}
+	if e.ImageName != "" {
+		r.Attributes[AttributeImage] = e.ImageName
+	}
+	if e.Label != nil {
+		r.Attributes[AttributeSubsystem] = e.Label.Subsystem
+		r.Attributes[AttributeCategory] = e.Label.Category
+	}
+	switch e.Level {
+	case ostrace.LogLevelDebug:
+		r.SeverityNumber = SeverityDebug
+	case ostrace.LogLevelInfo:
+		r.SeverityNumber = SeverityInfo
+	case ostrace.LogLevelError:
+		r.SeverityNumber = SeverityError
+	case ostrace.LogLevelFault:
+		r.SeverityNumber = SeverityError3
+	default:
+		r.SeverityNumber = SeverityInfo2
+	}
+	return r
+}
+
+// FromSyslog converts a parsed syslog entry, see [syslog.LogEntry.Time] for how the
+// timestamp is interpreted. Entries without a valid timestamp get the current time.
+func FromSyslog(e *syslog.LogEntry) Record {
+	t, err := e.Time()
+	if err != nil {
+		t = time.Now()
+	}
+	r := Record{
+		Time:         t,
+		SeverityText: e.Level,
+		Body:         e.Message,
+		Attributes: map[string]string{
+			AttributeSource:  "syslog",
+			AttributeProcess: e.Process,
+			AttributePID:     e.PID,
+		},
+	}
+	switch strings.ToLower(e.Level) {
+	case "debug":
+		r.SeverityNumber = SeverityDebug
+	case "info":
+		r.SeverityNumber = SeverityInfo
+	case "warning":
+		r.SeverityNumber = SeverityWarn
+	case "error":
+		r.SeverityNumber = SeverityError
+	case "critical", "alert", "emergency", "fault":
+		r.SeverityNumber = SeverityFatal
+	default:
+		r.SeverityNumber = SeverityInfo2
+	}
+	return r
+}
+
+func lastPathElement(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
@@ -0,0 +1,262 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/ostrace"
+	"github.com/danielpaulus/go-ios/ios/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testResource = Resource{
+	AttributeDeviceID:    "00008030-001A",
+	AttributeDeviceModel: "iPhone12,1",
+	AttributeOSVersion:   "17.4",
+}
+
+func TestFromOsTrace(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	r := FromOsTrace(ostrace.LogEntry{
+		PID:       42,
+		Timestamp: ts,
+		Level:     ostrace.LogLevelError,
+		LevelName: "Error",
+		ThreadID:  7,
+		ImageName: "UIKitCore",
+		Filename:  "/usr/libexec/locationd",
+		Message:   "failed",
+		Label:     &ostrace.LogLabel{Subsystem: "com.apple.locationd", Category: "core"},
+	})
+	assert.Equal(t, ts, r.Time)
+	assert.Equal(t, SeverityError, r.SeverityNumber)
+	assert.Equal(t, "Error", r.SeverityText)
+	assert.Equal(t, "failed", r.Body)
+	assert.Equal(t, map[string]string{
+		AttributeSource:    "ostrace",
+		AttributeProcess:   "locationd",
+		AttributePID:       "42",
+		AttributeThreadID:  "7",
+		AttributeImage:     "UIKitCore",
+		AttributeSubsystem: "com.apple.locationd",
+		AttributeCategory:  "core",
+	}, r.Attributes)
+}
+
+func TestFromSyslog(t *testing.T) {
+	r := FromSyslog(&syslog.LogEntry{
+		Timestamp: "2024-05-01T10:00:00",
+		Process:   "SpringBoard",
+		PID:       "58",
+		Level:     "Warning",
+		Message:   "low memory",
+	})
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local), r.Time)
+	assert.Equal(t, SeverityWarn, r.SeverityNumber)
+	assert.Equal(t, "low memory", r.Body)
+	assert.Equal(t, "SpringBoard", r.Attributes[AttributeProcess])
+	assert.Equal(t, "58", r.Attributes[AttributePID])
+	assert.Equal(t, "syslog", r.Attributes[AttributeSource])
+
+	r = FromSyslog(&syslog.LogEntry{Timestamp: "2024-05-01T10:00:00+02:00", Message: "zoned"})
+	assert.True(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC).Equal(r.Time), "time %v", r.Time)
+	r = FromSyslog(&syslog.LogEntry{Timestamp: "May  1 10:00:00", Message: "relay"})
+	assert.Equal(t, time.Date(time.Now().Year(), 5, 1, 10, 0, 0, 0, time.Local), r.Time)
+}
+
+// captureServer records the request bodies it receives
+func captureServer(t *testing.T) (*httptest.Server, func() (string, []byte)) {
+	var mu sync.Mutex
+	var path string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		mu.Lock()
+		path, body = r.URL.Path, b
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() (string, []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		return path, body
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	server, received := captureServer(t)
+	exporter, err := NewOTLPExporter(server.URL, testResource)
+	require.NoError(t, err)
+
+	ts := time.Unix(1714557600, 123)
+	err = exporter.Export([]Record{{
+		Time:           ts,
+		SeverityNumber: SeverityInfo,
+		SeverityText:   "Info",
+		Body:           "hello",
+		Attributes:     map[string]string{AttributeProcess: "SpringBoard"},
+	}})
+	require.NoError(t, err)
+
+	path, body := received()
+	assert.Equal(t, "/v1/logs", path)
+	var request otlpLogsRequest
+	require.NoError(t, json.Unmarshal(body, &request))
+	require.Len(t, request.ResourceLogs, 1)
+	assert.Equal(t, []otlpKeyValue{
+		{Key: AttributeDeviceID, Value: otlpAnyValue{StringValue: "00008030-001A"}},
+		{Key: AttributeDeviceModel, Value: otlpAnyValue{StringValue: "iPhone12,1"}},
+		{Key: AttributeOSVersion, Value: otlpAnyValue{StringValue: "17.4"}},
+	}, request.ResourceLogs[0].Resource.Attributes)
+	records := request.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 1)
+	assert.Equal(t, "1714557600000000123", records[0].TimeUnixNano)
+	assert.Equal(t, SeverityInfo, records[0].SeverityNumber)
+	assert.Equal(t, "hello", records[0].Body.StringValue)
+	assert.Equal(t, []otlpKeyValue{{Key: AttributeProcess, Value: otlpAnyValue{StringValue: "SpringBoard"}}}, records[0].Attributes)
+}
+
+func TestLokiExporter(t *testing.T) {
+	server, received := captureServer(t)
+	exporter, err := NewLokiExporter(server.URL, testResource)
+	require.NoError(t, err)
+
+	ts := time.Unix(1714557600, 0)
+	err = exporter.Export([]Record{
+		{Time: ts, SeverityText: "Error", Body: "first", Attributes: map[string]string{AttributeSource: "syslog", AttributePID: "1"}},
+		{Time: ts, SeverityText: "Info", Body: "second line", Attributes: map[string]string{AttributeSource: "syslog"}},
+		{Time: ts, SeverityText: "Error", Body: "third", Attributes: map[string]string{AttributeSource: "syslog"}},
+	})
+	require.NoError(t, err)
+
+	path, body := received()
+	assert.Equal(t, "/loki/api/v1/push", path)
+	var request lokiPushRequest
+	require.NoError(t, json.Unmarshal(body, &request))
+	require.Len(t, request.Streams, 2)
+	assert.Equal(t, map[string]string{
+		"job":          "go-ios",
+		"udid":         "00008030-001A",
+		"product_type": "iPhone12,1",
+		"ios_version":  "17.4",
+		"source":       "syslog",
+		"level":        "error",
+	}, request.Streams[0].Stream)
+	assert.Equal(t, [][2]string{
+		{"1714557600000000000", "process_pid=1 msg=first"},
+		{"1714557600000000000", "msg=third"},
+	}, request.Streams[0].Values)
+	assert.Equal(t, "info", request.Streams[1].Stream["level"])
+	assert.Equal(t, [][2]string{{"1714557600000000000", `msg="second line"`}}, request.Streams[1].Values)
+}
+
+func TestExporterEndpoint(t *testing.T) {
+	exporter, err := NewOTLPExporter("http://collector:4318/custom/logs", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://collector:4318/custom/logs", exporter.endpoint)
+
+	_, err = NewLokiExporter("localhost:3100", nil)
+	assert.Error(t, err)
+}
+
+func TestPostErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var permanent *PermanentError
+	err := post(server.Client(), server.URL, nil)
+	assert.True(t, errors.As(err, &permanent))
+
+	status = http.StatusTooManyRequests
+	err = post(server.Client(), server.URL, nil)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &permanent))
+}
+
+type fakeExporter struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	block    chan struct{}
+	batches  [][]Record
+	attempts int
+}
+
+func (f *fakeExporter) Export(records []Record) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.attempts <= f.failures {
+		return f.err
+	}
+	f.batches = append(f.batches, records)
+	return nil
+}
+
+func TestShipperBatches(t *testing.T) {
+	exporter := &fakeExporter{}
+	shipper := NewShipper(exporter, ShipperOptions{BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, shipper.Send(context.Background(), Record{Body: "line"}))
+	}
+	require.NoError(t, shipper.Close(context.Background()))
+
+	require.Len(t, exporter.batches, 3)
+	assert.Len(t, exporter.batches[0], 2)
+	assert.Len(t, exporter.batches[2], 1)
+	assert.Equal(t, 0, shipper.Dropped())
+}
+
+func TestShipperRetries(t *testing.T) {
+	exporter := &fakeExporter{failures: 2, err: errors.New("connection refused")}
+	shipper := NewShipper(exporter, ShipperOptions{RetryBackoff: time.Millisecond})
+	require.NoError(t, shipper.Send(context.Background(), Record{Body: "line"}))
+	require.NoError(t, shipper.Close(context.Background()))
+
+	assert.Equal(t, 3, exporter.attempts)
+	assert.Len(t, exporter.batches, 1)
+	assert.Equal(t, 0, shipper.Dropped())
+}
+
+func TestShipperDropsPermanentErrors(t *testing.T) {
+	exporter := &fakeExporter{failures: 1, err: &PermanentError{StatusCode: http.StatusBadRequest}}
+	shipper := NewShipper(exporter, ShipperOptions{RetryBackoff: time.Millisecond})
+	require.NoError(t, shipper.Send(context.Background(), Record{Body: "line"}))
+	require.NoError(t, shipper.Close(context.Background()))
+
+	assert.Equal(t, 1, exporter.attempts)
+	assert.Equal(t, 1, shipper.Dropped())
+}
+
+func TestShipperBackpressure(t *testing.T) {
+	exporter := &fakeExporter{block: make(chan struct{})}
+	shipper := NewShipper(exporter, ShipperOptions{BatchSize: 1, QueueSize: 1})
+
+	// the first record is taken by the blocked exporter, the second fills the queue
+	require.NoError(t, shipper.Send(context.Background(), Record{}))
+	require.NoError(t, shipper.Send(context.Background(), Record{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, shipper.Send(ctx, Record{}), context.DeadlineExceeded)
+
+	close(exporter.block)
+	require.NoError(t, shipper.Close(context.Background()))
+	assert.Len(t, exporter.batches, 2)
+	assert.ErrorIs(t, shipper.Send(context.Background(), Record{}), ErrClosed)
+}
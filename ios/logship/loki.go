@@ -0,0 +1,133 @@
+package logship
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/syslog"
+)
+
+// lokiPushPath is the path of the Loki push API
+const lokiPushPath = "/loki/api/v1/push"
+
+// lokiLabels maps resource attributes to Loki labels. Only attributes with a
+// low number of values become labels, everything else is part of the log line.
+var lokiLabels = map[string]string{
+	AttributeDeviceID:    "udid",
+	AttributeDeviceModel: "product_type",
+	AttributeOSVersion:   "ios_version",
+}
+
+// LokiExporter sends records to the Loki push API using the JSON encoding
+type LokiExporter struct {
+	endpoint string
+	labels   map[string]string
+	client   *http.Client
+}
+
+// NewLokiExporter creates an exporter for the Loki server at endpoint, like "http://localhost:3100".
+// If endpoint has no path, the push API path /loki/api/v1/push is used.
+func NewLokiExporter(endpoint string, resource Resource) (*LokiExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, &url.Error{Op: "parse", URL: endpoint, Err: errInvalidEndpoint}
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	labels := map[string]string{"job": "go-ios"}
+	for attribute, label := range lokiLabels {
+		if value := resource[attribute]; value != "" {
+			labels[label] = value
+		}
+	}
+	return &LokiExporter{endpoint: u.String(), labels: labels, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// encode groups the records into one stream per label set. The level becomes a label,
+// the other attributes are written in logfmt in front of the message.
+func (e *LokiExporter) encode(records []Record) ([]byte, error) {
+	var streams []lokiStream
+	index := map[string]int{}
+	for _, r := range records {
+		labels := make(map[string]string, len(e.labels)+2)
+		for k, v := range e.labels {
+			labels[k] = v
+		}
+		if source := r.Attributes[AttributeSource]; source != "" {
+			labels["source"] = source
+		}
+		if r.SeverityText != "" {
+			labels["level"] = strings.ToLower(r.SeverityText)
+		}
+		key := labelKey(labels)
+		i, ok := index[key]
+		if !ok {
+			i = len(streams)
+			index[key] = i
+			streams = append(streams, lokiStream{Stream: labels})
+		}
+		streams[i].Values = append(streams[i].Values, [2]string{strconv.FormatInt(r.Time.UnixNano(), 10), lokiLine(r)})
+	}
+	return json.Marshal(lokiPushRequest{Streams: streams})
+}
+
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// lokiLine formats the record attributes and the message in logfmt
+func lokiLine(r Record) string {
+	keys := make([]string, 0, len(r.Attributes))
+	for k := range r.Attributes {
+		if k != AttributeSource {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(strings.NewReplacer(".", "_").Replace(k))
+		b.WriteByte('=')
+		b.WriteString(syslog.LogfmtValue(r.Attributes[k]))
+		b.WriteByte(' ')
+	}
+	b.WriteString("msg=")
+	b.WriteString(syslog.LogfmtValue(r.Body))
+	return b.String()
+}
+
+// Export sends one batch of records
+func (e *LokiExporter) Export(records []Record) error {
+	body, err := e.encode(records)
+	if err != nil {
+		return err
+	}
+	return post(e.client, e.endpoint, body)
+}
@@ -0,0 +1,111 @@
+package logship
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// otlpLogsPath is the default path of the OTLP/HTTP logs endpoint of a collector
+const otlpLogsPath = "/v1/logs"
+
+// OTLPExporter sends records to an OpenTelemetry collector using OTLP/HTTP with the JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	resource Resource
+	client   *http.Client
+}
+
+// NewOTLPExporter creates an exporter for the collector at endpoint, like "http://localhost:4318".
+// If endpoint has no path, the default logs path /v1/logs is used.
+func NewOTLPExporter(endpoint string, resource Resource) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, &url.Error{Op: "parse", URL: endpoint, Err: errInvalidEndpoint}
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpLogsPath
+	}
+	return &OTLPExporter{endpoint: u.String(), resource: resource, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attributes[k]}})
+	}
+	return result
+}
+
+// encode converts the records into an ExportLogsServiceRequest in the OTLP JSON encoding
+func (e *OTLPExporter) encode(records []Record) ([]byte, error) {
+	scope := otlpScopeLogs{LogRecords: make([]otlpLogRecord, 0, len(records))}
+	scope.Scope.Name = "go-ios"
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, r := range records {
+		scope.LogRecords = append(scope.LogRecords, otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(r.Time.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       r.SeverityNumber,
+			SeverityText:         r.SeverityText,
+			Body:                 otlpAnyValue{StringValue: r.Body},
+			Attributes:           otlpAttributes(r.Attributes),
+		})
+	}
+	resourceLogs := otlpResourceLogs{ScopeLogs: []otlpScopeLogs{scope}}
+	resourceLogs.Resource.Attributes = otlpAttributes(e.resource)
+	return json.Marshal(otlpLogsRequest{ResourceLogs: []otlpResourceLogs{resourceLogs}})
+}
+
+// Export sends one batch of records
+func (e *OTLPExporter) Export(records []Record) error {
+	body, err := e.encode(records)
+	if err != nil {
+		return err
+	}
+	return post(e.client, e.endpoint, body)
+}
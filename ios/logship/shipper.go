@@ -0,0 +1,220 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+var errInvalidEndpoint = errors.New("endpoint must be an absolute http(s) URL")
+
+// ErrClosed is returned by [Shipper.Send] after the shipper was closed
+var ErrClosed = errors.New("logship: shipper closed")
+
+// Exporter sends a batch of records to a backend
+type Exporter interface {
+	Export(records []Record) error
+}
+
+// PermanentError is returned by exporters for requests that will not succeed when retried
+type PermanentError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("logship: request rejected with status %d: %s", e.StatusCode, e.Body)
+}
+
+// post sends a JSON body. Client errors except 429 are permanent, everything else can be retried.
+func post(client *http.Client, endpoint string, body []byte) error {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return fmt.Errorf("logship: request failed with status %d: %s", resp.StatusCode, respBody)
+}
+
+// ShipperOptions configures a [Shipper], zero values use the defaults
+type ShipperOptions struct {
+	// BatchSize is the maximum number of records per request, defaults to 500
+	BatchSize int
+	// FlushInterval is the longest time a record waits for its batch to fill up, defaults to 1s
+	FlushInterval time.Duration
+	// QueueSize is the number of records buffered while a batch is sent. When the queue
+	// is full, [Shipper.Send] blocks until there is space. Defaults to 10 batches.
+	QueueSize int
+	// MaxRetries is how often a failed batch is retried before it is dropped, defaults to 5.
+	// A negative value disables retries.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, it doubles with every retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+}
+
+// Shipper batches records and sends them with an [Exporter] in the background
+type Shipper struct {
+	exporter Exporter
+	options  ShipperOptions
+	queue    chan Record
+	closing  chan struct{}
+	done     chan struct{}
+	stop     context.CancelFunc
+	stopCtx  context.Context
+	once     sync.Once
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewShipper starts a shipper, call [Shipper.Close] to send the remaining records
+func NewShipper(exporter Exporter, options ShipperOptions) *Shipper {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 500
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 10 * options.BatchSize
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	} else if options.MaxRetries == 0 {
+		options.MaxRetries = 5
+	}
+	if options.RetryBackoff <= 0 {
+		options.RetryBackoff = 500 * time.Millisecond
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	s := &Shipper{
+		exporter: exporter,
+		options:  options,
+		queue:    make(chan Record, options.QueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+		stop:     stop,
+		stopCtx:  ctx,
+	}
+	go s.run()
+	return s
+}
+
+// Send queues a record. It blocks while the queue is full, so a slow backend
+// slows down reading from the device instead of growing memory without bounds.
+func (s *Shipper) Send(ctx context.Context, r Record) error {
+	select {
+	case <-s.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.queue <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closing:
+		return ErrClosed
+	}
+}
+
+// Dropped returns the number of records dropped after all retries failed
+func (s *Shipper) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close sends the queued records and stops the shipper. Pending retries are
+// abandoned if ctx is done first.
+func (s *Shipper) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.closing) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.stop()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+func (s *Shipper) run() {
+	defer close(s.done)
+	batch := make([]Record, 0, s.options.BatchSize)
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.export(batch)
+		batch = make([]Record, 0, s.options.BatchSize)
+	}
+	for {
+		select {
+		case r := <-s.queue:
+			batch = append(batch, r)
+			if len(batch) >= s.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.closing:
+			for {
+				select {
+				case r := <-s.queue:
+					batch = append(batch, r)
+					if len(batch) >= s.options.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Shipper) export(batch []Record) {
+	backoff := s.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.exporter.Export(batch)
+		if err == nil {
+			return
+		}
+		var permanent *PermanentError
+		if errors.As(err, &permanent) || attempt >= s.options.MaxRetries {
+			golog.Warn("dropping log batch", "module", logModule, "records", len(batch), "attempts", attempt+1, "err", err)
+			s.mu.Lock()
+			s.dropped += len(batch)
+			s.mu.Unlock()
+			return
+		}
+		golog.Debug("log batch failed, retrying", "module", logModule, "records", len(batch), "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-s.stopCtx.Done():
+			s.mu.Lock()
+			s.dropped += len(batch)
+			s.mu.Unlock()
+			return
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
@@ -84,7 +84,7 @@ func archive(object interface{}, objects []interface{}) ([]interface{}, plist.UI
 		name = typeOf.String()
 	}
 
-	if encoderFunc, ok := encodableClasses[name]; ok {
+	if encoderFunc, ok := encoderFor(name); ok {
 		return encoderFunc(object, objects)
 	}
 
@@ -0,0 +1,63 @@
+package nskeyedarchiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FromJSON converts a JSON value to an object that ArchiveBin can encode. Objects become
+// NSDictionary, arrays NSArray, strings NSString, booleans and numbers NSNumber and null
+// NSNull. Integers are converted to int64 or uint64, all other numbers to float64.
+func FromJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return fromJSONValue(value)
+}
+
+func fromJSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return NewNSNull(), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			converted, err := fromJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted, err := fromJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = converted
+		}
+		return result, nil
+	case string, bool:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported JSON value %v of type %T", value, value)
+}
@@ -0,0 +1,38 @@
+package nskeyedarchiver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromJSON(t *testing.T) {
+	value, err := FromJSON([]byte(`{"ur": 1000, "bm": 0, "ratio": 0.5, "max": 18446744073709551615, "procAttrs": ["pid", "name"], "enabled": true, "none": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"ur":        int64(1000),
+		"bm":        int64(0),
+		"ratio":     0.5,
+		"max":       uint64(18446744073709551615),
+		"procAttrs": []interface{}{"pid", "name"},
+		"enabled":   true,
+		"none":      NewNSNull(),
+	}, value)
+
+	archived, err := ArchiveBin(value)
+	require.NoError(t, err)
+	unarchived, err := Unarchive(archived)
+	require.NoError(t, err)
+	require.Len(t, unarchived, 1)
+	assert.Equal(t, []interface{}{"pid", "name"}, unarchived[0].(map[string]interface{})["procAttrs"])
+
+	value, err = FromJSON([]byte(`"com.apple.instruments.server.services.deviceinfo"`))
+	require.NoError(t, err)
+	assert.Equal(t, "com.apple.instruments.server.services.deviceinfo", value)
+
+	_, err = FromJSON([]byte(`{"a": 1} {}`))
+	assert.Error(t, err)
+	_, err = FromJSON([]byte(`{"a": `))
+	assert.Error(t, err)
+}
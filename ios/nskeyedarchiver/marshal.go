@@ -0,0 +1,711 @@
+package nskeyedarchiver
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"howett.net/plist"
+)
+
+// nsReferenceTime is the reference date of NSDate
+var nsReferenceTime = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	urlType  = reflect.TypeOf(url.URL{})
+)
+
+// Marshal archives v like ArchiveBin and additionally encodes Go structs, similar to
+// encoding/json. Each exported field of a struct is a key of the archived object, the
+// class of the object is the name of the struct type.
+//
+// The nska struct tag changes how a field is archived:
+//
+//	// Field is archived with the key "name"
+//	Field string `nska:"name"`
+//	// Field is archived as object of class XCTIssue instead of the name of its type,
+//	// the class also applies to the elements of slices and maps
+//	Field Issue `nska:"issue,class=XCTIssue"`
+//	// Field is left out if it is empty, otherwise empty pointers, slices, maps and
+//	// interfaces are archived as $null
+//	Field *Issue `nska:"issue,omitempty"`
+//	// Field is ignored
+//	Field int `nska:"-"`
+//
+// The fields of embedded structs are promoted to the archived object like encoding/json does,
+// unless the tag of the embedded struct sets a key.
+//
+// Slices and arrays are archived as NSArray, []byte as data and maps with string keys as
+// NSDictionary. time.Time is archived as NSDate, the zero time as $null. uuid.UUID is archived
+// as NSUUID and url.URL as NSURL. Values of types with a registered EncoderFunc are archived
+// with it. Cyclic values cannot be archived and return an error.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encodeState{visiting: map[visit]bool{}}
+	object, err := e.marshalValue(reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	return ArchiveBin(nullIfNil(object))
+}
+
+// encodeState keeps track of the pointers, maps and slices that are being marshaled to detect cycles
+type encodeState struct {
+	visiting map[visit]bool
+}
+
+type visit struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// enter marks v as being marshaled until leave is called, it fails if v already is
+func (e *encodeState) enter(v reflect.Value) (leave func(), err error) {
+	key := visit{typ: v.Type(), ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if e.visiting[key] {
+		return nil, fmt.Errorf("nskeyedarchiver: cycle via %s", v.Type())
+	}
+	e.visiting[key] = true
+	return func() { delete(e.visiting, key) }, nil
+}
+
+// marshalValue converts v to a value archive can encode. class is the class of structs,
+// the name of their type is used if it is empty. nil is returned for empty pointers, slices,
+// maps and interfaces and for the zero time.
+func (e *encodeState) marshalValue(v reflect.Value, class string) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return nil, nil
+		}
+		return nsDateObject(t), nil
+	case uuidType:
+		return NewNSUUID(v.Interface().(uuid.UUID)), nil
+	case urlType:
+		u := v.Interface().(url.URL)
+		return nsURLObject(&u), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Pointer {
+			leave, err := e.enter(v)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		return e.marshalValue(v.Elem(), class)
+	case reflect.Struct:
+		if _, ok := encoderFor(typeName(v.Type())); ok {
+			return v.Interface(), nil
+		}
+		return e.marshalStruct(v, class)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), v.Bytes()...), nil
+		}
+		leave, err := e.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		return e.marshalList(v, class)
+	case reflect.Array:
+		return e.marshalList(v, class)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("nskeyedarchiver: unsupported map key type %s", v.Type().Key())
+		}
+		leave, err := e.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := e.marshalValue(iter.Value(), class)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", iter.Key().String(), err)
+			}
+			result[iter.Key().String()] = nullIfNil(value)
+		}
+		return result, nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	}
+	return nil, fmt.Errorf("nskeyedarchiver: unsupported type %s", v.Type())
+}
+
+func (e *encodeState) marshalList(v reflect.Value, class string) (interface{}, error) {
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		value, err := e.marshalValue(v.Index(i), class)
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+		result[i] = nullIfNil(value)
+	}
+	return result, nil
+}
+
+func (e *encodeState) marshalStruct(v reflect.Value, class string) (interface{}, error) {
+	if class == "" {
+		class = v.Type().Name()
+	}
+	object := ArchivedObject{Class: class, Fields: map[string]interface{}{}}
+	for _, field := range structFields(v.Type()) {
+		value, ok := fieldByIndex(v, field.index)
+		if !ok || field.omitEmpty && value.IsZero() {
+			continue
+		}
+		archivable, err := e.marshalValue(value, field.class)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", class, field.name, err)
+		}
+		object.Fields[field.key] = archivable
+	}
+	return object, nil
+}
+
+// nullIfNil replaces nil with NSNull, which unlike nil can be an element of NSArray and NSDictionary
+func nullIfNil(v interface{}) interface{} {
+	if v == nil {
+		return NewNSNull()
+	}
+	return v
+}
+
+func nsDateObject(t time.Time) ArchivedObject {
+	return ArchivedObject{Class: "NSDate", Fields: map[string]interface{}{"NS.time": t.Sub(nsReferenceTime).Seconds()}}
+}
+
+func nsURLObject(u *url.URL) ArchivedObject {
+	return ArchivedObject{Class: "NSURL", Fields: map[string]interface{}{"NS.base": nil, "NS.relative": u.String()}}
+}
+
+type structField struct {
+	name      string
+	key       string
+	class     string
+	omitEmpty bool
+	// index is the index sequence for reflect.Value.FieldByIndex
+	index []int
+}
+
+// structFields returns the archived fields of the struct type t. The fields of embedded
+// structs without a key in their tag are promoted like encoding/json does: a field hides
+// the fields with the same key in deeper embedded structs, and keys that appear more than
+// once at the same depth are left out.
+func structFields(t reflect.Type) []structField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []structField
+	// seenKeys are the keys of shallower fields, seenTypes the embedded types already expanded
+	seenKeys := map[string]bool{}
+	seenTypes := map[reflect.Type]bool{}
+	current := []embedded{{typ: t}}
+	for len(current) > 0 {
+		var next []embedded
+		var level []structField
+		count := map[string]int{}
+		for _, e := range current {
+			if seenTypes[e.typ] {
+				continue
+			}
+			seenTypes[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				f := e.typ.Field(i)
+				index := append(append([]int(nil), e.index...), i)
+				if embeddedType, ok := promotedStruct(f); ok {
+					next = append(next, embedded{typ: embeddedType, index: index})
+					continue
+				}
+				field, ok := parseField(f)
+				if !ok || seenKeys[field.key] {
+					continue
+				}
+				field.index = index
+				level = append(level, field)
+				count[field.key]++
+			}
+		}
+		for _, field := range level {
+			if count[field.key] == 1 {
+				fields = append(fields, field)
+			}
+			seenKeys[field.key] = true
+		}
+		current = next
+	}
+	return fields
+}
+
+// promotedStruct returns the struct type of an embedded field whose fields are promoted
+func promotedStruct(f reflect.StructField) (reflect.Type, bool) {
+	if !f.Anonymous {
+		return nil, false
+	}
+	if tag := f.Tag.Get("nska"); tag == "-" || strings.Split(tag, ",")[0] != "" {
+		return nil, false
+	}
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		// embedded pointers to unexported types cannot be allocated when unmarshaling
+		if !f.IsExported() {
+			return nil, false
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || t == urlType {
+		return nil, false
+	}
+	if _, ok := encoderFor(typeName(t)); ok {
+		return nil, false
+	}
+	return t, true
+}
+
+// fieldByIndex returns the field of v with the given index sequence, it returns false
+// if an embedded pointer on the way is nil
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// settableFieldByIndex works like fieldByIndex but allocates nil embedded pointers
+func settableFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// parseField reads the nska tag of f, it returns false for unexported and ignored fields
+func parseField(f reflect.StructField) (structField, bool) {
+	tag, hasTag := f.Tag.Lookup("nska")
+	if !f.IsExported() || tag == "-" {
+		return structField{}, false
+	}
+	field := structField{name: f.Name, key: f.Name}
+	if !hasTag {
+		return field, true
+	}
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		field.key = parts[0]
+	}
+	for _, option := range parts[1:] {
+		switch {
+		case option == "omitempty":
+			field.omitEmpty = true
+		case strings.HasPrefix(option, "class="):
+			field.class = strings.TrimPrefix(option, "class=")
+		}
+	}
+	return field, true
+}
+
+// Unmarshal decodes the root object of an archive into the value v points to, like
+// encoding/json does. It is the reverse of Marshal: struct fields are read from the keys of
+// archived objects or dictionaries, keys without field are ignored and fields without key
+// keep their value. Collections are decoded into slices and dictionaries into maps with
+// string keys. Values decoded into interface{} are the values Unarchive returns.
+func Unmarshal(data []byte, v interface{}) (err error) {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("nskeyedarchiver: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("nskeyedarchiver: Unmarshal: %v", r)
+		}
+	}()
+
+	SetupDecoders()
+	p, err := plistFromBytes(data)
+	if err != nil {
+		return err
+	}
+	archive, ok := p.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid NSKeyedArchiver plist: root is not a dictionary, got %T", p)
+	}
+	if err := verifyCorrectArchiver(archive); err != nil {
+		return err
+	}
+	top, _ := archive[topKey].(map[string]interface{})
+	objects, ok := archive[objectsKey].([]interface{})
+	if !ok {
+		return fmt.Errorf("invalid NSKeyedArchiver plist: '%s' is not an array, got %T", objectsKey, archive[objectsKey])
+	}
+	root, ok := top["root"].(plist.UID)
+	if !ok {
+		return fmt.Errorf("invalid NSKeyedArchiver plist: 'root' is not a UID, got %T", top["root"])
+	}
+	return unmarshalValue(root, objects, target.Elem(), 0)
+}
+
+// unmarshalValue decodes value, which is a reference or an inline value of an object,
+// into target
+func unmarshalValue(value interface{}, objects []interface{}, target reflect.Value, depth int) error {
+	if depth > maxUnarchiveDepth {
+		return fmt.Errorf("max unarchive depth %d exceeded", maxUnarchiveDepth)
+	}
+	if target.Kind() == reflect.Interface {
+		if target.NumMethod() != 0 {
+			return fmt.Errorf("cannot unmarshal into %s", target.Type())
+		}
+		resolved, err := resolveField(value, objects, depth)
+		if err != nil {
+			return err
+		}
+		if resolved == nil {
+			target.SetZero()
+			return nil
+		}
+		target.Set(reflect.ValueOf(resolved))
+		return nil
+	}
+
+	object := value
+	if uid, ok := value.(plist.UID); ok {
+		if uid == 0 {
+			target.SetZero()
+			return nil
+		}
+		if int(uid) >= len(objects) {
+			return fmt.Errorf("object UID %d out of range for $objects of length %d", uid, len(objects))
+		}
+		object = objects[uid]
+	}
+	if _, ok := object.(map[string]interface{}); ok && isNSNull(object, objects) {
+		target.SetZero()
+		return nil
+	}
+
+	if target.Kind() == reflect.Pointer {
+		elem := reflect.New(target.Type().Elem())
+		if err := unmarshalValue(object, objects, elem.Elem(), depth+1); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+
+	switch target.Type() {
+	case timeType:
+		dict, err := objectDict(object, "NSDate")
+		if err != nil {
+			return err
+		}
+		seconds, ok := dict["NS.time"].(float64)
+		if !ok {
+			return fmt.Errorf("NSDate without NS.time")
+		}
+		target.Set(reflect.ValueOf(nsReferenceTime.Add(time.Duration(seconds * float64(time.Second)))))
+		return nil
+	case uuidType:
+		dict, err := objectDict(object, "NSUUID")
+		if err != nil {
+			return err
+		}
+		id, err := uuid.FromBytes(asBytes(dict["NS.uuidbytes"]))
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(id))
+		return nil
+	case urlType:
+		u, err := unmarshalURL(object, objects, depth)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		return unmarshalStruct(object, objects, target, depth)
+	case reflect.Slice:
+		if target.Type().Elem().Kind() == reflect.Uint8 {
+			return unmarshalBytes(object, target)
+		}
+		return unmarshalList(object, objects, target, depth)
+	case reflect.Map:
+		return unmarshalMap(object, objects, target, depth)
+	}
+	return unmarshalPrimitive(object, objects, target)
+}
+
+func unmarshalStruct(object interface{}, objects []interface{}, target reflect.Value, depth int) error {
+	dict, err := objectDict(object, target.Type().Name())
+	if err != nil {
+		return err
+	}
+	if _, ok := isDictionaryObject(dict, objects); ok {
+		if dict, err = dictionaryFields(dict, objects, depth); err != nil {
+			return err
+		}
+	}
+	for _, field := range structFields(target.Type()) {
+		value, ok := dict[field.key]
+		if !ok {
+			continue
+		}
+		if err := unmarshalValue(value, objects, settableFieldByIndex(target, field.index), depth+1); err != nil {
+			return fmt.Errorf("%s.%s: %w", target.Type().Name(), field.name, err)
+		}
+	}
+	return nil
+}
+
+func unmarshalList(object interface{}, objects []interface{}, target reflect.Value, depth int) error {
+	dict, err := objectDict(object, "NSArray")
+	if err != nil {
+		return err
+	}
+	refs, ok := dict[nsObjects].([]interface{})
+	if !ok {
+		return fmt.Errorf("cannot unmarshal object without %s into %s", nsObjects, target.Type())
+	}
+	list := reflect.MakeSlice(target.Type(), len(refs), len(refs))
+	for i, ref := range refs {
+		if err := unmarshalValue(ref, objects, list.Index(i), depth+1); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+	target.Set(list)
+	return nil
+}
+
+func unmarshalMap(object interface{}, objects []interface{}, target reflect.Value, depth int) error {
+	if target.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s", target.Type().Key())
+	}
+	dict, err := objectDict(object, "NSDictionary")
+	if err != nil {
+		return err
+	}
+	fields, err := dictionaryFields(dict, objects, depth)
+	if err != nil {
+		return err
+	}
+	result := reflect.MakeMapWithSize(target.Type(), len(fields))
+	for key, ref := range fields {
+		value := reflect.New(target.Type().Elem()).Elem()
+		if err := unmarshalValue(ref, objects, value, depth+1); err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		result.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), value)
+	}
+	target.Set(result)
+	return nil
+}
+
+// dictionaryFields returns the references of the values of an NSDictionary by key, so
+// structs can be decoded from dictionaries like from other objects
+func dictionaryFields(dict map[string]interface{}, objects []interface{}, depth int) (map[string]interface{}, error) {
+	keyRefs, keysOk := dict[nsKeys].([]interface{})
+	valueRefs, valuesOk := dict[nsObjects].([]interface{})
+	if !keysOk || !valuesOk || len(keyRefs) != len(valueRefs) {
+		return nil, fmt.Errorf("NSDictionary without matching %s and %s", nsKeys, nsObjects)
+	}
+	fields := make(map[string]interface{}, len(keyRefs))
+	for i := range keyRefs {
+		var key string
+		if err := unmarshalValue(keyRefs[i], objects, reflect.ValueOf(&key).Elem(), depth+1); err != nil {
+			return nil, err
+		}
+		fields[key] = valueRefs[i]
+	}
+	return fields, nil
+}
+
+func unmarshalBytes(object interface{}, target reflect.Value) error {
+	data, ok := object.([]byte)
+	if !ok {
+		dict, err := objectDict(object, "NSData")
+		if err != nil {
+			return err
+		}
+		if data, ok = dict[nsDataKey].([]byte); !ok {
+			return fmt.Errorf("cannot unmarshal object without %s into %s", nsDataKey, target.Type())
+		}
+	}
+	target.SetBytes(append([]byte(nil), data...))
+	return nil
+}
+
+func unmarshalURL(object interface{}, objects []interface{}, depth int) (*url.URL, error) {
+	dict, err := objectDict(object, "NSURL")
+	if err != nil {
+		return nil, err
+	}
+	var relative string
+	if err := unmarshalValue(dict["NS.relative"], objects, reflect.ValueOf(&relative).Elem(), depth+1); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(relative)
+	if err != nil {
+		return nil, err
+	}
+	if base, ok := dict["NS.base"].(plist.UID); ok && base != 0 {
+		baseURL, err := unmarshalURL(objects[base], objects, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("NS.base: %w", err)
+		}
+		u = baseURL.ResolveReference(u)
+	}
+	return u, nil
+}
+
+func unmarshalPrimitive(object interface{}, objects []interface{}, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.Bool:
+		if b, ok := object.(bool); ok {
+			target.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := asInt64(object); ok && !target.OverflowInt(i) {
+			target.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u, ok := asUint64(object); ok && !target.OverflowUint(u) {
+			target.SetUint(u)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := asFloat64(object); ok {
+			target.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := object.(string); ok {
+			target.SetString(s)
+			return nil
+		}
+		if dict, ok := object.(map[string]interface{}); ok {
+			if s, ok := dict[nsStringKey].(string); ok {
+				target.SetString(s)
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", target.Type())
+	}
+	return fmt.Errorf("cannot unmarshal %T %v into %s", object, object, target.Type())
+}
+
+// objectDict returns the dictionary of an archived object, want names the expected kind
+// of object for the error
+func objectDict(object interface{}, want string) (map[string]interface{}, error) {
+	dict, ok := object.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot unmarshal %T into %s", object, want)
+	}
+	return dict, nil
+}
+
+func isNSNull(object interface{}, objects []interface{}) bool {
+	dict := object.(map[string]interface{})
+	classes, err := resolveClasses(dict[class], objects)
+	return err == nil && classes[0] == nsNullKey
+}
+
+func asBytes(v interface{}) []byte {
+	b, _ := v.([]byte)
+	return b
+}
+
+func asInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func asUint64(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case int64:
+		return uint64(n), n >= 0
+	case int:
+		return uint64(n), n >= 0
+	case int32:
+		return uint64(n), n >= 0
+	}
+	return 0, false
+}
+
+func asFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
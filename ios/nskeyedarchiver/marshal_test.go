@@ -0,0 +1,284 @@
+package nskeyedarchiver_test
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	archiver "github.com/danielpaulus/go-ios/ios/nskeyedarchiver"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// XCTIssue has the name of the class it is archived as
+type XCTIssue struct {
+	Severity    uint64            `nska:"runtimeIssueSeverity"`
+	Detailed    string            `nska:"detailed-description"`
+	Compact     string            `nska:"compact-description"`
+	Context     sourceCodeContext `nska:"source-code-context,class=XCTSourceCodeContext"`
+	Unsupported func()            `nska:"-"`
+}
+
+type sourceCodeContext struct {
+	Location sourceCodeLocation `nska:"location,class=XCTSourceCodeLocation"`
+}
+
+type sourceCodeLocation struct {
+	File url.URL `nska:"file-url"`
+	Line uint64  `nska:"line-number"`
+}
+
+func TestMarshalIsUnarchivable(t *testing.T) {
+	file, err := url.Parse("file:///tmp/Tests.swift")
+	require.NoError(t, err)
+	archived, err := archiver.Marshal(XCTIssue{
+		Severity: 2,
+		Detailed: "detailed",
+		Compact:  "compact",
+		Context:  sourceCodeContext{Location: sourceCodeLocation{File: *file, Line: 42}},
+	})
+	require.NoError(t, err)
+
+	unarchived, err := archiver.Unarchive(archived)
+	require.NoError(t, err)
+	assert.Equal(t, archiver.XCTIssue{
+		RuntimeIssueSeverity: 2,
+		DetailedDescription:  "detailed",
+		CompactDescription:   "compact",
+		SourceCodeContext: archiver.XCTSourceCodeContext{
+			Location: archiver.XCTSourceCodeLocation{FileUrl: archiver.NewNSURL("file:///tmp/Tests.swift"), LineNumber: 42},
+		},
+	}, unarchived[0])
+}
+
+type payload struct {
+	Name       string                 `nska:"name"`
+	Count      int32                  `nska:"count"`
+	Ratio      float64                `nska:"ratio"`
+	Enabled    bool                   `nska:"enabled"`
+	Started    time.Time              `nska:"started"`
+	Session    uuid.UUID              `nska:"session"`
+	Bundle     url.URL                `nska:"bundle"`
+	Data       []byte                 `nska:"data"`
+	Tags       []string               `nska:"tags"`
+	Limits     map[string]uint64      `nska:"limits"`
+	Children   []child                `nska:"children,class=Child"`
+	Parent     *child                 `nska:"parent,class=Child"`
+	Missing    *child                 `nska:"missing,class=Child"`
+	Optional   *child                 `nska:"optional,omitempty"`
+	Any        interface{}            `nska:"any"`
+	Attributes map[string]interface{} `nska:"attributes"`
+	Default    string
+	ignored    string
+}
+
+type child struct {
+	ID uint64 `nska:"id"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	bundle, err := url.Parse("https://example.com/app?id=1")
+	require.NoError(t, err)
+	original := payload{
+		Name:       "sample",
+		Count:      -3,
+		Ratio:      0.25,
+		Enabled:    true,
+		Started:    time.Date(2024, time.March, 1, 12, 30, 15, 0, time.UTC),
+		Session:    uuid.MustParse("6b2f3a08-9a8e-4c1f-8f53-7a0a3b2e1c44"),
+		Bundle:     *bundle,
+		Data:       []byte{1, 2, 3},
+		Tags:       []string{"a", "b"},
+		Limits:     map[string]uint64{"cpu": 80},
+		Children:   []child{{ID: 1}, {ID: 2}},
+		Parent:     &child{ID: 3},
+		Any:        "value",
+		Attributes: map[string]interface{}{"count": uint64(1), "names": []interface{}{"x"}},
+		Default:    "field name is the key",
+		ignored:    "not archived",
+	}
+	archived, err := archiver.Marshal(original)
+	require.NoError(t, err)
+
+	var decoded payload
+	require.NoError(t, archiver.Unmarshal(archived, &decoded))
+	original.ignored = ""
+	assert.True(t, original.Started.Equal(decoded.Started))
+	decoded.Started = original.Started
+	assert.Equal(t, original, decoded)
+
+	unarchived, err := archiver.Unarchive(archived)
+	require.NoError(t, err)
+	object := unarchived[0].(archiver.ArchivedObject)
+	assert.Equal(t, "payload", object.Class)
+	assert.NotContains(t, object.Fields, "optional")
+	assert.Contains(t, object.Fields, "missing")
+	assert.Equal(t, "Child", object.Fields["parent"].(archiver.ArchivedObject).Class)
+}
+
+type node struct {
+	Name     string  `nska:"name"`
+	Next     *node   `nska:"next"`
+	Children []*node `nska:"children"`
+}
+
+func TestMarshalCycles(t *testing.T) {
+	loop := &node{Name: "a"}
+	loop.Next = &node{Name: "b", Next: loop}
+	_, err := archiver.Marshal(loop)
+	assert.ErrorContains(t, err, "cycle")
+
+	list := []interface{}{nil}
+	list[0] = list
+	_, err = archiver.Marshal(list)
+	assert.ErrorContains(t, err, "cycle")
+
+	dict := map[string]interface{}{}
+	dict["self"] = dict
+	_, err = archiver.Marshal(dict)
+	assert.ErrorContains(t, err, "cycle")
+
+	// values that are referenced more than once are no cycle
+	shared := &node{Name: "shared"}
+	_, err = archiver.Marshal(&node{Name: "root", Next: shared, Children: []*node{shared, shared}})
+	assert.NoError(t, err)
+}
+
+type Base struct {
+	ID      uint64 `nska:"id"`
+	Name    string `nska:"name"`
+	Created time.Time
+}
+
+type audit struct {
+	Author string `nska:"author"`
+}
+
+type Extra struct {
+	Note string `nska:"note"`
+}
+
+type conflictA struct {
+	Shared string `nska:"shared"`
+}
+
+type conflictB struct {
+	Shared string `nska:"shared"`
+}
+
+type document struct {
+	Base
+	audit
+	*Extra
+	conflictA
+	conflictB
+	// Name hides Base.Name
+	Name  string `nska:"name"`
+	Owner Base   `nska:"owner"`
+}
+
+func TestMarshalEmbeddedStructs(t *testing.T) {
+	original := document{
+		Base:      Base{ID: 7, Name: "hidden"},
+		audit:     audit{Author: "me"},
+		Extra:     &Extra{Note: "note"},
+		conflictA: conflictA{Shared: "a"},
+		conflictB: conflictB{Shared: "b"},
+		Name:      "outer",
+		Owner:     Base{ID: 1, Name: "owner"},
+	}
+	archived, err := archiver.Marshal(original)
+	require.NoError(t, err)
+
+	unarchived, err := archiver.Unarchive(archived)
+	require.NoError(t, err)
+	fields := unarchived[0].(archiver.ArchivedObject).Fields
+	assert.Equal(t, uint64(7), fields["id"])
+	assert.Equal(t, "outer", fields["name"])
+	assert.Equal(t, "me", fields["author"])
+	assert.Equal(t, "note", fields["note"])
+	assert.NotContains(t, fields, "Base")
+	assert.NotContains(t, fields, "shared", "ambiguous keys are left out")
+	assert.Equal(t, "Base", fields["owner"].(archiver.ArchivedObject).Class)
+
+	var decoded document
+	require.NoError(t, archiver.Unmarshal(archived, &decoded))
+	assert.Equal(t, document{
+		Base:  Base{ID: 7},
+		audit: audit{Author: "me"},
+		Extra: &Extra{Note: "note"},
+		Name:  "outer",
+		Owner: Base{ID: 1, Name: "owner"},
+	}, decoded)
+
+	// a nil embedded pointer has no fields
+	archived, err = archiver.Marshal(document{Name: "no extra"})
+	require.NoError(t, err)
+	unarchived, err = archiver.Unarchive(archived)
+	require.NoError(t, err)
+	assert.NotContains(t, unarchived[0].(archiver.ArchivedObject).Fields, "note")
+}
+
+func TestMarshalZeroTime(t *testing.T) {
+	type times struct {
+		Started  time.Time `nska:"started"`
+		Finished time.Time `nska:"finished,omitempty"`
+	}
+	archived, err := archiver.Marshal(times{})
+	require.NoError(t, err)
+
+	unarchived, err := archiver.Unarchive(archived)
+	require.NoError(t, err)
+	fields := unarchived[0].(archiver.ArchivedObject).Fields
+	assert.Contains(t, fields, "started")
+	assert.Nil(t, fields["started"])
+	assert.NotContains(t, fields, "finished")
+
+	decoded := times{Started: time.Now()}
+	require.NoError(t, archiver.Unmarshal(archived, &decoded))
+	assert.True(t, decoded.Started.IsZero())
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	archived, err := archiver.Marshal(map[string]interface{}{"count": "not a number"})
+	require.NoError(t, err)
+
+	var wrongType struct {
+		Count int `nska:"count"`
+	}
+	assert.Error(t, archiver.Unmarshal(archived, &wrongType))
+	assert.Error(t, archiver.Unmarshal(archived, wrongType))
+
+	var overflow struct {
+		Count int8 `nska:"count"`
+	}
+	archived, err = archiver.Marshal(map[string]interface{}{"count": uint64(300)})
+	require.NoError(t, err)
+	assert.Error(t, archiver.Unmarshal(archived, &overflow))
+}
+
+// activityRecord decodes the same fields as the hand written XCActivityRecord decoder
+type activityRecord struct {
+	Title        string    `nska:"title"`
+	ActivityType string    `nska:"activityType"`
+	UUID         uuid.UUID `nska:"uuid"`
+	Start        time.Time `nska:"start"`
+	Finish       time.Time `nska:"finish"`
+}
+
+func TestUnmarshalFixture(t *testing.T) {
+	nskeyedBytes, err := os.ReadFile("fixtures/XCActivityRecord.bin")
+	require.NoError(t, err)
+	unarchived, err := archiver.Unarchive(nskeyedBytes)
+	require.NoError(t, err)
+	expected := unarchived[0].(archiver.XCActivityRecord)
+
+	var record activityRecord
+	require.NoError(t, archiver.Unmarshal(nskeyedBytes, &record))
+	assert.Equal(t, expected.Title, record.Title)
+	assert.Equal(t, expected.ActivityType, record.ActivityType)
+	assert.Equal(t, expected.UUID.String(), record.UUID.String())
+	assert.WithinDuration(t, expected.Start.Timestamp, record.Start, time.Millisecond)
+}
@@ -3,6 +3,7 @@ package nskeyedarchiver
 import (
 	"fmt"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/semver"
@@ -17,15 +18,19 @@ const (
 )
 
 var (
-	decodableClasses map[string]func(map[string]interface{}, []interface{}) interface{}
-	encodableClasses map[string]func(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error)
+	// registryMutex guards decodableClasses and encodableClasses, see RegisterDecoder and RegisterEncoder
+	registryMutex    sync.RWMutex
+	decodableClasses map[string]DecoderFunc
+	encodableClasses map[string]EncoderFunc
 )
 
 var testIdentifierRegex = regexp.MustCompile(`((?P<module>[^\.]+)\.)?(?P<class>[^\/]+)(\/(?P<method>[^\.]+))?`)
 
 func SetupDecoders() {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
 	if decodableClasses == nil {
-		decodableClasses = map[string]func(map[string]interface{}, []interface{}) interface{}{
+		decodableClasses = map[string]DecoderFunc{
 			"DTActivityTraceTapMessage": NewDTActivityTraceTapMessage,
 			"DTSysmonTapMessage":        NewDTActivityTraceTapMessage,
 			"NSError":                   NewNSError,
@@ -54,8 +59,10 @@ func SetupDecoders() {
 }
 
 func SetupEncoders() {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
 	if encodableClasses == nil {
-		encodableClasses = map[string]func(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error){
+		encodableClasses = map[string]EncoderFunc{
 			"XCTestConfiguration":  archiveXcTestConfiguration,
 			"NSUUID":               archiveNSUUID,
 			"NSURL":                archiveNSURL,
@@ -69,6 +76,7 @@ func SetupEncoders() {
 			"XCTTestIdentifier":    archiveXCTTestIdentifier,
 			"XCTTestIdentifierSet": archiveXCTTestIdentifierSet,
 			"NSValuePoint":         archiveNSValuePoint,
+			"ArchivedObject":       archiveArchivedObject,
 		}
 	}
 }
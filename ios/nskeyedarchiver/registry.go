@@ -0,0 +1,251 @@
+package nskeyedarchiver
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"howett.net/plist"
+)
+
+// DecoderFunc converts an archived object to a Go value. object is the dictionary of the
+// object in objects, it references other objects with plist.UIDs that ResolveObject decodes.
+type DecoderFunc func(object map[string]interface{}, objects []interface{}) interface{}
+
+// EncoderFunc appends the dictionary of object, its class dictionary and the objects it
+// references to objects and returns the UID of the dictionary. AppendObject archives the
+// referenced objects, an ArchivedObject with the fields of object is often all an encoder
+// needs to build.
+type EncoderFunc func(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error)
+
+// RegisterDecoder decodes archived objects of the Objective-C or Swift class className with
+// decoder. It replaces the decoder of classes this package knows by default.
+func RegisterDecoder(className string, decoder DecoderFunc) {
+	SetupDecoders()
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	decodableClasses[className] = decoder
+}
+
+// RegisterEncoder archives Go values of the type of example with encoder. Types are matched
+// by name, like they are for the types of this package.
+func RegisterEncoder(example interface{}, encoder EncoderFunc) {
+	SetupEncoders()
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	encodableClasses[typeName(reflect.TypeOf(example))] = encoder
+}
+
+func typeName(t reflect.Type) string {
+	name := t.Name()
+	// seems like Name() can be empty for pointer types
+	if name == "" {
+		name = t.String()
+	}
+	return name
+}
+
+func decoderFor(className string) (DecoderFunc, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	decoder, ok := decodableClasses[className]
+	return decoder, ok
+}
+
+func encoderFor(name string) (EncoderFunc, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	encoder, ok := encodableClasses[name]
+	return encoder, ok
+}
+
+// AppendObject archives object into objects for use in an EncoderFunc
+func AppendObject(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error) {
+	return archive(object, objects)
+}
+
+// ResolveObject decodes a value of an archived object for use in a DecoderFunc. References
+// to other objects are decoded, nil is returned for references to $null and all other
+// values are returned as they are.
+func ResolveObject(value interface{}, objects []interface{}) (interface{}, error) {
+	return resolveField(value, objects, 0)
+}
+
+func resolveField(value interface{}, objects []interface{}, depth int) (interface{}, error) {
+	uid, ok := value.(plist.UID)
+	if !ok {
+		return value, nil
+	}
+	if uid == 0 {
+		return nil, nil
+	}
+	decoded, err := extractObjects([]plist.UID{uid}, objects, depth)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[0], nil
+}
+
+// ArchivedObject is an object of a class without registered decoder. Archiving it creates
+// the same object again, so objects of unknown classes can be sent back to the device.
+type ArchivedObject struct {
+	// Class is the name of the class of the object
+	Class string `json:"class"`
+	// Classes is the class hierarchy, starting with Class
+	Classes []string `json:"classes"`
+	// Fields contains the values of the object by key with references to other objects
+	// decoded. References to $null are nil.
+	Fields map[string]interface{} `json:"fields"`
+
+	// layout tells how decoded fields were stored, fields not in it are stored inline
+	// if they are numbers, booleans or data and as reference otherwise
+	layout map[string]fieldLayout
+}
+
+type fieldLayout int
+
+const (
+	fieldInline fieldLayout = iota
+	fieldReference
+	// fieldReferences is an inline array of references, like NS.objects of collections
+	fieldReferences
+)
+
+func decodeArchivedObject(object map[string]interface{}, objects []interface{}, depth int) (ArchivedObject, error) {
+	classes, err := resolveClasses(object[class], objects)
+	if err != nil {
+		return ArchivedObject{}, err
+	}
+	result := ArchivedObject{
+		Class:   classes[0],
+		Classes: classes,
+		Fields:  make(map[string]interface{}, len(object)),
+		layout:  make(map[string]fieldLayout, len(object)),
+	}
+	for key, value := range object {
+		if key == class {
+			continue
+		}
+		layout := fieldInline
+		switch v := value.(type) {
+		case plist.UID:
+			layout = fieldReference
+			value, err = resolveField(v, objects, depth)
+		case []interface{}:
+			if isUIDList(v) {
+				layout = fieldReferences
+				values := make([]interface{}, len(v))
+				for i, item := range v {
+					if values[i], err = resolveField(item, objects, depth); err != nil {
+						break
+					}
+				}
+				value = values
+			}
+		}
+		if err != nil {
+			return ArchivedObject{}, fmt.Errorf("%s.%s: %w", result.Class, key, err)
+		}
+		result.Fields[key] = value
+		result.layout[key] = layout
+	}
+	return result, nil
+}
+
+func isUIDList(list []interface{}) bool {
+	for _, item := range list {
+		if _, ok := item.(plist.UID); !ok {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+func resolveClasses(classInfo interface{}, objects []interface{}) ([]string, error) {
+	uid, ok := classInfo.(plist.UID)
+	if !ok || int(uid) >= len(objects) {
+		return nil, fmt.Errorf("Could not find class for %s", classInfo)
+	}
+	classDict, ok := objects[uid].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("class %d is not a dictionary, got %T", uid, objects[uid])
+	}
+	name, ok := classDict[className].(string)
+	if !ok {
+		return nil, fmt.Errorf("class %d has no name", uid)
+	}
+	classes := []string{name}
+	if hierarchy, ok := classDict["$classes"].([]interface{}); ok && len(hierarchy) > 0 {
+		classes = make([]string, 0, len(hierarchy))
+		for _, c := range hierarchy {
+			if s, ok := c.(string); ok {
+				classes = append(classes, s)
+			}
+		}
+	}
+	return classes, nil
+}
+
+func (o ArchivedObject) fieldLayout(key string, value interface{}) fieldLayout {
+	if layout, ok := o.layout[key]; ok {
+		return layout
+	}
+	switch value.(type) {
+	case bool, int, int32, int64, uint64, float64, []byte:
+		return fieldInline
+	}
+	return fieldReference
+}
+
+func archiveArchivedObject(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error) {
+	o := object.(ArchivedObject)
+	classes := o.Classes
+	if len(classes) == 0 {
+		classes = []string{o.Class, "NSObject"}
+	}
+	dict := map[string]interface{}{}
+	ref := len(objects)
+	objects = append(objects, dict)
+	objects = append(objects, buildClassDict(toInterfaceSlice(classes)...))
+	dict[class] = plist.UID(ref + 1)
+
+	keys := make([]string, 0, len(o.Fields))
+	for key := range o.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := o.Fields[key]
+		var err error
+		switch o.fieldLayout(key, value) {
+		case fieldInline:
+			dict[key] = value
+		case fieldReference:
+			objects, dict[key], err = appendField(value, objects)
+		case fieldReferences:
+			values, ok := value.([]interface{})
+			if !ok {
+				return nil, 0, fmt.Errorf("%s.%s: expected a list of objects, got %T", o.Class, key, value)
+			}
+			refs := make([]plist.UID, len(values))
+			for i, item := range values {
+				if objects, refs[i], err = appendField(item, objects); err != nil {
+					break
+				}
+			}
+			dict[key] = refs
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s.%s: %w", o.Class, key, err)
+		}
+	}
+	return objects, plist.UID(ref), nil
+}
+
+// appendField archives value and references $null for nil
+func appendField(value interface{}, objects []interface{}) ([]interface{}, plist.UID, error) {
+	if value == nil {
+		return objects, 0, nil
+	}
+	return archive(value, objects)
+}
@@ -0,0 +1,94 @@
+package nskeyedarchiver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"howett.net/plist"
+)
+
+// orderedSetArchive is an NSOrderedSet, which has no decoder, with a referenced NSNumber,
+// an inline boolean and a list of references
+func orderedSetArchive(t *testing.T) []byte {
+	archive := createSkeleton(true)
+	archive[objectsKey] = []interface{}{
+		null,
+		map[string]interface{}{class: plist.UID(2), "count": plist.UID(3), "flag": true, nsObjects: []interface{}{plist.UID(4), plist.UID(0)}},
+		buildClassDict("NSOrderedSet", "NSObject"),
+		uint64(7),
+		"a",
+	}
+	b, err := toBinaryPlist(archive)
+	require.NoError(t, err)
+	return b
+}
+
+func TestUnknownClassRoundTrip(t *testing.T) {
+	decoded, err := Unarchive(orderedSetArchive(t))
+	require.NoError(t, err)
+	object, ok := decoded[0].(ArchivedObject)
+	require.True(t, ok, "got %T", decoded[0])
+	assert.Equal(t, "NSOrderedSet", object.Class)
+	assert.Equal(t, []string{"NSOrderedSet", "NSObject"}, object.Classes)
+	assert.Equal(t, map[string]interface{}{"count": uint64(7), "flag": true, nsObjects: []interface{}{"a", nil}}, object.Fields)
+
+	archived, err := ArchiveBin(object)
+	require.NoError(t, err)
+	raw, err := plistFromBytes(archived)
+	require.NoError(t, err)
+	objects := raw.(map[string]interface{})[objectsKey].([]interface{})
+	root := objects[1].(map[string]interface{})
+	assert.Equal(t, uint64(7), objects[root["count"].(plist.UID)], "count stays a reference")
+	assert.Equal(t, true, root["flag"], "flag stays inline")
+	refs := root[nsObjects].([]interface{})
+	require.Len(t, refs, 2)
+	assert.Equal(t, "a", objects[refs[0].(plist.UID)])
+	assert.Equal(t, plist.UID(0), refs[1])
+
+	again, err := Unarchive(archived)
+	require.NoError(t, err)
+	assert.Equal(t, object.Fields, again[0].(ArchivedObject).Fields)
+}
+
+func TestArchiveConstructedObject(t *testing.T) {
+	archived, err := ArchiveBin(ArchivedObject{Class: "GoIOSTestObject", Fields: map[string]interface{}{"name": "x", "size": uint64(3), "none": nil}})
+	require.NoError(t, err)
+	raw, err := plistFromBytes(archived)
+	require.NoError(t, err)
+	objects := raw.(map[string]interface{})[objectsKey].([]interface{})
+	root := objects[1].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$classname": "GoIOSTestObject", "$classes": []interface{}{"GoIOSTestObject", "NSObject"}}, objects[root[class].(plist.UID)])
+	assert.Equal(t, "x", objects[root["name"].(plist.UID)])
+	assert.Equal(t, uint64(3), root["size"])
+	assert.Equal(t, plist.UID(0), root["none"])
+}
+
+type testRect struct {
+	X, Y, Width, Height float64
+}
+
+func TestRegisteredClass(t *testing.T) {
+	RegisterEncoder(testRect{}, func(object interface{}, objects []interface{}) ([]interface{}, plist.UID, error) {
+		r := object.(testRect)
+		return AppendObject(ArchivedObject{
+			Class:  "GoIOSTestRect",
+			Fields: map[string]interface{}{"origin": []interface{}{r.X, r.Y}, "width": r.Width, "height": r.Height},
+		}, objects)
+	})
+	RegisterDecoder("GoIOSTestRect", func(object map[string]interface{}, objects []interface{}) interface{} {
+		origin, err := ResolveObject(object["origin"], objects)
+		if err != nil {
+			panic(err)
+		}
+		xy := origin.([]interface{})
+		return testRect{X: xy[0].(float64), Y: xy[1].(float64), Width: object["width"].(float64), Height: object["height"].(float64)}
+	})
+
+	rect := testRect{X: 1, Y: 2, Width: 3, Height: 4}
+	archived, err := ArchiveBin(map[string]interface{}{"frame": rect})
+	require.NoError(t, err)
+	decoded, err := Unarchive(archived)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"frame": rect}, decoded[0])
+}
@@ -12,6 +12,7 @@ import (
 // Primitives will be extracted just like regular Plist primitives (string, float64, int64, []uint8 etc.).
 // NSArray, NSMutableArray, NSSet and NSMutableSet will transformed into []interface{}
 // NSDictionary and NSMutableDictionary will be transformed into map[string] interface{}. I might add non string keys later.
+// Objects of other classes are decoded by the DecoderFunc registered for their class, or to an ArchivedObject.
 func Unarchive(xml []byte) (result []interface{}, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -131,7 +132,7 @@ func extractObjects(objectRefs []plist.UID, objects []interface{}, depth int) ([
 			continue
 		}
 
-		obj, err := decodeNonstandardObject(nonPrimitiveObjectRef, objects)
+		obj, err := decodeNonstandardObject(nonPrimitiveObjectRef, objects, depth+1)
 		if err != nil {
 			return nil, err
 		}
@@ -141,16 +142,17 @@ func extractObjects(objectRefs []plist.UID, objects []interface{}, depth int) ([
 	return returnValue, nil
 }
 
-func decodeNonstandardObject(object map[string]interface{}, objects []interface{}) (interface{}, error) {
+// decodeNonstandardObject decodes objects with the decoder registered for their class and
+// objects of other classes to an ArchivedObject
+func decodeNonstandardObject(object map[string]interface{}, objects []interface{}, depth int) (interface{}, error) {
 	className, err := resolveClass(object[class], objects)
 	if err != nil {
 		return nil, err
 	}
-	factory := decodableClasses[className]
-	if factory == nil {
-		return nil, fmt.Errorf("Unknown class:%s", className)
+	if decoder, ok := decoderFor(className); ok {
+		return decoder(object, objects), nil
 	}
-	return factory(object, objects), nil
+	return decodeArchivedObject(object, objects, depth)
 }
 
 func isArrayObject(object map[string]interface{}, objects []interface{}) (map[string]interface{}, bool) {
@@ -0,0 +1,212 @@
+package ostrace
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+const (
+	// responseMarker precedes the plist response of PidList and CreateArchive
+	responseMarker = 0x01
+	// archiveChunkMarker precedes every chunk of the archive tar stream
+	archiveChunkMarker = 0x03
+)
+
+// Process is a process that is known to the unified logging system
+type Process struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// ArchiveOptions configures [CreateArchive]. Zero values do not limit the archive.
+type ArchiveOptions struct {
+	// StartTime drops log data older than this time
+	StartTime time.Time
+	// SizeLimit is the maximum size of the log data in bytes
+	SizeLimit uint64
+}
+
+// ListPids returns all processes the device has log data for, sorted by PID
+func ListPids(device ios.DeviceEntry) ([]Process, error) {
+	deviceConn, err := connect(device)
+	if err != nil {
+		return nil, err
+	}
+	defer deviceConn.Close()
+	return listPids(deviceConn.Reader(), deviceConn.Writer())
+}
+
+func listPids(r io.Reader, w io.Writer) ([]Process, error) {
+	codec := ios.NewPlistCodecReadWriter(r, w)
+	if err := codec.Write(map[string]interface{}{"Request": "PidList"}); err != nil {
+		return nil, fmt.Errorf("ostrace: failed to send PidList request: %w", err)
+	}
+	response, err := readResponse(r)
+	if err != nil {
+		return nil, err
+	}
+	payload, _ := response["Payload"].(map[string]interface{})
+	processes := make([]Process, 0, len(payload))
+	for pidStr, info := range payload {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+		process := Process{PID: pid}
+		if infoMap, ok := info.(map[string]interface{}); ok {
+			process.Name, _ = infoMap["ProcessName"].(string)
+		}
+		processes = append(processes, process)
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].PID < processes[j].PID })
+	return processes, nil
+}
+
+// CreateArchive asks the device to create a log archive and streams it to w.
+// The archive is a tar of the contents of a .logarchive directory, use
+// [ExtractArchive] to unpack it for the `log` command on macOS.
+func CreateArchive(device ios.DeviceEntry, w io.Writer, options ArchiveOptions) error {
+	deviceConn, err := connect(device)
+	if err != nil {
+		return err
+	}
+	defer deviceConn.Close()
+	return createArchive(deviceConn.Reader(), deviceConn.Writer(), w, options)
+}
+
+func createArchive(r io.Reader, conn io.Writer, w io.Writer, options ArchiveOptions) error {
+	request := map[string]interface{}{"Request": "CreateArchive"}
+	if !options.StartTime.IsZero() {
+		request["StartTime"] = options.StartTime.Unix()
+	}
+	if options.SizeLimit > 0 {
+		request["SizeLimit"] = options.SizeLimit
+	}
+	codec := ios.NewPlistCodecReadWriter(r, conn)
+	if err := codec.Write(request); err != nil {
+		return fmt.Errorf("ostrace: failed to send CreateArchive request: %w", err)
+	}
+	if _, err := readResponse(r); err != nil {
+		return err
+	}
+
+	// the archive follows as chunks of 1 byte marker + 4 bytes LE length + data
+	// until the device closes the connection
+	var written int64
+	for {
+		var marker [1]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				golog.Debug("ostrace: archive complete", "module", logModule, "bytes", written)
+				return nil
+			}
+			return fmt.Errorf("ostrace: failed to read archive chunk: %w", err)
+		}
+		if marker[0] != archiveChunkMarker {
+			return fmt.Errorf("ostrace: unexpected archive chunk marker: 0x%02x", marker[0])
+		}
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return fmt.Errorf("ostrace: failed to read archive chunk length: %w", err)
+		}
+		n, err := io.CopyN(w, r, int64(length))
+		written += n
+		if err != nil {
+			return fmt.Errorf("ostrace: failed to copy archive chunk: %w", err)
+		}
+	}
+}
+
+// readResponse reads the marker byte and the length prefixed plist the device answers requests with
+func readResponse(r io.Reader) (map[string]interface{}, error) {
+	var marker [1]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return nil, fmt.Errorf("ostrace: failed to read response: %w", err)
+	}
+	if marker[0] != responseMarker {
+		return nil, fmt.Errorf("ostrace: unexpected response marker: 0x%02x", marker[0])
+	}
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("ostrace: failed to read response length: %w", err)
+	}
+	plistData := make([]byte, length)
+	if _, err := io.ReadFull(r, plistData); err != nil {
+		return nil, fmt.Errorf("ostrace: failed to read response plist: %w", err)
+	}
+	response, err := ios.ParsePlist(plistData)
+	if err != nil {
+		return nil, fmt.Errorf("ostrace: failed to parse response plist: %w", err)
+	}
+	if status, _ := response["Status"].(string); status != "RequestSuccessful" {
+		return nil, fmt.Errorf("ostrace: request failed, response: %v", response)
+	}
+	return response, nil
+}
+
+// ExtractArchive unpacks an archive created by [CreateArchive] into dir, which
+// becomes a .logarchive directory. Entries that would end up outside of dir are rejected.
+func ExtractArchive(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ostrace: invalid archive: %w", err)
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			if filepath.Clean(name) == "." {
+				continue
+			}
+			return fmt.Errorf("ostrace: archive entry %q escapes the target directory", header.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, header); err != nil {
+				return err
+			}
+		default:
+			golog.Debug("ostrace: skipping archive entry", "module", logModule, "name", header.Name, "type", header.Typeflag)
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, header *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,92 @@
+package ostrace
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func response(t *testing.T, payload map[string]interface{}) []byte {
+	data := ios.ToPlistBytes(payload)
+	var b bytes.Buffer
+	b.WriteByte(responseMarker)
+	require.NoError(t, binary.Write(&b, binary.BigEndian, uint32(len(data))))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func logArchiveTar(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content)), ModTime: time.Unix(1700000000, 0)}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return b.Bytes()
+}
+
+func TestListPids(t *testing.T) {
+	deviceResponse := response(t, map[string]interface{}{
+		"Status": "RequestSuccessful",
+		"Payload": map[string]interface{}{
+			"88": map[string]interface{}{"ProcessName": "SpringBoard"},
+			"1":  map[string]interface{}{"ProcessName": "launchd"},
+		},
+	})
+	var request bytes.Buffer
+	processes, err := listPids(bytes.NewReader(deviceResponse), &request)
+	require.NoError(t, err)
+	assert.Equal(t, []Process{{PID: 1, Name: "launchd"}, {PID: 88, Name: "SpringBoard"}}, processes)
+	assert.Contains(t, request.String(), "PidList")
+}
+
+func TestCreateArchive(t *testing.T) {
+	archive := logArchiveTar(t, map[string]string{
+		"./Info.plist":                       "info",
+		"./Persist/0000000000000001.tracev3": "trace data",
+	})
+	var device bytes.Buffer
+	device.Write(response(t, map[string]interface{}{"Status": "RequestSuccessful"}))
+	// split the archive into two chunks
+	for _, chunk := range [][]byte{archive[:700], archive[700:]} {
+		device.WriteByte(archiveChunkMarker)
+		require.NoError(t, binary.Write(&device, binary.LittleEndian, uint32(len(chunk))))
+		device.Write(chunk)
+	}
+
+	var request, out bytes.Buffer
+	err := createArchive(&device, &request, &out, ArchiveOptions{StartTime: time.Unix(1700000000, 0), SizeLimit: 1 << 20})
+	require.NoError(t, err)
+	assert.Equal(t, archive, out.Bytes())
+	assert.Contains(t, request.String(), "CreateArchive")
+	assert.Contains(t, request.String(), "StartTime")
+
+	dir := filepath.Join(t.TempDir(), "device.logarchive")
+	require.NoError(t, ExtractArchive(&out, dir))
+	data, err := os.ReadFile(filepath.Join(dir, "Persist", "0000000000000001.tracev3"))
+	require.NoError(t, err)
+	assert.Equal(t, "trace data", string(data))
+}
+
+func TestCreateArchiveFailedRequest(t *testing.T) {
+	device := bytes.NewReader(response(t, map[string]interface{}{"Status": "RequestFailed"}))
+	err := createArchive(device, &bytes.Buffer{}, &bytes.Buffer{}, ArchiveOptions{})
+	assert.Error(t, err)
+}
+
+func TestExtractArchiveRejectsEscapingEntries(t *testing.T) {
+	archive := logArchiveTar(t, map[string]string{"../outside": "x"})
+	err := ExtractArchive(bytes.NewReader(archive), t.TempDir())
+	assert.Error(t, err)
+}
@@ -87,6 +87,9 @@ func (l LogLevel) String() string {
 	case LogLevelFault:
 		return "Fault"
 	default:
+		if l.isSignpost() {
+			return "Signpost"
+		}
 		return fmt.Sprintf("Unknown(%d)", l)
 	}
 }
@@ -217,6 +220,7 @@ type LogEntry struct {
 	Filename    string    `json:"filename"`
 	Message     string    `json:"message"`
 	Label       *LogLabel `json:"label,omitempty"`
+	Signpost    *Signpost `json:"signpost,omitempty"`
 }
 
 // Connection wraps a device connection to the os_trace_relay service.
@@ -232,16 +236,9 @@ type Connection struct {
 // MessageFilter* and StreamFlags* constants, or build a spec with
 // ParseLevelFilter.
 func New(device ios.DeviceEntry, pid int, messageFilter uint16, streamFlags uint32) (*Connection, error) {
-	var deviceConn ios.DeviceConnectionInterface
-	var err error
-
-	if device.SupportsRsd() {
-		deviceConn, err = ios.ConnectToShimService(device, shimServiceName)
-	} else {
-		deviceConn, err = ios.ConnectToService(device, usbmuxdServiceName)
-	}
+	deviceConn, err := connect(device)
 	if err != nil {
-		return nil, fmt.Errorf("ostrace: failed to connect to service: %w", err)
+		return nil, err
 	}
 
 	conn := &Connection{
@@ -258,6 +255,22 @@ func New(device ios.DeviceEntry, pid int, messageFilter uint16, streamFlags uint
 	return conn, nil
 }
 
+// connect opens os_trace_relay over the shim service on iOS 17+ and over usbmuxd on older devices
+func connect(device ios.DeviceEntry) (ios.DeviceConnectionInterface, error) {
+	var deviceConn ios.DeviceConnectionInterface
+	var err error
+
+	if device.SupportsRsd() {
+		deviceConn, err = ios.ConnectToShimService(device, shimServiceName)
+	} else {
+		deviceConn, err = ios.ConnectToService(device, usbmuxdServiceName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ostrace: failed to connect to service: %w", err)
+	}
+	return deviceConn, nil
+}
+
 // startActivity sends the StartActivity plist request and reads the handshake response.
 func (c *Connection) startActivity(pid int, messageFilter uint16, streamFlags uint32) error {
 	codec := ios.NewPlistCodecReadWriter(c.reader, c.writer)
@@ -403,6 +416,7 @@ func parseEntry(data []byte) (LogEntry, error) {
 		return LogEntry{}, fmt.Errorf("ostrace: pid %d exceeds sanity limit, possibly corrupted stream", pid)
 	}
 	procpathLen := binary.LittleEndian.Uint16(data[37:39])
+	activityID := binary.LittleEndian.Uint64(data[39:47])
 	timeSec := binary.LittleEndian.Uint64(data[55:63])
 	timeUsec := binary.LittleEndian.Uint32(data[63:67])
 	level := LogLevel(data[68])
@@ -452,6 +466,9 @@ func parseEntry(data []byte) (LogEntry, error) {
 		Filename:    filename,
 		Message:     message,
 	}
+	if level.isSignpost() {
+		entry.Signpost = &Signpost{ID: activityID, Type: SignpostType(level & 0x03), Name: message}
+	}
 
 	// Optional label: subsystem + category
 	if subsystemLen > 0 && categoryLen > 0 {
@@ -0,0 +1,209 @@
+package ostrace
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SignpostType tells whether a signpost marks a single event or the begin or end of an interval.
+type SignpostType uint8
+
+const (
+	SignpostTypeEvent SignpostType = 0x00
+	SignpostTypeBegin SignpostType = 0x01
+	SignpostTypeEnd   SignpostType = 0x02
+)
+
+func (t SignpostType) String() string {
+	switch t {
+	case SignpostTypeEvent:
+		return "event"
+	case SignpostTypeBegin:
+		return "begin"
+	case SignpostTypeEnd:
+		return "end"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the type as its name
+func (t SignpostType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Signpost contains the os_signpost fields of a log entry. Signpost records use
+// the log type byte for the signpost type (0x80 event, 0x81 begin, 0x82 end, with
+// bit 0x40 set for the system and thread scopes) and the activity ID field of the
+// frame for the signpost ID. The relay does not send the static signpost name
+// separately, Name holds the formatted signpost message.
+type Signpost struct {
+	ID   uint64       `json:"id"`
+	Type SignpostType `json:"type"`
+	Name string       `json:"name"`
+}
+
+func (l LogLevel) isSignpost() bool {
+	return l&0xc0 != 0 && l&0x3f <= LogLevel(SignpostTypeEnd)
+}
+
+// Interval is a matched pair of begin and end signposts
+type Interval struct {
+	Name       string        `json:"name"`
+	ID         uint64        `json:"id"`
+	PID        uint32        `json:"pid"`
+	Subsystem  string        `json:"subsystem,omitempty"`
+	Category   string        `json:"category,omitempty"`
+	Begin      time.Time     `json:"begin"`
+	End        time.Time     `json:"end"`
+	Duration   time.Duration `json:"-"`
+	DurationMs float64       `json:"durationMs"`
+}
+
+// IntervalStats summarizes the durations of all intervals with the same name, subsystem and category
+type IntervalStats struct {
+	Name      string  `json:"name"`
+	Subsystem string  `json:"subsystem,omitempty"`
+	Category  string  `json:"category,omitempty"`
+	Count     int     `json:"count"`
+	P50Ms     float64 `json:"p50Ms"`
+	P95Ms     float64 `json:"p95Ms"`
+	MaxMs     float64 `json:"maxMs"`
+}
+
+type signpostKey struct {
+	pid uint32
+	id  uint64
+}
+
+// SignpostAnalyzer pairs begin and end signposts into intervals. Entries have to be
+// added in the order they are received from the device.
+type SignpostAnalyzer struct {
+	open      map[signpostKey][]LogEntry
+	intervals []Interval
+}
+
+// NewSignpostAnalyzer creates an empty analyzer
+func NewSignpostAnalyzer() *SignpostAnalyzer {
+	return &SignpostAnalyzer{open: map[signpostKey][]LogEntry{}}
+}
+
+// Add records a log entry. It returns the completed interval if entry is the end
+// signpost of an open interval. An end is matched to the open begin with the same
+// process, signpost ID and name, or to the latest begin with the same ID if the
+// names differ because the messages are formatted with different arguments.
+func (a *SignpostAnalyzer) Add(entry LogEntry) (Interval, bool) {
+	if entry.Signpost == nil {
+		return Interval{}, false
+	}
+	key := signpostKey{pid: entry.PID, id: entry.Signpost.ID}
+	switch entry.Signpost.Type {
+	case SignpostTypeBegin:
+		a.open[key] = append(a.open[key], entry)
+	case SignpostTypeEnd:
+		begins := a.open[key]
+		if len(begins) == 0 {
+			return Interval{}, false
+		}
+		i := len(begins) - 1
+		for j := len(begins) - 1; j >= 0; j-- {
+			if begins[j].Signpost.Name == entry.Signpost.Name {
+				i = j
+				break
+			}
+		}
+		begin := begins[i]
+		begins = append(begins[:i], begins[i+1:]...)
+		if len(begins) == 0 {
+			delete(a.open, key)
+		} else {
+			a.open[key] = begins
+		}
+		interval := newInterval(begin, entry)
+		a.intervals = append(a.intervals, interval)
+		return interval, true
+	}
+	return Interval{}, false
+}
+
+func newInterval(begin, end LogEntry) Interval {
+	duration := end.Timestamp.Sub(begin.Timestamp)
+	interval := Interval{
+		Name:       begin.Signpost.Name,
+		ID:         begin.Signpost.ID,
+		PID:        begin.PID,
+		Begin:      begin.Timestamp,
+		End:        end.Timestamp,
+		Duration:   duration,
+		DurationMs: durationMs(duration),
+	}
+	if begin.Label != nil {
+		interval.Subsystem = begin.Label.Subsystem
+		interval.Category = begin.Label.Category
+	}
+	return interval
+}
+
+// Intervals returns all completed intervals in the order they ended
+func (a *SignpostAnalyzer) Intervals() []Interval {
+	return a.intervals
+}
+
+// OpenIntervals returns the number of begin signposts without an end
+func (a *SignpostAnalyzer) OpenIntervals() int {
+	n := 0
+	for _, begins := range a.open {
+		n += len(begins)
+	}
+	return n
+}
+
+// Stats returns the duration statistics of the completed intervals, grouped by
+// name, subsystem and category and sorted in this order.
+func (a *SignpostAnalyzer) Stats() []IntervalStats {
+	type group struct {
+		name, subsystem, category string
+	}
+	durations := map[group][]time.Duration{}
+	for _, interval := range a.intervals {
+		g := group{interval.Name, interval.Subsystem, interval.Category}
+		durations[g] = append(durations[g], interval.Duration)
+	}
+	stats := make([]IntervalStats, 0, len(durations))
+	for g, d := range durations {
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		stats = append(stats, IntervalStats{
+			Name:      g.name,
+			Subsystem: g.subsystem,
+			Category:  g.category,
+			Count:     len(d),
+			P50Ms:     durationMs(percentile(d, 50)),
+			P95Ms:     durationMs(percentile(d, 95)),
+			MaxMs:     durationMs(d[len(d)-1]),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		if stats[i].Subsystem != stats[j].Subsystem {
+			return stats[i].Subsystem < stats[j].Subsystem
+		}
+		return stats[i].Category < stats[j].Category
+	})
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,98 @@
+package ostrace
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEntrySignpost(t *testing.T) {
+	data := make([]byte, 140)
+	binary.LittleEndian.PutUint32(data[9:13], 42)
+	binary.LittleEndian.PutUint64(data[39:47], 0xeeeeb0b5b2b2eeee)
+	data[68] = 0x81
+	binary.LittleEndian.PutUint32(data[109:113], 11)
+	copy(data[129:], "ScreenLoad\x00")
+
+	entry, err := parseEntry(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Signpost", entry.LevelName)
+	assert.Equal(t, &Signpost{ID: 0xeeeeb0b5b2b2eeee, Type: SignpostTypeBegin, Name: "ScreenLoad"}, entry.Signpost)
+
+	data[68] = byte(LogLevelError)
+	entry, err = parseEntry(data)
+	require.NoError(t, err)
+	assert.Nil(t, entry.Signpost)
+}
+
+func signpostEntry(pid uint32, id uint64, signpostType SignpostType, name string, ms int) LogEntry {
+	return LogEntry{
+		PID:       pid,
+		Timestamp: time.Unix(1700000000, 0).Add(time.Duration(ms) * time.Millisecond),
+		Label:     &LogLabel{Subsystem: "com.example.app", Category: "PointsOfInterest"},
+		Signpost:  &Signpost{ID: id, Type: signpostType, Name: name},
+	}
+}
+
+func TestSignpostAnalyzerPairs(t *testing.T) {
+	a := NewSignpostAnalyzer()
+	_, ok := a.Add(signpostEntry(1, 10, SignpostTypeBegin, "ScreenLoad", 0))
+	assert.False(t, ok)
+	_, ok = a.Add(signpostEntry(1, 11, SignpostTypeBegin, "ScreenLoad", 5))
+	assert.False(t, ok)
+	_, ok = a.Add(signpostEntry(1, 10, SignpostTypeEvent, "ScreenLoad", 7))
+	assert.False(t, ok)
+
+	interval, ok := a.Add(signpostEntry(1, 11, SignpostTypeEnd, "ScreenLoad", 105))
+	require.True(t, ok)
+	assert.Equal(t, uint64(11), interval.ID)
+	assert.Equal(t, 100*time.Millisecond, interval.Duration)
+	assert.Equal(t, 100.0, interval.DurationMs)
+	assert.Equal(t, "com.example.app", interval.Subsystem)
+
+	// the same ID in another process is a different interval
+	_, ok = a.Add(signpostEntry(2, 10, SignpostTypeEnd, "ScreenLoad", 110))
+	assert.False(t, ok)
+
+	interval, ok = a.Add(signpostEntry(1, 10, SignpostTypeEnd, "ScreenLoad", 250))
+	require.True(t, ok)
+	assert.Equal(t, 250.0, interval.DurationMs)
+	assert.Len(t, a.Intervals(), 2)
+	assert.Equal(t, 0, a.OpenIntervals())
+}
+
+func TestSignpostAnalyzerMatchesName(t *testing.T) {
+	a := NewSignpostAnalyzer()
+	a.Add(signpostEntry(1, 10, SignpostTypeBegin, "Decode", 0))
+	a.Add(signpostEntry(1, 10, SignpostTypeBegin, "Fetch", 10))
+	interval, ok := a.Add(signpostEntry(1, 10, SignpostTypeEnd, "Decode", 30))
+	require.True(t, ok)
+	assert.Equal(t, "Decode", interval.Name)
+	assert.Equal(t, 30.0, interval.DurationMs)
+
+	// without a matching name the latest begin with the ID is used
+	interval, ok = a.Add(signpostEntry(1, 10, SignpostTypeEnd, "Fetch done", 50))
+	require.True(t, ok)
+	assert.Equal(t, "Fetch", interval.Name)
+	assert.Equal(t, 0, a.OpenIntervals())
+}
+
+func TestSignpostAnalyzerStats(t *testing.T) {
+	a := NewSignpostAnalyzer()
+	for i := 1; i <= 20; i++ {
+		a.Add(signpostEntry(1, uint64(i), SignpostTypeBegin, "ScreenLoad", 0))
+		a.Add(signpostEntry(1, uint64(i), SignpostTypeEnd, "ScreenLoad", i*10))
+	}
+	a.Add(signpostEntry(1, 100, SignpostTypeBegin, "Animation", 0))
+	a.Add(signpostEntry(1, 100, SignpostTypeEnd, "Animation", 16))
+	a.Add(signpostEntry(1, 101, SignpostTypeBegin, "Animation", 0))
+
+	assert.Equal(t, []IntervalStats{
+		{Name: "Animation", Subsystem: "com.example.app", Category: "PointsOfInterest", Count: 1, P50Ms: 16, P95Ms: 16, MaxMs: 16},
+		{Name: "ScreenLoad", Subsystem: "com.example.app", Category: "PointsOfInterest", Count: 20, P50Ms: 100, P95Ms: 190, MaxMs: 200},
+	}, a.Stats())
+	assert.Equal(t, 1, a.OpenIntervals())
+}
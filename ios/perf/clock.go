@@ -0,0 +1,93 @@
+package perf
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+)
+
+// Clock converts timestamps of the device to host time. Sysmontap samples and app state
+// notifications use mach absolute time, os_trace logs use the wall clock of the device.
+type Clock struct {
+	// MachAbsoluteTime is the mach absolute time of the device at Reference
+	MachAbsoluteTime uint64
+	Timebase         kdebug.Timebase
+	// Reference is the host time MachAbsoluteTime was read at, it is zero if unknown
+	Reference time.Time
+	// WallClockOffset is how far the wall clock of the device is ahead of the host
+	WallClockOffset time.Duration
+}
+
+// NewClock reads the mach absolute time and timebase with DeviceInfoService and the wall
+// clock of the device with lockdown. The reference time is the middle of the request, so
+// half of the round trip is the largest error.
+func NewClock(device ios.DeviceEntry) (Clock, error) {
+	deviceInfo, err := instruments.NewDeviceInfoService(device)
+	if err != nil {
+		return Clock{}, err
+	}
+	defer deviceInfo.Close()
+
+	before := time.Now()
+	info, err := deviceInfo.MachTimeInfo()
+	if err != nil {
+		return Clock{}, err
+	}
+	clock := Clock{
+		MachAbsoluteTime: info.MachAbsoluteTime,
+		Timebase:         info.Timebase,
+		Reference:        before.Add(time.Since(before) / 2),
+	}
+
+	offset, err := wallClockOffset(device)
+	if err != nil {
+		return clock, fmt.Errorf("failed reading device time: %w", err)
+	}
+	clock.WallClockOffset = offset
+	return clock, nil
+}
+
+func wallClockOffset(device ios.DeviceEntry) (time.Duration, error) {
+	lockdown, err := ios.ConnectLockdownWithSession(device)
+	if err != nil {
+		return 0, err
+	}
+	defer lockdown.Close()
+	before := time.Now()
+	value, err := lockdown.GetValue("TimeIntervalSince1970")
+	if err != nil {
+		return 0, err
+	}
+	reference := before.Add(time.Since(before) / 2)
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case uint64:
+		seconds = float64(v)
+	default:
+		return 0, fmt.Errorf("unexpected TimeIntervalSince1970 %T: %v", value, value)
+	}
+	deviceTime := time.Unix(0, int64(seconds*float64(time.Second)))
+	return deviceTime.Sub(reference), nil
+}
+
+// FromMachTime converts a mach absolute time to host time. It returns false if the clock
+// has no mach time reference.
+func (c Clock) FromMachTime(machTime uint64) (time.Time, bool) {
+	if c.Reference.IsZero() || machTime == 0 {
+		return time.Time{}, false
+	}
+	if machTime >= c.MachAbsoluteTime {
+		return c.Reference.Add(time.Duration(c.Timebase.Nanoseconds(machTime - c.MachAbsoluteTime))), true
+	}
+	return c.Reference.Add(-time.Duration(c.Timebase.Nanoseconds(c.MachAbsoluteTime - machTime))), true
+}
+
+// FromDeviceTime converts a wall clock time of the device to host time
+func (c Clock) FromDeviceTime(t time.Time) time.Time {
+	return t.Add(-c.WallClockOffset)
+}
@@ -0,0 +1,359 @@
+package perf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/golog"
+	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/ostrace"
+)
+
+const logModule = "go-ios/perf"
+
+// DefaultSampleInterval is the sysmontap sample interval if Options.SampleInterval is zero
+const DefaultSampleInterval = time.Second
+
+// maxLogNameLength limits the length of log messages used as event names, the full
+// message is in the args of the event
+const maxLogNameLength = 80
+
+// Options configures Record
+type Options struct {
+	// Duration is the recording time, zero records until the context is done
+	Duration time.Duration
+	// PID limits process counters and logs to one process, zero records all processes
+	PID uint64
+	// SampleInterval of the CPU and memory counters
+	SampleInterval time.Duration
+}
+
+// Record runs the sysmontap, graphics, network, app state notification and os_trace
+// collectors concurrently for the given duration, or until ctx is done, and returns their
+// samples on one timeline. Collectors that fail to start are skipped, Record only fails if
+// none of them started.
+func Record(ctx context.Context, device ios.DeviceEntry, options Options) (*Timeline, error) {
+	if options.SampleInterval == 0 {
+		options.SampleInterval = DefaultSampleInterval
+	}
+	clock, err := NewClock(device)
+	if err != nil {
+		golog.Warn("failed reading device clock, using arrival times of samples", "module", logModule, "error", err)
+	}
+	r := newRecorder(NewTimeline(time.Now()), clock, options.PID)
+
+	collectors := []struct {
+		name  string
+		start func(ios.DeviceEntry, *sync.WaitGroup) (func() error, error)
+	}{
+		{"sysmontap", r.collectSysmontap(options.SampleInterval)},
+		{"graphics", r.collectFPS},
+		{"network", r.collectNetwork},
+		{"notifications", r.collectAppStateNotifications},
+		{"os_trace", r.collectLogs},
+	}
+	var wg sync.WaitGroup
+	var stops []func() error
+	var errs []error
+	for _, c := range collectors {
+		stop, err := c.start(device, &wg)
+		if err != nil {
+			golog.Warn("failed starting collector", "module", logModule, "collector", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		stops = append(stops, stop)
+	}
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("no collector started: %w", errors.Join(errs...))
+	}
+
+	var timeout <-chan time.Time
+	if options.Duration > 0 {
+		timer := time.NewTimer(options.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-timeout:
+	case <-ctx.Done():
+	}
+	for _, stop := range stops {
+		if err := stop(); err != nil {
+			golog.Debug("failed stopping collector", "module", logModule, "error", err)
+		}
+	}
+	wg.Wait()
+	return r.timeline, nil
+}
+
+// recorder converts the samples of the collectors to trace events
+type recorder struct {
+	timeline *Timeline
+	clock    Clock
+	pid      uint64
+
+	// connectionPIDs maps the serial numbers of connections to their process,
+	// the network samples are only handled by one goroutine
+	connectionPIDs map[uint64]uint64
+	lastUpdates    map[uint64]instruments.ConnectionUpdate
+	traffic        map[uint64]*instruments.NetworkTraffic
+}
+
+func newRecorder(timeline *Timeline, clock Clock, pid uint64) *recorder {
+	return &recorder{
+		timeline:       timeline,
+		clock:          clock,
+		pid:            pid,
+		connectionPIDs: map[uint64]uint64{},
+		lastUpdates:    map[uint64]instruments.ConnectionUpdate{},
+		traffic:        map[uint64]*instruments.NetworkTraffic{},
+	}
+}
+
+func (r *recorder) includes(pid uint64) bool {
+	return r.pid == 0 || r.pid == pid
+}
+
+func (r *recorder) machTime(machTime uint64, fallback time.Time) time.Time {
+	if t, ok := r.clock.FromMachTime(machTime); ok {
+		return t
+	}
+	return fallback
+}
+
+func (r *recorder) collectSysmontap(interval time.Duration) func(ios.DeviceEntry, *sync.WaitGroup) (func() error, error) {
+	return func(device ios.DeviceEntry, wg *sync.WaitGroup) (func() error, error) {
+		service, err := instruments.NewSysmontapServiceWithInterval(device, interval)
+		if err != nil {
+			return nil, err
+		}
+		samples := service.ReceiveSamples()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sample := range samples {
+				r.addSysmontapSample(sample)
+			}
+		}()
+		return service.Close, nil
+	}
+}
+
+func (r *recorder) addSysmontapSample(sample instruments.SysmontapSample) {
+	at := r.machTime(sample.EndMachAbsTime, sample.Time)
+	if sample.SystemCPUUsage != nil {
+		r.timeline.Counter(at, DevicePID, "CPU", map[string]float64{"total": sample.SystemCPUUsage.CPU_TotalLoad})
+	}
+	if s := sample.System; s != nil {
+		r.timeline.Counter(at, DevicePID, "Memory (pages)", map[string]float64{
+			"free":       float64(s.VMFreeCount),
+			"active":     float64(s.VMActiveCount),
+			"inactive":   float64(s.VMInactiveCount),
+			"wired":      float64(s.VMWireCount),
+			"compressed": float64(s.VMCompressorPageCount),
+		})
+	}
+	for _, p := range sample.Processes {
+		if !r.includes(p.PID) {
+			continue
+		}
+		if p.Name != "" {
+			r.timeline.SetProcessName(p.PID, p.Name)
+		}
+		r.timeline.Counter(at, p.PID, "CPU", map[string]float64{"usage": p.CPUUsage})
+		r.timeline.Counter(at, p.PID, "Memory", map[string]float64{
+			"physFootprint":   float64(p.PhysFootprint),
+			"memResidentSize": float64(p.MemResidentSize),
+		})
+	}
+}
+
+func (r *recorder) collectFPS(device ios.DeviceEntry, wg *sync.WaitGroup) (func() error, error) {
+	service, err := instruments.NewGraphicsOpenGLService(device)
+	if err != nil {
+		return nil, err
+	}
+	samples := service.ReceiveFramesPerSecondSamples()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for sample := range samples {
+			r.addFPSSample(time.Now(), sample)
+		}
+	}()
+	return service.Close, nil
+}
+
+func (r *recorder) addFPSSample(at time.Time, sample instruments.FramesPerSecondSample) {
+	r.timeline.Counter(at, DevicePID, "FPS", map[string]float64{"fps": sample.CoreAnimationFramesPerSecond})
+}
+
+func (r *recorder) collectNetwork(device ios.DeviceEntry, wg *sync.WaitGroup) (func() error, error) {
+	service, err := instruments.NewNetworkService(device)
+	if err != nil {
+		return nil, err
+	}
+	samples := service.ReceiveNetworkSamples()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for sample := range samples {
+			r.addNetworkSample(time.Now(), sample)
+		}
+	}()
+	return service.Close, nil
+}
+
+// addNetworkSample adds an instant event for new connections and a counter with the traffic
+// of the process since the recording started for connection updates. Updates of connections
+// that were opened before the recording started are skipped, their process is unknown.
+func (r *recorder) addNetworkSample(at time.Time, sample instruments.NetworkSample) {
+	switch {
+	case sample.Connection != nil:
+		c := sample.Connection
+		r.connectionPIDs[c.SerialNumber] = c.PID
+		if r.includes(c.PID) {
+			r.timeline.Instant(at, c.PID, 0, ScopeProcess, "network", "connect "+c.RemoteAddress.String(), map[string]interface{}{
+				"local":  c.LocalAddress.String(),
+				"remote": c.RemoteAddress.String(),
+			})
+		}
+	case sample.Update != nil:
+		u := *sample.Update
+		pid, ok := r.connectionPIDs[u.ConnectionSerial]
+		if !ok || !r.includes(pid) {
+			return
+		}
+		last := r.lastUpdates[u.ConnectionSerial]
+		r.lastUpdates[u.ConnectionSerial] = u
+		traffic, ok := r.traffic[pid]
+		if !ok {
+			traffic = &instruments.NetworkTraffic{}
+			r.traffic[pid] = traffic
+		}
+		traffic.RxBytes += u.RxBytes - min(last.RxBytes, u.RxBytes)
+		traffic.TxBytes += u.TxBytes - min(last.TxBytes, u.TxBytes)
+		r.timeline.Counter(at, pid, "Network (bytes)", map[string]float64{"rx": float64(traffic.RxBytes), "tx": float64(traffic.TxBytes)})
+	}
+}
+
+func (r *recorder) collectAppStateNotifications(device ios.DeviceEntry, wg *sync.WaitGroup) (func() error, error) {
+	receive, stop, err := instruments.ListenAppStateNotifications(device)
+	if err != nil {
+		return nil, err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			notification, err := receive()
+			if err != nil {
+				return
+			}
+			r.addAppStateNotification(time.Now(), notification)
+		}
+	}()
+	return stop, nil
+}
+
+// addAppStateNotification adds an instant event with the new state of an app, like
+// "Running" or "Background Task Suspended", to the process of the app
+func (r *recorder) addAppStateNotification(at time.Time, notification map[string]interface{}) {
+	pid, ok := uint64Value(notification["pid"])
+	if !ok || !r.includes(pid) {
+		return
+	}
+	name, _ := notification["appName"].(string)
+	state, _ := notification["state_description"].(string)
+	if machTime, ok := uint64Value(notification["mach_absolute_time"]); ok {
+		at = r.machTime(machTime, at)
+	}
+	if name != "" {
+		r.timeline.SetProcessName(pid, name)
+	}
+	r.timeline.Instant(at, pid, 0, ScopeProcess, "app state", state, map[string]interface{}{"appName": name})
+}
+
+func (r *recorder) collectLogs(device ios.DeviceEntry, wg *sync.WaitGroup) (func() error, error) {
+	pid := -1
+	if r.pid != 0 {
+		pid = int(r.pid)
+	}
+	conn, err := ostrace.New(device, pid, ostrace.MessageFilterLogMessage|ostrace.MessageFilterSignpost, 0)
+	if err != nil {
+		return nil, err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			entry, err := conn.ReadEntry()
+			if err != nil {
+				return
+			}
+			r.addLogEntry(entry)
+		}
+	}()
+	return conn.Close, nil
+}
+
+// addLogEntry adds signposts as async events and other log messages as instant events
+// on their thread
+func (r *recorder) addLogEntry(entry ostrace.LogEntry) {
+	at := r.clock.FromDeviceTime(entry.Timestamp)
+	args := map[string]interface{}{"message": entry.Message, "level": entry.LevelName, "image": entry.ImageName}
+	category := "log"
+	if entry.Label != nil {
+		args["subsystem"] = entry.Label.Subsystem
+		args["category"] = entry.Label.Category
+		category = entry.Label.Subsystem
+	}
+	pid := uint64(entry.PID)
+	if s := entry.Signpost; s != nil {
+		phase := PhaseAsync
+		switch s.Type {
+		case ostrace.SignpostTypeBegin:
+			phase = PhaseAsyncBegin
+		case ostrace.SignpostTypeEnd:
+			phase = PhaseAsyncEnd
+		}
+		// signpost IDs are only unique within a process
+		r.timeline.Add(at, TraceEvent{
+			Name:     s.Name,
+			Category: "signpost",
+			Phase:    phase,
+			PID:      pid,
+			TID:      uint64(entry.ThreadID),
+			ID:       fmt.Sprintf("%d:0x%x", pid, s.ID),
+			Args:     args,
+		})
+		return
+	}
+	r.timeline.Instant(at, pid, uint64(entry.ThreadID), ScopeThread, category, truncate(entry.Message, maxLogNameLength), args)
+}
+
+// uint64Value converts the integers of unarchived notifications
+func uint64Value(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case int64:
+		return uint64(n), n >= 0
+	case int:
+		return uint64(n), n >= 0
+	}
+	return 0, false
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
@@ -0,0 +1,78 @@
+package perf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/kdebug"
+	"github.com/danielpaulus/go-ios/ios/ostrace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	reference := time.Unix(1700000000, 0)
+	clock := Clock{MachAbsoluteTime: 3000, Timebase: kdebug.Timebase{Numer: 125, Denom: 3}, Reference: reference, WallClockOffset: 2 * time.Second}
+
+	at, ok := clock.FromMachTime(3024)
+	require.True(t, ok)
+	assert.Equal(t, reference.Add(time.Microsecond), at)
+	at, ok = clock.FromMachTime(2976)
+	require.True(t, ok)
+	assert.Equal(t, reference.Add(-time.Microsecond), at)
+	assert.Equal(t, reference, clock.FromDeviceTime(reference.Add(2*time.Second)))
+
+	_, ok = Clock{}.FromMachTime(3024)
+	assert.False(t, ok)
+}
+
+func TestRecorder(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := Clock{MachAbsoluteTime: 1000, Timebase: kdebug.Timebase{Numer: 1, Denom: 1}, Reference: start}
+	r := newRecorder(NewTimeline(start), clock, 42)
+
+	r.addSysmontapSample(instruments.SysmontapSample{
+		Time:           start.Add(time.Hour),
+		EndMachAbsTime: 1000 + uint64(time.Second),
+		SystemCPUUsage: &instruments.CPUUsage{CPU_TotalLoad: 80},
+		Processes: []instruments.ProcessSample{
+			{PID: 1, Name: "launchd", CPUUsage: 1},
+			{PID: 42, Name: "MyApp", CPUUsage: 25, PhysFootprint: 1024},
+		},
+	})
+	r.addAppStateNotification(start, map[string]interface{}{"appName": "MyApp", "pid": uint64(42), "state_description": "Running", "mach_absolute_time": uint64(1000 + 2*time.Second)})
+	r.addAppStateNotification(start, map[string]interface{}{"appName": "Other", "pid": uint64(43), "state_description": "Running"})
+
+	local := instruments.SocketAddress{IP: net.IPv4(10, 0, 0, 2), Port: 50000}
+	remote := instruments.SocketAddress{IP: net.IPv4(1, 2, 3, 4), Port: 443}
+	r.addNetworkSample(start, instruments.NetworkSample{Connection: &instruments.ConnectionDetection{PID: 42, SerialNumber: 5, LocalAddress: local, RemoteAddress: remote}})
+	r.addNetworkSample(start, instruments.NetworkSample{Update: &instruments.ConnectionUpdate{ConnectionSerial: 5, RxBytes: 100, TxBytes: 10}})
+	r.addNetworkSample(start, instruments.NetworkSample{Update: &instruments.ConnectionUpdate{ConnectionSerial: 5, RxBytes: 150, TxBytes: 10}})
+	// the process of connections opened before the recording is unknown
+	r.addNetworkSample(start, instruments.NetworkSample{Update: &instruments.ConnectionUpdate{ConnectionSerial: 6, RxBytes: 100}})
+
+	r.addLogEntry(ostrace.LogEntry{PID: 42, ThreadID: 7, Timestamp: start.Add(3 * time.Second), Message: "loading", Signpost: &ostrace.Signpost{ID: 9, Type: ostrace.SignpostTypeBegin, Name: "Load"}})
+	r.addLogEntry(ostrace.LogEntry{PID: 42, ThreadID: 7, Timestamp: start.Add(4 * time.Second), Message: "done", Label: &ostrace.LogLabel{Subsystem: "com.example", Category: "net"}})
+
+	events := r.timeline.Events()
+	require.Len(t, events, 11)
+	assert.Equal(t, map[string]interface{}{"name": "MyApp"}, events[1].Args)
+	counters := events[2:]
+
+	assert.Equal(t, TraceEvent{Name: "connect 1.2.3.4:443", Category: "network", Phase: PhaseInstant, PID: 42, Scope: ScopeProcess, Args: map[string]interface{}{"local": "10.0.0.2:50000", "remote": "1.2.3.4:443"}}, counters[0])
+	assert.Equal(t, map[string]interface{}{"rx": 100.0, "tx": 10.0}, counters[1].Args)
+	assert.Equal(t, map[string]interface{}{"rx": 150.0, "tx": 10.0}, counters[2].Args)
+
+	assert.Equal(t, TraceEvent{Name: "CPU", Phase: PhaseCounter, Timestamp: 1e6, PID: DevicePID, Args: map[string]interface{}{"total": 80.0}}, counters[3])
+	assert.Equal(t, "CPU", counters[4].Name)
+	assert.Equal(t, uint64(42), counters[4].PID)
+	assert.Equal(t, "Memory", counters[5].Name)
+
+	assert.Equal(t, TraceEvent{Name: "Running", Category: "app state", Phase: PhaseInstant, Timestamp: 2e6, PID: 42, Scope: ScopeProcess, Args: map[string]interface{}{"appName": "MyApp"}}, counters[6])
+	assert.Equal(t, PhaseAsyncBegin, counters[7].Phase)
+	assert.Equal(t, "42:0x9", counters[7].ID)
+	assert.Equal(t, TraceEvent{Name: "done", Category: "com.example", Phase: PhaseInstant, Timestamp: 4e6, PID: 42, TID: 7, Scope: ScopeThread,
+		Args: map[string]interface{}{"message": "done", "level": "", "image": "", "subsystem": "com.example", "category": "net"}}, counters[8])
+}
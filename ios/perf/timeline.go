@@ -0,0 +1,130 @@
+// Package perf records metrics of several instruments services and os_trace logs into one
+// timeline in the Chrome Trace Event format, which ui.perfetto.dev and chrome://tracing open.
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+package perf
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phases of trace events
+const (
+	PhaseCounter    = "C"
+	PhaseInstant    = "i"
+	PhaseAsyncBegin = "b"
+	PhaseAsyncEnd   = "e"
+	PhaseAsync      = "n"
+	PhaseMetadata   = "M"
+)
+
+// Scopes of instant events
+const (
+	ScopeGlobal  = "g"
+	ScopeProcess = "p"
+	ScopeThread  = "t"
+)
+
+// DevicePID is the process of the timeline that contains the system wide counters
+const DevicePID = 0
+
+// TraceEvent is one event of the Chrome Trace Event format. Timestamp is in
+// microseconds since the start of the timeline.
+type TraceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	PID       uint64                 `json:"pid"`
+	TID       uint64                 `json:"tid"`
+	ID        string                 `json:"id,omitempty"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// Timeline collects trace events with timestamps relative to its start. It is safe for
+// concurrent use.
+type Timeline struct {
+	start time.Time
+
+	mu           sync.Mutex
+	events       []TraceEvent
+	processNames map[uint64]string
+}
+
+// NewTimeline creates an empty timeline that starts at start
+func NewTimeline(start time.Time) *Timeline {
+	return &Timeline{start: start, processNames: map[uint64]string{DevicePID: "Device"}}
+}
+
+// Start returns the time the timeline starts at
+func (t *Timeline) Start() time.Time {
+	return t.start
+}
+
+func (t *Timeline) timestamp(at time.Time) float64 {
+	return float64(at.Sub(t.start).Nanoseconds()) / 1e3
+}
+
+// Add adds an event that happened at the given time
+func (t *Timeline) Add(at time.Time, event TraceEvent) {
+	event.Timestamp = t.timestamp(at)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+// Counter adds the values of a counter track of a process. Every key of values is one
+// series of the track.
+func (t *Timeline) Counter(at time.Time, pid uint64, name string, values map[string]float64) {
+	args := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		args[key] = value
+	}
+	t.Add(at, TraceEvent{Name: name, Phase: PhaseCounter, PID: pid, Args: args})
+}
+
+// Instant adds an instant event. The scope tells if the event is drawn on the thread,
+// the process or across the whole timeline.
+func (t *Timeline) Instant(at time.Time, pid, tid uint64, scope, category, name string, args map[string]interface{}) {
+	t.Add(at, TraceEvent{Name: name, Category: category, Phase: PhaseInstant, PID: pid, TID: tid, Scope: scope, Args: args})
+}
+
+// SetProcessName names the track of a process. Names set later replace earlier names.
+func (t *Timeline) SetProcessName(pid uint64, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.processNames[pid] = name
+}
+
+// Events returns the events sorted by timestamp, starting with the process name metadata
+func (t *Timeline) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pids := make([]uint64, 0, len(t.processNames))
+	for pid := range t.processNames {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+
+	events := make([]TraceEvent, 0, len(pids)+len(t.events))
+	for _, pid := range pids {
+		events = append(events, TraceEvent{Name: "process_name", Phase: PhaseMetadata, PID: pid, Args: map[string]interface{}{"name": t.processNames[pid]}})
+	}
+	sorted := append([]TraceEvent(nil), t.events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	return append(events, sorted...)
+}
+
+type traceFile struct {
+	TraceEvents     []TraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// Write writes the timeline as JSON trace file
+func (t *Timeline) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(traceFile{TraceEvents: t.Events(), DisplayTimeUnit: "ms"})
+}
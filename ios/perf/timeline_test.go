@@ -0,0 +1,34 @@
+package perf
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineWrite(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	timeline := NewTimeline(start)
+	timeline.Instant(start.Add(2*time.Millisecond), 42, 7, ScopeThread, "log", "hello", nil)
+	timeline.Counter(start.Add(1500*time.Microsecond), DevicePID, "FPS", map[string]float64{"fps": 60})
+	timeline.SetProcessName(42, "MyApp")
+
+	var buf bytes.Buffer
+	require.NoError(t, timeline.Write(&buf))
+	var file struct {
+		TraceEvents     []map[string]interface{} `json:"traceEvents"`
+		DisplayTimeUnit string                   `json:"displayTimeUnit"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &file))
+	assert.Equal(t, "ms", file.DisplayTimeUnit)
+	require.Len(t, file.TraceEvents, 4)
+
+	assert.Equal(t, map[string]interface{}{"name": "process_name", "ph": "M", "ts": 0.0, "pid": 0.0, "tid": 0.0, "args": map[string]interface{}{"name": "Device"}}, file.TraceEvents[0])
+	assert.Equal(t, map[string]interface{}{"name": "MyApp"}, file.TraceEvents[1]["args"])
+	assert.Equal(t, map[string]interface{}{"name": "FPS", "ph": "C", "ts": 1500.0, "pid": 0.0, "tid": 0.0, "args": map[string]interface{}{"fps": 60.0}}, file.TraceEvents[2])
+	assert.Equal(t, map[string]interface{}{"name": "hello", "cat": "log", "ph": "i", "ts": 2000.0, "pid": 42.0, "tid": 7.0, "s": "t"}, file.TraceEvents[3])
+}
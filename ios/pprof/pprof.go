@@ -0,0 +1,277 @@
+// Package pprof writes profiles in the profile.proto format of pprof, see
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+// The types follow github.com/google/pprof/profile, IDs are assigned when the profile is encoded.
+package pprof
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// ValueType describes the semantics and unit of a sample value, like "cpu" and "nanoseconds"
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Label is a string or numeric label of a sample
+type Label struct {
+	Key     string
+	Str     string
+	Num     int64
+	NumUnit string
+}
+
+// Sample is a callstack with values. The first location is the leaf.
+type Sample struct {
+	Location []*Location
+	Value    []int64
+	Label    []Label
+}
+
+// Mapping is a binary image in the address space of the profiled process
+type Mapping struct {
+	Start          uint64
+	Limit          uint64
+	Offset         uint64
+	File           string
+	BuildID        string
+	HasFunctions   bool
+	HasFilenames   bool
+	HasLineNumbers bool
+}
+
+// Location is an instruction address, optionally resolved to functions and lines
+type Location struct {
+	Mapping *Mapping
+	Address uint64
+	Line    []Line
+}
+
+// Line is a source line of a function
+type Line struct {
+	Function *Function
+	Line     int64
+}
+
+// Function is a function of a binary
+type Function struct {
+	Name       string
+	SystemName string
+	Filename   string
+	StartLine  int64
+}
+
+// Profile is a pprof profile. Mappings, locations and functions that are referenced
+// by samples have to be part of the profile.
+type Profile struct {
+	SampleType    []ValueType
+	Sample        []*Sample
+	Mapping       []*Mapping
+	Location      []*Location
+	Function      []*Function
+	TimeNanos     int64
+	DurationNanos int64
+	PeriodType    ValueType
+	Period        int64
+	Comments      []string
+}
+
+// field numbers of profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileComment       = 13
+)
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type buffer struct {
+	data []byte
+}
+
+func (b *buffer) tag(field int, wireType int) {
+	b.data = binary.AppendUvarint(b.data, uint64(field<<3|wireType))
+}
+
+func (b *buffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+func (b *buffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *buffer) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *buffer) bytes(field int, v []byte) {
+	b.tag(field, wireBytes)
+	b.data = binary.AppendUvarint(b.data, uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *buffer) message(field int, encode func(m *buffer)) {
+	var m buffer
+	encode(&m)
+	b.bytes(field, m.data)
+}
+
+func (b *buffer) packedUint64(field int, values []uint64) {
+	if len(values) == 0 {
+		return
+	}
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	b.bytes(field, packed)
+}
+
+func (b *buffer) packedInt64(field int, values []int64) {
+	converted := make([]uint64, len(values))
+	for i, v := range values {
+		converted[i] = uint64(v)
+	}
+	b.packedUint64(field, converted)
+}
+
+type encoder struct {
+	strings   []string
+	stringIDs map[string]int64
+}
+
+// str returns the index of s in the string table, the first entry is always ""
+func (e *encoder) str(s string) int64 {
+	if id, ok := e.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(e.strings))
+	e.strings = append(e.strings, s)
+	e.stringIDs[s] = id
+	return id
+}
+
+func (e *encoder) valueType(b *buffer, v ValueType) {
+	b.int64(1, e.str(v.Type))
+	b.int64(2, e.str(v.Unit))
+}
+
+// Encode returns the uncompressed protobuf encoding of the profile
+func (p *Profile) Encode() []byte {
+	e := &encoder{strings: []string{""}, stringIDs: map[string]int64{"": 0}}
+	mappingIDs := make(map[*Mapping]uint64, len(p.Mapping))
+	for i, m := range p.Mapping {
+		mappingIDs[m] = uint64(i + 1)
+	}
+	locationIDs := make(map[*Location]uint64, len(p.Location))
+	for i, l := range p.Location {
+		locationIDs[l] = uint64(i + 1)
+	}
+	functionIDs := make(map[*Function]uint64, len(p.Function))
+	for i, f := range p.Function {
+		functionIDs[f] = uint64(i + 1)
+	}
+
+	var b buffer
+	for _, v := range p.SampleType {
+		b.message(profileSampleType, func(m *buffer) { e.valueType(m, v) })
+	}
+	for _, s := range p.Sample {
+		b.message(profileSample, func(m *buffer) {
+			ids := make([]uint64, len(s.Location))
+			for i, l := range s.Location {
+				ids[i] = locationIDs[l]
+			}
+			m.packedUint64(1, ids)
+			m.packedInt64(2, s.Value)
+			for _, label := range s.Label {
+				m.message(3, func(l *buffer) {
+					l.int64(1, e.str(label.Key))
+					l.int64(2, e.str(label.Str))
+					l.int64(3, label.Num)
+					l.int64(4, e.str(label.NumUnit))
+				})
+			}
+		})
+	}
+	for _, mapping := range p.Mapping {
+		b.message(profileMapping, func(m *buffer) {
+			m.uint64(1, mappingIDs[mapping])
+			m.uint64(2, mapping.Start)
+			m.uint64(3, mapping.Limit)
+			m.uint64(4, mapping.Offset)
+			m.int64(5, e.str(mapping.File))
+			m.int64(6, e.str(mapping.BuildID))
+			m.bool(7, mapping.HasFunctions)
+			m.bool(8, mapping.HasFilenames)
+			m.bool(9, mapping.HasLineNumbers)
+		})
+	}
+	for _, location := range p.Location {
+		b.message(profileLocation, func(m *buffer) {
+			m.uint64(1, locationIDs[location])
+			m.uint64(2, mappingIDs[location.Mapping])
+			m.uint64(3, location.Address)
+			for _, line := range location.Line {
+				m.message(4, func(l *buffer) {
+					l.uint64(1, functionIDs[line.Function])
+					l.int64(2, line.Line)
+				})
+			}
+		})
+	}
+	for _, function := range p.Function {
+		b.message(profileFunction, func(m *buffer) {
+			m.uint64(1, functionIDs[function])
+			m.int64(2, e.str(function.Name))
+			m.int64(3, e.str(function.SystemName))
+			m.int64(4, e.str(function.Filename))
+			m.int64(5, function.StartLine)
+		})
+	}
+	b.int64(profileTimeNanos, p.TimeNanos)
+	b.int64(profileDurationNanos, p.DurationNanos)
+	if p.PeriodType != (ValueType{}) {
+		b.message(profilePeriodType, func(m *buffer) { e.valueType(m, p.PeriodType) })
+	}
+	b.int64(profilePeriod, p.Period)
+	comments := make([]int64, len(p.Comments))
+	for i, c := range p.Comments {
+		comments[i] = e.str(c)
+	}
+	b.packedInt64(profileComment, comments)
+	// the string table is written last because encoding the other fields fills it
+	for _, s := range e.strings {
+		b.bytes(profileStringTable, []byte(s))
+	}
+	return b.data
+}
+
+// Write writes the gzip compressed profile, the format go tool pprof reads
+func (p *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.Encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,111 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type field struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+// decodeFields splits a protobuf message into its fields
+func decodeFields(t *testing.T, data []byte) []field {
+	var fields []field
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		require.Greater(t, n, 0)
+		data = data[n:]
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(data)
+			require.Greater(t, n, 0)
+			data = data[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			require.Greater(t, n, 0)
+			f.bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func fieldsByNumber(t *testing.T, data []byte) map[int][]field {
+	result := map[int][]field{}
+	for _, f := range decodeFields(t, data) {
+		result[f.number] = append(result[f.number], f)
+	}
+	return result
+}
+
+func TestEncode(t *testing.T) {
+	mapping := &Mapping{Start: 0x100000000, Limit: 0x100100000, File: "MyApp", BuildID: "AA000000-0000-0000-0000-000000000000", HasFunctions: true}
+	function := &Function{Name: "main", Filename: "main.swift"}
+	leaf := &Location{Mapping: mapping, Address: 0x100001000, Line: []Line{{Function: function, Line: 12}}}
+	caller := &Location{Mapping: mapping, Address: 0x100002000}
+	p := &Profile{
+		SampleType: []ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*Sample{
+			{Location: []*Location{leaf, caller}, Value: []int64{1, 1000000}, Label: []Label{{Key: "thread", Num: 7}}},
+		},
+		Mapping:       []*Mapping{mapping},
+		Location:      []*Location{leaf, caller},
+		Function:      []*Function{function},
+		TimeNanos:     1700000000000000000,
+		DurationNanos: 5000000000,
+		PeriodType:    ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        1000000,
+	}
+
+	var compressed bytes.Buffer
+	require.NoError(t, p.Write(&compressed))
+	zr, err := gzip.NewReader(&compressed)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, p.Encode(), data)
+
+	fields := fieldsByNumber(t, data)
+	var stringTable []string
+	for _, f := range fields[profileStringTable] {
+		stringTable = append(stringTable, string(f.bytes))
+	}
+	assert.Equal(t, []string{"", "samples", "count", "cpu", "nanoseconds", "thread", "MyApp", "AA000000-0000-0000-0000-000000000000", "main", "main.swift"}, stringTable)
+	assert.Len(t, fields[profileSampleType], 2)
+	assert.Equal(t, uint64(5000000000), fields[profileDurationNanos][0].varint)
+	assert.Equal(t, uint64(1000000), fields[profilePeriod][0].varint)
+
+	require.Len(t, fields[profileSample], 1)
+	sample := fieldsByNumber(t, fields[profileSample][0].bytes)
+	assert.Equal(t, []byte{1, 2}, sample[1][0].bytes)
+	assert.Equal(t, binary.AppendUvarint([]byte{1}, 1000000), sample[2][0].bytes)
+	label := fieldsByNumber(t, sample[3][0].bytes)
+	assert.Equal(t, uint64(5), label[1][0].varint)
+	assert.Equal(t, uint64(7), label[3][0].varint)
+
+	require.Len(t, fields[profileLocation], 2)
+	location := fieldsByNumber(t, fields[profileLocation][0].bytes)
+	assert.Equal(t, uint64(1), location[1][0].varint)
+	assert.Equal(t, uint64(1), location[2][0].varint)
+	assert.Equal(t, uint64(0x100001000), location[3][0].varint)
+	line := fieldsByNumber(t, location[4][0].bytes)
+	assert.Equal(t, uint64(1), line[1][0].varint)
+	assert.Equal(t, uint64(12), line[2][0].varint)
+
+	mappingFields := fieldsByNumber(t, fields[profileMapping][0].bytes)
+	assert.Equal(t, uint64(0x100100000), mappingFields[3][0].varint)
+	assert.Equal(t, uint64(1), mappingFields[7][0].varint)
+}
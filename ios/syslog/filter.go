@@ -0,0 +1,150 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterOptions are the unparsed filter settings, as they come from command line
+// flags or query parameters. Empty fields do not filter.
+type FilterOptions struct {
+	// Process is a comma-separated list of process names. "SpringBoard" also
+	// matches entries of "SpringBoard(FrontBoard)", which syslog uses for libraries.
+	Process string
+	// PID only passes entries of this process ID
+	PID string
+	// Level is a comma-separated list of levels like "error,fault", compared case-insensitively
+	Level string
+	// Match is a regular expression the message has to match
+	Match string
+	// Exclude is a regular expression, entries with a matching message are dropped
+	Exclude string
+	// Since drops entries older than a duration like "10m" or a timestamp
+	// like "2024-05-01T10:00:00" in the local time zone or RFC 3339
+	Since string
+}
+
+// Filter decides which syslog entries to keep. Create it with [NewFilter].
+type Filter struct {
+	processes []string
+	pid       string
+	levels    []string
+	match     *regexp.Regexp
+	exclude   *regexp.Regexp
+	since     time.Time
+	parse     func(log string) (*LogEntry, error)
+}
+
+// NewFilter validates and compiles the filter options
+func NewFilter(options FilterOptions) (*Filter, error) {
+	f := &Filter{parse: Parser()}
+	for _, p := range strings.Split(options.Process, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			f.processes = append(f.processes, p)
+		}
+	}
+	for _, l := range strings.Split(options.Level, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			f.levels = append(f.levels, strings.ToLower(l))
+		}
+	}
+	if options.PID != "" {
+		if _, err := strconv.Atoi(options.PID); err != nil {
+			return nil, fmt.Errorf("invalid pid %q", options.PID)
+		}
+		f.pid = options.PID
+	}
+	var err error
+	if options.Match != "" {
+		if f.match, err = regexp.Compile(options.Match); err != nil {
+			return nil, fmt.Errorf("invalid match expression: %w", err)
+		}
+	}
+	if options.Exclude != "" {
+		if f.exclude, err = regexp.Compile(options.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude expression: %w", err)
+		}
+	}
+	if options.Since != "" {
+		if f.since, err = parseSince(options.Since, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(timestampLayout, since, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q, use a duration like 10m or a timestamp like 2006-01-02T15:04:05", since)
+}
+
+// IsEmpty returns true if the filter passes every entry
+func (f *Filter) IsEmpty() bool {
+	return len(f.processes) == 0 && f.pid == "" && len(f.levels) == 0 && f.match == nil && f.exclude == nil && f.since.IsZero()
+}
+
+// Matches returns true if the entry passes all filters
+func (f *Filter) Matches(entry *LogEntry) bool {
+	if len(f.processes) > 0 && !f.matchesProcess(entry.Process) {
+		return false
+	}
+	if f.pid != "" && entry.PID != f.pid {
+		return false
+	}
+	if len(f.levels) > 0 && !containsFold(f.levels, entry.Level) {
+		return false
+	}
+	if f.match != nil && !f.match.MatchString(entry.Message) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(entry.Message) {
+		return false
+	}
+	if !f.since.IsZero() {
+		t, err := entry.Time()
+		if err == nil && t.Before(f.since.Truncate(time.Second)) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchLine parses a message returned by [Connection.ReadLogMessage] and applies the filter.
+// The entry is nil if the message cannot be parsed, such messages only pass an empty filter.
+func (f *Filter) MatchLine(log string) (*LogEntry, bool) {
+	log = strings.TrimRight(log, "\x00\n")
+	entry, err := f.parse(log)
+	if err != nil {
+		return nil, f.IsEmpty()
+	}
+	return entry, f.Matches(entry)
+}
+
+func (f *Filter) matchesProcess(process string) bool {
+	for _, p := range f.processes {
+		if process == p || strings.HasPrefix(process, p+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	entry := &LogEntry{
+		Timestamp: time.Now().Format(timestampLayout),
+		Process:   "SpringBoard(FrontBoard)",
+		PID:       "57",
+		Level:     "Error",
+		Message:   "scene update failed: timeout",
+	}
+
+	tests := []struct {
+		name    string
+		options FilterOptions
+		pass    bool
+	}{
+		{name: "empty filter", pass: true},
+		{name: "process", options: FilterOptions{Process: "backboardd, SpringBoard"}, pass: true},
+		{name: "other process", options: FilterOptions{Process: "Spring"}, pass: false},
+		{name: "pid", options: FilterOptions{PID: "57"}, pass: true},
+		{name: "other pid", options: FilterOptions{PID: "58"}, pass: false},
+		{name: "level is case insensitive", options: FilterOptions{Level: "fault,error"}, pass: true},
+		{name: "other level", options: FilterOptions{Level: "notice"}, pass: false},
+		{name: "match regex", options: FilterOptions{Match: `failed: \w+`}, pass: true},
+		{name: "match regex misses", options: FilterOptions{Match: `^timeout`}, pass: false},
+		{name: "exclude regex", options: FilterOptions{Exclude: "time(out)?"}, pass: false},
+		{name: "since duration", options: FilterOptions{Since: "1m"}, pass: true},
+		{name: "since future timestamp", options: FilterOptions{Since: time.Now().Add(time.Hour).Format(time.RFC3339)}, pass: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.pass, f.Matches(entry))
+		})
+	}
+}
+
+func TestNewFilterRejectsInvalidOptions(t *testing.T) {
+	for _, options := range []FilterOptions{{PID: "abc"}, {Match: "("}, {Exclude: "[a"}, {Since: "yesterday"}} {
+		_, err := NewFilter(options)
+		assert.Error(t, err, "%+v", options)
+	}
+}
+
+func TestFilterMatchLine(t *testing.T) {
+	f, err := NewFilter(FilterOptions{Process: "SpringBoard"})
+	require.NoError(t, err)
+
+	entry, ok := f.MatchLine("Jan 2 15:04:05 iPhone SpringBoard[123] <Notice>: hello\n\x00")
+	assert.True(t, ok)
+	require.NotNil(t, entry)
+	assert.Equal(t, "hello", entry.Message)
+
+	entry, ok = f.MatchLine("not a syslog line")
+	assert.False(t, ok)
+	assert.Nil(t, entry)
+
+	empty, err := NewFilter(FilterOptions{})
+	require.NoError(t, err)
+	_, ok = empty.MatchLine("not a syslog line")
+	assert.True(t, ok)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +17,12 @@ const (
 	shimServiceName           = "com.apple.syslog_relay.shim.remote"
 )
 
+// timestampLayout is the format of LogEntry.Timestamp
+const timestampLayout = "2006-01-02T15:04:05"
+
+// relayTimestampLayout is the format of the timestamps the syslog relay sends
+const relayTimestampLayout = "Jan _2 15:04:05"
+
 // Connection exposes the LogReader channel which send the LogMessages as strings.
 type Connection struct {
 	closer         io.Closer
@@ -77,6 +84,32 @@ type LogEntry struct {
 	Message   string `json:"message"`
 }
 
+// Time parses the Timestamp of the entry. Syslog has no year and no time zone, timestamps in the
+// format of the relay or of [Parser] are interpreted in the local time zone and the current year.
+// Timestamps in RFC 3339 keep their zone.
+func (e *LogEntry) Time() (time.Time, error) {
+	if t, err := time.ParseInLocation(timestampLayout, e.Timestamp, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, e.Timestamp); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(relayTimestampLayout, strings.TrimSpace(e.Timestamp), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid syslog timestamp %q", e.Timestamp)
+	}
+	return t.AddDate(time.Now().Year()-t.Year(), 0, 0), nil
+}
+
+// LogfmtValue quotes values that contain spaces, quotes or equal signs, so they can be
+// used as logfmt values
+func LogfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
 func Parser() func(log string) (*LogEntry, error) {
 	pattern := `(?P<Timestamp>[A-Z][a-z]{2}\s+\d+\s+\d{2}:\d{2}:\d{2})\s+(?P<Device>\S+)\s+(?P<Process>[^\[]+)\[(?P<PID>\d+)\]\s+<(?P<Level>\w+)>: (?P<Message>.+)`
 	regexp := regexp.MustCompile(pattern)
@@ -98,7 +131,7 @@ func Parser() func(log string) (*LogEntry, error) {
 
 		// Parse the original timestamp
 		originalTimestamp := result["Timestamp"]
-		parsedTime, err := time.Parse("Jan 2 15:04:05", originalTimestamp)
+		parsedTime, err := time.Parse(relayTimestampLayout, originalTimestamp)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse syslog timestamp: %s", log)
 		}
@@ -106,7 +139,7 @@ func Parser() func(log string) (*LogEntry, error) {
 		parsedTime = parsedTime.AddDate(time.Now().Year()-parsedTime.Year(), 0, 0)
 
 		// Convert to ISO 8601 format
-		isoTimestamp := parsedTime.Format("2006-01-02T15:04:05")
+		isoTimestamp := parsedTime.Format(timestampLayout)
 
 		// Populate the LogEntry struct
 		entry := &LogEntry{
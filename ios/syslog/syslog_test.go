@@ -2,6 +2,7 @@ package syslog_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/danielpaulus/go-ios/ios/syslog"
 	"github.com/stretchr/testify/assert"
@@ -205,3 +206,41 @@ func TestParserWithDecodedVisLine(t *testing.T) {
 	assert.Equal(t, "42", e.PID)
 	assert.Equal(t, "indexPath 或 model 为空", e.Message)
 }
+
+func TestLogEntryTime(t *testing.T) {
+	year := time.Now().Year()
+	tests := []struct {
+		name      string
+		timestamp string
+		want      time.Time
+	}{
+		{name: "parser output", timestamp: "2024-05-01T10:00:00", want: time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)},
+		{name: "relay", timestamp: "May  1 10:00:00", want: time.Date(year, 5, 1, 10, 0, 0, 0, time.Local)},
+		{name: "relay two digit day", timestamp: "May 17 10:00:00", want: time.Date(year, 5, 17, 10, 0, 0, 0, time.Local)},
+		{name: "rfc3339 keeps zone", timestamp: "2024-05-01T10:00:00+02:00", want: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&syslog.LogEntry{Timestamp: tt.timestamp}).Time()
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %v, want %v", got, tt.want)
+		})
+	}
+
+	_, err := (&syslog.LogEntry{Timestamp: "yesterday"}).Time()
+	assert.Error(t, err)
+
+	e, err := syslog.Parser()("May  1 10:00:00 iPhone SpringBoard[58] <Notice>: hello")
+	require.NoError(t, err)
+	got, err := e.Time()
+	require.NoError(t, err)
+	assert.True(t, time.Date(year, 5, 1, 10, 0, 0, 0, time.Local).Equal(got), "got %v", got)
+}
+
+func TestLogfmtValue(t *testing.T) {
+	assert.Equal(t, "SpringBoard", syslog.LogfmtValue("SpringBoard"))
+	assert.Equal(t, `""`, syslog.LogfmtValue(""))
+	assert.Equal(t, `"hello world"`, syslog.LogfmtValue("hello world"))
+	assert.Equal(t, `"a=b"`, syslog.LogfmtValue("a=b"))
+	assert.Equal(t, `"say \"hi\""`, syslog.LogfmtValue(`say "hi"`))
+}
@@ -0,0 +1,398 @@
+package testmanagerd
+
+import (
+	"bytes"
+	"debug/macho"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// loadCmdDyldChainedFixups is LC_DYLD_CHAINED_FIXUPS, debug/macho does not parse it
+const loadCmdDyldChainedFixups macho.LoadCmd = 0x80000034
+
+// smallMethodListFlag marks method lists with relative offsets instead of pointers
+const smallMethodListFlag = 0x80000000
+
+// maxObjCListCount limits the number of entries read from a method list of a damaged binary
+const maxObjCListCount = 1 << 16
+
+// ListBundleTests lists the tests of a local copy of an xctest bundle, like the build
+// product of the test target. p is the .xctest bundle, the test runner .app that contains
+// it in PlugIns or the binary of the bundle. The tests are read from the Objective-C
+// metadata of the binary: every instance method starting with test that takes no arguments,
+// including the methods that are inherited from classes of the bundle. Swift test methods
+// that throw or are async are included as well. The tests have the TestClass/testMethod
+// format of TestConfig.TestsToRun and are sorted.
+func ListBundleTests(p string) ([]string, error) {
+	binary, err := bundleBinary(p)
+	if err != nil {
+		return nil, err
+	}
+	f, closer, err := openMachO(binary)
+	if err != nil {
+		return nil, fmt.Errorf("ListBundleTests: %w", err)
+	}
+	defer closer.Close()
+	tests, err := newObjCImage(f).tests()
+	if err != nil {
+		return nil, fmt.Errorf("ListBundleTests: %s: %w", binary, err)
+	}
+	return tests, nil
+}
+
+// bundleBinary returns the path of the binary of an xctest bundle
+func bundleBinary(p string) (string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return p, nil
+	}
+	if filepath.Ext(p) == ".app" {
+		bundles, err := filepath.Glob(filepath.Join(p, "PlugIns", "*.xctest"))
+		if err != nil {
+			return "", err
+		}
+		if len(bundles) != 1 {
+			return "", fmt.Errorf("ListBundleTests: %s contains %d test bundles, pass the .xctest bundle instead", p, len(bundles))
+		}
+		p = bundles[0]
+	}
+	executable := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	if data, err := os.ReadFile(filepath.Join(p, "Info.plist")); err == nil {
+		var bundleInfo struct {
+			CFBundleExecutable string
+		}
+		if _, err := plist.Unmarshal(data, &bundleInfo); err == nil && bundleInfo.CFBundleExecutable != "" {
+			executable = bundleInfo.CFBundleExecutable
+		}
+	}
+	return filepath.Join(p, executable), nil
+}
+
+// openMachO opens a Mach-O file, of fat binaries the first slice is used because all
+// slices contain the same tests
+func openMachO(p string) (*macho.File, interface{ Close() error }, error) {
+	fat, err := macho.OpenFat(p)
+	if err == nil {
+		if len(fat.Arches) == 0 {
+			fat.Close()
+			return nil, nil, fmt.Errorf("%s has no architectures", p)
+		}
+		return fat.Arches[0].File, fat, nil
+	}
+	if !errors.Is(err, macho.ErrNotFat) {
+		return nil, nil, err
+	}
+	f, err := macho.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+// objCImage reads the Objective-C metadata of a 64 bit Mach-O image that is not loaded yet
+type objCImage struct {
+	f *macho.File
+	// chained is true if pointers are encoded as chained fixups
+	chained bool
+	// base is the address of the __TEXT segment, chained rebases can be relative to it
+	base     uint64
+	sections map[*macho.Section][]byte
+}
+
+// objCClass is a class of the image with the names of its test methods
+type objCClass struct {
+	name       string
+	superclass uint64
+	tests      []string
+}
+
+func newObjCImage(f *macho.File) *objCImage {
+	image := &objCImage{f: f, sections: map[*macho.Section][]byte{}}
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) >= 4 && macho.LoadCmd(f.ByteOrder.Uint32(raw)) == loadCmdDyldChainedFixups {
+			image.chained = true
+		}
+	}
+	if text := f.Segment("__TEXT"); text != nil {
+		image.base = text.Addr
+	}
+	return image
+}
+
+func (m *objCImage) tests() ([]string, error) {
+	if m.f.Magic != macho.Magic64 {
+		return nil, errors.New("only 64 bit binaries are supported")
+	}
+	classList := m.f.Section("__objc_classlist")
+	if classList == nil {
+		return nil, errors.New("binary has no Objective-C classes")
+	}
+	classes := map[uint64]*objCClass{}
+	for offset := uint64(0); offset+8 <= classList.Size; offset += 8 {
+		address, ok, err := m.pointer(classList.Addr + offset)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		class, err := m.class(address)
+		if err != nil {
+			return nil, err
+		}
+		classes[address] = class
+	}
+
+	var tests []string
+	for _, class := range classes {
+		seen := map[string]bool{}
+		// tests of superclasses in the image are inherited, the depth limits damaged class chains
+		for c, depth := class, 0; c != nil && depth < len(classes); c, depth = classes[c.superclass], depth+1 {
+			for _, test := range c.tests {
+				if !seen[test] {
+					seen[test] = true
+					tests = append(tests, class.name+"/"+test)
+				}
+			}
+		}
+	}
+	sort.Strings(tests)
+	return tests, nil
+}
+
+// class reads the class_t at address
+func (m *objCImage) class(address uint64) (*objCClass, error) {
+	superclass, _, err := m.pointer(address + 8)
+	if err != nil {
+		return nil, err
+	}
+	ro, ok, err := m.pointer(address + 32)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("class at %#x has no data", address)
+	}
+	// the low bits of the data pointer are flags, like the one of Swift classes
+	ro &^= 7
+	namePointer, ok, err := m.pointer(ro + 24)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("class at %#x has no name", address)
+	}
+	name, err := m.cString(namePointer)
+	if err != nil {
+		return nil, err
+	}
+	class := &objCClass{name: swiftClassName(name), superclass: superclass}
+	methods, ok, err := m.pointer(ro + 32)
+	if err != nil || !ok {
+		return class, err
+	}
+	class.tests, err = m.testMethods(methods)
+	if err != nil {
+		return nil, fmt.Errorf("class %s: %w", class.name, err)
+	}
+	return class, nil
+}
+
+// testMethods reads the method_list_t at address and returns the names of the test methods
+func (m *objCImage) testMethods(address uint64) ([]string, error) {
+	header, err := m.read(address, 8)
+	if err != nil {
+		return nil, err
+	}
+	flags := m.f.ByteOrder.Uint32(header)
+	count := m.f.ByteOrder.Uint32(header[4:])
+	size := uint64(flags & 0xfffc)
+	if count > maxObjCListCount || size == 0 {
+		return nil, fmt.Errorf("invalid method list at %#x", address)
+	}
+	var tests []string
+	for i := uint64(0); i < uint64(count); i++ {
+		entry := address + 8 + i*size
+		var selector, types string
+		if flags&smallMethodListFlag != 0 {
+			selector, types, err = m.relativeMethod(entry)
+		} else {
+			selector, types, err = m.absoluteMethod(entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if test, ok := testName(selector, types); ok {
+			tests = append(tests, test)
+		}
+	}
+	return tests, nil
+}
+
+// relativeMethod reads a method with offsets relative to the entry, the name points to a selector reference
+func (m *objCImage) relativeMethod(entry uint64) (string, string, error) {
+	offsets, err := m.read(entry, 8)
+	if err != nil {
+		return "", "", err
+	}
+	nameOffset := int64(int32(m.f.ByteOrder.Uint32(offsets)))
+	typesOffset := int64(int32(m.f.ByteOrder.Uint32(offsets[4:])))
+	selectorRef, ok, err := m.pointer(uint64(int64(entry) + nameOffset))
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("method at %#x has no selector", entry)
+	}
+	selector, err := m.cString(selectorRef)
+	if err != nil {
+		return "", "", err
+	}
+	types, err := m.cString(uint64(int64(entry) + 4 + typesOffset))
+	return selector, types, err
+}
+
+func (m *objCImage) absoluteMethod(entry uint64) (string, string, error) {
+	selectorPointer, ok, err := m.pointer(entry)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("method at %#x has no selector", entry)
+	}
+	selector, err := m.cString(selectorPointer)
+	if err != nil {
+		return "", "", err
+	}
+	typesPointer, ok, err := m.pointer(entry + 8)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("method at %#x has no types", entry)
+	}
+	types, err := m.cString(typesPointer)
+	return selector, types, err
+}
+
+// testName returns the name of the test XCTest runs for a method. Swift exposes throwing
+// and async methods to Objective-C with an error or completion handler argument.
+func testName(selector string, types string) (string, bool) {
+	if !strings.HasPrefix(selector, "test") {
+		return "", false
+	}
+	for _, suffix := range []string{"AndReturnError:", "WithCompletionHandler:"} {
+		if name, ok := strings.CutSuffix(selector, suffix); ok && !strings.Contains(name, ":") {
+			return name, true
+		}
+	}
+	return selector, !strings.Contains(selector, ":") && strings.HasPrefix(types, "v")
+}
+
+// swiftClassName returns the name of a Swift class without its module, like XCTest reports
+// it. Other names are returned unchanged.
+func swiftClassName(name string) string {
+	rest, ok := strings.CutPrefix(name, "_TtC")
+	if !ok {
+		return name
+	}
+	var parts []string
+	for len(rest) > 0 {
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		length, err := strconv.Atoi(rest[:digits])
+		if err != nil || length == 0 || digits+length > len(rest) {
+			return name
+		}
+		parts = append(parts, rest[digits:digits+length])
+		rest = rest[digits+length:]
+	}
+	if len(parts) != 2 {
+		return name
+	}
+	return parts[1]
+}
+
+// pointer reads the pointer at address. ok is false for null pointers and pointers to other
+// images, which are bound when the image is loaded.
+func (m *objCImage) pointer(address uint64) (uint64, bool, error) {
+	data, err := m.read(address, 8)
+	if err != nil {
+		return 0, false, err
+	}
+	raw := m.f.ByteOrder.Uint64(data)
+	if raw == 0 {
+		return 0, false, nil
+	}
+	if !m.chained {
+		return raw, true, nil
+	}
+	// DYLD_CHAINED_PTR_64 and DYLD_CHAINED_PTR_64_OFFSET: binds have the highest bit set,
+	// rebases have a 36 bit target that is either an address or an offset from the image base
+	if raw>>63 == 1 {
+		return 0, false, nil
+	}
+	target := raw & (1<<36 - 1)
+	if target < m.base {
+		target += m.base
+	}
+	return target, true, nil
+}
+
+// read returns n bytes at address
+func (m *objCImage) read(address uint64, n int) ([]byte, error) {
+	data, err := m.data(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < n {
+		return nil, fmt.Errorf("%d bytes at %#x exceed their section", n, address)
+	}
+	return data[:n], nil
+}
+
+// cString reads the null terminated string at address
+func (m *objCImage) cString(address uint64) (string, error) {
+	data, err := m.data(address)
+	if err != nil {
+		return "", err
+	}
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", fmt.Errorf("string at %#x is not terminated", address)
+	}
+	return string(data[:end]), nil
+}
+
+// data returns the bytes from address to the end of its section
+func (m *objCImage) data(address uint64) ([]byte, error) {
+	for _, s := range m.f.Sections {
+		// zero fill sections have no data in the file
+		if s.Flags&0xff == 1 || address < s.Addr || address >= s.Addr+s.Size {
+			continue
+		}
+		data, ok := m.sections[s]
+		if !ok {
+			var err error
+			if data, err = s.Data(); err != nil {
+				return nil, err
+			}
+			m.sections[s] = data
+		}
+		return data[address-s.Addr:], nil
+	}
+	return nil, fmt.Errorf("address %#x is not in a section", address)
+}
@@ -0,0 +1,251 @@
+package testmanagerd
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objCFixture builds a Mach-O bundle with the Objective-C metadata of classes, either with
+// chained fixups and relative method lists like current toolchains or with plain pointers
+type objCFixture struct {
+	chained bool
+	data    []byte
+}
+
+// fixtureClass is a class of the fixture, superclass is the index of a class built
+// before or -1 for a class of another image like XCTestCase
+type fixtureClass struct {
+	name       string
+	superclass int
+	swift      bool
+	// methods are pairs of selector and type encoding
+	methods [][2]string
+}
+
+// fixtureDataAddress is the address and file offset of the Objective-C data
+const fixtureDataAddress = 0x1000
+
+func (b *objCFixture) address() uint64 {
+	return fixtureDataAddress + uint64(len(b.data))
+}
+
+func (b *objCFixture) align() {
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+func (b *objCFixture) cString(s string) uint64 {
+	address := b.address()
+	b.data = append(append(b.data, s...), 0)
+	return address
+}
+
+func (b *objCFixture) uint32(v uint32) {
+	b.data = binary.LittleEndian.AppendUint32(b.data, v)
+}
+
+func (b *objCFixture) pointer(target uint64) {
+	b.data = binary.LittleEndian.AppendUint64(b.data, target)
+}
+
+// bind adds a pointer to another image
+func (b *objCFixture) bind() {
+	if b.chained {
+		b.pointer(1 << 63)
+		return
+	}
+	b.pointer(0)
+}
+
+func (b *objCFixture) methodList(methods [][2]string) uint64 {
+	selectors := make([]uint64, len(methods))
+	types := make([]uint64, len(methods))
+	for i, method := range methods {
+		selectors[i] = b.cString(method[0])
+		types[i] = b.cString(method[1])
+	}
+	b.align()
+	if !b.chained {
+		list := b.address()
+		b.uint32(24)
+		b.uint32(uint32(len(methods)))
+		for i := range methods {
+			b.pointer(selectors[i])
+			b.pointer(types[i])
+			b.pointer(0)
+		}
+		return list
+	}
+	selectorRefs := make([]uint64, len(methods))
+	for i := range methods {
+		selectorRefs[i] = b.address()
+		b.pointer(selectors[i])
+	}
+	list := b.address()
+	b.uint32(12 | smallMethodListFlag)
+	b.uint32(uint32(len(methods)))
+	for i := range methods {
+		entry := b.address()
+		b.uint32(uint32(int32(int64(selectorRefs[i]) - int64(entry))))
+		b.uint32(uint32(int32(int64(types[i]) - int64(entry+4))))
+		b.uint32(0)
+	}
+	return list
+}
+
+func (b *objCFixture) class(class fixtureClass, built []uint64) uint64 {
+	name := b.cString(class.name)
+	methods := b.methodList(class.methods)
+	b.align()
+	ro := b.address()
+	b.data = append(b.data, make([]byte, 24)...)
+	b.pointer(name)
+	b.pointer(methods)
+	b.data = append(b.data, make([]byte, 40)...)
+
+	address := b.address()
+	b.bind()
+	if class.superclass < 0 {
+		b.bind()
+	} else {
+		b.pointer(built[class.superclass])
+	}
+	b.pointer(0)
+	b.pointer(0)
+	if class.swift {
+		ro |= 2
+	}
+	b.pointer(ro)
+	return address
+}
+
+// build returns the Mach-O file with a class list of all classes
+func (b *objCFixture) build(classes []fixtureClass) []byte {
+	built := make([]uint64, len(classes))
+	for i, class := range classes {
+		built[i] = b.class(class, built)
+	}
+	b.align()
+	dataSize := uint64(len(b.data))
+	for _, class := range built {
+		b.pointer(class)
+	}
+
+	type section struct {
+		name          string
+		address, size uint64
+	}
+	sections := []section{
+		{"__objc_data", fixtureDataAddress, dataSize},
+		{"__objc_classlist", fixtureDataAddress + dataSize, uint64(len(b.data)) - dataSize},
+	}
+	name := func(s string) []byte {
+		return append([]byte(s), make([]byte, 16-len(s))...)
+	}
+	var commands []byte
+	commands = binary.LittleEndian.AppendUint32(commands, 0x19)
+	commands = binary.LittleEndian.AppendUint32(commands, uint32(72+80*len(sections)))
+	commands = append(commands, name("__DATA")...)
+	for _, v := range []uint64{fixtureDataAddress, uint64(len(b.data)), fixtureDataAddress, uint64(len(b.data))} {
+		commands = binary.LittleEndian.AppendUint64(commands, v)
+	}
+	for _, v := range []uint32{3, 3, uint32(len(sections)), 0} {
+		commands = binary.LittleEndian.AppendUint32(commands, v)
+	}
+	for _, s := range sections {
+		commands = append(commands, name(s.name)...)
+		commands = append(commands, name("__DATA")...)
+		commands = binary.LittleEndian.AppendUint64(commands, s.address)
+		commands = binary.LittleEndian.AppendUint64(commands, s.size)
+		for _, v := range []uint32{uint32(s.address), 3, 0, 0, 0, 0, 0, 0} {
+			commands = binary.LittleEndian.AppendUint32(commands, v)
+		}
+	}
+	ncmds := uint32(1)
+	if b.chained {
+		ncmds++
+		for _, v := range []uint32{uint32(loadCmdDyldChainedFixups), 16, 0, 0} {
+			commands = binary.LittleEndian.AppendUint32(commands, v)
+		}
+	}
+
+	var file []byte
+	// MH_MAGIC_64, CPU_TYPE_ARM64 and MH_BUNDLE
+	for _, v := range []uint32{0xfeedfacf, 0x0100000c, 0, 8, ncmds, uint32(len(commands)), 0, 0} {
+		file = binary.LittleEndian.AppendUint32(file, v)
+	}
+	file = append(file, commands...)
+	file = append(file, make([]byte, fixtureDataAddress-len(file))...)
+	return append(file, b.data...)
+}
+
+var fixtureClasses = []fixtureClass{
+	{name: "BaseTests", superclass: -1, methods: [][2]string{
+		{"testShared", "v16@0:8"},
+		{"setUp", "v16@0:8"},
+	}},
+	{name: "_TtC8AppTests10LoginTests", superclass: 0, swift: true, methods: [][2]string{
+		{"testLogin", "v16@0:8"},
+		{"testThrowsAndReturnError:", "B24@0:8^@16"},
+		{"testAsyncWithCompletionHandler:", "v24@0:8@?16"},
+		{"testWithArgument:", "v24@0:8@16"},
+		{"testReturnsValue", "@16@0:8"},
+	}},
+	{name: "Helper", superclass: -1, methods: [][2]string{{"run", "v16@0:8"}}},
+}
+
+func TestListBundleTests(t *testing.T) {
+	expected := []string{"BaseTests/testShared", "LoginTests/testAsync", "LoginTests/testLogin", "LoginTests/testShared", "LoginTests/testThrows"}
+	for name, chained := range map[string]bool{"chained fixups": true, "pointers": false} {
+		t.Run(name, func(t *testing.T) {
+			bundle := filepath.Join(t.TempDir(), "AppTests.xctest")
+			require.NoError(t, os.Mkdir(bundle, 0o755))
+			fixture := &objCFixture{chained: chained}
+			require.NoError(t, os.WriteFile(filepath.Join(bundle, "AppTests"), fixture.build(fixtureClasses), 0o644))
+
+			tests, err := ListBundleTests(bundle)
+			require.NoError(t, err)
+			assert.Equal(t, expected, tests)
+		})
+	}
+
+	t.Run("runner app with executable in Info.plist", func(t *testing.T) {
+		app := filepath.Join(t.TempDir(), "AppTests-Runner.app")
+		bundle := filepath.Join(app, "PlugIns", "AppTests.xctest")
+		require.NoError(t, os.MkdirAll(bundle, 0o755))
+		info := `<plist version="1.0"><dict><key>CFBundleExecutable</key><string>Tests</string></dict></plist>`
+		require.NoError(t, os.WriteFile(filepath.Join(bundle, "Info.plist"), []byte(info), 0o644))
+		fixture := &objCFixture{chained: true}
+		require.NoError(t, os.WriteFile(filepath.Join(bundle, "Tests"), fixture.build(fixtureClasses), 0o644))
+
+		tests, err := ListBundleTests(app)
+		require.NoError(t, err)
+		assert.Equal(t, expected, tests)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := ListBundleTests(filepath.Join(dir, "Missing.xctest"))
+		assert.Error(t, err)
+		notMachO := filepath.Join(dir, "AppTests")
+		require.NoError(t, os.WriteFile(notMachO, []byte("not a binary"), 0o644))
+		_, err = ListBundleTests(notMachO)
+		assert.Error(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "Empty.app", "PlugIns"), 0o755))
+		_, err = ListBundleTests(filepath.Join(dir, "Empty.app"))
+		assert.ErrorContains(t, err, "0 test bundles")
+	})
+}
+
+func TestSwiftClassName(t *testing.T) {
+	assert.Equal(t, "LoginTests", swiftClassName("_TtC8AppTests10LoginTests"))
+	assert.Equal(t, "ObjCTests", swiftClassName("ObjCTests"))
+	assert.Equal(t, "_TtCC8AppTests5Outer5Inner", swiftClassName("_TtCC8AppTests5Outer5Inner"))
+	assert.Equal(t, "_TtC8AppTests99Broken", swiftClassName("_TtC8AppTests99Broken"))
+}
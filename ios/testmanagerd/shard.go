@@ -0,0 +1,415 @@
+package testmanagerd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/golog"
+)
+
+// ShardStrategy decides how ShardTests splits tests between devices
+type ShardStrategy string
+
+const (
+	// ShardByClass keeps the tests of a class together and balances the number of tests
+	ShardByClass = ShardStrategy("by-class")
+	// ShardByTest spreads single tests and balances the number of tests
+	ShardByTest = ShardStrategy("by-test")
+	// ShardByDuration keeps the tests of a class together and balances how long the
+	// classes took in previous runs
+	ShardByDuration = ShardStrategy("by-duration")
+)
+
+// defaultMaxAttempts is how often a shard is started when its devices keep disconnecting
+const defaultMaxAttempts = 3
+
+// ParseShardStrategy returns the ShardStrategy named s
+func ParseShardStrategy(s string) (ShardStrategy, error) {
+	switch strategy := ShardStrategy(s); strategy {
+	case ShardByClass, ShardByTest, ShardByDuration:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown shard strategy %q, use %s, %s or %s", s, ShardByClass, ShardByTest, ShardByDuration)
+}
+
+// ShardTests splits tests, in the format of TestConfig.TestsToRun, into at most count shards.
+// Tests in testsToSkip are left out, [ListBundleTests] lists all tests of a test bundle.
+// history contains the results of previous runs, it is only used to weigh the tests, so
+// tests that are not in history are run as well. The selectors of a shard can be passed
+// as TestsToRun of a TestConfig.
+func ShardTests(tests []string, testsToSkip []string, history []TestSuite, strategy ShardStrategy, count int) ([][]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("ShardTests: cannot split tests into %d shards", count)
+	}
+	if _, err := ParseShardStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+	durations := historicalDurations(history)
+	tests = slices.DeleteFunc(slices.Clone(tests), func(test string) bool {
+		class, method := parseTestSelector(test)
+		return isSkipped(testsToSkip, class, method)
+	})
+	if len(tests) == 0 {
+		return nil, errors.New("ShardTests: no tests to shard")
+	}
+
+	units := shardUnits(tests, strategy, durations)
+	totals := make([]float64, count)
+	shards := make([][]string, count)
+	for _, unit := range units {
+		shortest := 0
+		for i := range totals {
+			if totals[i] < totals[shortest] {
+				shortest = i
+			}
+		}
+		totals[shortest] += unit.weight
+		shards[shortest] = append(shards[shortest], unit.selectors...)
+	}
+
+	result := make([][]string, 0, count)
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			result = append(result, shard)
+		}
+	}
+	return result, nil
+}
+
+// shardUnit contains selectors that are run on the same device
+type shardUnit struct {
+	key       string
+	selectors []string
+	weight    float64
+}
+
+// shardUnits groups tests by their class for ShardByClass and ShardByDuration and sorts the
+// units by descending weight, which is the number of tests or the duration of previous runs
+func shardUnits(tests []string, strategy ShardStrategy, durations testDurations) []shardUnit {
+	byKey := map[string]*shardUnit{}
+	var units []*shardUnit
+	for _, test := range tests {
+		class, method := parseTestSelector(test)
+		key := class
+		if strategy == ShardByTest && method != "" {
+			key = class + "/" + method
+		}
+		unit, ok := byKey[key]
+		if !ok {
+			unit = &shardUnit{key: key}
+			byKey[key] = unit
+			units = append(units, unit)
+		}
+		unit.selectors = append(unit.selectors, test)
+		if strategy == ShardByDuration {
+			unit.weight += durations.of(class, method).Seconds()
+		} else {
+			unit.weight += float64(max(durations.count(class, method), 1))
+		}
+	}
+
+	if strategy == ShardByDuration {
+		// classes that never ran take as long as an average class
+		var known, total float64
+		for _, unit := range units {
+			if unit.weight > 0 {
+				known++
+				total += unit.weight
+			}
+		}
+		average := 1.0
+		if known > 0 {
+			average = total / known
+		}
+		for _, unit := range units {
+			if unit.weight == 0 {
+				unit.weight = average
+			}
+		}
+	}
+
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].weight != units[j].weight {
+			return units[i].weight > units[j].weight
+		}
+		return units[i].key < units[j].key
+	})
+	result := make([]shardUnit, len(units))
+	for i, unit := range units {
+		result[i] = *unit
+	}
+	return result
+}
+
+// parseTestSelector splits a selector like (TestTarget.)TestClass(/testMethod) into the
+// class without the target and the method
+func parseTestSelector(selector string) (string, string) {
+	class, method, _ := strings.Cut(selector, "/")
+	return trimTestTarget(class), method
+}
+
+func trimTestTarget(class string) string {
+	if i := strings.LastIndex(class, "."); i >= 0 {
+		return class[i+1:]
+	}
+	return class
+}
+
+func isSkipped(testsToSkip []string, class string, method string) bool {
+	for _, skip := range testsToSkip {
+		skipClass, skipMethod := parseTestSelector(skip)
+		if skipClass == class && (skipMethod == "" || skipMethod == method) {
+			return true
+		}
+	}
+	return false
+}
+
+// testDurations has the average duration and the number of runs of tests by class and method
+type testDurations map[string]map[string]testDuration
+
+type testDuration struct {
+	total time.Duration
+	runs  int
+}
+
+func historicalDurations(history []TestSuite) testDurations {
+	durations := testDurations{}
+	for _, suite := range history {
+		for _, testCase := range suite.TestCases {
+			class := trimTestTarget(testCase.ClassName)
+			if durations[class] == nil {
+				durations[class] = map[string]testDuration{}
+			}
+			d := durations[class][testCase.MethodName]
+			d.total += testCase.Duration
+			d.runs++
+			durations[class][testCase.MethodName] = d
+		}
+	}
+	return durations
+}
+
+// of returns the average duration of a test, or the sum of the averages of all tests of
+// class if method is empty
+func (d testDurations) of(class string, method string) time.Duration {
+	var total time.Duration
+	for name, duration := range d[class] {
+		if method == "" || name == method {
+			total += duration.total / time.Duration(duration.runs)
+		}
+	}
+	return total
+}
+
+// count returns the number of known tests of class or 1 for a known method
+func (d testDurations) count(class string, method string) int {
+	if method != "" {
+		if _, ok := d[class][method]; ok {
+			return 1
+		}
+		return 0
+	}
+	return len(d[class])
+}
+
+// ShardedTestConfig configures RunShardedTests
+type ShardedTestConfig struct {
+	// Config is used for all shards, Device, TestsToRun and Listener are set per shard run
+	Config TestConfig
+	// Devices run the shards, one shard at a time each
+	Devices []ios.DeviceEntry
+	// Shards contains the TestsToRun of every shard, see ShardTests
+	Shards [][]string
+	// NewListener creates the listener of a shard run on device. Without it, logs
+	// of the test runs are discarded.
+	NewListener func(device ios.DeviceEntry) *TestListener
+	// MaxAttempts is how often a shard is started when its device disconnects while
+	// running it, defaults to 3
+	MaxAttempts int
+}
+
+// RunShardedTests runs the shards of config concurrently on its devices. A shard whose
+// device disconnects is run again on one of the other devices and the disconnected device
+// is not used anymore. The results of all shards are merged with MergeTestSuites. Errors
+// of shards are joined, the results of all other shards are returned anyway.
+func RunShardedTests(ctx context.Context, config ShardedTestConfig) ([]TestSuite, error) {
+	return runShards(ctx, config, RunTestWithConfig, deviceConnected)
+}
+
+func deviceConnected(device ios.DeviceEntry) bool {
+	_, err := ios.GetDevice(device.Properties.SerialNumber)
+	return err == nil
+}
+
+type shardRun struct {
+	index   int
+	attempt int
+}
+
+// shardQueue hands out shards to the devices until all of them finished
+type shardQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []shardRun
+	running int
+}
+
+func newShardQueue(shards int) *shardQueue {
+	q := &shardQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	for i := 0; i < shards; i++ {
+		q.pending = append(q.pending, shardRun{index: i, attempt: 1})
+	}
+	return q
+}
+
+// next waits for a shard to run and returns false when there is none left
+func (q *shardQueue) next(ctx context.Context) (shardRun, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && q.running > 0 {
+		q.cond.Wait()
+	}
+	if len(q.pending) == 0 || ctx.Err() != nil {
+		return shardRun{}, false
+	}
+	run := q.pending[0]
+	q.pending = q.pending[1:]
+	q.running++
+	return run, true
+}
+
+func (q *shardQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.cond.Broadcast()
+}
+
+func (q *shardQueue) retry(run shardRun) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.pending = append(q.pending, shardRun{index: run.index, attempt: run.attempt + 1})
+	q.cond.Broadcast()
+}
+
+func (q *shardQueue) remaining() []shardRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+func runShards(
+	ctx context.Context,
+	config ShardedTestConfig,
+	runTest func(context.Context, TestConfig) ([]TestSuite, error),
+	connected func(ios.DeviceEntry) bool,
+) ([]TestSuite, error) {
+	if len(config.Devices) == 0 {
+		return nil, errors.New("RunShardedTests: no devices to run the tests on")
+	}
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	newListener := config.NewListener
+	if newListener == nil {
+		newListener = func(ios.DeviceEntry) *TestListener {
+			return NewTestListener(io.Discard, io.Discard, os.TempDir())
+		}
+	}
+
+	queue := newShardQueue(len(config.Shards))
+	results := make([][]TestSuite, len(config.Shards))
+	var errMutex sync.Mutex
+	var errs []error
+	addError := func(err error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		errs = append(errs, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, device := range config.Devices {
+		wg.Add(1)
+		go func(device ios.DeviceEntry) {
+			defer wg.Done()
+			udid := device.Properties.SerialNumber
+			for {
+				run, ok := queue.next(ctx)
+				if !ok {
+					return
+				}
+				testConfig := config.Config
+				testConfig.Device = device
+				testConfig.TestsToRun = config.Shards[run.index]
+				testConfig.Listener = newListener(device)
+				golog.Info("running test shard", "module", logModule, "shard", run.index, "attempt", run.attempt, "udid", udid, "tests", len(testConfig.TestsToRun))
+				suites, err := runTest(ctx, testConfig)
+				if err != nil && ctx.Err() == nil && !connected(device) {
+					if run.attempt < maxAttempts {
+						golog.Warn("device disconnected while running a test shard, running it on another device", "module", logModule, "shard", run.index, "udid", udid, "error", err)
+						queue.retry(run)
+					} else {
+						addError(fmt.Errorf("shard %d: device %s disconnected on attempt %d: %w", run.index, udid, run.attempt, err))
+						queue.done()
+					}
+					return
+				}
+				if err != nil {
+					addError(fmt.Errorf("shard %d on device %s: %w", run.index, udid, err))
+				}
+				results[run.index] = suites
+				queue.done()
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	for _, run := range queue.remaining() {
+		addError(fmt.Errorf("shard %d was not run: %w", run.index, cmp.Or(ctx.Err(), errors.New("all devices disconnected"))))
+	}
+	return MergeTestSuites(results...), errors.Join(errs...)
+}
+
+// MergeTestSuites combines the results of several test runs. Suites with the same name
+// are merged into one suite with the test cases of all of them, suites keep the order in
+// which they appear first.
+func MergeTestSuites(results ...[]TestSuite) []TestSuite {
+	merged := []TestSuite{}
+	byName := map[string]int{}
+	for _, suites := range results {
+		for _, suite := range suites {
+			i, ok := byName[suite.Name]
+			if !ok {
+				byName[suite.Name] = len(merged)
+				suite.TestCases = append([]TestCase{}, suite.TestCases...)
+				merged = append(merged, suite)
+				continue
+			}
+			m := &merged[i]
+			m.TestCases = append(m.TestCases, suite.TestCases...)
+			m.TestDuration += suite.TestDuration
+			m.TotalDuration += suite.TotalDuration
+			if m.StartDate.IsZero() || (!suite.StartDate.IsZero() && suite.StartDate.Before(m.StartDate)) {
+				m.StartDate = suite.StartDate
+			}
+			if suite.EndDate.After(m.EndDate) {
+				m.EndDate = suite.EndDate
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,198 @@
+package testmanagerd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func previousRun(durations map[string]time.Duration) []TestSuite {
+	suite := TestSuite{Name: "ExampleUITests"}
+	for test, duration := range durations {
+		class, method := parseTestSelector(test)
+		suite.TestCases = append(suite.TestCases, TestCase{ClassName: class, MethodName: method, Status: StatusPassed, Duration: duration})
+	}
+	return []TestSuite{suite}
+}
+
+func TestShardTests(t *testing.T) {
+	t.Run("by class keeps classes together", func(t *testing.T) {
+		shards, err := ShardTests([]string{"App.Login/testA", "Settings", "App.Login/testB", "Search/testC"}, nil, nil, ShardByClass, 2)
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"App.Login/testA", "App.Login/testB"}, {"Search/testC", "Settings"}}, shards)
+	})
+
+	t.Run("by test spreads tests of a class", func(t *testing.T) {
+		shards, err := ShardTests([]string{"Login/testA", "Login/testB", "Login/testC"}, nil, nil, ShardByTest, 2)
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"Login/testA", "Login/testC"}, {"Login/testB"}}, shards)
+	})
+
+	t.Run("by duration balances previous runs", func(t *testing.T) {
+		previous := previousRun(map[string]time.Duration{
+			"Login/testA":    40 * time.Second,
+			"Login/testB":    20 * time.Second,
+			"Search/testA":   50 * time.Second,
+			"Settings/testA": 10 * time.Second,
+			"Profile/testA":  5 * time.Second,
+		})
+		shards, err := ShardTests([]string{"Login", "Search", "Settings", "Profile"}, []string{"Profile"}, previous, ShardByDuration, 2)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"Login"}, {"Search", "Settings"}}, shards)
+
+		// NewTests never ran, it counts as an average class
+		shards, err = ShardTests([]string{"Login", "Search", "Settings", "NewTests"}, nil, previous, ShardByDuration, 2)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"Login", "Settings"}, {"Search", "NewTests"}}, shards)
+	})
+
+	t.Run("history only weighs tests", func(t *testing.T) {
+		previous := previousRun(map[string]time.Duration{"Login/testA": time.Second, "Login/testB": time.Second, "Removed/testA": time.Second})
+		shards, err := ShardTests([]string{"Login/testA", "Login/testB", "Login/testC"}, []string{"Login/testB"}, previous, ShardByTest, 3)
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"Login/testA"}, {"Login/testC"}}, shards, "new tests are run, skipped and removed tests are not")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ShardTests(nil, nil, previousRun(map[string]time.Duration{"Login/testA": time.Second}), ShardByClass, 2)
+		assert.Error(t, err)
+		_, err = ShardTests([]string{"Login/testA"}, []string{"Login"}, nil, ShardByClass, 2)
+		assert.Error(t, err)
+		_, err = ShardTests([]string{"Login"}, nil, nil, ShardStrategy("random"), 2)
+		assert.Error(t, err)
+		_, err = ShardTests([]string{"Login"}, nil, nil, ShardByClass, 0)
+		assert.Error(t, err)
+	})
+}
+
+func shardDevice(udid string) ios.DeviceEntry {
+	return ios.DeviceEntry{Properties: ios.DeviceProperties{SerialNumber: udid}}
+}
+
+// fakeDevices runs shards by reporting a passed test case for every test to run.
+// Devices in disconnecting fail their first run and disconnect, the other devices
+// wait for that so every disconnecting device gets a shard.
+type fakeDevices struct {
+	mu              sync.Mutex
+	disconnecting   map[string]bool
+	disconnected    map[string]bool
+	allDisconnected chan struct{}
+	runs            map[string][]string
+}
+
+func (f *fakeDevices) run(_ context.Context, config TestConfig) ([]TestSuite, error) {
+	udid := config.Device.Properties.SerialNumber
+	f.mu.Lock()
+	f.runs[udid] = append(f.runs[udid], config.TestsToRun...)
+	if f.disconnecting[udid] {
+		f.disconnected[udid] = true
+		if len(f.disconnected) == len(f.disconnecting) {
+			close(f.allDisconnected)
+		}
+		f.mu.Unlock()
+		return []TestSuite{{Name: "Partial"}}, errors.New("connection reset")
+	}
+	f.mu.Unlock()
+	<-f.allDisconnected
+
+	suite := TestSuite{Name: "ExampleUITests", TestDuration: time.Second}
+	for _, test := range config.TestsToRun {
+		suite.TestCases = append(suite.TestCases, TestCase{ClassName: test, MethodName: "test", Status: StatusPassed})
+	}
+	return []TestSuite{suite}, nil
+}
+
+func (f *fakeDevices) connected(device ios.DeviceEntry) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.disconnected[device.Properties.SerialNumber]
+}
+
+func newFakeDevices(disconnecting ...string) *fakeDevices {
+	f := &fakeDevices{
+		disconnecting:   map[string]bool{},
+		disconnected:    map[string]bool{},
+		allDisconnected: make(chan struct{}),
+		runs:            map[string][]string{},
+	}
+	for _, udid := range disconnecting {
+		f.disconnecting[udid] = true
+	}
+	if len(disconnecting) == 0 {
+		close(f.allDisconnected)
+	}
+	return f
+}
+
+func TestRunShards(t *testing.T) {
+	shards := [][]string{{"Login"}, {"Search"}, {"Settings"}, {"Profile"}}
+
+	t.Run("retries shards of disconnected devices", func(t *testing.T) {
+		devices := newFakeDevices("b")
+		suites, err := runShards(context.Background(), ShardedTestConfig{
+			Devices: []ios.DeviceEntry{shardDevice("a"), shardDevice("b")},
+			Shards:  shards,
+		}, devices.run, devices.connected)
+		require.NoError(t, err)
+
+		require.Len(t, suites, 1, "suites of interrupted runs are dropped")
+		assert.Equal(t, "ExampleUITests", suites[0].Name)
+		assert.Equal(t, 4*time.Second, suites[0].TestDuration)
+		var classes []string
+		for _, testCase := range suites[0].TestCases {
+			classes = append(classes, testCase.ClassName)
+		}
+		assert.Equal(t, []string{"Login", "Search", "Settings", "Profile"}, classes, "results are in shard order")
+		assert.Len(t, devices.runs["b"], 1)
+		assert.ElementsMatch(t, []string{"Login", "Search", "Settings", "Profile"}, devices.runs["a"])
+	})
+
+	t.Run("gives up when all devices disconnect", func(t *testing.T) {
+		devices := newFakeDevices("a", "b")
+		suites, err := runShards(context.Background(), ShardedTestConfig{
+			Devices: []ios.DeviceEntry{shardDevice("a"), shardDevice("b")},
+			Shards:  shards,
+		}, devices.run, devices.connected)
+		assert.Error(t, err)
+		assert.Empty(t, suites)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		devices := newFakeDevices("a", "b")
+		_, err := runShards(context.Background(), ShardedTestConfig{
+			Devices:     []ios.DeviceEntry{shardDevice("a"), shardDevice("b")},
+			Shards:      [][]string{{"Login"}},
+			MaxAttempts: 2,
+		}, devices.run, devices.connected)
+		assert.ErrorContains(t, err, "attempt 2")
+	})
+
+	t.Run("no devices", func(t *testing.T) {
+		_, err := runShards(context.Background(), ShardedTestConfig{Shards: shards}, nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestMergeTestSuites(t *testing.T) {
+	start := time.Date(2026, 8, 5, 10, 30, 0, 0, time.UTC)
+	merged := MergeTestSuites(
+		[]TestSuite{
+			{Name: "All tests", StartDate: start.Add(time.Minute), EndDate: start.Add(2 * time.Minute), TestDuration: time.Minute, TestCases: []TestCase{{ClassName: "Login"}}},
+		},
+		nil,
+		[]TestSuite{
+			{Name: "All tests", StartDate: start, EndDate: start.Add(time.Minute), TestDuration: time.Minute, TestCases: []TestCase{{ClassName: "Search"}}},
+			{Name: "Other", TestCases: []TestCase{{ClassName: "Other"}}},
+		},
+	)
+	assert.Equal(t, []TestSuite{
+		{Name: "All tests", StartDate: start, EndDate: start.Add(2 * time.Minute), TestDuration: 2 * time.Minute, TestCases: []TestCase{{ClassName: "Login"}, {ClassName: "Search"}}},
+		{Name: "Other", TestCases: []TestCase{{ClassName: "Other"}}},
+	}, merged)
+}
@@ -25,6 +25,9 @@ type TestListener struct {
 	attachmentsDirectory string
 	TestSuites           []TestSuite
 	runningTestSuite     *TestSuite
+	// OnTestFailure is called whenever a test case reports a failure or stalls,
+	// while the test run is still going. A test case can report several failures.
+	OnTestFailure func(testCase TestCase)
 }
 
 type TestSuite struct {
@@ -119,6 +122,7 @@ func (t *TestListener) testCaseStalled(testClass string, method string, file str
 			File:    file,
 			Line:    line,
 		}
+		t.testFailed(*testCase)
 	}
 }
 
@@ -249,6 +253,13 @@ func (t *TestListener) testCaseFailedForClass(testClass string, testMethod strin
 		File:    file,
 		Line:    line,
 	}
+	t.testFailed(*testCase)
+}
+
+func (t *TestListener) testFailed(testCase TestCase) {
+	if t.OnTestFailure != nil {
+		t.OnTestFailure(testCase)
+	}
 }
 
 func (t *TestListener) testCaseDidFinishForTest(testClass string, testMethod string, status string, duration float64) {
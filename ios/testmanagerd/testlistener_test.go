@@ -142,6 +142,25 @@ func TestFinishExecutingTestPlan(t *testing.T) {
 		assert.Equal(t, uint64(123), testListener.TestSuites[0].TestCases[0].Err.Line)
 	})
 
+	t.Run("Check test failure callback", func(t *testing.T) {
+		testListener := NewTestListener(io.Discard, io.Discard, os.TempDir())
+		var failed []TestCase
+		testListener.OnTestFailure = func(testCase TestCase) {
+			failed = append(failed, testCase)
+		}
+
+		testListener.testSuiteDidStart("mysuite", "2024-01-16 15:36:43 +0000")
+		testListener.testCaseDidStartForClass("mysuite", "mymethod")
+		testListener.testCaseFailedForClass("mysuite", "mymethod", "error", "file://app.swift", 123)
+		testListener.testCaseDidStartForClass("mysuite", "mymethod2")
+		testListener.testCaseStalled("mysuite", "mymethod2", "file://app.swift", 456)
+
+		assert.Equal(t, 2, len(failed))
+		assert.Equal(t, "mymethod", failed[0].MethodName)
+		assert.Equal(t, "error", failed[0].Err.Message)
+		assert.Equal(t, TestCaseStatus("stalled"), failed[1].Status)
+	})
+
 	t.Run("Check test case finish", func(t *testing.T) {
 		testListener := NewTestListener(io.Discard, io.Discard, os.TempDir())
 
@@ -40,6 +40,7 @@ import (
 	"github.com/danielpaulus/go-ios/ios/forward"
 	"github.com/danielpaulus/go-ios/ios/installationproxy"
 	"github.com/danielpaulus/go-ios/ios/instruments"
+	"github.com/danielpaulus/go-ios/ios/logship"
 	"github.com/danielpaulus/go-ios/ios/mcinstall"
 	"github.com/danielpaulus/go-ios/ios/notificationproxy"
 	"github.com/danielpaulus/go-ios/ios/ostrace"
@@ -70,15 +71,20 @@ Usage:
   ios --version | version [options]
   ios -h | --help
   ios activate [options]
+  ios appdata snapshot <bundleID> --output=<outfile> [--include=<glob>]... [--exclude=<glob>]... [--compress=<gzip|zstd>] [options]
+  ios appdata restore <bundleID> <file> [--include=<glob>]... [--exclude=<glob>]... [options]
   ios apps [--system] [--all] [--list] [--filesharing] [options]
   ios assistivetouch (enable | disable | toggle | get) [--force] [options]
   ios ax [--font=<fontSize>] [options]
   ios ax audit [options]
   ios batterycheck [options]
   ios batteryregistry [options]
-  ios crash cp <srcpattern> <target> [options]
-  ios crash ls [<pattern>] [options]
+  ios crash cp <srcpattern> <target> [--dsym=<dir>]... [options]
+  ios crash ls [<pattern>] [--details] [options]
   ios crash rm <cwd> <pattern> [options]
+  ios crash show <name> [options]
+  ios crash symbolicate <report> --dsym=<dir>... [--output=<outfile>] [options]
+  ios crash watch [--bundle-id=<bundleID>] [--exec=<cmd>] [--webhook=<url>] [--download=<dir>] [--state=<file>] [--interval=<seconds>] [options]
   ios date [options]
   ios debug [options] [--stop-at-entry] <app_path>
   ios devicename [options]
@@ -88,13 +94,22 @@ Usage:
   ios diagnostics list [options]
   ios diskspace [options]
   ios dproxy [--binary] [--mode=<all(default)|usbmuxd|utun>] [--iface=<iface>] [options]
+  ios dtx call --service=<service> --channel=<identifier> --selector=<selector> [--arg=<json>]... [options]
+  ios dtx listen --service=<service> --channel=<identifier> [--selector=<selector>] [--arg=<json>]... [options]
   ios erase [--force] [options]
   ios file ls [--app=<bundleID> | --app-group=<groupID> | --crash | --temp] [--path=<path>] [options]
   ios file pull [--app=<bundleID> | --app-group=<groupID> | --crash | --temp] --remote=<remotePath> --local=<localPath> [options]
   ios file push [--app=<bundleID> | --app-group=<groupID> | --crash | --temp] --local=<localPath> --remote=<remotePath> [options]
+  ios file serve [--app=<bundleID> | --app-group=<groupID> | --crash] [--host=<host>] [--port=<port>] [--readonly] [--auth=<user:password>] [options]
+  ios flightrecorder --dir=<dir> [--window=<duration>] [--max-entries=<n>] [--source=<source>]... [--on-crash] [options]
   ios forward [options] [<hostPort> <targetPort>] [--port=<mapping>]...
-  ios fsync [--app=bundleId] [options] (pull | push) --srcPath=<srcPath> --dstPath=<dstPath>
+  ios fsync [--app=bundleId] [options] (pull | push) --srcPath=<srcPath> --dstPath=<dstPath> [--sync] [--parallel=<n>] [--delete] [--verify]
   ios fsync [--app=bundleId] [options] (rm [--r] | tree | mkdir) --path=<targetPath>
+  ios fsync [--app=bundleId] [options] (mv | ln [--s]) --srcPath=<srcPath> --dstPath=<dstPath>
+  ios fsync [--app=bundleId] [options] truncate --path=<targetPath> --size=<bytes>
+  ios fsync [--app=bundleId] [options] touch --path=<targetPath> [--mtime=<time>]
+  ios fsync [--app=bundleId] [options] export --path=<targetPath> [--compress=<gzip|zstd>]
+  ios fsync [--app=bundleId] [options] import --path=<targetPath>
   ios httpproxy <host> <port> [<user>] [<pass>] --p12file=<orgid> --password=<p12password> [options]
   ios httpproxy remove [options]
   ios image auto [--basedir=<where_dev_images_are_stored>] [options]
@@ -103,9 +118,12 @@ Usage:
   ios image unmount [options]
   ios info [display | lockdown] [options]
   ios install --path=<ipaOrAppFolder> [options]
+  ios instruments energy --pid=<processID> [--duration=<seconds>] [options]
   ios instruments fps [--duration=<seconds>] [options]
-  ios instruments network [--duration=<seconds>] [options]
+  ios instruments network [--duration=<seconds>] [--summary] [options]
   ios instruments notifications [options]
+  ios instruments profile --pid=<processID> [--duration=<seconds>] [--output=<outfile>] [--dsym=<dir>]... [options]
+  ios instruments trace [--duration=<seconds>] [--filter=<class>] [--output=<outfile>] [options]
   ios ip [options]
   ios kill (<bundleIDs>... | --pid=<processID> | --process=<processName>) [--watch] [options]
   ios lang [--setlocale=<locale>] [--setlang=<newlang>] [options]
@@ -122,6 +140,7 @@ Usage:
   ios pair [--p12file=<orgid>] [--password=<p12password>] [options]
   ios pasteboard (set [<text>] | get) [options]
   ios pcap [options] [--pid=<processID>] [--process=<processName>]
+  ios perf record [--duration=<seconds>] [--pid=<processID>] [--interval=<duration>] [--output=<outfile>] [options]
   ios prepare [--skip-all] [--skip=<option>]... [--certfile=<cert_file_path>] [--orgname=<org_name>] [--p12password=<p12password>] [--locale=<locale>] [--lang=<lang>] [--timezone=<tz>] [options]
   ios prepare cloudconfig [options]
   ios prepare create-cert
@@ -136,7 +155,7 @@ Usage:
   ios resetax [options]
   ios resetlocation [options]
   ios rsd ls [options]
-  ios runtest [--bundle-id=<bundleid>] [--test-runner-bundle-id=<testrunnerbundleid>] [--xctest-config=<xctestconfig>] [--log-output=<file>] [--junit-output=<file>] [--xctest] [--test-to-run=<tests>]... [--test-to-skip=<tests>]... [--env=<e>]... [options]
+  ios runtest [--bundle-id=<bundleid>] [--test-runner-bundle-id=<testrunnerbundleid>] [--xctest-config=<xctestconfig>] [--log-output=<file>] [--junit-output=<file>] [--xctest] [--test-to-run=<tests>]... [--test-to-skip=<tests>]... [--env=<e>]... [--flight-recorder=<dir>] [--shard=<strategy>] [--shard-history=<junit>]... [--test-bundle=<path>] [options]
   ios runwda [--bundleid=<bundleid>] [--testrunnerbundleid=<testbundleid>] [--xctestconfig=<xctestconfig>] [--log-output=<file>] [--arg=<a>]... [--env=<e>]... [options]
   ios runxctest [--xctestrun-file-path=<xctestrunFilePath>] [--log-output=<file>] [--junit-output=<file>] [options]
   ios screenshot [options] [--output=<outfile>] [--stream] [--port=<port>]
@@ -150,9 +169,12 @@ Usage:
   ios get-wallpaper [--output=<outfile>] [options]
   ios get-icon-layout [--output=<outfile>] [options]
   ios set-icon-layout <layoutFile> [options]
-  ios syslog [--parse] [options]
-  ios ostrace [--pid=<processID>] [--process=<processName>] [--follow] [--level=<levels>] [--subsystem=<sub>] [--match=<str>] [--exclude=<str>] [options]
-  ios sysmontap [options]
+  ios syslog [--parse] [--format=<format>] [--process=<processName>] [--pid=<processID>] [--level=<levels>] [--match=<str>] [--exclude=<str>] [--since=<since>] [--otlp=<endpoint>] [--loki=<url>] [options]
+  ios ostrace [--pid=<processID>] [--process=<processName>] [--follow] [--level=<levels>] [--subsystem=<sub>] [--match=<str>] [--exclude=<str>] [--otlp=<endpoint>] [--loki=<url>] [options]
+  ios ostrace archive --output=<path> [--start=<time>] [--size-limit=<bytes>] [options]
+  ios ostrace pids [options]
+  ios ostrace signposts [--pid=<processID>] [--subsystem=<sub>] [--duration=<seconds>] [options]
+  ios sysmontap [--pid=<processID>] [--process=<processName>] [--interval=<duration>] [--duration=<seconds>] [options]
   ios timeformat (24h | 12h | toggle | get) [--force] [options]
   ios tunnel ls [options]
   ios tunnel stop [options]
@@ -191,6 +213,7 @@ Usage:
 Options:
   -v --verbose              Enable Debug Logging.
   -t --trace                Enable Trace Logging (dump every message).
+  --record-dtx=<file>       Write every DTX message sent and received to a JSON lines file, for replaying in tests.
   --nojson                  Disable JSON output
   --pretty                  Pretty-print JSON command output
   -h --help                 Show this screen.
@@ -234,6 +257,14 @@ The commands work as following:
     ios -h | --help                                       Prints this screen.
     ios activate [options]                                Activate a device
 
+    ios appdata snapshot <bundleID> --output=<outfile> [--include=<glob>]... [--exclude=<glob>]... [--compress=<gzip|zstd>] [options]
+                                                          Kill the app and write Documents, Library and tmp of its container as tar archive to outfile.
+                                                          --include and --exclude limit the snapshot to matching paths relative to the container,
+                                                          like "Documents/*.sqlite". "**" matches any number of directories.
+    ios appdata restore <bundleID> <file> [--include=<glob>]... [--exclude=<glob>]... [options]
+                                                          Kill the app, wipe Documents, Library and tmp of its container and restore the snapshot from file.
+                                                          With --include only matching paths are wiped and restored, excluded paths on the device are kept.
+
     ios apps [--system] [--all] [--list] [--filesharing]  Retrieves a list of installed applications.
                                                           --system prints out preinstalled system apps.
                                                           --all prints all apps, including system, user, and hidden apps.
@@ -249,12 +280,30 @@ The commands work as following:
                                                   Each issue includes its type, the element's label and on-screen rect.
     ios batterycheck [options]                    Prints battery info.
     ios batteryregistry [options]                 Prints battery registry stats like Temperature, Voltage.
-    ios crash cp <srcpattern> <target> [options]  Copy "file pattern" to the target dir. Ex.: 'ios crash cp "*" "./crashes"'
+    ios crash cp <srcpattern> <target> [--dsym=<dir>]... [options]
+                                                  Copy "file pattern" to the target dir. Ex.: 'ios crash cp "*" "./crashes"'
+                                                  With --dsym the copied .ips reports are symbolicated, see crash symbolicate.
 
-    ios crash ls [<pattern>] [options]            Run "ios crash ls" to get all crashreports in a list,
+    ios crash ls [<pattern>] [--details] [options]
+                                                  Run "ios crash ls" to get all crashreports in a list,
                                                   or use a pattern like 'ios crash ls "*ips*"' to filter
+                                                  --details parses .ips reports and prints process, bundle ID, app version,
+                                                  exception type, crashed thread and top frames of each report.
 
     ios crash rm <cwd> <pattern> [options]        Remove file pattern from dir. Ex.: 'ios crash rm "." "*"' to delete everything
+    ios crash show <name> [options]               Parse the .ips report with the given name straight off the device
+                                                  and print its details with all frames of the crashed thread.
+    ios crash symbolicate <report> --dsym=<dir>... [--output=<outfile>] [options]
+                                                  Symbolicate a local .ips report with the DWARF debug info of dSYM bundles, without macOS tools.
+                                                  --dsym is a dSYM bundle, a directory containing dSYM bundles or a Mach-O file.
+                                                  Prints the report details, --output writes the symbolicated .ips report to outfile.
+    ios crash watch [--bundle-id=<bundleID>] [--exec=<cmd>] [--webhook=<url>] [--download=<dir>] [--state=<file>] [--interval=<seconds>] [options]
+                                                  Poll the crash reports of the device and print a JSON event for every new report.
+                                                  --bundle-id only reports crashes of that app, --download copies new reports to dir.
+                                                  --exec runs cmd with the event JSON on stdin, --webhook POSTs the event JSON to url.
+                                                  Emitted reports are stored in --state (default in the user cache dir) so a restart
+                                                  does not report them again. Polls every 5 seconds unless --interval is given.
+                                                  Reports that cannot be parsed are reported with an error once they stop growing.
     ios date [options]                            Prints the device date in the device's own timezone
     ios debug [--stop-at-entry] <app_path>        Start debug with lldb
     ios devicename [options]                      Prints the devicename
@@ -280,6 +329,18 @@ The commands work as following:
                                                                   to stop usbmuxd and load to start it again should the proxy mess up things.
                                                                   The --binary flag will dump everything in raw binary without any decoding.
 
+    ios dtx call --service=<service> --channel=<identifier> --selector=<selector> [--arg=<json>]... [options]
+                                                                  Open a DTX channel of a lockdown or RSD service, call a selector and print the
+                                                                  unarchived reply as JSON. Every --arg is a JSON value that is archived with
+                                                                  NSKeyedArchiver: objects become NSDictionary, arrays NSArray, null NSNull.
+                                                                  Example: ios dtx call --service=com.apple.instruments.dtservicehub
+                                                                    --channel=com.apple.instruments.server.services.deviceinfo --selector=runningProcesses
+
+    ios dtx listen --service=<service> --channel=<identifier> [--selector=<selector>] [--arg=<json>]... [options]
+                                                                  Open a DTX channel and print every message the device sends on it and on the
+                                                                  global channel as JSON line until CTRL+C. --selector is called after opening the
+                                                                  channel, for services that only send data once they are started.
+
     ios erase [--force] [options]                                 Erase the device. It will prompt you to input y+Enter unless --force is specified.
 
     ios file ls [--app=<bundleID> | --app-group=<groupID> | --crash | --temp] [--path=<path>] [options]
@@ -294,17 +355,58 @@ The commands work as following:
                                                                   Upload file using RemoteXPC (iOS 17+).
                                                                   Requires tunnel. Preserves source file permissions.
 
+    ios file serve [--app=<bundleID> | --app-group=<groupID> | --crash] [--host=<host>] [--port=<port>] [--readonly] [--auth=<user:password>] [options]
+                                                                  Serve device storage over WebDAV using AFC, so Finder, Nautilus or rclone can mount it.
+                                                                  Serves the media partition by default, the app container with --app or the crash reports with --crash.
+                                                                  --app-group serves an app group container through the file service of iOS 17+, it needs a tunnel.
+                                                                  That service only transfers whole files: listings have no sizes or times, files cannot be removed
+                                                                  or renamed and no directories can be created.
+                                                                  Listens on 127.0.0.1:8080 unless --host and --port are given. --readonly rejects all modifications,
+                                                                  --auth enables HTTP basic auth. Runs until CTRL+C.
+
+    ios flightrecorder --dir=<dir> [--window=<duration>] [--max-entries=<n>] [--source=<source>]... [--on-crash] [options]
+                                                                  Record the device logs into an in-memory ring buffer and write the last --window
+                                                                  (default 5m) of logs as JSON lines to a new file in dir when
+                                                                    - the process receives SIGUSR1 (kill -USR1 <pid>, not available on Windows)
+                                                                    - a new crash report appears on the device, with --on-crash
+                                                                  --source is syslog (default) or ostrace, --max-entries bounds the buffer (default 200000).
+                                                                  Keeps recording across device reconnects. Prints a JSON line for every dump.
+
     ios forward [options] [<hostPort> <targetPort>] [--port=<mapping>]...
                                                                   Forward TCP connections to device.
                                                                   Use --port for multiple ports: --port=8100:8100 --port=9191:9191
 
-    ios fsync [--app=bundleId] [options] (pull | push) --srcPath=<srcPath> --dstPath=<dstPath>
+    ios fsync [--app=bundleId] [options] (pull | push) --srcPath=<srcPath> --dstPath=<dstPath> [--sync] [--parallel=<n>] [--delete] [--verify]
                                                                   Pull or Push file from srcPath to dstPath.
+                                                                  --sync transfers like rsync: files with matching size and modification time are skipped
+                                                                  and interrupted transfers resume from hidden .<name>.partial files.
+                                                                  --parallel, --delete and --verify imply --sync. --parallel=<n> uses n AFC connections,
+                                                                  --delete removes files missing on the source from dstPath, --verify compares SHA-256
+                                                                  checksums after each transfer. In JSON mode every progress event is printed as a JSON line.
 
     ios fsync [--app=bundleId] [options] (rm [--r] | tree | mkdir) --path=<targetPath>
                                                                   Remove | treeview | mkdir in target path.
                                                                   --r used alongside rm will recursively remove all files and directories from target path.
 
+    ios fsync [--app=bundleId] [options] (mv | ln [--s]) --srcPath=<srcPath> --dstPath=<dstPath>
+                                                                  Rename srcPath to dstPath, or create a hard link at dstPath pointing to srcPath.
+                                                                  --s used alongside ln creates a symbolic link instead.
+
+    ios fsync [--app=bundleId] [options] truncate --path=<targetPath> --size=<bytes>
+                                                                  Shrink or zero-extend the file at target path to the given size.
+
+    ios fsync [--app=bundleId] [options] touch --path=<targetPath> [--mtime=<time>]
+                                                                  Create the file at target path if it does not exist and set its modification time.
+                                                                  --mtime is an RFC3339 timestamp, the default is the current time.
+
+    ios fsync [--app=bundleId] [options] export --path=<targetPath> [--compress=<gzip|zstd>]
+                                                                  Write the directory tree at target path as tar archive to stdout, keeping modification times and modes.
+                                                                  --compress compresses the archive with gzip or zstd.
+
+    ios fsync [--app=bundleId] [options] import --path=<targetPath>
+                                                                  Extract a tar archive read from stdin into target path. Gzip and zstd archives are detected automatically.
+                                                                  Entries that would be written outside of target path are rejected.
+
     ios httpproxy <host> <port> [<user>] [<pass>] --p12file=<orgid> [--password=<p12password>]
                                                                   Set global http proxy on supervised device.
                                                                   Use the password argument or set the environment variable 'P12_PASSWORD'
@@ -326,15 +428,37 @@ The commands work as following:
     ios image unmount [options]                     Unmount developer disk image
     ios info [display | lockdown] [options]         Prints a dump of device information from the given source.
     ios install --path=<ipaOrAppFolder> [options]   Specify a .app folder or an installable ipa file that will be installed.
+    ios instruments energy --pid=<processID> [--duration=<seconds>] [options]
+                                                    Stream the energy impact of processes from the Xcode energy gauge service, use
+                                                    comma-separated pids for several processes. One line is printed per process
+                                                    every second with the total, CPU, GPU, networking, location and display cost
+                                                    and the overhead. Stops after --duration seconds, or on CTRL+C.
+
     ios instruments fps [--duration=<seconds>] [options]
                                                     Stream frames-per-second samples from the instruments graphics service.
                                                     One line is printed per sample. Stops after --duration seconds, or on CTRL+C.
 
-    ios instruments network [--duration=<seconds>] [options]
+    ios instruments network [--duration=<seconds>] [--summary] [options]
                                                     Stream network samples from the instruments network monitoring service.
                                                     One line is printed per sample. Stops after --duration seconds, or on CTRL+C.
+                                                    Interface and connection detections and connection updates are decoded.
+                                                    --summary prints the traffic per process and per remote host at the end.
 
     ios instruments notifications [options]         Listen to application state notifications
+    ios instruments profile --pid=<processID> [--duration=<seconds>] [--output=<outfile>] [--dsym=<dir>]... [options]
+                                                    Sample the user space callstacks of a process every millisecond with the core
+                                                    profile session tap and write them as gzipped pprof profile to --output,
+                                                    cpu.pb.gz by default. Open it with "go tool pprof". Frames are mapped to the
+                                                    binary images of the process, --dsym symbolicates them with a dSYM bundle, a
+                                                    directory containing dSYM bundles or a Mach-O file. Records for --duration
+                                                    seconds, or until CTRL+C.
+    ios instruments trace [--duration=<seconds>] [--filter=<class>] [--output=<outfile>] [options]
+                                                    Capture kernel trace (kdebug) events with the core profile session tap. One
+                                                    line is printed per event with the timestamp in mach absolute time, the
+                                                    event name, thread, CPU and arguments. --filter is a comma-separated list of
+                                                    classes like syscall, sched, vm, ipc, mach, bsd, fs or dyld, a class number
+                                                    or a class and subclass like 0x040c. --output writes the events as raw kd_buf
+                                                    records to a file instead. Stops after --duration seconds, or on CTRL+C.
 
     ios ip [options]                                Uses the live pcap iOS packet capture to wait until it finds one that contains the IP address of the device.
                                                     It relies on the MAC address of the WiFi adapter to know which is the right IP.
@@ -420,6 +544,15 @@ The commands work as following:
 
     ios pcap [options] [--pid=<processID>] [--process=<processName>]   Starts a pcap dump of network traffic, use --pid or --process to filter specific processes.
 
+    ios perf record [--duration=<seconds>] [--pid=<processID>] [--interval=<duration>] [--output=<outfile>] [options]
+                                                                       Record FPS, CPU and memory counters, network traffic, app state changes and
+                                                                       logs into one Chrome Trace Event JSON file that ui.perfetto.dev opens. Device
+                                                                       timestamps are converted to host time with the mach timebase of the device.
+                                                                         --pid=<processID>     Only record the counters and logs of this process
+                                                                         --interval=<duration> CPU and memory sampling interval like 500ms, defaults to 1s
+                                                                         --output=<outfile>    Defaults to trace.json
+                                                                       Stops after --duration seconds, or on CTRL+C.
+
     ios prepare [--skip-all] [--skip=<option>]... [--certfile=<cert_file_path>] [--orgname=<org_name>] [--p12password=<p12password>] [--locale] [--lang] [--timezone=<tz>] [options]
                                                                        Prepare a device. Use skip-all to skip everything multiple --skip args to skip only a subset.
                                                                        You can use 'ios prepare printskip' to get a list of all options to skip.
@@ -462,14 +595,25 @@ The commands work as following:
     ios resetlocation [options]       Resets the location of the device to the actual one
     ios rsd ls [options]              List RSD services and their port.
 
-    ios runtest [--bundle-id=<bundleid>] [--test-runner-bundle-id=<testbundleid>] [--xctest-config=<xctestconfig>] [--log-output=<file>] [--junit-output=<file>] [--xctest] [--test-to-run=<tests>]... [--test-to-skip=<tests>]... [--env=<e>]... [options]
+    ios runtest [--bundle-id=<bundleid>] [--test-runner-bundle-id=<testbundleid>] [--xctest-config=<xctestconfig>] [--log-output=<file>] [--junit-output=<file>] [--xctest] [--test-to-run=<tests>]... [--test-to-skip=<tests>]... [--env=<e>]... [--flight-recorder=<dir>] [--shard=<strategy>] [--shard-history=<junit>]... [--test-bundle=<path>] [options]
                                                                     Run a XCUITest.
                                                                     If you provide only bundle-id go-ios will try to dynamically create test-runner-bundle-id and xctest-config.
                                                                     If you provide '-' as log output, it prints resuts to stdout.
                                                                     With --junit-output the test results are additionally written to the given file as JUnit XML.
+                                                                    With --flight-recorder the device syslog is recorded during the run and the last 5 minutes
+                                                                    are written to a file in the given dir whenever a test fails, see flightrecorder.
                                                                     To be able to filter for tests to run or skip, use one argument per test selector.
                                                                     Ex.: runtest --test-to-run=(TestTarget.)TestClass/testMethod (the value for 'TestTarget' is optional)
                                                                     The method name can also be omitted and in this case all tests of the specified class are run
+                                                                    To run the tests on several devices in parallel, pass --udid once per device and
+                                                                    --shard=by-class|by-test|by-duration, with --shard alone all connected devices are used.
+                                                                    by-class keeps the tests of a class on one device, by-test spreads single tests and
+                                                                    by-duration balances classes by their durations in the JUnit reports of --shard-history.
+                                                                    Without --test-to-run the tests of --test-bundle are run, a local copy of the .xctest
+                                                                    bundle or the test runner .app. Tests missing from the reports count with an average
+                                                                    duration. A shard is run again on another device if its device disconnects, the
+                                                                    results of all shards are merged into one report. The lines of --log-output start
+                                                                    with the udid of their device, --flight-recorder records every device.
 
     ios runwda [--bundleid=<bundleid>] [--testrunnerbundleid=<testbundleid>] [--xctestconfig=<xctestconfig>] [--log-output=<file>] [--arg=<a>]... [--env=<e>]...[options]
                                                                     Runs WebDriverAgents
@@ -560,8 +704,22 @@ The commands work as following:
                                                                     behavior may occur if the given layout does not contain every icon on the device".
                                                                     Missing apps are re-paginated, not hidden.
 
-    ios syslog [--parse] [options]                                  Prints a device's log output, Use --parse to parse the fields from the log
-    ios ostrace [--pid=<processID>] [--process=<processName>] [--follow] [--level=<levels>] [--subsystem=<sub>] [--match=<str>] [--exclude=<str>]
+    ios syslog [--parse] [--format=<format>] [--process=<processName>] [--pid=<processID>] [--level=<levels>] [--match=<str>] [--exclude=<str>] [--since=<since>] [--otlp=<endpoint>] [--loki=<url>] [options]
+                                                                    Prints a device's log output, Use --parse to parse the fields from the log
+                                                                      --format=<format>     Output format: raw, json (parsed entries, same as --parse),
+                                                                                            logfmt or human (colored when printing to a terminal)
+                                                                    Filters on the parsed entries, lines that cannot be parsed are dropped when filtering:
+                                                                      --process=<name>      Comma-separated process names
+                                                                      --pid=<pid>           Only show logs of this process ID
+                                                                      --level=<levels>      Comma-separated levels like notice,error
+                                                                      --match=<regex>       Only show entries whose message matches the regular expression
+                                                                      --exclude=<regex>     Hide entries whose message matches the regular expression
+                                                                      --since=<since>       Hide entries older than a duration like 10m or a timestamp
+                                                                                            like 2006-01-02T15:04:05
+                                                                    Ship the parsed entries instead of printing them:
+                                                                      --otlp=<endpoint>     OpenTelemetry collector OTLP/HTTP endpoint like http://localhost:4318
+                                                                      --loki=<url>          Loki push URL like http://localhost:3100
+    ios ostrace [--pid=<processID>] [--process=<processName>] [--follow] [--level=<levels>] [--subsystem=<sub>] [--match=<str>] [--exclude=<str>] [--otlp=<endpoint>] [--loki=<url>]
                                                                      Stream structured syslog via os_trace_relay. Note: streaming logs
                                                                      places significant CPU load on the device.
                                                                        --follow             Keep running and reconnect when the process exits or restarts.
@@ -574,7 +732,30 @@ The commands work as following:
                                                                        --subsystem=<sub>     Only show entries matching this subsystem (substring match)
                                                                        --match=<str>         Only show entries where the message contains this string
                                                                        --exclude=<str>       Hide entries where the message contains this string
-    ios sysmontap                                                   Get system stats like MEM, CPU
+                                                                     Ship the entries instead of printing them:
+                                                                       --otlp=<endpoint>     OpenTelemetry collector OTLP/HTTP endpoint like http://localhost:4318
+                                                                       --loki=<url>          Loki push URL like http://localhost:3100
+    ios ostrace archive --output=<path> [--start=<time>] [--size-limit=<bytes>] [options]
+                                                                    Create a log archive with the historical unified log of the device and download it.
+                                                                    The archive is extracted to a .logarchive directory at path for "log show" on macOS,
+                                                                    or written as tar if path ends with .tar or is "-" for stdout.
+                                                                      --start=<time>        Only include logs after a duration ago like 2h or an RFC 3339 timestamp
+                                                                      --size-limit=<bytes>  Limit the size of the log data in the archive
+    ios ostrace pids [options]                                      List the processes the unified log has entries for.
+    ios ostrace signposts [--pid=<processID>] [--subsystem=<sub>] [--duration=<seconds>] [options]
+                                                                    Pair os_signpost begin and end events by signpost ID and name. Every interval
+                                                                    is printed as a JSON line, followed by count, p50, p95 and max durations
+                                                                    per signpost name when the stream ends.
+                                                                      --subsystem=<sub>     Only use signposts whose subsystem contains this string
+                                                                      --duration=<seconds>  Stop after this many seconds, otherwise run until Ctrl+C
+    ios sysmontap [--pid=<processID>] [--process=<processName>] [--interval=<duration>] [--duration=<seconds>] [options]
+                                                                    Logs the system CPU usage. With --pid, --process or --interval, prints system stats
+                                                                    like MEM, CPU, disk and network I/O and per-process CPU usage, memory footprint,
+                                                                    threads and disk I/O as one JSON line per sample instead.
+                                                                      --pid=<pid>           Only include this process
+                                                                      --process=<name>      Only include processes with these comma-separated names
+                                                                      --interval=<duration> Sampling interval like 1s, defaults to the Xcode sampling rate
+                                                                      --duration=<seconds>  Stop after this many seconds, otherwise run until Ctrl+C
 
     ios timeformat (24h | 12h | toggle | get) [--force] [options]   Sets, or returns the state of the "time format".
                                                                     iOS 11+ only (Use --force to try on older versions).
@@ -636,9 +817,13 @@ func Main() {
 		return
 	}
 
-	arguments, err := docopt.ParseDoc(cliUsage())
+	argv, udids := splitUdidArgs(os.Args[1:])
+	arguments, err := docopt.ParseArgs(cliUsage(), argv, "")
 	exitIfError("failed parsing args", err)
 	configureCLI(arguments)
+	if len(udids) > 1 && !boolArg(arguments, "runtest") {
+		logFatal("--udid can only be given several times for runtest", "udids", udids)
+	}
 	if dispatchCommand(commandContext{Args: arguments}, preProxyCommands) {
 		return
 	}
@@ -653,7 +838,7 @@ func Main() {
 	tunnelInfo := tunnelInfoConfigFromArgs(arguments)
 	device := resolveDevice(arguments, tunnelInfo)
 
-	if dispatchCommand(commandContext{Args: arguments, Device: device}, deviceCommands) {
+	if dispatchCommand(commandContext{Args: arguments, Device: device, Udids: udids}, deviceCommands) {
 		return
 	}
 
@@ -666,7 +851,10 @@ func Main() {
 	}
 }
 
-func printSysmontapStats(device ios.DeviceEntry) {
+// printSysmontapStats prints a JSON line with the system metrics and the metrics of the
+// selected processes for every sample. All processes are printed if none are selected.
+// printSysmontapCPUUsage logs the system CPU usage of every sample
+func printSysmontapCPUUsage(device ios.DeviceEntry, duration time.Duration) {
 	const xcodeDefaultSamplingRate = 10
 	sysmon, err := instruments.NewSysmontapService(device, xcodeDefaultSamplingRate)
 	if err != nil {
@@ -678,6 +866,10 @@ func printSysmontapStats(device ios.DeviceEntry) {
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
 
 	slog.Info("starting to monitor CPU usage... Press CTRL+C to stop.")
 
@@ -695,6 +887,50 @@ func printSysmontapStats(device ios.DeviceEntry) {
 				"cpu_total_load", cpuUsageMsg.SystemCPUUsage.CPU_TotalLoad,
 			)
 
+		case <-timeout:
+			return
+
+		case <-c:
+			slog.Info("shutting down sysmontap")
+			return
+		}
+	}
+}
+
+// printSysmontapStats prints every sample of the system and the selected processes as JSON line
+func printSysmontapStats(device ios.DeviceEntry, pid uint64, processNames []string, interval time.Duration, duration time.Duration) {
+	sysmon, err := instruments.NewSysmontapServiceWithInterval(device, interval)
+	if err != nil {
+		exitIfError("systemMonitor creation error", err)
+	}
+	defer sysmon.Close()
+
+	samples := sysmon.ReceiveSamples()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+
+	slog.Info("starting to monitor system and process metrics... Press CTRL+C to stop.")
+
+	for {
+		select {
+		case sample, ok := <-samples:
+			if !ok {
+				slog.Info("sysmontap channel closed.")
+				return
+			}
+			if pid != 0 || len(processNames) > 0 {
+				sample = sample.FilterProcesses(pid, processNames)
+			}
+			fmt.Println(convertToJSONString(sample))
+
+		case <-timeout:
+			return
+
 		case <-c:
 			slog.Info("shutting down sysmontap")
 			return
@@ -1619,23 +1855,32 @@ func printDeviceInfo(device ios.DeviceEntry) {
 	fmt.Println(convertToJSONString(allValues))
 }
 
-func runSyslog(device ios.DeviceEntry, parse bool) {
+// runSyslog prints the device log, or sends it to shipper if it is not nil
+func runSyslog(device ios.DeviceEntry, parse bool, format string, filter *syslog.Filter, shipper *logship.Shipper) {
 	slog.Debug("Run Syslog.")
 
-	syslogConnection, err := syslog.New(device)
-	exitIfError("Syslog connection failed", err)
-
-	defer syslogConnection.Close()
-
-	var logFormatter func(string) string
-	if JSONdisabled {
+	var logFormatter func(string, *syslog.LogEntry) string
+	switch {
+	case format == "raw" || (format == "" && JSONdisabled):
 		logFormatter = rawSyslog
-	} else if parse {
+	case format == "json" || (format == "" && parse):
 		logFormatter = parsedJsonSyslog()
-	} else {
+	case format == "logfmt":
+		logFormatter = logfmtSyslog
+	case format == "human":
+		logFormatter = humanSyslog(isTerminal(int(os.Stdout.Fd())))
+	case format == "":
 		logFormatter = legacyJsonSyslog()
+	default:
+		exitIfError("invalid --format", fmt.Errorf("unknown format %q, use raw, json, logfmt or human", format))
 	}
 
+	syslogConnection, err := syslog.New(device)
+	exitIfError("Syslog connection failed", err)
+
+	defer syslogConnection.Close()
+	defer closeLogShipper(shipper)
+
 	go func() {
 		for {
 			logMessage, err := syslogConnection.ReadLogMessage()
@@ -1645,7 +1890,18 @@ func runSyslog(device ios.DeviceEntry, parse bool) {
 			logMessage = strings.TrimSuffix(logMessage, "\x00")
 			logMessage = strings.TrimSuffix(logMessage, "\x0A")
 
-			fmt.Println(logFormatter(logMessage))
+			entry, ok := filter.MatchLine(logMessage)
+			if !ok {
+				continue
+			}
+			if shipper != nil {
+				if entry == nil {
+					entry = &syslog.LogEntry{Message: logMessage}
+				}
+				_ = shipper.Send(context.Background(), logship.FromSyslog(entry))
+				continue
+			}
+			fmt.Println(logFormatter(logMessage, entry))
 		}
 	}()
 	c := make(chan os.Signal, 1)
@@ -1653,7 +1909,8 @@ func runSyslog(device ios.DeviceEntry, parse bool) {
 	<-c
 }
 
-func runOsTrace(device ios.DeviceEntry, pid int, processName string, messageFilter uint16, streamFlags uint32, clientFilter ostrace.ClientFilter, follow bool) {
+// runOsTrace prints the os_trace stream, or sends it to shipper if it is not nil
+func runOsTrace(device ios.DeviceEntry, pid int, processName string, messageFilter uint16, streamFlags uint32, clientFilter ostrace.ClientFilter, follow bool, shipper *logship.Shipper) {
 	slog.Debug("Run OsTrace.")
 	// Note: streaming log messages places significant CPU load on the device.
 
@@ -1674,6 +1931,7 @@ func runOsTrace(device ios.DeviceEntry, pid int, processName string, messageFilt
 		<-sigCh
 		cancel()
 	}()
+	defer closeLogShipper(shipper)
 
 	sleepOrCancel := func(d time.Duration) bool {
 		select {
@@ -1769,6 +2027,12 @@ func runOsTrace(device ios.DeviceEntry, pid int, processName string, messageFilt
 					done <- err
 					return
 				}
+				if shipper != nil {
+					if shipper.Send(ctx, logship.FromOsTrace(entry)) != nil {
+						return
+					}
+					continue
+				}
 				fmt.Println(formatEntry(entry))
 			}
 		}()
@@ -1871,29 +2135,71 @@ func isProcessAlive(device ios.DeviceEntry, pid uint64) bool {
 	return false
 }
 
-func rawSyslog(log string) string {
+func rawSyslog(log string, _ *syslog.LogEntry) string {
 	return log
 }
 
-func legacyJsonSyslog() func(log string) string {
+func legacyJsonSyslog() func(log string, entry *syslog.LogEntry) string {
 	messageContainer := map[string]string{}
 
-	return func(log string) string {
+	return func(log string, _ *syslog.LogEntry) string {
 		messageContainer["msg"] = log
 		return convertToJSONString(messageContainer)
 	}
 }
 
-func parsedJsonSyslog() func(log string) string {
-	parser := syslog.Parser()
+func parsedJsonSyslog() func(log string, entry *syslog.LogEntry) string {
+	return func(log string, entry *syslog.LogEntry) string {
+		if entry == nil {
+			return convertToJSONString(map[string]string{"msg": log, "error": "failed to parse syslog message"})
+		}
 
-	return func(log string) string {
-		log_entry, err := parser(log)
-		if err != nil {
-			return convertToJSONString(map[string]string{"msg": log, "error": err.Error()})
+		return convertToJSONString(entry)
+	}
+}
+
+func logfmtSyslog(log string, entry *syslog.LogEntry) string {
+	if entry == nil {
+		return "msg=" + syslog.LogfmtValue(log)
+	}
+	return fmt.Sprintf("time=%s device=%s process=%s pid=%s level=%s msg=%s",
+		entry.Timestamp, syslog.LogfmtValue(entry.Device), syslog.LogfmtValue(entry.Process), entry.PID,
+		syslog.LogfmtValue(strings.ToLower(entry.Level)), syslog.LogfmtValue(entry.Message))
+}
+
+func humanSyslog(useColor bool) func(log string, entry *syslog.LogEntry) string {
+	return func(log string, entry *syslog.LogEntry) string {
+		if entry == nil {
+			return log
 		}
+		dim, reset, color := "", "", ""
+		if useColor {
+			dim = "\033[90m"
+			reset = "\033[0m"
+			color = colorForSyslogLevel(entry.Level)
+		}
+		return fmt.Sprintf("%s%s%s  %s%s[%s]%s  %s<%-7s>%s  %s%s%s",
+			dim, entry.Timestamp, reset,
+			dim, entry.Process, entry.PID, reset,
+			color, entry.Level, reset,
+			color, entry.Message, reset)
+	}
+}
 
-		return convertToJSONString(log_entry)
+func colorForSyslogLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "debug":
+		return "\033[90m" // bright black (gray)
+	case "info":
+		return "\033[36m" // cyan
+	case "warning":
+		return "\033[33m" // yellow
+	case "error":
+		return "\033[31m" // red
+	case "fault", "critical", "alert", "emergency":
+		return "\033[1;31m" // bold red
+	default:
+		return "" // no color
 	}
 }
 
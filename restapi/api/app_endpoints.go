@@ -7,6 +7,8 @@ import (
 	"path"
 
 	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/afc"
+	"github.com/danielpaulus/go-ios/ios/appdata"
 	"github.com/danielpaulus/go-ios/ios/installationproxy"
 	"github.com/danielpaulus/go-ios/ios/instruments"
 	"github.com/danielpaulus/go-ios/ios/zipconduit"
@@ -235,3 +237,96 @@ func UninstallApp(c *gin.Context) {
 
 	c.JSON(http.StatusOK, GenericResponse{Message: bundleID + " uninstalled successfully"})
 }
+
+// Snapshot the data container of an app
+// @Summary      Snapshot app data
+// @Description  Kill the app and stream Documents, Library and tmp of its container as tar archive
+// @Tags         apps
+// @Produce      application/x-tar,application/gzip,application/zstd
+// @Param        bundleID query string true "bundle identifier of the targeted app"
+// @Param        include query []string false "globs of container paths to include" collectionFormat(multi)
+// @Param        exclude query []string false "globs of container paths to exclude" collectionFormat(multi)
+// @Param        compress query string false "gzip or zstd"
+// @Success      200 {file} binary
+// @Failure      422 {object} GenericResponse
+// @Failure      500 {object} GenericResponse
+// @Router       /device/{udid}/apps/appdata [get]
+func SnapshotAppData(c *gin.Context) {
+	device := c.MustGet(IOS_KEY).(ios.DeviceEntry)
+
+	bundleID := c.Query("bundleID")
+	if bundleID == "" {
+		c.JSON(http.StatusUnprocessableEntity, GenericResponse{Error: "bundleID query param is missing"})
+		return
+	}
+	options := appdata.Options{
+		Include:     c.QueryArray("include"),
+		Exclude:     c.QueryArray("exclude"),
+		Compression: afc.Compression(c.Query("compress")),
+	}
+
+	contentType, extension, ok := snapshotContentType(options.Compression)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, GenericResponse{Error: "compress must be gzip or zstd"})
+		return
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename="+bundleID+extension)
+	err := appdata.Snapshot(device, bundleID, c.Writer, options)
+	if err != nil {
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, GenericResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("snapshot of %s failed after streaming started: %v", bundleID, err)
+		c.Abort()
+	}
+}
+
+// snapshotContentType returns the content type and file extension of a snapshot archive
+func snapshotContentType(compression afc.Compression) (string, string, bool) {
+	switch compression {
+	case afc.CompressionNone:
+		return "application/x-tar", ".tar", true
+	case afc.CompressionGzip:
+		return "application/gzip", ".tar.gz", true
+	case afc.CompressionZstd:
+		return "application/zstd", ".tar.zst", true
+	default:
+		return "", "", false
+	}
+}
+
+// Restore the data container of an app
+// @Summary      Restore app data
+// @Description  Kill the app, wipe Documents, Library and tmp of its container and restore the tar archive from the request body
+// @Tags         apps
+// @Accept       application/x-tar,application/gzip,application/zstd
+// @Produce      json
+// @Param        bundleID query string true "bundle identifier of the targeted app"
+// @Param        include query []string false "globs of container paths to include" collectionFormat(multi)
+// @Param        exclude query []string false "globs of container paths to exclude" collectionFormat(multi)
+// @Success      200 {object} GenericResponse
+// @Failure      500 {object} GenericResponse
+// @Router       /device/{udid}/apps/appdata [post]
+func RestoreAppData(c *gin.Context) {
+	device := c.MustGet(IOS_KEY).(ios.DeviceEntry)
+
+	bundleID := c.Query("bundleID")
+	if bundleID == "" {
+		c.JSON(http.StatusUnprocessableEntity, GenericResponse{Error: "bundleID query param is missing"})
+		return
+	}
+	options := appdata.Options{
+		Include: c.QueryArray("include"),
+		Exclude: c.QueryArray("exclude"),
+	}
+
+	err := appdata.Restore(device, bundleID, c.Request.Body, options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, GenericResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, GenericResponse{Message: bundleID + " app data restored successfully"})
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielpaulus/go-ios/ios"
+	"github.com/danielpaulus/go-ios/ios/crashreport"
+	"github.com/danielpaulus/go-ios/ios/flightrecorder"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type FlightRecorderConfig struct {
+	// Window is a duration like "5m", defaults to 5 minutes
+	Window     string   `json:"window"`
+	MaxEntries int      `json:"maxEntries"`
+	Sources    []string `json:"sources"`
+	// Dir is a directory relative to the FLIGHT_RECORDER_FOLDER of the server, which defaults
+	// to a go-ios-flightrecorder directory in the temp dir
+	Dir     string `json:"dir"`
+	OnCrash bool   `json:"onCrash"`
+}
+
+type FlightRecorderSession struct {
+	Config FlightRecorderConfig `json:"config"`
+	Udid   string               `json:"udid"`
+	Dumps  []string             `json:"dumps"`
+
+	recorder *flightrecorder.Recorder
+	stop     context.CancelFunc
+	mu       *sync.Mutex
+}
+
+type FlightRecorderDump struct {
+	Path string `json:"path"`
+}
+
+var globalFlightRecorders = sync.Map{}
+
+// @Summary Start a flight recorder
+// @Description Record the device logs into a ring buffer until the recorder is stopped. Dumps are written on request and, with onCrash, whenever a new crash report appears.
+// @Tags flightrecorder
+// @Accept json
+// @Produce json
+// @Param config body FlightRecorderConfig false "Flight recorder configuration"
+// @Success 200 {object} FlightRecorderSession
+// @Failure 400 {object} GenericResponse
+// @Failure 409 {object} GenericResponse
+// @Router /device/{udid}/flightrecorder [post]
+func StartFlightRecorder(c *gin.Context) {
+	device := c.MustGet(IOS_KEY).(ios.DeviceEntry)
+	udid := device.Properties.SerialNumber
+
+	var config FlightRecorderConfig
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, GenericResponse{Error: err.Error()})
+			return
+		}
+	}
+	dir, err := flightRecorderDir(config.Dir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, GenericResponse{Error: err.Error()})
+		return
+	}
+	config.Dir = dir
+	options := flightrecorder.Options{MaxEntries: config.MaxEntries, Dir: dir}
+	if config.Window != "" {
+		window, err := time.ParseDuration(config.Window)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, GenericResponse{Error: "invalid window: " + err.Error()})
+			return
+		}
+		options.Window = window
+	}
+	for _, name := range config.Sources {
+		source, err := flightrecorder.ParseSource(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, GenericResponse{Error: err.Error()})
+			return
+		}
+		options.Sources = append(options.Sources, source)
+	}
+
+	recordCtx, stop := context.WithCancel(context.Background())
+	session := &FlightRecorderSession{
+		Config:   config,
+		Udid:     udid,
+		Dumps:    []string{},
+		recorder: flightrecorder.New(device, options),
+		stop:     stop,
+		mu:       &sync.Mutex{},
+	}
+	if _, loaded := globalFlightRecorders.LoadOrStore(udid, session); loaded {
+		stop()
+		c.JSON(http.StatusConflict, GenericResponse{Error: "flight recorder already running"})
+		return
+	}
+
+	go func() {
+		if err := session.recorder.Run(recordCtx); err != nil {
+			log.WithField("udid", udid).WithError(err).Error("flight recorder failed")
+		}
+	}()
+	if config.OnCrash {
+		go func() {
+			err := session.recorder.DumpOnCrash(recordCtx, "", func(p string, _ crashreport.WatchEvent) {
+				session.addDump(p)
+			})
+			if err != nil {
+				log.WithField("udid", udid).WithError(err).Error("flight recorder crash watch failed")
+			}
+		}()
+	}
+	log.WithField("udid", udid).Debug("Started flight recorder")
+
+	c.JSON(http.StatusOK, session.snapshot())
+}
+
+// @Summary Get the flight recorder
+// @Description Get the configuration of the running flight recorder and the dumps it wrote
+// @Tags flightrecorder
+// @Produce json
+// @Success 200 {object} FlightRecorderSession
+// @Failure 404 {object} GenericResponse
+// @Router /device/{udid}/flightrecorder [get]
+func ReadFlightRecorder(c *gin.Context) {
+	session, ok := flightRecorderSession(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, session.snapshot())
+}
+
+// @Summary Dump the flight recorder
+// @Description Write the recorded window of logs as JSON lines to a new file in the dir of the recorder
+// @Tags flightrecorder
+// @Produce json
+// @Param reason query string false "Reason that is added to the file name"
+// @Success 200 {object} FlightRecorderDump
+// @Failure 404 {object} GenericResponse
+// @Failure 500 {object} GenericResponse
+// @Router /device/{udid}/flightrecorder/dump [post]
+func DumpFlightRecorder(c *gin.Context) {
+	session, ok := flightRecorderSession(c)
+	if !ok {
+		return
+	}
+	p, err := session.recorder.DumpFile(c.DefaultQuery("reason", "rest"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, GenericResponse{Error: err.Error()})
+		return
+	}
+	session.addDump(p)
+	c.JSON(http.StatusOK, FlightRecorderDump{Path: p})
+}
+
+// @Summary Stop the flight recorder
+// @Description Stop recording and drop the recorded logs
+// @Tags flightrecorder
+// @Produce json
+// @Success 200 {object} FlightRecorderSession
+// @Failure 404 {object} GenericResponse
+// @Router /device/{udid}/flightrecorder [delete]
+func StopFlightRecorder(c *gin.Context) {
+	session, ok := flightRecorderSession(c)
+	if !ok {
+		return
+	}
+	session.stop()
+	globalFlightRecorders.Delete(session.Udid)
+	log.WithField("udid", session.Udid).Debug("Stopped flight recorder")
+	c.JSON(http.StatusOK, session.snapshot())
+}
+
+// flightRecorderDir resolves the dir of a request inside the FLIGHT_RECORDER_FOLDER, so
+// callers cannot make the server write dumps to arbitrary paths.
+func flightRecorderDir(dir string) (string, error) {
+	base := os.Getenv("FLIGHT_RECORDER_FOLDER")
+	if base == "" {
+		base = filepath.Join(os.TempDir(), "go-ios-flightrecorder")
+	}
+	if filepath.IsAbs(dir) {
+		return "", fmt.Errorf("invalid dir %q: must be relative to the flight recorder folder", dir)
+	}
+	resolved := filepath.Join(base, dir)
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid dir %q: must not leave the flight recorder folder", dir)
+	}
+	return resolved, nil
+}
+
+func flightRecorderSession(c *gin.Context) (*FlightRecorderSession, bool) {
+	device := c.MustGet(IOS_KEY).(ios.DeviceEntry)
+	session, ok := globalFlightRecorders.Load(device.Properties.SerialNumber)
+	if !ok {
+		c.JSON(http.StatusNotFound, GenericResponse{Error: "no flight recorder running"})
+		return nil, false
+	}
+	return session.(*FlightRecorderSession), true
+}
+
+func (s *FlightRecorderSession) addDump(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Dumps = append(s.Dumps, p)
+}
+
+func (s *FlightRecorderSession) snapshot() FlightRecorderSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return FlightRecorderSession{Config: s.Config, Udid: s.Udid, Dumps: append([]string{}, s.Dumps...)}
+}
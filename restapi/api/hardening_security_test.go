@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -287,3 +288,31 @@ func TestLimitNumClientsUDIDNoBypassUnderConcurrency(t *testing.T) {
 	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight),
 		"more than one request for the same udid was in-flight simultaneously; the per-udid limit was bypassed")
 }
+
+// TestStartFlightRecorderRejectsDirOutsideFolder pins that the dir of a flight
+// recorder stays inside FLIGHT_RECORDER_FOLDER. Dumps are written to it, so an
+// unrestricted dir would let callers write files anywhere on the server.
+func TestStartFlightRecorderRejectsDirOutsideFolder(t *testing.T) {
+	t.Setenv("FLIGHT_RECORDER_FOLDER", t.TempDir())
+	hostileDirs := []string{
+		"../../../../etc",
+		"foo/../../bar",
+		"/etc/go-ios",
+		"..",
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(hardeningDeviceMiddleware())
+	r.POST("/flightrecorder", api.StartFlightRecorder)
+	for _, dir := range hostileDirs {
+		t.Run(dir, func(t *testing.T) {
+			body, err := json.Marshal(api.FlightRecorderConfig{Dir: dir})
+			require.NoError(t, err)
+			req, _ := http.NewRequest("POST", "/flightrecorder", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "hostile dir %q must be rejected with 400", dir)
+			assert.Contains(t, w.Body.String(), "invalid dir")
+		})
+	}
+}
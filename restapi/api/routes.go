@@ -40,6 +40,11 @@ func simpleDeviceRoutes(device *gin.RouterGroup) {
 	device.GET("/syslog", streamingMiddleWare, Syslog)
 	device.GET("/ostrace", streamingMiddleWare, OsTrace)
 
+	device.POST("/flightrecorder", StartFlightRecorder)
+	device.GET("/flightrecorder", ReadFlightRecorder)
+	device.POST("/flightrecorder/dump", DumpFlightRecorder)
+	device.DELETE("/flightrecorder", StopFlightRecorder)
+
 	device.POST("/wda/session", CreateWdaSession)
 	device.GET("/wda/session/:sessionId", ReadWdaSession)
 	device.DELETE("/wda/session/:sessionId", DeleteWdaSession)
@@ -53,4 +58,6 @@ func appRoutes(group *gin.RouterGroup) {
 	router.POST("/kill", KillApp)
 	router.POST("/install", InstallApp)
 	router.POST("/uninstall", UninstallApp)
+	router.GET("/appdata", SnapshotAppData)
+	router.POST("/appdata", RestoreAppData)
 }
@@ -53,12 +53,37 @@ func Notifications(c *gin.Context) {
 // Syslog
 // Listen                godoc
 // @Summary      Uses SSE to connect to the LISTEN command
-// @Description Uses SSE to connect to the LISTEN command
+// @Description Streams the device syslog. With format=json every entry is parsed and sent as a JSON object followed by a line break.
+// @Description The filters are applied to the parsed entries, messages that cannot be parsed are dropped when a filter is set.
 // @Tags         general
 // @Produce      json
+// @Param        format   query  string  false  "raw (default) or json"
+// @Param        process  query  string  false  "Comma-separated process names"
+// @Param        pid      query  string  false  "Process ID"
+// @Param        level    query  string  false  "Comma-separated levels like notice,error"
+// @Param        match    query  string  false  "Regular expression the message has to match"
+// @Param        exclude  query  string  false  "Regular expression, entries with a matching message are dropped"
+// @Param        since    query  string  false  "Drop entries older than a duration like 10m or a timestamp like 2006-01-02T15:04:05"
 // @Success      200  {object}  map[string]interface{}
-// @Router       /listen [get]
+// @Router       /syslog [get]
 func Syslog(c *gin.Context) {
+	format := c.DefaultQuery("format", "raw")
+	if format != "raw" && format != "json" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be raw or json"})
+		return
+	}
+	filter, err := syslog.NewFilter(syslog.FilterOptions{
+		Process: c.Query("process"),
+		PID:     c.Query("pid"),
+		Level:   c.Query("level"),
+		Match:   c.Query("match"),
+		Exclude: c.Query("exclude"),
+		Since:   c.Query("since"),
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// We are streaming current time to clients in the interval 10 seconds
 	log.Info("connect")
 	device := c.MustGet(IOS_KEY).(ios.DeviceEntry)
@@ -69,13 +94,28 @@ func Syslog(c *gin.Context) {
 	}
 	defer syslogConnection.Close()
 	c.Stream(func(w io.Writer) bool {
-		m, err := syslogConnection.ReadLogMessage()
-		if err != nil {
-			return false
+		for {
+			m, err := syslogConnection.ReadLogMessage()
+			if err != nil {
+				return false
+			}
+			entry, ok := filter.MatchLine(m)
+			if !ok {
+				continue
+			}
+			if format == "json" {
+				if entry != nil {
+					w.Write([]byte(MustMarshal(entry)))
+				} else {
+					w.Write([]byte(MustMarshal(gin.H{"msg": m})))
+				}
+				w.Write([]byte("\n"))
+				return true
+			}
+			// Stream message to client from message channel
+			w.Write([]byte(MustMarshal(m)))
+			return true
 		}
-		// Stream message to client from message channel
-		w.Write([]byte(MustMarshal(m)))
-		return true
 	})
 }
 